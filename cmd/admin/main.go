@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/mr1hm/go-chat-moderator/internal/auth"
+	"github.com/mr1hm/go-chat-moderator/internal/shared/config"
+	"github.com/mr1hm/go-chat-moderator/internal/shared/sqlite"
+)
+
+// Sets a user's global role directly in the database, e.g. to create the
+// first admin, who can then manage roles through the API
+func main() {
+	dbCfg := config.LoadDBConfig()
+
+	email := flag.String("email", "", "email of the user to update")
+	role := flag.String("role", auth.RoleAdmin, "role to grant: user, moderator or admin")
+	flag.Parse()
+
+	if *email == "" {
+		log.Fatal("-email is required")
+	}
+	if !auth.IsValidRole(*role) {
+		log.Fatalf("Unknown role %q", *role)
+	}
+
+	sqlite.Init(dbCfg.DBPath)
+	defer sqlite.Close()
+
+	repo := auth.NewUserRepository()
+	user, err := repo.FindByEmail(*email)
+	if err != nil {
+		log.Fatalf("Failed to find user: %v", err)
+	}
+
+	if err := repo.UpdateRole(user.ID, *role); err != nil {
+		log.Fatalf("Failed to update role: %v", err)
+	}
+
+	log.Printf("%s (%s) is now %s; the change applies from their next token refresh", user.Username, user.Email, *role)
+}
@@ -1,15 +1,23 @@
 package main
 
 import (
+	"context"
 	"log"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/mr1hm/go-chat-moderator/internal/admin"
+	"github.com/mr1hm/go-chat-moderator/internal/audit"
 	"github.com/mr1hm/go-chat-moderator/internal/auth"
 	"github.com/mr1hm/go-chat-moderator/internal/chat"
+	"github.com/mr1hm/go-chat-moderator/internal/export"
+	"github.com/mr1hm/go-chat-moderator/internal/moderation"
+	"github.com/mr1hm/go-chat-moderator/internal/shared/blob"
 	"github.com/mr1hm/go-chat-moderator/internal/shared/config"
+	"github.com/mr1hm/go-chat-moderator/internal/shared/mail"
 	"github.com/mr1hm/go-chat-moderator/internal/shared/redis"
 	"github.com/mr1hm/go-chat-moderator/internal/shared/sqlite"
+	"github.com/mr1hm/go-chat-moderator/internal/webhooks"
 )
 
 func main() {
@@ -18,6 +26,13 @@ func main() {
 	redisCfg := config.LoadRedisConfig()
 	srvCfg := config.LoadServerConfig()
 	jwtCfg := config.LoadJWTConfig()
+	mailCfg := config.LoadMailConfig()
+	authCfg := config.LoadAuthConfig()
+	oidcCfg := config.LoadOIDCConfig()
+	modCfg := config.LoadModerationConfig()
+	exportCfg := config.LoadExportConfig()
+	blobCfg := config.LoadBlobConfig()
+	avatarCfg := config.LoadAvatarConfig()
 
 	// Init connections
 	sqlite.Init(dbCfg.DBPath)
@@ -30,17 +45,110 @@ func main() {
 	r := gin.Default()
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:5173", "http://localhost:3000"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Authorization", "Content-Type"},
 		AllowCredentials: true,
 	}))
 
-	authHandler := auth.RegisterRoutes(r, jwtCfg.Secret)
+	jwtService := auth.NewJWTService(jwtCfg.Secret)
+	if jwtCfg.KeysDir != "" {
+		keys, err := auth.LoadKeySet(jwtCfg.KeysDir, jwtCfg.ActiveKID)
+		if err != nil {
+			log.Fatalf("error while loading JWT keys: %v", err)
+		}
+		jwtService = auth.NewJWTServiceWithKeys(jwtCfg.Secret, keys, jwtCfg.KeyGrace)
+		if err := jwtService.RecordRetirements(auth.NewKeyRetirementRepository()); err != nil {
+			log.Fatalf("error while recording JWT key retirements: %v", err)
+		}
+	}
+
+	passwords := &auth.PasswordPolicy{
+		MinLength:   authCfg.PasswordMinLength,
+		CheckCommon: authCfg.PasswordCheckCommon,
+	}
+	logins := &auth.LoginPolicy{
+		MaxFailures:     authCfg.LoginMaxFailures,
+		MaxIPFailures:   authCfg.LoginMaxIPFailures,
+		Window:          authCfg.LoginFailureWindow,
+		LockoutDuration: authCfg.LoginLockout,
+		DelayAfter:      authCfg.LoginDelayAfter,
+		MaxDelay:        authCfg.LoginMaxDelay,
+	}
+
+	authHandler := auth.RegisterRoutes(r, jwtService, newMailer(mailCfg), srvCfg.AppURL, passwords, logins)
+	if err := authHandler.Service().SetAccountDeletion(authCfg.AccountDeletion); err != nil {
+		log.Fatalf("error while setting account deletion policy: %v", err)
+	}
+	authHandler.Service().SetAvatarStore(newBlobStore(blobCfg), auth.AvatarPolicy{
+		MaxBytes:     avatarCfg.MaxBytes,
+		MaxDimension: avatarCfg.MaxDimension,
+	})
+	if modCfg.CheckProfiles {
+		provider, err := moderation.NewProvider(modCfg.Provider, modCfg.Model)
+		if err != nil {
+			log.Fatalf("error while setting up profile moderation: %v", err)
+		}
+		authHandler.Service().SetContentChecker(moderation.Scorer{
+			Provider:  provider,
+			Threshold: modCfg.Threshold,
+		})
+	}
+	if oidcCfg.IssuerURL != "" {
+		provider, err := auth.NewOIDCProvider(context.Background(), auth.OIDCConfig{
+			IssuerURL:    oidcCfg.IssuerURL,
+			ClientID:     oidcCfg.ClientID,
+			ClientSecret: oidcCfg.ClientSecret,
+			RedirectURL:  oidcCfg.RedirectURL,
+			Scopes:       oidcCfg.Scopes,
+			GroupsClaim:  oidcCfg.GroupsClaim,
+			RoleMapping:  oidcCfg.RoleMapping,
+			AllowSignup:  oidcCfg.AllowSignup,
+		})
+		if err != nil {
+			log.Fatalf("error while setting up OIDC provider: %v", err)
+		}
+		auth.RegisterOIDCRoutes(r, authHandler, provider, srvCfg.AppURL)
+	}
+
 	hub := chat.NewHub()
 	go hub.Run()
 
-	chat.RegisterRoutes(r, hub, authHandler)
+	chat.RegisterRoutes(r, hub, authHandler, srvCfg.AppURL)
+	moderation.RegisterRoutes(r, authHandler)
+	audit.RegisterRoutes(r, authHandler)
+	webhooks.RegisterRoutes(r, authHandler)
+	admin.RegisterRoutes(r, authHandler)
+	export.RegisterRoutes(r, authHandler, srvCfg.AppURL)
+
+	go export.NewWorker(exportCfg.Dir, exportCfg.LinkTTL).Run(context.Background())
 
 	log.Printf("API starting on %s", srvCfg.Port)
 	r.Run(srvCfg.Port)
 }
+
+func newMailer(cfg config.MailConfig) mail.Mailer {
+	switch cfg.Driver {
+	case "smtp":
+		if cfg.SMTPHost == "" {
+			log.Fatal("SMTP_HOST environment variable missing")
+		}
+		return mail.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.From)
+	case "file":
+		return mail.NewFileMailer(cfg.Dir, cfg.From)
+	case "log":
+		return mail.NewLogMailer()
+	default:
+		log.Fatalf("Unknown MAIL_DRIVER %q", cfg.Driver)
+		return nil
+	}
+}
+
+func newBlobStore(cfg config.BlobConfig) blob.Store {
+	switch cfg.Driver {
+	case "local":
+		return blob.NewLocalStore(cfg.Dir)
+	default:
+		log.Fatalf("Unknown BLOB_DRIVER %q", cfg.Driver)
+		return nil
+	}
+}
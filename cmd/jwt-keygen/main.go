@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func main() {
+	alg := flag.String("alg", "EdDSA", "key algorithm: EdDSA or RS256")
+	dir := flag.String("dir", "data/jwt-keys", "directory to write <kid>.pem to")
+	kid := flag.String("kid", time.Now().UTC().Format("20060102T150405"), "key ID; newest name becomes the active key by default")
+	flag.Parse()
+
+	var private crypto.Signer
+	var err error
+	switch *alg {
+	case "EdDSA":
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	case "RS256":
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		log.Fatalf("Unsupported algorithm %q", *alg)
+	}
+	if err != nil {
+		log.Fatalf("Failed to generate key: %v", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		log.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	if err := os.MkdirAll(*dir, 0700); err != nil {
+		log.Fatalf("Failed to create %s: %v", *dir, err)
+	}
+	path := filepath.Join(*dir, *kid+".pem")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		log.Fatalf("Failed to create key file: %v", err)
+	}
+	defer f.Close()
+
+	if err := pem.Encode(f, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		log.Fatalf("Failed to write key: %v", err)
+	}
+
+	log.Printf("%s key %s written to %s", *alg, *kid, path)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/mr1hm/go-chat-moderator/internal/auth/oidctest"
+)
+
+// Runs a local OpenID Connect provider that signs everyone in as the given
+// user, for trying SSO without a real identity provider:
+//
+//	go run ./cmd/mock-oidc -email staff@example.com -groups chat-admins
+//	OIDC_ISSUER_URL=http://localhost:9000 OIDC_CLIENT_ID=chat go run ./cmd/api
+func main() {
+	addr := flag.String("addr", "localhost:9000", "listen address")
+	clientID := flag.String("client-id", "chat", "client ID to accept")
+	email := flag.String("email", "staff@example.com", "email of the signed-in user")
+	username := flag.String("username", "", "preferred_username claim (default: email local part)")
+	groups := flag.String("groups", "", "comma-separated groups claim")
+	unverified := flag.Bool("unverified", false, "report the email as unverified")
+	mfa := flag.Bool("mfa", false, "report a second factor in amr")
+	flag.Parse()
+
+	name := *username
+	if name == "" {
+		name, _, _ = strings.Cut(*email, "@")
+	}
+
+	user := oidctest.User{
+		Subject:       "mock|" + *email,
+		Email:         *email,
+		EmailVerified: !*unverified,
+		Username:      name,
+	}
+	if *groups != "" {
+		user.Groups = strings.Split(*groups, ",")
+	}
+	if *mfa {
+		user.AMR = []string{"pwd", "mfa"}
+	}
+
+	issuer := oidctest.New("http://"+*addr, *clientID)
+	issuer.SetUser(user)
+
+	log.Printf("Mock OIDC issuer at http://%s signing in %s", *addr, *email)
+	log.Fatal(http.ListenAndServe(*addr, issuer))
+}
@@ -11,12 +11,13 @@ import (
 	"github.com/mr1hm/go-chat-moderator/internal/shared/config"
 	"github.com/mr1hm/go-chat-moderator/internal/shared/redis"
 	"github.com/mr1hm/go-chat-moderator/internal/shared/sqlite"
+	"github.com/mr1hm/go-chat-moderator/internal/webhooks"
 )
 
 func main() {
 	dbCfg := config.LoadDBConfig()
 	redisCfg := config.LoadRedisConfig()
-	mistralAICfg := config.LoadMistralAIConfig()
+	modCfg := config.LoadModerationConfig()
 
 	sqlite.Init(dbCfg.DBPath)
 	defer sqlite.Close()
@@ -36,6 +37,30 @@ func main() {
 		cancel()
 	}()
 
-	worker := moderation.NewWorker(mistralAICfg.Key)
+	primary := moderation.Scorer{
+		Provider:  newProvider(modCfg.Provider, modCfg.Model),
+		Threshold: modCfg.Threshold,
+	}
+
+	var shadow *moderation.Scorer
+	if modCfg.ShadowProvider != "" {
+		shadow = &moderation.Scorer{
+			Provider:  newProvider(modCfg.ShadowProvider, modCfg.ShadowModel),
+			Threshold: modCfg.ShadowThreshold,
+		}
+		log.Printf("Shadow evaluation enabled: %s (%s)", shadow.Provider.Name(), shadow.Provider.Version())
+	}
+
+	go webhooks.NewWorker().Run(ctx)
+
+	worker := moderation.NewWorker(primary, shadow)
 	worker.Run(ctx)
 }
+
+func newProvider(name, model string) moderation.Provider {
+	p, err := moderation.NewProvider(name, model)
+	if err != nil {
+		log.Fatalf("Failed to set up moderation provider: %v", err)
+	}
+	return p
+}
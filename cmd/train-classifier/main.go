@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/mr1hm/go-chat-moderator/internal/moderation"
+	"github.com/mr1hm/go-chat-moderator/internal/moderation/classifier"
+	"github.com/mr1hm/go-chat-moderator/internal/shared/config"
+	"github.com/mr1hm/go-chat-moderator/internal/shared/sqlite"
+)
+
+func main() {
+	dbCfg := config.LoadDBConfig()
+	classifierCfg := config.LoadClassifierConfig()
+
+	out := flag.String("out", classifierCfg.ModelPath, "path to write the trained model")
+	minExamples := flag.Int("min-examples", 20, "minimum labeled messages required to train")
+	flag.Parse()
+
+	sqlite.Init(dbCfg.DBPath)
+	defer sqlite.Close()
+
+	examples, err := moderation.NewModerationActionRepository().TrainingExamples()
+	if err != nil {
+		log.Fatalf("Failed to load training examples: %v", err)
+	}
+
+	var toxic int
+	for _, ex := range examples {
+		if ex.Toxic {
+			toxic++
+		}
+	}
+	log.Printf("Loaded %d labeled messages (%d removed, %d approved)", len(examples), toxic, len(examples)-toxic)
+
+	if len(examples) < *minExamples {
+		log.Fatalf("Not enough labeled messages to train: have %d, need %d", len(examples), *minExamples)
+	}
+	if toxic == 0 || toxic == len(examples) {
+		log.Fatal("Training data must contain both approved and removed messages")
+	}
+
+	model := classifier.Train(examples)
+	if err := model.Save(*out); err != nil {
+		log.Fatalf("Failed to save model: %v", err)
+	}
+
+	log.Printf("Model %s written to %s (vocabulary: %d)", model.Version(), *out, model.VocabSize)
+}
@@ -2,6 +2,11 @@ import { BrowserRouter, Routes, Route, Navigate } from 'react-router-dom';
 import { AuthProvider, useAuth } from './hooks/useAuth';
 import { Login } from './pages/Login';
 import { Register } from './pages/Register';
+import { ForgotPassword } from './pages/ForgotPassword';
+import { ResetPassword } from './pages/ResetPassword';
+import { VerifyEmail } from './pages/VerifyEmail';
+import { UnlockAccount } from './pages/UnlockAccount';
+import { SSOCallback } from './pages/SSOCallback';
 import { Rooms } from './pages/Rooms';
 import { Chat } from './pages/Chat';
 import './index.css';
@@ -18,6 +23,11 @@ function App() {
             <Routes>
                 <Route path="/login" element={<Login />} />
                 <Route path="/register" element={<Register />} />
+                <Route path="/forgot-password" element={<ForgotPassword />} />
+                <Route path="/reset-password" element={<ResetPassword />} />
+                <Route path="/verify-email" element={<VerifyEmail />} />
+                <Route path="/unlock-account" element={<UnlockAccount />} />
+                <Route path="/sso/callback" element={<SSOCallback />} />
                 <Route path="/rooms" element={<PrivateRoute><Rooms /></PrivateRoute>} />
                 <Route path="/chat/:roomId" element={<PrivateRoute><Chat /></PrivateRoute>} />
                 <Route path="*" element={<Navigate to="/login" />} />
@@ -1,12 +1,33 @@
-import type { AuthResponse, Room, Message } from '../types'
+import type { AuthResponse, MFAChallenge, Room, RoomPage, Message } from '../types'
 
 const API_URL = '/api'
 
+// Full-page navigation starts single sign-on
+export const SSO_LOGIN_URL = `${API_URL}/auth/oidc/login`;
+
 function getToken(): string | null {
     return localStorage.getItem('token');
 }
 
-async function request<T>(path: string, options: RequestInit = {}): Promise<T> {
+// Access tokens are short-lived; trade the refresh token for a new pair
+export async function refreshTokens(): Promise<boolean> {
+    const refreshToken = localStorage.getItem('refresh_token');
+    if (!refreshToken) return false;
+
+    const res = await fetch(`${API_URL}/token/refresh`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ refresh_token: refreshToken }),
+    });
+    if (!res.ok) return false;
+
+    const data: AuthResponse = await res.json();
+    localStorage.setItem('token', data.token);
+    localStorage.setItem('refresh_token', data.refresh_token);
+    return true;
+}
+
+async function request<T>(path: string, options: RequestInit = {}, retry = true): Promise<T> {
     const token = getToken();
     const headers: HeadersInit = {
         'Content-Type': 'application/json',
@@ -15,10 +36,16 @@ async function request<T>(path: string, options: RequestInit = {}): Promise<T> {
     };
 
     const res = await fetch(`${API_URL}${path}`, { ...options, headers });
+    if (res.status === 401 && retry && token && await refreshTokens()) {
+        return request<T>(path, options, false);
+    }
     if (!res.ok) {
         const error = await res.json()
         throw new Error(error.error || 'Request failed');
     }
+    if (res.status === 204) {
+        return undefined as T;
+    }
 
     return res.json()
 }
@@ -31,12 +58,58 @@ export const api = {
         }),
 
     login: (email: string, password: string) =>
-        request<AuthResponse>('/login', {
+        request<AuthResponse | MFAChallenge>('/login', {
             method: 'POST',
             body: JSON.stringify({ email, password }),
         }),
 
-    getRooms: () => request<Room[]>('/rooms'),
+    loginMFA: (mfaToken: string, code: string) =>
+        request<AuthResponse>('/login/mfa', {
+            method: 'POST',
+            body: JSON.stringify({ mfa_token: mfaToken, code }),
+        }),
+
+    exchangeSSO: (code: string) =>
+        request<AuthResponse>('/auth/oidc/exchange', {
+            method: 'POST',
+            body: JSON.stringify({ code }),
+        }),
+
+    logout: (refreshToken: string | null) =>
+        request<void>('/logout', {
+            method: 'POST',
+            body: JSON.stringify({ refresh_token: refreshToken ?? '' }),
+        }),
+
+    requestPasswordReset: (email: string) =>
+        request<{ message: string }>('/password/reset', {
+            method: 'POST',
+            body: JSON.stringify({ email }),
+        }),
+
+    confirmPasswordReset: (token: string, password: string) =>
+        request<void>('/password/reset/confirm', {
+            method: 'POST',
+            body: JSON.stringify({ token, password }),
+        }),
+
+    verifyEmail: (token: string) =>
+        request<void>('/verify-email', {
+            method: 'POST',
+            body: JSON.stringify({ token }),
+        }),
+
+    unlockAccount: (token: string) =>
+        request<void>('/account/unlock', {
+            method: 'POST',
+            body: JSON.stringify({ token }),
+        }),
+
+    resendVerification: () =>
+        request<{ message: string }>('/verify-email/resend', { method: 'POST' }),
+
+    getRooms: (cursor?: string) =>
+        request<RoomPage>(cursor ? `/rooms?cursor=${encodeURIComponent(cursor)}` : '/rooms'),
 
     createRoom: (name: string) =>
         request<Room>('/rooms', {
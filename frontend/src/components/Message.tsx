@@ -11,7 +11,10 @@ export function Message({ message, isOwn }: Props) {
     return (
         <div className={`message ${isOwn ? 'own' : ''} ${statusClass}`}>
             <div className="message-header">
-            <span className="username">{message.username}</span>
+            <span className="username">
+                {message.username}
+                {message.bot && <span className="bot-badge">BOT</span>}
+            </span>
             {message.moderation_status === 'pending' && (
                 <span className="pending-indicator">⏳</span>
             )}
@@ -22,7 +25,9 @@ export function Message({ message, isOwn }: Props) {
             <div className="message-content">
             {message.moderation_status === 'flagged'
                 ? '[This message was flagged by moderation]'
-                : message.content
+                : message.moderation_status === 'removed'
+                    ? '[This message was removed by a moderator]'
+                    : message.content
             }
             </div>
         </div>
@@ -1,11 +1,12 @@
 import { useState, useEffect, createContext, useContext } from 'react';
 import type { ReactNode } from 'react';
 import type { User } from '../types';
+import { api } from '../api/client';
 
 interface AuthContextType {
     user: User | null;
     token: string | null;
-    login: (token: string, user: User) => void;
+    login: (token: string, user: User, refreshToken: string) => void;
     logout: () => void;
     isAuthenticated: boolean;
 }
@@ -26,15 +27,19 @@ export function AuthProvider({ children }: { children: ReactNode }) {
         }
     }, []);
 
-    const login = (newToken: string, newUser: User) => {
+    const login = (newToken: string, newUser: User, refreshToken: string) => {
         localStorage.setItem('token', newToken);
+        localStorage.setItem('refresh_token', refreshToken);
         localStorage.setItem('user', JSON.stringify(newUser));
         setToken(newToken);
         setUser(newUser);
     }
 
     const logout = () => {
+        // Revoke server-side; local state is cleared either way
+        api.logout(localStorage.getItem('refresh_token')).catch(() => {});
         localStorage.removeItem('token');
+        localStorage.removeItem('refresh_token');
         localStorage.removeItem('user');
         setToken(null);
         setUser(null);
@@ -1,18 +1,21 @@
 import { useState, useEffect, useCallback, useRef } from 'react';
-import type { Message, WSMessage, ModerationUpdate } from '../types';
+import type { Message, WSMessage, ModerationUpdate, WSError } from '../types';
 
 const WS_URL = `${window.location.protocol === 'https:' ? 'wss:' : 'ws:'}//${window.location.host}/ws`;
 
 export function useWebSocket(roomId: string, token: string | null) {
     const [messages, setMessages] = useState<Message[]>([]);
     const [status, setStatus] = useState<'connecting' | 'connected' | 'disconnected'>('disconnected');
+    const [error, setError] = useState('');
     const wsRef = useRef<WebSocket | null>(null);
 
     useEffect(() => {
         if (!token || !roomId) return;
 
         setStatus('connecting');
-        const ws = new WebSocket(`${WS_URL}/${roomId}?token=${token}`)
+        // Prefer the stored token, which API calls keep fresh via refresh
+        const currentToken = localStorage.getItem('token') ?? token;
+        const ws = new WebSocket(`${WS_URL}/${roomId}?token=${currentToken}`)
         wsRef.current = ws;
 
         ws.onopen = () => setStatus('connected');
@@ -33,6 +36,8 @@ export function useWebSocket(roomId: string, token: string | null) {
                             : msg
                     )
                 );
+            } else if (data.type === 'error') {
+                setError((data.payload as WSError).error);
             }
         };
 
@@ -44,9 +49,10 @@ export function useWebSocket(roomId: string, token: string | null) {
 
     const sendMessage = useCallback((content: string) => {
         if (wsRef.current?.readyState === WebSocket.OPEN) {
+            setError('');
             wsRef.current.send(JSON.stringify({ content }));
         }
     }, []);
 
-    return { messages, sendMessage, status, setMessages };
+    return { messages, sendMessage, status, setMessages, error };
 } 
\ No newline at end of file
@@ -10,7 +10,7 @@ export function Chat() {
     const { roomId } = useParams<{ roomId: string }>();
     const navigate = useNavigate();
     const { token, user } = useAuth();
-    const { messages, sendMessage, status, setMessages } = useWebSocket(roomId!, token);
+    const { messages, sendMessage, status, setMessages, error } = useWebSocket(roomId!, token);
 
     useEffect(() => {
         if (roomId) {
@@ -27,6 +27,7 @@ export function Chat() {
                 <span className={`status ${status}`}>{status}</span>
             </header>
             <MessageList messages={messages} currentUserId={user?.id} />
+            {error && <div className="error">{error}</div>}
             <MessageInput onSend={sendMessage} disabled={status !== 'connected'} />
         </div>
     )
@@ -0,0 +1,42 @@
+import { useState } from 'react';
+import { Link } from 'react-router-dom';
+import { api } from '../api/client';
+
+export function ForgotPassword() {
+    const [email, setEmail] = useState('');
+    const [sent, setSent] = useState(false);
+    const [error, setError] = useState('');
+
+    const handleSubmit = async (e: React.FormEvent) => {
+      e.preventDefault();
+      setError('');
+      try {
+        await api.requestPasswordReset(email);
+        setSent(true);
+      } catch (err) {
+        setError(err instanceof Error ? err.message : 'Request failed');
+      }
+    };
+
+    return (
+        <div className="auth-container">
+            <h1>Reset Password</h1>
+            {error && <div className="error">{error}</div>}
+            {sent ? (
+                <p>If that email is registered, a reset link is on its way.</p>
+            ) : (
+                <form onSubmit={handleSubmit}>
+                    <input
+                        type="email"
+                        placeholder="Email"
+                        value={email}
+                        onChange={(e) => setEmail(e.target.value)}
+                        required
+                    />
+                    <button type="submit">Send reset link</button>
+                </form>
+            )}
+            <p><Link to="/login">Back to login</Link></p>
+        </div>
+    )
+}
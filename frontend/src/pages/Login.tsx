@@ -1,12 +1,15 @@
 import { useState } from 'react';
-import { useNavigate, Link } from 'react-router-dom';
-import { api } from '../api/client';
+import { useNavigate, useSearchParams, Link } from 'react-router-dom';
+import { api, SSO_LOGIN_URL } from '../api/client';
 import { useAuth } from '../hooks/useAuth';
 
 export function Login() {
     const [email, setEmail] = useState('');
     const [password, setPassword] = useState('');
-    const [error, setError] = useState('');
+    const [mfaToken, setMfaToken] = useState('');
+    const [code, setCode] = useState('');
+    const [searchParams] = useSearchParams();
+    const [error, setError] = useState(searchParams.get('sso_error') ?? '');
     const navigate = useNavigate();
     const { login } = useAuth();
 
@@ -14,14 +17,41 @@ export function Login() {
       e.preventDefault();
       setError('');
       try {
-        const res = await api.login(email, password);
-        login(res.token, res.user);
+        const res = mfaToken
+          ? await api.loginMFA(mfaToken, code)
+          : await api.login(email, password);
+        if ('mfa_required' in res) {
+          setMfaToken(res.mfa_token);
+          return;
+        }
+        login(res.token, res.user, res.refresh_token);
         navigate('/rooms');
       } catch (err) {
         setError(err instanceof Error ? err.message : 'Login failed');
       }
     };
 
+    if (mfaToken) {
+        return (
+            <div className="auth-container">
+                <h1>Two-Factor Authentication</h1>
+                {error && <div className="error">{error}</div>}
+                <form onSubmit={handleSubmit}>
+                    <input
+                        type="text"
+                        placeholder="Authenticator or recovery code"
+                        value={code}
+                        onChange={(e) => setCode(e.target.value)}
+                        autoComplete="one-time-code"
+                        required
+                    />
+                    <button type="submit">Verify</button>
+                </form>
+                <p><Link to="/login" onClick={() => setMfaToken('')}>Start over</Link></p>
+            </div>
+        )
+    }
+
     return (
         <div className="auth-container">
             <h1>Login</h1>
@@ -43,7 +73,9 @@ export function Login() {
                 />
                 <button type="submit">Login</button>
             </form>
+            <p><a href={SSO_LOGIN_URL}>Sign in with SSO</a></p>
             <p>Don't have an account? <Link to="/register">Register</Link></p>
+            <p><Link to="/forgot-password">Forgot your password?</Link></p>
         </div>
     )
 }
\ No newline at end of file
@@ -16,7 +16,7 @@ export function Register() {
       setError('');
       try {
         const res = await api.register(email, password, username);
-        login(res.token, res.user);
+        login(res.token, res.user, res.refresh_token);
         navigate('/rooms');
       } catch (err) {
         setError(err instanceof Error ? err.message : 'Registration failed');
@@ -0,0 +1,39 @@
+import { useState } from 'react';
+import { useNavigate, useSearchParams, Link } from 'react-router-dom';
+import { api } from '../api/client';
+
+export function ResetPassword() {
+    const [password, setPassword] = useState('');
+    const [error, setError] = useState('');
+    const [searchParams] = useSearchParams();
+    const navigate = useNavigate();
+
+    const handleSubmit = async (e: React.FormEvent) => {
+      e.preventDefault();
+      setError('');
+      try {
+        await api.confirmPasswordReset(searchParams.get('token') ?? '', password);
+        navigate('/login');
+      } catch (err) {
+        setError(err instanceof Error ? err.message : 'Reset failed');
+      }
+    };
+
+    return (
+        <div className="auth-container">
+            <h1>Choose a New Password</h1>
+            {error && <div className="error">{error}</div>}
+            <form onSubmit={handleSubmit}>
+                <input
+                    type="password"
+                    placeholder="New password"
+                    value={password}
+                    onChange={(e) => setPassword(e.target.value)}
+                    required
+                />
+                <button type="submit">Reset password</button>
+            </form>
+            <p><Link to="/forgot-password">Request a new link</Link></p>
+        </div>
+    )
+}
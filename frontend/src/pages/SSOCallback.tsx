@@ -0,0 +1,33 @@
+import { useEffect, useRef, useState } from 'react';
+import { useNavigate, Link } from 'react-router-dom';
+import { api } from '../api/client';
+import { useAuth } from '../hooks/useAuth';
+
+export function SSOCallback() {
+    const [error, setError] = useState('');
+    const navigate = useNavigate();
+    const { login } = useAuth();
+    // The code is single-use; don't redeem it twice under StrictMode
+    const started = useRef(false);
+
+    useEffect(() => {
+        if (started.current) return;
+        started.current = true;
+
+        const code = new URLSearchParams(window.location.hash.slice(1)).get('code') ?? '';
+        api.exchangeSSO(code)
+            .then((res) => {
+                login(res.token, res.user, res.refresh_token);
+                navigate('/rooms', { replace: true });
+            })
+            .catch((err) => setError(err instanceof Error ? err.message : 'Single sign-on failed'));
+    }, [login, navigate]);
+
+    return (
+        <div className="auth-container">
+            <h1>Single Sign-On</h1>
+            {error ? <div className="error">{error}</div> : <p>Signing you in...</p>}
+            <p><Link to="/login">Back to login</Link></p>
+        </div>
+    )
+}
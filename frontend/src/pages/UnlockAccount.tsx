@@ -0,0 +1,28 @@
+import { useEffect, useState } from 'react';
+import { useSearchParams, Link } from 'react-router-dom';
+import { api } from '../api/client';
+
+export function UnlockAccount() {
+    const [searchParams] = useSearchParams();
+    const [status, setStatus] = useState<'unlocking' | 'unlocked' | 'failed'>('unlocking');
+    const [error, setError] = useState('');
+
+    useEffect(() => {
+        api.unlockAccount(searchParams.get('token') ?? '')
+            .then(() => setStatus('unlocked'))
+            .catch((err) => {
+                setError(err instanceof Error ? err.message : 'Unlock failed');
+                setStatus('failed');
+            });
+    }, [searchParams]);
+
+    return (
+        <div className="auth-container">
+            <h1>Unlock Account</h1>
+            {status === 'unlocking' && <p>Unlocking...</p>}
+            {status === 'unlocked' && <p>Your account is unlocked. You can log in again.</p>}
+            {status === 'failed' && <div className="error">{error}</div>}
+            <p><Link to="/login">Back to login</Link></p>
+        </div>
+    )
+}
@@ -0,0 +1,30 @@
+import { useEffect, useState } from 'react';
+import { useSearchParams, Link } from 'react-router-dom';
+import { api, refreshTokens } from '../api/client';
+
+export function VerifyEmail() {
+    const [searchParams] = useSearchParams();
+    const [status, setStatus] = useState<'verifying' | 'verified' | 'failed'>('verifying');
+    const [error, setError] = useState('');
+
+    useEffect(() => {
+        api.verifyEmail(searchParams.get('token') ?? '')
+            // Pick up email_verified in a fresh access token if logged in
+            .then(() => refreshTokens())
+            .then(() => setStatus('verified'))
+            .catch((err) => {
+                setError(err instanceof Error ? err.message : 'Verification failed');
+                setStatus('failed');
+            });
+    }, [searchParams]);
+
+    return (
+        <div className="auth-container">
+            <h1>Email Verification</h1>
+            {status === 'verifying' && <p>Verifying...</p>}
+            {status === 'verified' && <p>Your email address is verified.</p>}
+            {status === 'failed' && <div className="error">{error}</div>}
+            <p><Link to="/rooms">Continue</Link></p>
+        </div>
+    )
+}
@@ -2,36 +2,83 @@ export interface User {
     id: string;
     email: string;
     username: string;
+    role: 'user' | 'moderator' | 'admin';
+    bot: boolean;
+    verified_at: string | null;
 }
 
 export interface AuthResponse {
     token: string;
+    refresh_token: string;
     user: User;
 }
 
+// Returned by /login instead of tokens when the account uses 2FA
+export interface MFAChallenge {
+    mfa_required: true;
+    mfa_token: string;
+}
+
 export interface Room {
     id: string;
     name: string;
+    description: string;
+    topic: string;
+    tags: string[];
     created_by: string;
+    kind: 'room' | 'dm';
+    visibility: 'public' | 'private';
+    require_verified: boolean;
+    archived_at?: string;
     created_at: string;
 }
 
+export interface RoomListing extends Room {
+    member_count: number;
+    online_count: number;
+    last_activity_at: string;
+}
+
+export interface RoomPage {
+    rooms: RoomListing[];
+    next_cursor?: string;
+}
+
 export interface Message {
     id: string;
     room_id: string;
     user_id: string;
     username: string;
+    bot: boolean;
     content: string;
-    moderation_status: 'pending' | 'approved' | 'flagged';
+    moderation_status: 'pending' | 'approved' | 'flagged' | 'removed';
     created_at: string;
 }
 
 export interface WSMessage {
-    type: 'message' | 'moderation_update'
-    payload: Message | ModerationUpdate;
+    type: 'message' | 'moderation_update' | 'error' | 'room_updated' | 'kicked'
+    payload: Message | ModerationUpdate | WSError | RoomUpdated | Kicked;
+}
+
+export interface Kicked {
+    room_id: string;
+    user_id: string;
+    reason?: string;
+    banned: boolean;
+    banned_until?: string;
+}
+
+export interface RoomUpdated {
+    room: Room;
+    owner_id?: string;
+    deleted?: boolean;
+}
+
+export interface WSError {
+    error: string;
 }
 
 export interface ModerationUpdate {
     message_id: string;
-    status: 'approved' | 'flagged';
+    status: 'approved' | 'flagged' | 'removed';
 }
\ No newline at end of file
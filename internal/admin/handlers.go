@@ -0,0 +1,384 @@
+package admin
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mr1hm/go-chat-moderator/internal/audit"
+	"github.com/mr1hm/go-chat-moderator/internal/auth"
+)
+
+type Handler struct {
+	userRepo    auth.UserRepository
+	auditRepo   audit.Repository
+	authHandler *auth.Handler
+}
+
+func NewHandler(authHandler *auth.Handler) *Handler {
+	return &Handler{
+		userRepo:    auth.NewUserRepository(),
+		auditRepo:   audit.NewRepository(),
+		authHandler: authHandler,
+	}
+}
+
+// UpdateUserRole sets a user's global role. Their current access tokens are
+// invalidated so the new role applies on their next refresh.
+func (h *Handler) UpdateUserRole(c *gin.Context) {
+	var req auth.UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	user, err := h.userRepo.FindByID(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, auth.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": auth.ErrUserNotFound.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to get user",
+		})
+		return
+	}
+
+	actorID := c.GetString("user_id")
+	if user.ID == actorID && req.Role != auth.RoleAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "admins cannot demote themselves",
+		})
+		return
+	}
+
+	if err := h.userRepo.UpdateRole(user.ID, req.Role); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to update role",
+		})
+		return
+	}
+
+	if err := h.auditRepo.Append(audit.NewEntry(
+		actorID, audit.ActionUserRoleChange, "user", user.ID, req.Reason,
+		gin.H{"role": user.Role},
+		gin.H{"role": req.Role},
+	)); err != nil {
+		log.Printf("error while writing audit entry: %v", err)
+	}
+
+	if err := h.authHandler.InvalidateAccessTokens(c.Request.Context(), user.ID); err != nil {
+		log.Printf("error while invalidating access tokens: %v", err)
+	}
+
+	user.Role = req.Role
+	c.JSON(http.StatusOK, user)
+}
+
+// GetMFAPolicy returns the global roles that must use two-factor authentication
+func (h *Handler) GetMFAPolicy(c *gin.Context) {
+	policy, err := h.authHandler.MFAService().Policy()
+	if err != nil {
+		log.Printf("error while loading mfa policy: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to get mfa policy",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// UpdateMFAPolicy sets which global roles must use two-factor authentication.
+// Covered users without a second factor keep their role but are refused on
+// privileged routes until they enroll and log in again.
+func (h *Handler) UpdateMFAPolicy(c *gin.Context) {
+	var req auth.UpdateMFAPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	mfaService := h.authHandler.MFAService()
+	before, err := mfaService.Policy()
+	if err != nil {
+		log.Printf("error while loading mfa policy: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to update mfa policy",
+		})
+		return
+	}
+
+	// Admins enabling the policy for their own role without a second factor
+	// would lock themselves out of this endpoint
+	claims := c.MustGet("claims").(*auth.Claims)
+	if !claims.MFA && slices.Contains(req.Roles, claims.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "log in with two-factor authentication before requiring it for your role",
+		})
+		return
+	}
+
+	after := &auth.MFAPolicy{Roles: req.Roles}
+	if err := mfaService.SetPolicy(after); err != nil {
+		if errors.Is(err, auth.ErrInvalidMFAPolicy) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		log.Printf("error while updating mfa policy: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to update mfa policy",
+		})
+		return
+	}
+
+	if err := h.auditRepo.Append(audit.NewEntry(
+		c.GetString("user_id"), audit.ActionMFAPolicy, "setting", auth.MFAPolicySetting, req.Reason,
+		before, after,
+	)); err != nil {
+		log.Printf("error while writing audit entry: %v", err)
+	}
+
+	c.JSON(http.StatusOK, after)
+}
+
+// UnlockUser lifts a login lockout on a user's account
+func (h *Handler) UnlockUser(c *gin.Context) {
+	var req struct {
+		Reason string `json:"reason" binding:"max=500"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	user, err := h.userRepo.FindByID(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, auth.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": auth.ErrUserNotFound.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to get user",
+		})
+		return
+	}
+
+	if err := h.authHandler.Lockouts().Unlock(c.Request.Context(), user.Email); err != nil {
+		log.Printf("error while unlocking account: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to unlock account",
+		})
+		return
+	}
+
+	if err := h.auditRepo.Append(audit.NewEntry(
+		c.GetString("user_id"), audit.ActionUserUnlock, "user", user.ID, req.Reason, nil, nil,
+	)); err != nil {
+		log.Printf("error while writing audit entry: %v", err)
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// CreateBot creates a bot account. Give it API keys with
+// POST /admin/users/:id/api-keys.
+func (h *Handler) CreateBot(c *gin.Context) {
+	var req auth.CreateBotRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	bot, err := h.authHandler.Service().CreateBot(req.Username, req.Role)
+	if err != nil {
+		if errors.Is(err, auth.ErrUsernameExists) || errors.Is(err, auth.ErrEmailExists) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": auth.ErrUsernameExists.Error(),
+			})
+			return
+		}
+		log.Printf("error while creating bot: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to create bot",
+		})
+		return
+	}
+
+	if err := h.auditRepo.Append(audit.NewEntry(
+		c.GetString("user_id"), audit.ActionBotCreate, "user", bot.ID, req.Reason,
+		nil,
+		gin.H{"username": bot.Username, "role": bot.Role},
+	)); err != nil {
+		log.Printf("error while writing audit entry: %v", err)
+	}
+
+	c.JSON(http.StatusCreated, bot)
+}
+
+func (h *Handler) ListBots(c *gin.Context) {
+	bots, err := h.userRepo.ListBots()
+	if err != nil {
+		log.Printf("error while listing bots: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to list bots",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, bots)
+}
+
+func (h *Handler) ListUserAPIKeys(c *gin.Context) {
+	keys, err := h.authHandler.APIKeys().List(c.Param("id"))
+	if err != nil {
+		log.Printf("error while listing api keys: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to list api keys",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// CreateUserAPIKey issues a key for any user, typically a bot. The key is
+// only ever shown in this response.
+func (h *Handler) CreateUserAPIKey(c *gin.Context) {
+	var req auth.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	user, err := h.userRepo.FindByID(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, auth.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": auth.ErrUserNotFound.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to get user",
+		})
+		return
+	}
+
+	actorID := c.GetString("user_id")
+	key, err := h.authHandler.APIKeys().Create(user.ID, actorID, req.Name, req.Scopes, time.Duration(req.ExpiresInDays)*24*time.Hour)
+	if err != nil {
+		auth.AbortAPIKeyError(c, err)
+		return
+	}
+
+	if err := h.auditRepo.Append(audit.NewEntry(
+		actorID, audit.ActionAPIKeyCreate, "api_key", key.ID, req.Reason,
+		nil,
+		gin.H{"user_id": user.ID, "name": key.Name, "prefix": key.Prefix, "scopes": key.Scopes},
+	)); err != nil {
+		log.Printf("error while writing audit entry: %v", err)
+	}
+
+	c.JSON(http.StatusCreated, key)
+}
+
+// RevokeUserAPIKey revokes a user's key and closes websockets opened with it
+func (h *Handler) RevokeUserAPIKey(c *gin.Context) {
+	var req struct {
+		Reason string `json:"reason" binding:"max=500"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	userID, keyID := c.Param("id"), c.Param("keyID")
+	if err := h.authHandler.RevokeAPIKey(c.Request.Context(), userID, keyID); err != nil {
+		auth.AbortAPIKeyError(c, err)
+		return
+	}
+
+	if err := h.auditRepo.Append(audit.NewEntry(
+		c.GetString("user_id"), audit.ActionAPIKeyRevoke, "api_key", keyID, req.Reason,
+		gin.H{"user_id": userID},
+		nil,
+	)); err != nil {
+		log.Printf("error while writing audit entry: %v", err)
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// auditLockout records accounts locked by failed logins. Lockouts of
+// unregistered emails are recorded against the email.
+func (h *Handler) auditLockout(event *auth.LockoutEvent) {
+	target := event.UserID
+	if target == "" {
+		target = event.Email
+	}
+
+	if err := h.auditRepo.Append(audit.NewEntry(
+		"system", audit.ActionUserLockout, "user", target, "too many failed logins",
+		nil,
+		gin.H{"ip": event.IP, "locked_until": event.Until.UTC().Format(time.RFC3339)},
+	)); err != nil {
+		log.Printf("error while writing audit entry: %v", err)
+	}
+}
+
+// auditRoleChange records roles changed outside the admin API, such as by
+// SSO group sync
+func (h *Handler) auditRoleChange(event *auth.RoleChangeEvent) {
+	if err := h.auditRepo.Append(audit.NewEntry(
+		"system", audit.ActionUserRoleChange, "user", event.UserID, event.Reason,
+		gin.H{"role": event.From},
+		gin.H{"role": event.To},
+	)); err != nil {
+		log.Printf("error while writing audit entry: %v", err)
+	}
+}
+
+func RegisterRoutes(r *gin.Engine, authHandler *auth.Handler) *Handler {
+	handler := NewHandler(authHandler)
+	authHandler.Lockouts().OnLockout(handler.auditLockout)
+	authHandler.OnRoleChange(handler.auditRoleChange)
+
+	a := r.Group("/admin")
+	a.Use(authHandler.AuthMiddleware(), authHandler.RequireRole(auth.RoleAdmin))
+	{
+		a.PUT("/users/:id/role", handler.UpdateUserRole)
+		a.POST("/users/:id/unlock", handler.UnlockUser)
+		a.GET("/settings/mfa", handler.GetMFAPolicy)
+		a.PUT("/settings/mfa", handler.UpdateMFAPolicy)
+		a.POST("/bots", handler.CreateBot)
+		a.GET("/bots", handler.ListBots)
+		a.GET("/users/:id/api-keys", handler.ListUserAPIKeys)
+		a.POST("/users/:id/api-keys", handler.CreateUserAPIKey)
+		a.DELETE("/users/:id/api-keys/:keyID", handler.RevokeUserAPIKey)
+	}
+
+	return handler
+}
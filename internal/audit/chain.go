@@ -0,0 +1,54 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ComputeHash hashes an entry's content together with the previous entry's hash
+func ComputeHash(prevHash string, e *Entry) string {
+	fields := []string{
+		prevHash,
+		e.ID,
+		e.ActorID,
+		e.Action,
+		e.TargetType,
+		e.TargetID,
+		e.Reason,
+		string(e.Before),
+		string(e.After),
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}
+
+	// Length-prefix each field so values containing the separator can't collide
+	var b strings.Builder
+	for _, f := range fields {
+		b.WriteString(strconv.Itoa(len(f)))
+		b.WriteByte(':')
+		b.WriteString(f)
+	}
+
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyChain checks entries in sequence order, starting from the genesis entry
+func VerifyChain(entries []*Entry) *VerifyResult {
+	result := &VerifyResult{Valid: true, Entries: len(entries)}
+
+	prev := ""
+	for _, e := range entries {
+		if e.PrevHash != prev {
+			return &VerifyResult{Entries: len(entries), BadSeq: e.Seq, Reason: "previous hash mismatch"}
+		}
+		if ComputeHash(prev, e) != e.Hash {
+			return &VerifyResult{Entries: len(entries), BadSeq: e.Seq, Reason: "content hash mismatch"}
+		}
+		prev = e.Hash
+	}
+
+	return result
+}
@@ -0,0 +1,88 @@
+package audit
+
+import (
+	"testing"
+	"time"
+)
+
+func buildChain(n int) []*Entry {
+	entries := make([]*Entry, n)
+	prev := ""
+	for i := range entries {
+		e := NewEntry("mod-1", ActionMessageRemove, "message", "msg-"+string(rune('a'+i)), "spam",
+			map[string]string{"moderation_status": "flagged"},
+			map[string]string{"moderation_status": "removed"},
+		)
+		e.Seq = int64(i + 1)
+		e.ID = "entry-" + string(rune('a'+i))
+		e.CreatedAt = time.Date(2026, 1, 1, 0, 0, i, 0, time.UTC)
+		e.PrevHash = prev
+		e.Hash = ComputeHash(prev, e)
+		prev = e.Hash
+		entries[i] = e
+	}
+	return entries
+}
+
+func TestNewEntry_EncodesState(t *testing.T) {
+	e := NewEntry("mod-1", ActionMessageApprove, "message", "msg-1", "", nil, map[string]string{"moderation_status": "approved"})
+
+	if e.Before != nil {
+		t.Errorf("expected empty before state, got %s", e.Before)
+	}
+	if string(e.After) != `{"moderation_status":"approved"}` {
+		t.Errorf("unexpected after state: %s", e.After)
+	}
+}
+
+func TestVerifyChain_Valid(t *testing.T) {
+	result := VerifyChain(buildChain(3))
+
+	if !result.Valid {
+		t.Fatalf("expected valid chain, got %+v", result)
+	}
+	if result.Entries != 3 {
+		t.Errorf("expected 3 entries, got %d", result.Entries)
+	}
+}
+
+func TestVerifyChain_Empty(t *testing.T) {
+	if result := VerifyChain(nil); !result.Valid {
+		t.Fatalf("expected empty chain to be valid, got %+v", result)
+	}
+}
+
+func TestVerifyChain_TamperedContent(t *testing.T) {
+	entries := buildChain(3)
+	entries[1].Reason = "edited after the fact"
+
+	result := VerifyChain(entries)
+	if result.Valid {
+		t.Fatal("expected tampered chain to be invalid")
+	}
+	if result.BadSeq != 2 {
+		t.Errorf("expected bad seq 2, got %d", result.BadSeq)
+	}
+}
+
+func TestVerifyChain_DeletedEntry(t *testing.T) {
+	entries := buildChain(3)
+	entries = append(entries[:1], entries[2:]...)
+
+	result := VerifyChain(entries)
+	if result.Valid {
+		t.Fatal("expected chain with a deleted entry to be invalid")
+	}
+	if result.BadSeq != 3 {
+		t.Errorf("expected bad seq 3, got %d", result.BadSeq)
+	}
+}
+
+func TestComputeHash_FieldBoundaries(t *testing.T) {
+	a := &Entry{ActorID: "ab", Action: "c"}
+	b := &Entry{ActorID: "a", Action: "bc"}
+
+	if ComputeHash("", a) == ComputeHash("", b) {
+		t.Error("expected different hashes when field boundaries differ")
+	}
+}
@@ -0,0 +1,177 @@
+package audit
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mr1hm/go-chat-moderator/internal/auth"
+)
+
+type Handler struct {
+	repo Repository
+}
+
+func NewHandler() *Handler {
+	return &Handler{
+		repo: NewRepository(),
+	}
+}
+
+// List returns entries in chain order.
+// Optional query params: actor, target, action, from, to, limit
+func (h *Handler) List(c *gin.Context) {
+	filter, err := parseFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if filter.Limit == 0 {
+		filter.Limit = 100
+	}
+
+	entries, err := h.repo.List(filter)
+	if err != nil {
+		log.Printf("error while listing audit log: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to list audit log",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// Export downloads matching entries as JSON (default) or CSV
+func (h *Handler) Export(c *gin.Context) {
+	filter, err := parseFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "format must be json or csv",
+		})
+		return
+	}
+
+	entries, err := h.repo.List(filter)
+	if err != nil {
+		log.Printf("error while exporting audit log: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to export audit log",
+		})
+		return
+	}
+
+	filename := fmt.Sprintf("audit-%s.%s", time.Now().UTC().Format("20060102T150405Z"), format)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	if format == "json" {
+		c.JSON(http.StatusOK, entries)
+		return
+	}
+
+	c.Header("Content-Type", "text/csv")
+	c.Status(http.StatusOK)
+	if err := writeCSV(c.Writer, entries); err != nil {
+		log.Printf("error while writing audit csv: %v", err)
+	}
+}
+
+// Verify recomputes the hash chain and reports the first broken entry
+func (h *Handler) Verify(c *gin.Context) {
+	result, err := h.repo.Verify()
+	if err != nil {
+		log.Printf("error while verifying audit log: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to verify audit log",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func writeCSV(w http.ResponseWriter, entries []*Entry) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"seq", "id", "actor_id", "action", "target_type", "target_id", "reason", "before", "after", "created_at", "prev_hash", "hash"})
+	for _, e := range entries {
+		cw.Write([]string{
+			strconv.FormatInt(e.Seq, 10),
+			e.ID,
+			e.ActorID,
+			e.Action,
+			e.TargetType,
+			e.TargetID,
+			e.Reason,
+			string(e.Before),
+			string(e.After),
+			e.CreatedAt.Format(time.RFC3339Nano),
+			e.PrevHash,
+			e.Hash,
+		})
+	}
+	cw.Flush()
+
+	return cw.Error()
+}
+
+func parseFilter(c *gin.Context) (Filter, error) {
+	filter := Filter{
+		ActorID:  c.Query("actor"),
+		TargetID: c.Query("target"),
+		Action:   c.Query("action"),
+	}
+
+	var err error
+	if filter.From, err = parseDate(c.Query("from")); err != nil {
+		return filter, fmt.Errorf("invalid from: %w", err)
+	}
+	if filter.To, err = parseDate(c.Query("to")); err != nil {
+		return filter, fmt.Errorf("invalid to: %w", err)
+	}
+	if limit := c.Query("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit < 0 {
+			return filter, errors.New("invalid limit")
+		}
+	}
+
+	return filter, nil
+}
+
+func parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
+func RegisterRoutes(r *gin.Engine, authHandler *auth.Handler) *Handler {
+	handler := NewHandler()
+
+	a := r.Group("/audit")
+	a.Use(authHandler.AuthMiddleware(), authHandler.RequireRole(auth.RoleAdmin))
+	{
+		a.GET("", handler.List)
+		a.GET("/export", handler.Export)
+		a.GET("/verify", handler.Verify)
+	}
+
+	return handler
+}
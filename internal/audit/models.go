@@ -0,0 +1,84 @@
+package audit
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Actions recorded in the audit log
+const (
+	ActionMessageApprove = "message.approve"
+	ActionMessageRemove  = "message.remove"
+	ActionUserRoleChange = "user.role_change"
+	ActionRoomRoleChange = "room.role_change"
+	ActionRoomUpdate     = "room.update"
+	ActionRoomDelete     = "room.delete"
+	ActionRoomTransfer   = "room.transfer"
+	ActionRoomKick       = "room.kick"
+	ActionRoomBan        = "room.ban"
+	ActionRoomUnban      = "room.unban"
+	ActionMFAPolicy      = "settings.mfa_policy"
+	ActionUserLockout    = "user.lockout"
+	ActionUserUnlock     = "user.unlock"
+	ActionBotCreate      = "bot.create"
+	ActionAPIKeyCreate   = "api_key.create"
+	ActionAPIKeyRevoke   = "api_key.revoke"
+)
+
+// Entry is one row of the append-only audit trail. Hash covers every other
+// field plus PrevHash, chaining each entry to the one before it.
+type Entry struct {
+	Seq        int64           `json:"seq"`
+	ID         string          `json:"id"`
+	ActorID    string          `json:"actor_id"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	Reason     string          `json:"reason,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	PrevHash   string          `json:"prev_hash"`
+	Hash       string          `json:"hash"`
+}
+
+type Filter struct {
+	ActorID  string
+	TargetID string
+	Action   string
+	From     time.Time
+	To       time.Time
+	Limit    int // Zero means no limit
+}
+
+type VerifyResult struct {
+	Valid   bool   `json:"valid"`
+	Entries int    `json:"entries"`
+	BadSeq  int64  `json:"bad_seq,omitempty"` // First entry whose hash or link doesn't match
+	Reason  string `json:"reason,omitempty"`
+}
+
+// NewEntry builds an entry, encoding before and after state as JSON. Nil
+// state is left empty.
+func NewEntry(actorID, action, targetType, targetID, reason string, before, after any) *Entry {
+	return &Entry{
+		ActorID:    actorID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Reason:     reason,
+		Before:     encodeState(before),
+		After:      encodeState(after),
+	}
+}
+
+func encodeState(state any) json.RawMessage {
+	if state == nil {
+		return nil
+	}
+	b, err := json.Marshal(state)
+	if err != nil {
+		return nil
+	}
+	return b
+}
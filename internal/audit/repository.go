@@ -0,0 +1,151 @@
+package audit
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mr1hm/go-chat-moderator/internal/shared/sqlite"
+)
+
+// Fixed-width timestamps keep created_at lexically sortable for range filters
+const timeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+const maxAppendAttempts = 5
+
+// Repository is append-only; there is deliberately no update or delete
+type Repository interface {
+	Append(entry *Entry) error
+	List(filter Filter) ([]*Entry, error)
+	Verify() (*VerifyResult, error)
+}
+
+type sqliteRepo struct {
+	mtx sync.Mutex
+}
+
+func NewRepository() Repository {
+	return &sqliteRepo{}
+}
+
+// Append links the entry to the current head of the chain. prev_hash is
+// UNIQUE, so if another process appends concurrently the insert fails and
+// is retried against the new head instead of forking the chain.
+func (r *sqliteRepo) Append(e *Entry) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	e.ID = uuid.New().String()
+	e.CreatedAt = time.Now().UTC()
+
+	for attempt := 0; attempt < maxAppendAttempts; attempt++ {
+		var prev string
+		err := sqlite.DB.QueryRow(`SELECT hash FROM audit_log ORDER BY seq DESC LIMIT 1`).Scan(&prev)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("error while reading audit chain head: %w", err)
+		}
+
+		e.PrevHash = prev
+		e.Hash = ComputeHash(prev, e)
+
+		res, err := sqlite.DB.Exec(
+			`INSERT INTO audit_log (id, actor_id, action, target_type, target_id, reason, before_state, after_state, created_at, prev_hash, hash)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			e.ID, e.ActorID, e.Action, e.TargetType, e.TargetID, e.Reason,
+			string(e.Before), string(e.After), e.CreatedAt.Format(timeLayout), e.PrevHash, e.Hash,
+		)
+		if err == nil {
+			e.Seq, _ = res.LastInsertId()
+			return nil
+		}
+		if !strings.Contains(err.Error(), "UNIQUE") {
+			return fmt.Errorf("error while appending audit entry: %w", err)
+		}
+	}
+
+	return fmt.Errorf("error while appending audit entry: chain head kept changing")
+}
+
+func (r *sqliteRepo) List(filter Filter) ([]*Entry, error) {
+	query := `SELECT seq, id, actor_id, action, target_type, target_id, reason, before_state, after_state, created_at, prev_hash, hash
+		FROM audit_log WHERE 1 = 1`
+	var args []any
+	if filter.ActorID != "" {
+		query += ` AND actor_id = ?`
+		args = append(args, filter.ActorID)
+	}
+	if filter.TargetID != "" {
+		query += ` AND target_id = ?`
+		args = append(args, filter.TargetID)
+	}
+	if filter.Action != "" {
+		query += ` AND action = ?`
+		args = append(args, filter.Action)
+	}
+	if !filter.From.IsZero() {
+		query += ` AND created_at >= ?`
+		args = append(args, filter.From.UTC().Format(timeLayout))
+	}
+	if !filter.To.IsZero() {
+		query += ` AND created_at < ?`
+		args = append(args, filter.To.UTC().Format(timeLayout))
+	}
+	query += ` ORDER BY seq`
+	if filter.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := sqlite.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error while querying audit log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []*Entry{}
+	for rows.Next() {
+		e := &Entry{}
+		var before, after, createdAt string
+		if err := rows.Scan(
+			&e.Seq,
+			&e.ID,
+			&e.ActorID,
+			&e.Action,
+			&e.TargetType,
+			&e.TargetID,
+			&e.Reason,
+			&before,
+			&after,
+			&createdAt,
+			&e.PrevHash,
+			&e.Hash,
+		); err != nil {
+			return nil, fmt.Errorf("error while scanning audit log: %w", err)
+		}
+		if before != "" {
+			e.Before = []byte(before)
+		}
+		if after != "" {
+			e.After = []byte(after)
+		}
+		if e.CreatedAt, err = time.Parse(timeLayout, createdAt); err != nil {
+			return nil, fmt.Errorf("error while parsing audit timestamp: %w", err)
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+func (r *sqliteRepo) Verify() (*VerifyResult, error) {
+	entries, err := r.List(Filter{})
+	if err != nil {
+		return nil, err
+	}
+
+	return VerifyChain(entries), nil
+}
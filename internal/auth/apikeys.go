@@ -0,0 +1,274 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidAPIKey  = errors.New("invalid api key")
+	ErrInvalidScope   = errors.New("unknown api key scope")
+	ErrTooManyAPIKeys = errors.New("too many api keys")
+)
+
+// API key scopes. Keys are refused on routes that don't name a scope.
+const (
+	ScopeRoomsRead     = "rooms:read"     // List and read rooms, open websockets
+	ScopeMessagesWrite = "messages:write" // Post messages
+	ScopeModerationAct = "moderation:act" // Approve and remove messages (moderators only)
+)
+
+var knownScopes = map[string]bool{
+	ScopeRoomsRead:     true,
+	ScopeMessagesWrite: true,
+	ScopeModerationAct: true,
+}
+
+func IsValidScope(scope string) bool {
+	return knownScopes[scope]
+}
+
+const (
+	apiKeyPrefix        = "gcm_"
+	apiKeyPrefixLength  = 12 // Characters of the key kept in clear to identify it
+	apiKeyTouchInterval = time.Minute
+	maxAPIKeysPerUser   = 25
+)
+
+// IsAPIKey tells API keys apart from access tokens by their prefix
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
+
+// APIKeyService issues API keys and authenticates requests made with them
+type APIKeyService struct {
+	repo  APIKeyRepository
+	users UserRepository
+	now   func() time.Time
+}
+
+func NewAPIKeyService(repo APIKeyRepository, users UserRepository) *APIKeyService {
+	return &APIKeyService{
+		repo:  repo,
+		users: users,
+		now:   time.Now,
+	}
+}
+
+// Create issues a key for userID. The returned Key is not stored and can't
+// be recovered later.
+func (s *APIKeyService) Create(userID, createdBy, name string, scopes []string, expiresIn time.Duration) (*NewAPIKey, error) {
+	for _, scope := range scopes {
+		if !IsValidScope(scope) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+		}
+	}
+
+	existing, err := s.repo.ListByUser(userID)
+	if err != nil {
+		return nil, fmt.Errorf("error while listing api keys: %w", err)
+	}
+	if len(existing) >= maxAPIKeysPerUser {
+		return nil, ErrTooManyAPIKeys
+	}
+
+	raw, err := randomToken()
+	if err != nil {
+		return nil, fmt.Errorf("error while generating api key: %w", err)
+	}
+	raw = apiKeyPrefix + raw
+
+	key := &APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    raw[:apiKeyPrefixLength],
+		KeyHash:   hashToken(raw),
+		Scopes:    scopes,
+		CreatedBy: createdBy,
+	}
+	if expiresIn > 0 {
+		expiresAt := s.now().Add(expiresIn)
+		key.ExpiresAt = &expiresAt
+	}
+
+	if err := s.repo.Create(key); err != nil {
+		return nil, fmt.Errorf("error while storing api key: %w", err)
+	}
+
+	return &NewAPIKey{APIKey: *key, Key: raw}, nil
+}
+
+func (s *APIKeyService) List(userID string) ([]*APIKey, error) {
+	return s.repo.ListByUser(userID)
+}
+
+func (s *APIKeyService) Revoke(userID, keyID string) error {
+	return s.repo.Revoke(userID, keyID)
+}
+
+// Authenticate resolves a key to claims for its user. Role and verification
+// are read fresh on every request, so changes apply immediately.
+func (s *APIKeyService) Authenticate(raw string) (*Claims, error) {
+	key, err := s.repo.FindActive(hashToken(raw))
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error while finding api key: %w", err)
+	}
+
+	user, err := s.users.FindByID(key.UserID)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error while finding api key user: %w", err)
+	}
+
+	if key.LastUsedAt == nil || s.now().Sub(*key.LastUsedAt) >= apiKeyTouchInterval {
+		if err := s.repo.Touch(key.ID); err != nil {
+			log.Printf("error while touching api key: %v", err)
+		}
+	}
+
+	return &Claims{
+		UserID:   user.ID,
+		Username: user.Username,
+		Verified: user.VerifiedAt != nil,
+		Role:     user.Role,
+		Bot:      user.Bot,
+		APIKeyID: key.ID,
+		Scopes:   key.Scopes,
+	}, nil
+}
+
+// CreateBot creates a bot account. Bots have no usable password or mailbox
+// and act only through API keys; they count as verified.
+func (s *AuthService) CreateBot(username, role string) (*User, error) {
+	if role == "" {
+		role = RoleUser
+	}
+
+	raw, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(raw), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("error while generating password hash: %w", err)
+	}
+
+	user := &User{
+		// .invalid is reserved (RFC 2606), so this never reaches anyone
+		Email:        strings.ToLower(username) + "@bots.invalid",
+		PasswordHash: string(hash),
+		Username:     username,
+		Role:         role,
+		Bot:          true,
+	}
+	if err := s.repo.Create(user); err != nil {
+		return nil, fmt.Errorf("error while creating bot: %w", err)
+	}
+
+	if err := s.repo.MarkVerified(user.ID); err != nil {
+		return nil, fmt.Errorf("error while marking bot verified: %w", err)
+	}
+	now := time.Now()
+	user.VerifiedAt = &now
+
+	return user, nil
+}
+
+// ListAPIKeys returns the current user's keys, without the keys themselves
+func (h *Handler) ListAPIKeys(c *gin.Context) {
+	claims := c.MustGet("claims").(*Claims)
+
+	keys, err := h.apiKeys.List(claims.UserID)
+	if err != nil {
+		log.Printf("error while listing api keys: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to list api keys",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// CreateAPIKey issues a key for the current user. The key is only ever
+// shown in this response.
+func (h *Handler) CreateAPIKey(c *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	claims := c.MustGet("claims").(*Claims)
+
+	key, err := h.apiKeys.Create(claims.UserID, claims.UserID, req.Name, req.Scopes, time.Duration(req.ExpiresInDays)*24*time.Hour)
+	if err != nil {
+		AbortAPIKeyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, key)
+}
+
+// DeleteAPIKey revokes one of the current user's keys
+func (h *Handler) DeleteAPIKey(c *gin.Context) {
+	claims := c.MustGet("claims").(*Claims)
+
+	if err := h.RevokeAPIKey(c.Request.Context(), claims.UserID, c.Param("id")); err != nil {
+		AbortAPIKeyError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RevokeAPIKey revokes a user's key and closes websockets opened with it
+func (h *Handler) RevokeAPIKey(ctx context.Context, userID, keyID string) error {
+	if err := h.apiKeys.Revoke(userID, keyID); err != nil {
+		return err
+	}
+
+	if err := h.revocations.Publish(ctx, &RevocationEvent{UserID: userID, APIKeyID: keyID}); err != nil {
+		log.Printf("error while publishing revocation: %v", err)
+	}
+
+	return nil
+}
+
+// AbortAPIKeyError answers a failed API key operation
+func AbortAPIKeyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrAPIKeyNotFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": ErrAPIKeyNotFound.Error(),
+		})
+	case errors.Is(err, ErrInvalidScope):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+	case errors.Is(err, ErrTooManyAPIKeys):
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": fmt.Sprintf("%s, revoke one first (limit %d)", ErrTooManyAPIKeys, maxAPIKeysPerUser),
+		})
+	default:
+		log.Printf("error while managing api keys: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to manage api keys",
+		})
+	}
+}
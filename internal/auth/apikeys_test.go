@@ -0,0 +1,261 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Mock API key repository for testing
+type mockAPIKeyRepo struct {
+	keys    map[string]*APIKey // id -> key
+	touches int
+	now     func() time.Time
+}
+
+func newMockAPIKeyRepo(now func() time.Time) *mockAPIKeyRepo {
+	return &mockAPIKeyRepo{
+		keys: make(map[string]*APIKey),
+		now:  now,
+	}
+}
+
+func (m *mockAPIKeyRepo) Create(key *APIKey) error {
+	key.ID = "key-" + key.KeyHash[:8]
+	key.CreatedAt = m.now()
+	m.keys[key.ID] = key
+	return nil
+}
+
+func (m *mockAPIKeyRepo) FindActive(hash string) (*APIKey, error) {
+	for _, k := range m.keys {
+		if k.KeyHash == hash && k.RevokedAt == nil && (k.ExpiresAt == nil || k.ExpiresAt.After(m.now())) {
+			copied := *k
+			return &copied, nil
+		}
+	}
+	return nil, ErrAPIKeyNotFound
+}
+
+func (m *mockAPIKeyRepo) ListByUser(userID string) ([]*APIKey, error) {
+	keys := []*APIKey{}
+	for _, k := range m.keys {
+		if k.UserID == userID && k.RevokedAt == nil {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+func (m *mockAPIKeyRepo) Revoke(userID, id string) error {
+	k, ok := m.keys[id]
+	if !ok || k.UserID != userID || k.RevokedAt != nil {
+		return ErrAPIKeyNotFound
+	}
+	now := m.now()
+	k.RevokedAt = &now
+	return nil
+}
+
+func (m *mockAPIKeyRepo) Touch(id string) error {
+	now := m.now()
+	m.keys[id].LastUsedAt = &now
+	m.touches++
+	return nil
+}
+
+func newTestAPIKeyService() (*APIKeyService, *mockAPIKeyRepo, *time.Time) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	users := newMockRepo()
+	verified := now
+	users.users["bot-1"] = &User{ID: "bot-1", Username: "announcer", Role: RoleModerator, Bot: true, VerifiedAt: &verified}
+
+	repo := newMockAPIKeyRepo(clock)
+	svc := NewAPIKeyService(repo, users)
+	svc.now = clock
+	return svc, repo, &now
+}
+
+func TestAPIKeyService_CreateAndAuthenticate(t *testing.T) {
+	svc, repo, _ := newTestAPIKeyService()
+
+	key, err := svc.Create("bot-1", "admin-1", "announcements", []string{ScopeRoomsRead, ScopeMessagesWrite}, 0)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !IsAPIKey(key.Key) || !strings.HasPrefix(key.Key, key.Prefix) {
+		t.Errorf("unexpected key %q with prefix %q", key.Key, key.Prefix)
+	}
+	if stored := repo.keys[key.ID]; stored.KeyHash == key.Key || strings.Contains(stored.KeyHash, key.Key) {
+		t.Error("expected only a hash of the key to be stored")
+	}
+
+	claims, err := svc.Authenticate(key.Key)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if claims.UserID != "bot-1" || claims.Role != RoleModerator || !claims.Bot || !claims.Verified || claims.APIKeyID != key.ID {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+	if !claims.HasScope(ScopeMessagesWrite) || claims.HasScope(ScopeModerationAct) {
+		t.Errorf("unexpected scopes %v", claims.Scopes)
+	}
+	if repo.keys[key.ID].LastUsedAt == nil {
+		t.Error("expected last use to be recorded")
+	}
+
+	if _, err := svc.Authenticate(key.Key + "x"); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("expected ErrInvalidAPIKey for a wrong key, got %v", err)
+	}
+}
+
+func TestAPIKeyService_Authenticate_TouchThrottled(t *testing.T) {
+	svc, repo, now := newTestAPIKeyService()
+	key, _ := svc.Create("bot-1", "admin-1", "reader", []string{ScopeRoomsRead}, 0)
+
+	svc.Authenticate(key.Key)
+	svc.Authenticate(key.Key)
+	if repo.touches != 1 {
+		t.Errorf("expected 1 touch within a minute, got %d", repo.touches)
+	}
+
+	*now = now.Add(apiKeyTouchInterval)
+	svc.Authenticate(key.Key)
+	if repo.touches != 2 {
+		t.Errorf("expected a touch after a minute, got %d", repo.touches)
+	}
+}
+
+func TestAPIKeyService_Authenticate_RevokedAndExpired(t *testing.T) {
+	svc, _, now := newTestAPIKeyService()
+
+	revoked, _ := svc.Create("bot-1", "admin-1", "revoked", []string{ScopeRoomsRead}, 0)
+	if err := svc.Revoke("bot-1", revoked.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := svc.Authenticate(revoked.Key); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("expected ErrInvalidAPIKey for a revoked key, got %v", err)
+	}
+	if err := svc.Revoke("bot-1", revoked.ID); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("expected ErrAPIKeyNotFound revoking twice, got %v", err)
+	}
+
+	expiring, _ := svc.Create("bot-1", "admin-1", "expiring", []string{ScopeRoomsRead}, time.Hour)
+	*now = now.Add(time.Hour)
+	if _, err := svc.Authenticate(expiring.Key); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("expected ErrInvalidAPIKey for an expired key, got %v", err)
+	}
+}
+
+func TestAPIKeyService_Revoke_OtherUsersKey(t *testing.T) {
+	svc, _, _ := newTestAPIKeyService()
+	key, _ := svc.Create("bot-1", "admin-1", "reader", []string{ScopeRoomsRead}, 0)
+
+	if err := svc.Revoke("user-2", key.ID); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("expected ErrAPIKeyNotFound, got %v", err)
+	}
+	if _, err := svc.Authenticate(key.Key); err != nil {
+		t.Errorf("expected key to still work, got %v", err)
+	}
+}
+
+func TestAPIKeyService_Create_Limits(t *testing.T) {
+	svc, _, _ := newTestAPIKeyService()
+
+	if _, err := svc.Create("bot-1", "admin-1", "bad", []string{"rooms:delete"}, 0); !errors.Is(err, ErrInvalidScope) {
+		t.Errorf("expected ErrInvalidScope, got %v", err)
+	}
+
+	for i := 0; i < maxAPIKeysPerUser; i++ {
+		if _, err := svc.Create("bot-1", "admin-1", "key", []string{ScopeRoomsRead}, 0); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if _, err := svc.Create("bot-1", "admin-1", "key", []string{ScopeRoomsRead}, 0); !errors.Is(err, ErrTooManyAPIKeys) {
+		t.Errorf("expected ErrTooManyAPIKeys, got %v", err)
+	}
+}
+
+func TestAuthService_CreateBot_CannotLogin(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewAuthService(repo, DefaultPasswordPolicy())
+
+	bot, err := svc.CreateBot("Announcer", "")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !bot.Bot || bot.Role != RoleUser || bot.VerifiedAt == nil {
+		t.Errorf("unexpected bot %+v", bot)
+	}
+
+	if _, err := svc.Login(&LoginRequest{Email: bot.Email, Password: ""}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("expected ErrInvalidCredentials, got %v", err)
+	}
+}
+
+func TestHandler_AuthMiddleware_APIKeyScopes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	svc, _, _ := newTestAPIKeyService()
+	h := NewHandler(nil, NewJWTService("test-secret"), nil, nil, newMockRevocationStore(), nil, nil, nil, nil, svc)
+
+	key, _ := svc.Create("bot-1", "admin-1", "reader", []string{ScopeRoomsRead}, 0)
+	token, err := h.generateToken(context.Background(), &User{ID: "user-123", Username: "testuser"}, "session-1", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	r := gin.New()
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/read", h.AuthMiddleware(ScopeRoomsRead), ok)
+	r.GET("/write", h.AuthMiddleware(ScopeMessagesWrite), ok)
+	r.GET("/user-only", h.AuthMiddleware(), ok)
+
+	for _, tt := range []struct {
+		path, token string
+		want        int
+	}{
+		{"/read", key.Key, http.StatusOK},
+		{"/write", key.Key, http.StatusForbidden},
+		{"/user-only", key.Key, http.StatusForbidden},
+		{"/user-only", token, http.StatusOK},
+		{"/write", token, http.StatusOK},
+		{"/read", "gcm_unknown", http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s with %.8s...: expected status %d, got %d", tt.path, tt.token, tt.want, w.Code)
+		}
+	}
+}
+
+func TestHandler_RevokeAPIKey_ClosesConnections(t *testing.T) {
+	svc, _, _ := newTestAPIKeyService()
+	store := newMockRevocationStore()
+	h := NewHandler(nil, NewJWTService("test-secret"), nil, nil, store, nil, nil, nil, nil, svc)
+
+	key, _ := svc.Create("bot-1", "admin-1", "reader", []string{ScopeRoomsRead}, 0)
+	claims, _ := svc.Authenticate(key.Key)
+
+	if err := h.RevokeAPIKey(context.Background(), "bot-1", key.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(store.events) != 1 || !store.events[0].Matches(claims) {
+		t.Fatalf("expected an event matching the key's connections, got %+v", store.events)
+	}
+	other := &Claims{UserID: "bot-1", APIKeyID: "key-other"}
+	if store.events[0].Matches(other) {
+		t.Error("expected other keys' connections to stay open")
+	}
+}
@@ -0,0 +1,261 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/mr1hm/go-chat-moderator/internal/shared/blob"
+)
+
+var (
+	ErrAvatarsDisabled  = errors.New("avatar uploads are not configured")
+	ErrNoAvatar         = errors.New("user has no avatar")
+	ErrAvatarTooLarge   = errors.New("avatar file is too large")
+	ErrAvatarType       = errors.New("avatar must be a PNG, JPEG or GIF image")
+	ErrAvatarDimensions = errors.New("avatar image is too large")
+)
+
+// AvatarPolicy limits uploaded avatars
+type AvatarPolicy struct {
+	MaxBytes     int64
+	MaxDimension int // Largest width or height in pixels
+}
+
+// Image formats accepted as avatars, by image.DecodeConfig format name
+var avatarFormats = map[string]struct {
+	contentType string
+	ext         string
+}{
+	"png":  {"image/png", ".png"},
+	"jpeg": {"image/jpeg", ".jpg"},
+	"gif":  {"image/gif", ".gif"},
+}
+
+// SetAvatarStore enables avatar uploads
+func (s *AuthService) SetAvatarStore(store blob.Store, policy AvatarPolicy) {
+	s.avatars = store
+	s.avatarPolicy = policy
+}
+
+// validateAvatar checks an upload's size, that its bytes are really an
+// accepted image type, and its dimensions. Only the header is decoded, so a
+// small file claiming huge dimensions is refused before any pixels are read.
+// It returns the image format.
+func (p AvatarPolicy) validateAvatar(data []byte) (string, error) {
+	if int64(len(data)) > p.MaxBytes {
+		return "", ErrAvatarTooLarge
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", ErrAvatarType
+	}
+	if _, ok := avatarFormats[format]; !ok {
+		return "", ErrAvatarType
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > p.MaxDimension || cfg.Height > p.MaxDimension {
+		return "", fmt.Errorf("%w: at most %dx%d pixels", ErrAvatarDimensions, p.MaxDimension, p.MaxDimension)
+	}
+
+	return format, nil
+}
+
+// SetAvatar stores a new avatar for a user and removes the previous one
+func (s *AuthService) SetAvatar(ctx context.Context, userID string, data []byte) (*User, error) {
+	if s.avatars == nil {
+		return nil, ErrAvatarsDisabled
+	}
+	user, err := s.repo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	format, err := s.avatarPolicy.validateAvatar(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// A new key per upload changes the avatar URL, so clients don't keep
+	// showing a cached old image
+	key := "avatars/" + userID + "/" + uuid.New().String() + avatarFormats[format].ext
+	if err := s.avatars.Put(ctx, key, bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("error while storing avatar: %w", err)
+	}
+	previous := user.AvatarKey
+	if err := s.repo.UpdateAvatar(userID, key); err != nil {
+		s.deleteAvatar(ctx, key)
+		return nil, err
+	}
+	s.deleteAvatar(ctx, previous)
+
+	user.AvatarKey = key
+	user.AvatarURL = avatarURL(userID, key)
+	return user, nil
+}
+
+// RemoveAvatar clears a user's avatar
+func (s *AuthService) RemoveAvatar(ctx context.Context, userID string) (*User, error) {
+	user, err := s.repo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	previous := user.AvatarKey
+	if previous == "" {
+		return user, nil
+	}
+
+	if err := s.repo.UpdateAvatar(userID, ""); err != nil {
+		return nil, err
+	}
+	s.deleteAvatar(ctx, previous)
+
+	user.AvatarKey = ""
+	user.AvatarURL = ""
+	return user, nil
+}
+
+// OpenAvatar returns a user's avatar and its content type
+func (s *AuthService) OpenAvatar(ctx context.Context, userID string) (io.ReadCloser, string, error) {
+	if s.avatars == nil {
+		return nil, "", ErrNoAvatar
+	}
+	user, err := s.repo.FindByID(userID)
+	if err != nil {
+		return nil, "", err
+	}
+	if user.AvatarKey == "" {
+		return nil, "", ErrNoAvatar
+	}
+
+	r, err := s.avatars.Get(ctx, user.AvatarKey)
+	if errors.Is(err, blob.ErrNotFound) {
+		return nil, "", ErrNoAvatar
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	contentType := "application/octet-stream"
+	for _, f := range avatarFormats {
+		if f.ext == path.Ext(user.AvatarKey) {
+			contentType = f.contentType
+		}
+	}
+	return r, contentType, nil
+}
+
+// deleteAvatar removes a stored avatar. Failures only leave an orphaned file.
+func (s *AuthService) deleteAvatar(ctx context.Context, key string) {
+	if key == "" || s.avatars == nil {
+		return
+	}
+	if err := s.avatars.Delete(ctx, key); err != nil {
+		log.Printf("error while deleting avatar %s: %v", key, err)
+	}
+}
+
+// avatarURL is where a user's avatar is served. The version changes with
+// every upload so clients refetch.
+func avatarURL(userID, key string) string {
+	if key == "" {
+		return ""
+	}
+	version := strings.TrimSuffix(path.Base(key), path.Ext(key))
+	return "/users/" + userID + "/avatar?v=" + version
+}
+
+// UploadAvatar sets the current user's avatar from the "avatar" field of a
+// multipart form
+func (h *Handler) UploadAvatar(c *gin.Context) {
+	claims := c.MustGet("claims").(*Claims)
+	maxBytes := h.service.avatarPolicy.MaxBytes
+
+	// Leave room for the multipart framing; the file itself is checked below
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+64<<10)
+	fh, err := c.FormFile("avatar")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			abortProfileError(c, ErrAvatarTooLarge)
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "avatar file missing",
+		})
+		return
+	}
+	if fh.Size > maxBytes {
+		abortProfileError(c, ErrAvatarTooLarge)
+		return
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		abortProfileError(c, err)
+		return
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxBytes+1))
+	if err != nil {
+		abortProfileError(c, err)
+		return
+	}
+
+	user, err := h.service.SetAvatar(c.Request.Context(), claims.UserID, data)
+	if err != nil {
+		abortProfileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+func (h *Handler) DeleteAvatar(c *gin.Context) {
+	claims := c.MustGet("claims").(*Claims)
+
+	user, err := h.service.RemoveAvatar(c.Request.Context(), claims.UserID)
+	if err != nil {
+		abortProfileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// GetAvatar serves a user's avatar. It needs no login so it works in <img>
+// tags; avatars are public like the rest of the profile.
+func (h *Handler) GetAvatar(c *gin.Context) {
+	r, contentType, err := h.service.OpenAvatar(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, ErrNoAvatar) || errors.Is(err, ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": ErrNoAvatar.Error(),
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("error while opening avatar: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to load avatar",
+		})
+		return
+	}
+	defer r.Close()
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Security-Policy", "default-src 'none'")
+	c.DataFromReader(http.StatusOK, -1, contentType, r, nil)
+}
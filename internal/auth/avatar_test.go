@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mr1hm/go-chat-moderator/internal/shared/blob"
+)
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestAvatarPolicy_Validate(t *testing.T) {
+	policy := AvatarPolicy{MaxBytes: 4096, MaxDimension: 64}
+
+	if format, err := policy.validateAvatar(encodePNG(t, 32, 32)); err != nil || format != "png" {
+		t.Errorf("expected png, got %q %v", format, err)
+	}
+	if _, err := policy.validateAvatar(encodePNG(t, 65, 10)); !errors.Is(err, ErrAvatarDimensions) {
+		t.Errorf("expected ErrAvatarDimensions, got %v", err)
+	}
+	if _, err := policy.validateAvatar([]byte("<svg xmlns='http://www.w3.org/2000/svg'/>")); !errors.Is(err, ErrAvatarType) {
+		t.Errorf("expected ErrAvatarType, got %v", err)
+	}
+	if _, err := policy.validateAvatar(make([]byte, 4097)); !errors.Is(err, ErrAvatarTooLarge) {
+		t.Errorf("expected ErrAvatarTooLarge, got %v", err)
+	}
+}
+
+func TestAuthService_SetAvatar(t *testing.T) {
+	svc, repo, user := newTestProfileService(t)
+	ctx := context.Background()
+
+	if _, err := svc.SetAvatar(ctx, user.ID, encodePNG(t, 8, 8)); !errors.Is(err, ErrAvatarsDisabled) {
+		t.Errorf("expected ErrAvatarsDisabled, got %v", err)
+	}
+
+	dir := t.TempDir()
+	svc.SetAvatarStore(blob.NewLocalStore(dir), AvatarPolicy{MaxBytes: 4096, MaxDimension: 64})
+
+	first, err := svc.SetAvatar(ctx, user.ID, encodePNG(t, 8, 8))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	firstKey, firstURL := first.AvatarKey, first.AvatarURL
+	if firstURL == "" || repo.users[user.ID].AvatarKey != firstKey {
+		t.Fatalf("expected avatar to be recorded, got %+v", repo.users[user.ID])
+	}
+
+	second, err := svc.SetAvatar(ctx, user.ID, encodePNG(t, 16, 16))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if second.AvatarURL == firstURL {
+		t.Error("expected a new avatar URL")
+	}
+	if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(firstKey))); !os.IsNotExist(err) {
+		t.Error("expected the previous avatar to be deleted")
+	}
+
+	r, contentType, err := svc.OpenAvatar(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if contentType != "image/png" || !bytes.Equal(data, encodePNG(t, 16, 16)) {
+		t.Errorf("unexpected avatar %s (%d bytes)", contentType, len(data))
+	}
+
+	if _, err := svc.RemoveAvatar(ctx, user.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, _, err := svc.OpenAvatar(ctx, user.ID); !errors.Is(err, ErrNoAvatar) {
+		t.Errorf("expected ErrNoAvatar, got %v", err)
+	}
+}
@@ -1,23 +1,48 @@
 package auth
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mr1hm/go-chat-moderator/internal/shared/mail"
+	"github.com/mr1hm/go-chat-moderator/internal/shared/ratelimit"
 )
 
 type Handler struct {
-	service    *AuthService
-	jwtService *JWTService
+	service        *AuthService
+	jwtService     *JWTService
+	refreshService *RefreshService
+	sessions       SessionRepository
+	revocations    RevocationStore
+	resetService   *PasswordResetService
+	verifyService  *VerificationService
+	mfaService     *MFAService
+	lockouts       *LockoutService
+	apiKeys        *APIKeyService
+	onRoleChange   []func(*RoleChangeEvent)
 }
 
-func NewHandler(service *AuthService, jwtService *JWTService) *Handler {
+func NewHandler(service *AuthService, jwtService *JWTService, refreshService *RefreshService, sessions SessionRepository, revocations RevocationStore, resetService *PasswordResetService, verifyService *VerificationService, mfaService *MFAService, lockouts *LockoutService, apiKeys *APIKeyService) *Handler {
 	return &Handler{
-		service:    service,
-		jwtService: jwtService,
+		service:        service,
+		jwtService:     jwtService,
+		refreshService: refreshService,
+		sessions:       sessions,
+		revocations:    revocations,
+		resetService:   resetService,
+		verifyService:  verifyService,
+		mfaService:     mfaService,
+		lockouts:       lockouts,
+		apiKeys:        apiKeys,
 	}
 }
 
@@ -40,6 +65,15 @@ func (h *Handler) Register(c *gin.Context) {
 			c.JSON(http.StatusConflict, gin.H{
 				"error": ErrUsernameExists.Error(),
 			})
+		} else if errors.Is(err, ErrWeakPassword) || errors.Is(err, ErrUsernameRejected) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+		} else if errors.Is(err, ErrContentCheck) {
+			log.Printf("error while checking username: %v", err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "couldn't check username, try again later",
+			})
 		} else {
 			fmt.Printf("error: %v\n", err)
 			c.JSON(http.StatusInternalServerError, gin.H{
@@ -49,7 +83,13 @@ func (h *Handler) Register(c *gin.Context) {
 		return
 	}
 
-	token, err := h.jwtService.Generate(user.ID, user.Username)
+	go func(user *User) {
+		if err := h.verifyService.Send(context.Background(), user); err != nil {
+			log.Printf("error while sending verification email: %v", err)
+		}
+	}(user)
+
+	resp, err := h.startSession(c, user, false)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "failed to generate token",
@@ -57,10 +97,7 @@ func (h *Handler) Register(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, AuthResponse{
-		Token: token,
-		User:  *user,
-	})
+	c.JSON(http.StatusCreated, resp)
 }
 
 func (h *Handler) Login(c *gin.Context) {
@@ -72,7 +109,111 @@ func (h *Handler) Login(c *gin.Context) {
 		return
 	}
 
+	ctx := c.Request.Context()
+	ip := c.ClientIP()
+
+	if err := h.lockouts.Check(ctx, req.Email, ip); err != nil {
+		var throttled *ThrottleError
+		if errors.As(err, &throttled) {
+			abortThrottled(c, throttled)
+			return
+		}
+		log.Printf("error while checking login throttling: %v", err)
+	}
+
 	user, err := h.service.Login(&req)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			if _, err := h.lockouts.Fail(ctx, req.Email, ip); err != nil {
+				log.Printf("error while recording failed login: %v", err)
+			}
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "invalid credentials",
+		})
+		return
+	}
+
+	enabled, err := h.mfaService.Enabled(user.ID)
+	if err != nil {
+		log.Printf("error while checking two-factor enrollment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "login failed",
+		})
+		return
+	}
+
+	// The password checked out; tokens wait for the second factor, and
+	// failures are only cleared once it's given
+	if enabled {
+		mfaToken, err := h.mfaService.Challenge(ctx, user.ID)
+		if err != nil {
+			log.Printf("error while creating mfa challenge: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "login failed",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, MFAChallenge{
+			MFARequired: true,
+			MFAToken:    mfaToken,
+		})
+		return
+	}
+
+	if err := h.lockouts.Succeed(ctx, user.Email); err != nil {
+		log.Printf("error while clearing failed logins: %v", err)
+	}
+
+	resp, err := h.startSession(c, user, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to generate token",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// LoginMFA completes a login that Login answered with an mfa_token
+func (h *Handler) LoginMFA(c *gin.Context) {
+	var req MFALoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	ip := c.ClientIP()
+
+	userID, err := h.mfaService.CompleteChallenge(ctx, req.MFAToken, req.Code)
+	if err != nil {
+		// Wrong codes count towards the account's lockout like wrong passwords
+		if errors.Is(err, ErrInvalidMFACode) {
+			if user, err := h.service.GetUser(userID); err == nil {
+				if _, err := h.lockouts.Fail(ctx, user.Email, ip); err != nil {
+					log.Printf("error while recording failed login: %v", err)
+				}
+			}
+		}
+		if errors.Is(err, ErrInvalidMFAToken) || errors.Is(err, ErrInvalidMFACode) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+		} else {
+			log.Printf("error while completing mfa challenge: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "login failed",
+			})
+		}
+		return
+	}
+
+	user, err := h.service.GetUser(userID)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"error": "invalid credentials",
@@ -80,7 +221,71 @@ func (h *Handler) Login(c *gin.Context) {
 		return
 	}
 
-	token, err := h.jwtService.Generate(user.ID, user.Username)
+	// The account may have been locked while this challenge was pending
+	if err := h.lockouts.Check(ctx, user.Email, ip); err != nil {
+		var throttled *ThrottleError
+		if errors.As(err, &throttled) && errors.Is(err, ErrAccountLocked) {
+			abortThrottled(c, throttled)
+			return
+		}
+	}
+
+	if err := h.lockouts.Succeed(ctx, user.Email); err != nil {
+		log.Printf("error while clearing failed logins: %v", err)
+	}
+
+	resp, err := h.startSession(c, user, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to generate token",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// Refresh exchanges a refresh token for a new access token and a rotated refresh token
+func (h *Handler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	consumed, next, err := h.refreshService.Rotate(req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, ErrRefreshTokenReused) {
+			log.Printf("refresh token reuse detected, family revoked")
+		} else if !errors.Is(err, ErrInvalidRefreshToken) {
+			log.Printf("error while rotating refresh token: %v", err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": ErrInvalidRefreshToken.Error(),
+		})
+		return
+	}
+
+	user, err := h.service.GetUser(consumed.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": ErrInvalidRefreshToken.Error(),
+		})
+		return
+	}
+
+	// Logins from before sessions were recorded have no session row
+	var mfa bool
+	if session, err := h.sessions.FindByID(consumed.FamilyID); err == nil {
+		mfa = session.MFA
+	} else if !errors.Is(err, ErrSessionNotFound) {
+		log.Printf("error while finding session: %v", err)
+	}
+
+	// The refresh token family is the session
+	token, err := h.generateToken(c.Request.Context(), user, consumed.FamilyID, mfa)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "failed to generate token",
@@ -88,12 +293,536 @@ func (h *Handler) Login(c *gin.Context) {
 		return
 	}
 
+	if err := h.sessions.Touch(consumed.FamilyID); err != nil {
+		log.Printf("error while touching session: %v", err)
+	}
+
 	c.JSON(http.StatusOK, AuthResponse{
-		Token: token,
-		User:  *user,
+		Token:        token,
+		RefreshToken: next,
+		User:         *user,
+	})
+}
+
+// Logout revokes the access token used for this request and ends its session.
+// Tokens issued before sessions existed end the login of the given refresh token.
+func (h *Handler) Logout(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	claims := c.MustGet("claims").(*Claims)
+	ctx := c.Request.Context()
+
+	if err := h.revocations.RevokeToken(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+		log.Printf("error while revoking token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to log out",
+		})
+		return
+	}
+
+	if req.RefreshToken != "" {
+		if err := h.refreshService.Revoke(req.RefreshToken); err != nil && !errors.Is(err, ErrInvalidRefreshToken) {
+			log.Printf("error while revoking refresh token: %v", err)
+		}
+	}
+
+	event := &RevocationEvent{UserID: claims.UserID, TokenID: claims.ID}
+	if claims.SessionID != "" {
+		if err := h.revokeSession(ctx, claims.SessionID); err != nil {
+			log.Printf("error while revoking session: %v", err)
+		}
+		event = &RevocationEvent{UserID: claims.UserID, SessionID: claims.SessionID}
+	}
+
+	if err := h.revocations.Publish(ctx, event); err != nil {
+		log.Printf("error while publishing revocation: %v", err)
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// LogoutAll invalidates every access and refresh token the user holds
+func (h *Handler) LogoutAll(c *gin.Context) {
+	claims := c.MustGet("claims").(*Claims)
+
+	if err := h.revokeAllSessions(c.Request.Context(), claims.UserID); err != nil {
+		log.Printf("error while revoking sessions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to log out",
+		})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RequestPasswordReset emails a reset link. The response is the same whether
+// or not the email is registered, and mail is sent in the background so
+// response time doesn't give it away either.
+func (h *Handler) RequestPasswordReset(c *gin.Context) {
+	var req PasswordResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	allowed, err := ratelimit.Allow(c.Request.Context(), "password_reset:"+c.ClientIP(), 5, 15*time.Minute)
+	if err != nil {
+		log.Printf("error while checking rate limit: %v", err)
+	}
+	if !allowed && err == nil {
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error": "too many reset requests, try again later",
+		})
+		return
+	}
+
+	go func(email string) {
+		if err := h.resetService.Request(context.Background(), email); err != nil {
+			log.Printf("error while requesting password reset: %v", err)
+		}
+	}(req.Email)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "if the email is registered, a reset link has been sent",
+	})
+}
+
+// ConfirmPasswordReset sets a new password from a reset link and logs the
+// user out everywhere
+func (h *Handler) ConfirmPasswordReset(c *gin.Context) {
+	var req PasswordResetConfirmRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	userID, err := h.resetService.Reset(req.Token, req.Password)
+	if err != nil {
+		if errors.Is(err, ErrInvalidUserToken) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": ErrInvalidUserToken.Error(),
+			})
+		} else if errors.Is(err, ErrWeakPassword) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+		} else {
+			log.Printf("error while resetting password: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to reset password",
+			})
+		}
+		return
+	}
+
+	if err := h.revokeAllSessions(c.Request.Context(), userID); err != nil {
+		log.Printf("error while revoking sessions after password reset: %v", err)
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// UnlockAccount lifts a login lockout from an emailed link
+func (h *Handler) UnlockAccount(c *gin.Context) {
+	var req UnlockAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if _, err := h.lockouts.ConfirmUnlock(c.Request.Context(), req.Token); err != nil {
+		if errors.Is(err, ErrInvalidUserToken) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": ErrInvalidUserToken.Error(),
+			})
+		} else {
+			log.Printf("error while unlocking account: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to unlock account",
+			})
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// abortThrottled refuses a login with 423 for locked accounts and 429
+// otherwise, telling the client when to retry
+func abortThrottled(c *gin.Context, err *ThrottleError) {
+	status := http.StatusTooManyRequests
+	if errors.Is(err, ErrAccountLocked) {
+		status = http.StatusLocked
+	}
+
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(err.RetryAfter.Seconds()))))
+	c.AbortWithStatusJSON(status, gin.H{
+		"error": err.Error(),
 	})
 }
 
+// VerifyEmail confirms an address from an emailed link. Tokens issued before
+// this carry email_verified=false until the client refreshes.
+func (h *Handler) VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if _, err := h.verifyService.Confirm(req.Token); err != nil {
+		if errors.Is(err, ErrInvalidUserToken) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": ErrInvalidUserToken.Error(),
+			})
+		} else {
+			log.Printf("error while verifying email: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to verify email",
+			})
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ResendVerification emails the current user a fresh verification link
+func (h *Handler) ResendVerification(c *gin.Context) {
+	claims := c.MustGet("claims").(*Claims)
+	ctx := c.Request.Context()
+
+	user, err := h.service.GetUser(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "user not found",
+		})
+		return
+	}
+	if user.VerifiedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": ErrAlreadyVerified.Error(),
+		})
+		return
+	}
+
+	allowed, err := ratelimit.Allow(ctx, "verify_email:"+user.ID, 3, 15*time.Minute)
+	if err != nil {
+		log.Printf("error while checking rate limit: %v", err)
+	}
+	if !allowed && err == nil {
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error": "too many verification emails, try again later",
+		})
+		return
+	}
+
+	if err := h.verifyService.Send(ctx, user); err != nil {
+		log.Printf("error while sending verification email: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to send verification email",
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "verification email sent",
+	})
+}
+
+// EnrollMFA starts TOTP enrollment for the current user
+func (h *Handler) EnrollMFA(c *gin.Context) {
+	claims := c.MustGet("claims").(*Claims)
+
+	user, err := h.service.GetUser(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "user not found",
+		})
+		return
+	}
+
+	enrollment, err := h.mfaService.Enroll(user)
+	if err != nil {
+		if errors.Is(err, ErrMFAAlreadyEnabled) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": ErrMFAAlreadyEnabled.Error(),
+			})
+		} else {
+			log.Printf("error while enrolling mfa: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to enroll two-factor authentication",
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// ConfirmMFA activates enrollment with a first code and returns the recovery
+// codes. Existing sessions keep mfa=false until the user logs in again.
+func (h *Handler) ConfirmMFA(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	claims := c.MustGet("claims").(*Claims)
+
+	codes, err := h.mfaService.Confirm(claims.UserID, req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrMFANotEnrolled):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": ErrMFANotEnrolled.Error(),
+			})
+		case errors.Is(err, ErrMFAAlreadyEnabled):
+			c.JSON(http.StatusConflict, gin.H{
+				"error": ErrMFAAlreadyEnabled.Error(),
+			})
+		case errors.Is(err, ErrInvalidMFACode):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": ErrInvalidMFACode.Error(),
+			})
+		default:
+			log.Printf("error while confirming mfa: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to confirm two-factor authentication",
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"recovery_codes": codes,
+	})
+}
+
+// DisableMFA turns off two-factor authentication after checking a code
+func (h *Handler) DisableMFA(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	claims := c.MustGet("claims").(*Claims)
+
+	user, err := h.service.GetUser(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "user not found",
+		})
+		return
+	}
+
+	if err := h.mfaService.Disable(user, req.Code); err != nil {
+		switch {
+		case errors.Is(err, ErrMFANotEnrolled):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": ErrMFANotEnrolled.Error(),
+			})
+		case errors.Is(err, ErrMFARequired):
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "two-factor authentication is required for your role",
+			})
+		case errors.Is(err, ErrInvalidMFACode):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": ErrInvalidMFACode.Error(),
+			})
+		default:
+			log.Printf("error while disabling mfa: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to disable two-factor authentication",
+			})
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// InvalidateAccessTokens rejects every outstanding access token of a user
+// and closes their websockets without ending their sessions, so clients
+// refresh and pick up changed claims such as a new role
+func (h *Handler) InvalidateAccessTokens(ctx context.Context, userID string) error {
+	version, err := h.revocations.BumpTokenVersion(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("error while bumping token version: %w", err)
+	}
+
+	if err := h.revocations.Publish(ctx, &RevocationEvent{UserID: userID, TokenVersion: version}); err != nil {
+		log.Printf("error while publishing revocation: %v", err)
+	}
+
+	return nil
+}
+
+// revokeAllSessions invalidates every access and refresh token of a user and
+// closes their websockets
+func (h *Handler) revokeAllSessions(ctx context.Context, userID string) error {
+	version, err := h.revocations.BumpTokenVersion(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("error while bumping token version: %w", err)
+	}
+
+	if err := h.refreshService.RevokeUser(userID); err != nil {
+		log.Printf("error while revoking refresh tokens: %v", err)
+	}
+	if err := h.sessions.RevokeUser(userID); err != nil {
+		log.Printf("error while revoking sessions: %v", err)
+	}
+
+	if err := h.revocations.Publish(ctx, &RevocationEvent{UserID: userID, TokenVersion: version}); err != nil {
+		log.Printf("error while publishing revocation: %v", err)
+	}
+
+	return nil
+}
+
+// ListSessions returns the current user's active logins
+func (h *Handler) ListSessions(c *gin.Context) {
+	claims := c.MustGet("claims").(*Claims)
+
+	sessions, err := h.sessions.ListActive(claims.UserID)
+	if err != nil {
+		log.Printf("error while listing sessions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to list sessions",
+		})
+		return
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == claims.SessionID
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSession ends one of the current user's logins and closes its websockets
+func (h *Handler) RevokeSession(c *gin.Context) {
+	claims := c.MustGet("claims").(*Claims)
+	ctx := c.Request.Context()
+
+	session, err := h.sessions.FindByID(c.Param("id"))
+	if errors.Is(err, ErrSessionNotFound) || (err == nil && session.UserID != claims.UserID) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": ErrSessionNotFound.Error(),
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("error while finding session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to revoke session",
+		})
+		return
+	}
+
+	if err := h.revokeSession(ctx, session.ID); err != nil {
+		log.Printf("error while revoking session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to revoke session",
+		})
+		return
+	}
+
+	if err := h.revocations.Publish(ctx, &RevocationEvent{UserID: claims.UserID, SessionID: session.ID}); err != nil {
+		log.Printf("error while publishing revocation: %v", err)
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// revokeSession marks a session revoked, revokes its refresh tokens and
+// denylists its outstanding access tokens
+func (h *Handler) revokeSession(ctx context.Context, sessionID string) error {
+	if err := h.sessions.Revoke(sessionID); err != nil {
+		return fmt.Errorf("error while revoking session: %w", err)
+	}
+	if err := h.refreshService.RevokeFamily(sessionID); err != nil {
+		return fmt.Errorf("error while revoking refresh tokens: %w", err)
+	}
+	return h.revocations.RevokeSession(ctx, sessionID, h.jwtService.Expiration())
+}
+
+// startSession records a new login from the requesting device and issues its tokens
+func (h *Handler) startSession(c *gin.Context, user *User, mfa bool) (*AuthResponse, error) {
+	session := &Session{
+		UserID:    user.ID,
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+		MFA:       mfa,
+	}
+	if err := h.sessions.Create(session); err != nil {
+		return nil, fmt.Errorf("error while creating session: %w", err)
+	}
+
+	return h.issueTokens(c.Request.Context(), user, session.ID, mfa)
+}
+
+// generateToken signs an access token for a session, stamped with the user's
+// current token version
+func (h *Handler) generateToken(ctx context.Context, user *User, sessionID string, mfa bool) (string, error) {
+	version, err := h.revocations.TokenVersion(ctx, user.ID)
+	if err != nil {
+		return "", fmt.Errorf("error while getting token version: %w", err)
+	}
+
+	return h.jwtService.GenerateClaims(&Claims{
+		UserID:       user.ID,
+		Username:     user.Username,
+		TokenVersion: version,
+		SessionID:    sessionID,
+		Verified:     user.VerifiedAt != nil,
+		Role:         user.Role,
+		MFA:          mfa,
+	})
+}
+
+// issueTokens creates an access token and a refresh token for a session
+func (h *Handler) issueTokens(ctx context.Context, user *User, sessionID string, mfa bool) (*AuthResponse, error) {
+	token, err := h.generateToken(ctx, user, sessionID, mfa)
+	if err != nil {
+		return nil, err
+	}
+
+	refresh, err := h.refreshService.Issue(user.ID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthResponse{
+		Token:        token,
+		RefreshToken: refresh,
+		User:         *user,
+	}, nil
+}
+
 func (h *Handler) Profile(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -114,8 +843,9 @@ func (h *Handler) Profile(c *gin.Context) {
 	c.JSON(http.StatusOK, user)
 }
 
-// Middleware
-func (h *Handler) AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware requires an access token, or an API key holding every one
+// of scopes. Routes that name no scopes refuse API keys.
+func (h *Handler) AuthMiddleware(scopes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -126,7 +856,7 @@ func (h *Handler) AuthMiddleware() gin.HandlerFunc {
 		}
 
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		claims, err := h.jwtService.Validate(tokenString)
+		claims, err := h.Authenticate(c.Request.Context(), tokenString)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 				"error": "invalid token",
@@ -134,20 +864,123 @@ func (h *Handler) AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		if claims.APIKeyID != "" && !allowsKey(claims, scopes) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "api key not allowed here",
+			})
+			return
+		}
+
 		c.Set("user_id", claims.UserID)
+		c.Set("claims", claims)
 		c.Next()
 	}
 }
 
-func RegisterRoutes(r *gin.Engine, jwtSecret string) *Handler {
+func allowsKey(claims *Claims, scopes []string) bool {
+	if len(scopes) == 0 {
+		return false
+	}
+	for _, scope := range scopes {
+		if !claims.HasScope(scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// Authenticate validates an access token and checks it hasn't been revoked,
+// either individually or by a "log out everywhere". API keys are accepted
+// too; callers must check their scopes with Claims.HasScope.
+func (h *Handler) Authenticate(ctx context.Context, tokenString string) (*Claims, error) {
+	if IsAPIKey(tokenString) {
+		if h.apiKeys == nil {
+			return nil, ErrInvalidAPIKey
+		}
+		return h.apiKeys.Authenticate(tokenString)
+	}
+
+	claims, err := h.jwtService.Validate(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked, err := h.revocations.IsTokenRevoked(ctx, claims.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error while checking token denylist: %w", err)
+	}
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+
+	if claims.SessionID != "" {
+		revoked, err := h.revocations.IsSessionRevoked(ctx, claims.SessionID)
+		if err != nil {
+			return nil, fmt.Errorf("error while checking session denylist: %w", err)
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
+	}
+
+	version, err := h.revocations.TokenVersion(ctx, claims.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("error while getting token version: %w", err)
+	}
+	if claims.TokenVersion < version {
+		return nil, ErrTokenRevoked
+	}
+
+	return claims, nil
+}
+
+// JWKS serves the public keys tokens are verified with
+func (h *Handler) JWKS(c *gin.Context) {
+	c.JSON(http.StatusOK, h.jwtService.JWKS())
+}
+
+func RegisterRoutes(r *gin.Engine, jwtService *JWTService, mailer mail.Mailer, appURL string, passwords *PasswordPolicy, logins *LoginPolicy) *Handler {
 	repo := NewUserRepository()
-	service := NewAuthService(repo)
-	jwtService := NewJWTService(jwtSecret)
-	handler := NewHandler(service, jwtService)
+	service := NewAuthService(repo, passwords)
+	refreshService := NewRefreshService(NewRefreshTokenRepository())
+	tokenRepo := NewUserTokenRepository()
+	resetService := NewPasswordResetService(repo, tokenRepo, mailer, appURL, passwords)
+	verifyService := NewVerificationService(repo, tokenRepo, mailer, appURL)
+	mfaService := NewMFAService(NewMFARepository(), NewSettingsRepository(), NewMFAChallengeStore())
+	lockouts := NewLockoutService(NewLoginAttemptStore(), logins, repo, tokenRepo, mailer, appURL)
+	apiKeys := NewAPIKeyService(NewAPIKeyRepository(), repo)
+	handler := NewHandler(service, jwtService, refreshService, NewSessionRepository(), NewRevocationStore(), resetService, verifyService, mfaService, lockouts, apiKeys)
 
+	r.GET("/.well-known/jwks.json", handler.JWKS)
 	r.POST("/register", handler.Register)
 	r.POST("/login", handler.Login)
+	r.POST("/login/mfa", handler.LoginMFA)
+	r.POST("/token/refresh", handler.Refresh)
+	r.POST("/password/reset", handler.RequestPasswordReset)
+	r.POST("/password/reset/confirm", handler.ConfirmPasswordReset)
+	r.POST("/account/unlock", handler.UnlockAccount)
+	r.POST("/verify-email", handler.VerifyEmail)
+	r.POST("/verify-email/resend", handler.AuthMiddleware(), handler.ResendVerification)
+	r.POST("/logout", handler.AuthMiddleware(), handler.Logout)
+	r.POST("/logout/all", handler.AuthMiddleware(), handler.LogoutAll)
 	r.GET("/profile", handler.AuthMiddleware(), handler.Profile)
+	r.PUT("/profile", handler.AuthMiddleware(), handler.UpdateProfile)
+	r.PUT("/profile/avatar", handler.AuthMiddleware(), handler.UploadAvatar)
+	r.DELETE("/profile/avatar", handler.AuthMiddleware(), handler.DeleteAvatar)
+	r.PUT("/profile/username", handler.AuthMiddleware(), handler.UpdateUsername)
+	r.PUT("/profile/email", handler.AuthMiddleware(), handler.UpdateEmail)
+	r.PUT("/profile/password", handler.AuthMiddleware(), handler.ChangePassword)
+	r.DELETE("/profile", handler.AuthMiddleware(), handler.DeleteAccount)
+	r.GET("/users/:id", handler.AuthMiddleware(), handler.GetUser)
+	r.GET("/users/:id/avatar", handler.GetAvatar)
+	r.GET("/sessions", handler.AuthMiddleware(), handler.ListSessions)
+	r.DELETE("/sessions/:id", handler.AuthMiddleware(), handler.RevokeSession)
+	r.POST("/mfa/enroll", handler.AuthMiddleware(), handler.EnrollMFA)
+	r.POST("/mfa/confirm", handler.AuthMiddleware(), handler.ConfirmMFA)
+	r.POST("/mfa/disable", handler.AuthMiddleware(), handler.DisableMFA)
+	r.GET("/api-keys", handler.AuthMiddleware(), handler.ListAPIKeys)
+	r.POST("/api-keys", handler.AuthMiddleware(), handler.CreateAPIKey)
+	r.DELETE("/api-keys/:id", handler.AuthMiddleware(), handler.DeleteAPIKey)
 
 	return handler
 }
@@ -155,3 +988,19 @@ func RegisterRoutes(r *gin.Engine, jwtSecret string) *Handler {
 func (h *Handler) JWTService() *JWTService {
 	return h.jwtService
 }
+
+func (h *Handler) MFAService() *MFAService {
+	return h.mfaService
+}
+
+func (h *Handler) Lockouts() *LockoutService {
+	return h.lockouts
+}
+
+func (h *Handler) Service() *AuthService {
+	return h.service
+}
+
+func (h *Handler) APIKeys() *APIKeyService {
+	return h.apiKeys
+}
@@ -3,51 +3,205 @@ package auth
 import (
 	"errors"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 var ErrInvalidToken = errors.New("invalid token")
 
+// secretKID stands for the HS256 secret in key retirement records
+const secretKID = "hs256"
+
 type Claims struct {
-	UserID   string `json:"user_id"`
-	Username string `json:"username"`
+	UserID       string `json:"user_id"`
+	Username     string `json:"username"`
+	TokenVersion int    `json:"ver"`           // Bumped per user on "log out everywhere"
+	SessionID    string `json:"sid,omitempty"` // Login the token was issued for
+	Verified     bool   `json:"email_verified"`
+	Role         string `json:"role"` // Global role; room roles are looked up per room
+	MFA          bool   `json:"mfa"`  // Session logged in with a second factor
+	Bot          bool   `json:"bot,omitempty"`
+
+	// Set only for requests authenticated with an API key, never signed
+	APIKeyID string   `json:"-"`
+	Scopes   []string `json:"-"`
+
 	jwt.RegisteredClaims
 }
 
+// HasScope reports whether claims allow scope. Only API keys are limited to
+// scopes; access tokens can do anything the user's role allows.
+func (c *Claims) HasScope(scope string) bool {
+	return c.APIKeyID == "" || slices.Contains(c.Scopes, scope)
+}
+
 type JWTService struct {
-	secret     []byte
+	secret     []byte        // HS256 key; signs only when no key set is configured
+	keys       *KeySet       // Asymmetric keys selected by the "kid" header
+	grace      time.Duration // How long a non-active key keeps validating after it was retired
 	expiration time.Duration
+	retiredAt  map[string]time.Time // When each non-active key, or the secret, stopped signing
 }
 
 func NewJWTService(secret string) *JWTService {
 	return &JWTService{
 		secret:     []byte(secret),
-		expiration: 24 * time.Hour,
+		expiration: 15 * time.Minute, // Short-lived; clients renew via /token/refresh
+	}
+}
+
+// NewJWTServiceWithKeys signs with the active key of keys. Tokens signed by
+// any other known key, or by secret (to migrate off HS256), validate until
+// grace after that key was retired. Keys count as retired from now until
+// RecordRetirements loads when they really were. secret may be empty.
+func NewJWTServiceWithKeys(secret string, keys *KeySet, grace time.Duration) *JWTService {
+	s := NewJWTService(secret)
+	s.keys = keys
+	s.grace = grace
+	s.retiredAt = make(map[string]time.Time)
+
+	now := time.Now()
+	for _, kid := range s.retiredKIDs() {
+		s.retiredAt[kid] = now
+	}
+
+	return s
+}
+
+// RecordRetirements stores when each non-active key and the secret were
+// first seen retired, keeping the earliest time across restarts and
+// instances, and validates against those times from then on
+func (s *JWTService) RecordRetirements(repo KeyRetirementRepository) error {
+	if s.keys == nil || s.keys.Active() == nil {
+		return nil
+	}
+
+	// A key made active again starts a fresh retirement when rotated out
+	if err := repo.Reinstate(s.keys.Active().ID); err != nil {
+		return fmt.Errorf("error while reinstating active key: %w", err)
+	}
+
+	retiredAt, err := repo.Retire(s.retiredKIDs(), time.Now())
+	if err != nil {
+		return fmt.Errorf("error while recording key retirements: %w", err)
+	}
+	s.retiredAt = retiredAt
+
+	return nil
+}
+
+// retiredKIDs lists the keys that still verify but no longer sign. Sets
+// without an active key only verify and have nothing to retire.
+func (s *JWTService) retiredKIDs() []string {
+	if s.keys == nil || s.keys.Active() == nil {
+		return nil
+	}
+
+	var kids []string
+	for kid := range s.keys.keys {
+		if kid != s.keys.Active().ID {
+			kids = append(kids, kid)
+		}
 	}
+	if len(s.secret) > 0 {
+		kids = append(kids, secretKID)
+	}
+
+	return kids
+}
+
+// pastGrace reports whether a retired key's grace period is over
+func (s *JWTService) pastGrace(kid string) bool {
+	retiredAt, ok := s.retiredAt[kid]
+	return ok && time.Since(retiredAt) > s.grace
+}
+
+// JWKS returns the public keys tokens may still be verified with, leaving
+// out retired keys past their grace period so verifiers drop them too
+func (s *JWTService) JWKS() JWKS {
+	if s.keys == nil {
+		return JWKS{Keys: []JWK{}}
+	}
+
+	jwks := s.keys.JWKS()
+	jwks.Keys = slices.DeleteFunc(jwks.Keys, func(jwk JWK) bool { return s.pastGrace(jwk.KeyID) })
+
+	return jwks
+}
+
+// Keys returns the asymmetric key set, nil when signing with HS256
+func (s *JWTService) Keys() *KeySet {
+	return s.keys
+}
+
+// Expiration is the lifetime of issued access tokens
+func (s *JWTService) Expiration() time.Duration {
+	return s.expiration
 }
 
 func (s *JWTService) Generate(userID, username string) (string, error) {
-	claims := &Claims{
+	return s.GenerateClaims(&Claims{
 		UserID:   userID,
 		Username: username,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.expiration)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+	})
+}
+
+// GenerateClaims signs the given claims, setting a unique token ID (jti),
+// issued-at and expiry
+func (s *JWTService) GenerateClaims(claims *Claims) (string, error) {
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        uuid.New().String(),
+		ExpiresAt: jwt.NewNumericDate(now.Add(s.expiration)),
+		IssuedAt:  jwt.NewNumericDate(now),
+	}
+
+	if s.keys == nil {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		return token.SignedString(s.secret)
+	}
+
+	active := s.keys.Active()
+	if active == nil {
+		return "", ErrNoSigningKey
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token := jwt.NewWithClaims(active.method(), claims)
+	token.Header["kid"] = active.ID
 
-	return token.SignedString(s.secret)
+	return token.SignedString(active.Private)
 }
 
 func (s *JWTService) Validate(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok || len(s.secret) == 0 {
+				return nil, fmt.Errorf("error while asserting signing method: %w", ErrInvalidToken)
+			}
+			if s.pastGrace(secretKID) {
+				return nil, fmt.Errorf("secret retired past grace period: %w", ErrInvalidToken)
+			}
+			return s.secret, nil
+		}
+
+		if s.keys == nil {
+			return nil, fmt.Errorf("unexpected kid %q: %w", kid, ErrInvalidToken)
+		}
+		key, ok := s.keys.Lookup(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown kid %q: %w", kid, ErrInvalidToken)
+		}
+		// Pin the algorithm to the key so a public key can't be used as an HMAC secret
+		if token.Method.Alg() != key.Algorithm {
 			return nil, fmt.Errorf("error while asserting signing method: %w", ErrInvalidToken)
 		}
-		return s.secret, nil
+		if s.pastGrace(kid) {
+			return nil, fmt.Errorf("kid %q retired past grace period: %w", kid, ErrInvalidToken)
+		}
+		return key.Public, nil
 	})
 	if err != nil {
 		return nil, fmt.Errorf("error while parsing with claims: %w", err)
@@ -98,8 +98,8 @@ func TestJWTService_Claims_ExpirationSet(t *testing.T) {
 		t.Fatal("expected expiration to be set")
 	}
 
-	// Should expire roughly 24 hours from now
-	expectedExpiry := time.Now().Add(24 * time.Hour)
+	// Should expire roughly 15 minutes from now
+	expectedExpiry := time.Now().Add(15 * time.Minute)
 	diff := claims.ExpiresAt.Time.Sub(expectedExpiry)
 
 	if diff > time.Minute || diff < -time.Minute {
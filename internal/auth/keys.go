@@ -0,0 +1,260 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+var ErrNoSigningKey = errors.New("no signing key")
+
+// SigningKey is an asymmetric key identified by the "kid" token header.
+// Private is nil for keys that can only verify.
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	Private   crypto.Signer
+	Public    crypto.PublicKey
+}
+
+// NewSigningKey wraps an RSA or Ed25519 private key
+func NewSigningKey(kid string, private crypto.Signer) (*SigningKey, error) {
+	key, err := NewVerificationKey(kid, private.Public())
+	if err != nil {
+		return nil, err
+	}
+	key.Private = private
+
+	return key, nil
+}
+
+// NewVerificationKey wraps an RSA or Ed25519 public key
+func NewVerificationKey(kid string, public crypto.PublicKey) (*SigningKey, error) {
+	key := &SigningKey{ID: kid, Public: public}
+	switch public.(type) {
+	case *rsa.PublicKey:
+		key.Algorithm = AlgRS256
+	case ed25519.PublicKey:
+		key.Algorithm = AlgEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T for kid %q", public, kid)
+	}
+
+	return key, nil
+}
+
+func (k *SigningKey) method() jwt.SigningMethod {
+	if k.Algorithm == AlgEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+// KeySet holds the key new tokens are signed with and every key tokens may
+// still be verified with
+type KeySet struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+// NewKeySet builds a key set. activeKID may be empty for verify-only sets.
+func NewKeySet(activeKID string, keys ...*SigningKey) (*KeySet, error) {
+	ks := &KeySet{keys: make(map[string]*SigningKey)}
+	for _, key := range keys {
+		ks.keys[key.ID] = key
+	}
+
+	if activeKID != "" {
+		active, ok := ks.keys[activeKID]
+		if !ok || active.Private == nil {
+			return nil, fmt.Errorf("no private key for active kid %q", activeKID)
+		}
+		ks.active = active
+	}
+
+	return ks, nil
+}
+
+// LoadKeySet reads every <kid>.pem in dir. Files may hold a PKCS#8 or PKCS#1
+// private key, or a PKIX public key for keys kept only to verify old tokens.
+// When activeKID is empty the last private key by name is used, so naming
+// files by date rotates to the newest key.
+func LoadKeySet(dir, activeKID string) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	var keys []*SigningKey
+	for _, path := range paths {
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		key, err := loadKeyFile(kid, path)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys found in %s", dir)
+	}
+
+	if activeKID == "" {
+		for i := len(keys) - 1; i >= 0; i-- {
+			if keys[i].Private != nil {
+				activeKID = keys[i].ID
+				break
+			}
+		}
+	}
+
+	return NewKeySet(activeKID, keys...)
+}
+
+func loadKeyFile(kid, path string) (*SigningKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading key %s: %w", path, err)
+	}
+
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block in %s", path)
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("error while parsing key %s: %w", path, err)
+		}
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key in %s", path)
+		}
+		return NewSigningKey(kid, signer)
+	case "RSA PRIVATE KEY":
+		private, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("error while parsing key %s: %w", path, err)
+		}
+		return NewSigningKey(kid, private)
+	case "PUBLIC KEY":
+		public, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("error while parsing key %s: %w", path, err)
+		}
+		return NewVerificationKey(kid, public)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q in %s", block.Type, path)
+	}
+}
+
+// Active returns the key new tokens are signed with, nil for verify-only sets
+func (ks *KeySet) Active() *SigningKey {
+	return ks.active
+}
+
+func (ks *KeySet) Lookup(kid string) (*SigningKey, bool) {
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+// JWK is the public part of a key as served from /.well-known/jwks.json
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	N         string `json:"n,omitempty"`   // RSA modulus
+	E         string `json:"e,omitempty"`   // RSA exponent
+	Curve     string `json:"crv,omitempty"` // OKP curve
+	X         string `json:"x,omitempty"`   // OKP public key
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the set, sorted by kid
+func (ks *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		jwk := JWK{KeyID: key.ID, Algorithm: key.Algorithm, Use: "sig"}
+		switch public := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	sort.Slice(jwks.Keys, func(i, j int) bool { return jwks.Keys[i].KeyID < jwks.Keys[j].KeyID })
+
+	return jwks
+}
+
+// ParseJWKS builds a verify-only key set from a JWKS document, so services
+// can validate tokens without holding any signing secret. Keys of
+// unsupported types are skipped.
+func ParseJWKS(data []byte) (*KeySet, error) {
+	var jwks JWKS
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("error while unmarshaling JWKS: %w", err)
+	}
+
+	var keys []*SigningKey
+	for _, jwk := range jwks.Keys {
+		var public crypto.PublicKey
+		switch {
+		case jwk.KeyType == "RSA":
+			n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+			if err != nil {
+				return nil, fmt.Errorf("error while decoding modulus of %q: %w", jwk.KeyID, err)
+			}
+			e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+			if err != nil {
+				return nil, fmt.Errorf("error while decoding exponent of %q: %w", jwk.KeyID, err)
+			}
+			public = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case jwk.KeyType == "OKP" && jwk.Curve == "Ed25519":
+			x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+			if err != nil || len(x) != ed25519.PublicKeySize {
+				return nil, fmt.Errorf("invalid Ed25519 key %q", jwk.KeyID)
+			}
+			public = ed25519.PublicKey(x)
+		default:
+			continue
+		}
+
+		key, err := NewVerificationKey(jwk.KeyID, public)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return NewKeySet("", keys...)
+}
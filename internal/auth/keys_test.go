@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Mock key retirement repository for testing
+type mockKeyRetirementRepo struct {
+	retiredAt map[string]time.Time
+}
+
+func (m *mockKeyRetirementRepo) Retire(kids []string, at time.Time) (map[string]time.Time, error) {
+	recorded := make(map[string]time.Time, len(kids))
+	for _, kid := range kids {
+		if _, ok := m.retiredAt[kid]; !ok {
+			m.retiredAt[kid] = at
+		}
+		recorded[kid] = m.retiredAt[kid]
+	}
+	return recorded, nil
+}
+
+func (m *mockKeyRetirementRepo) Reinstate(kid string) error {
+	delete(m.retiredAt, kid)
+	return nil
+}
+
+func newTestEdKey(t *testing.T, kid string) *SigningKey {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	key, err := NewSigningKey(kid, private)
+	if err != nil {
+		t.Fatalf("failed to wrap key: %v", err)
+	}
+	return key
+}
+
+func newTestRSAKey(t *testing.T, kid string) *SigningKey {
+	t.Helper()
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	key, err := NewSigningKey(kid, private)
+	if err != nil {
+		t.Fatalf("failed to wrap key: %v", err)
+	}
+	return key
+}
+
+func TestJWTService_Keys_SignAndValidate(t *testing.T) {
+	for _, key := range []*SigningKey{newTestEdKey(t, "ed"), newTestRSAKey(t, "rsa")} {
+		t.Run(key.Algorithm, func(t *testing.T) {
+			keys, _ := NewKeySet(key.ID, key)
+			svc := NewJWTServiceWithKeys("", keys, time.Hour)
+
+			token, err := svc.Generate("user-123", "testuser")
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			claims, err := svc.Validate(token)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if claims.UserID != "user-123" {
+				t.Errorf("expected user_id 'user-123', got %s", claims.UserID)
+			}
+		})
+	}
+}
+
+func TestJWTService_Keys_RetiredKeyGracePeriod(t *testing.T) {
+	oldKey := newTestEdKey(t, "old")
+	newKey := newTestEdKey(t, "new")
+
+	oldKeys, _ := NewKeySet("old", oldKey)
+	token, _ := NewJWTServiceWithKeys("", oldKeys, time.Hour).Generate("user-123", "testuser")
+
+	rotated, _ := NewKeySet("new", oldKey, newKey)
+	if _, err := NewJWTServiceWithKeys("", rotated, time.Hour).Validate(token); err != nil {
+		t.Errorf("expected old key to validate within grace period, got %v", err)
+	}
+	if _, err := NewJWTServiceWithKeys("", rotated, 0).Validate(token); err == nil {
+		t.Error("expected old key to be rejected after grace period")
+	}
+
+	dropped, _ := NewKeySet("new", newKey)
+	if _, err := NewJWTServiceWithKeys("", dropped, time.Hour).Validate(token); err == nil {
+		t.Error("expected token signed by unknown kid to be rejected")
+	}
+}
+
+func TestJWTService_Keys_RetiredKeyIgnoresIssuedAt(t *testing.T) {
+	oldKey := newTestEdKey(t, "old")
+	keys, _ := NewKeySet("new", oldKey, newTestEdKey(t, "new"))
+
+	// Whoever holds a retired key picks the iat, so it must not matter
+	future := time.Now().Add(time.Hour)
+	forged := func(method jwt.SigningMethod, kid string, key any) string {
+		token := jwt.NewWithClaims(method, &Claims{
+			UserID: "user-123",
+			RegisteredClaims: jwt.RegisteredClaims{
+				IssuedAt:  jwt.NewNumericDate(future),
+				ExpiresAt: jwt.NewNumericDate(future.Add(time.Hour)),
+			},
+		})
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("failed to sign: %v", err)
+		}
+		return signed
+	}
+	tokens := map[string]string{
+		"retired key": forged(jwt.SigningMethodEdDSA, "old", oldKey.Private),
+		"secret":      forged(jwt.SigningMethodHS256, "", []byte("test-secret")),
+	}
+
+	recent := &mockKeyRetirementRepo{retiredAt: map[string]time.Time{
+		"old": time.Now().Add(-30 * time.Minute), secretKID: time.Now().Add(-30 * time.Minute),
+	}}
+	svc := NewJWTServiceWithKeys("test-secret", keys, time.Hour)
+	if err := svc.RecordRetirements(recent); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for name, token := range tokens {
+		if _, err := svc.Validate(token); err != nil {
+			t.Errorf("%s: expected token to validate within grace period, got %v", name, err)
+		}
+	}
+
+	expired := &mockKeyRetirementRepo{retiredAt: map[string]time.Time{
+		"old": time.Now().Add(-2 * time.Hour), secretKID: time.Now().Add(-2 * time.Hour),
+	}}
+	svc = NewJWTServiceWithKeys("test-secret", keys, time.Hour)
+	if err := svc.RecordRetirements(expired); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for name, token := range tokens {
+		if _, err := svc.Validate(token); err == nil {
+			t.Errorf("%s: expected token to be rejected after grace period", name)
+		}
+	}
+	if jwks := svc.JWKS(); len(jwks.Keys) != 1 || jwks.Keys[0].KeyID != "new" {
+		t.Errorf("expected only the active key to be published, got %+v", jwks.Keys)
+	}
+}
+
+func TestJWTService_RecordRetirements_ReinstatesActiveKey(t *testing.T) {
+	repo := &mockKeyRetirementRepo{retiredAt: map[string]time.Time{"new": time.Now().Add(-48 * time.Hour)}}
+	keys, _ := NewKeySet("new", newTestEdKey(t, "old"), newTestEdKey(t, "new"))
+
+	if err := NewJWTServiceWithKeys("", keys, time.Hour).RecordRetirements(repo); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, ok := repo.retiredAt["new"]; ok {
+		t.Error("expected the active key's retirement to be cleared")
+	}
+	if _, ok := repo.retiredAt["old"]; !ok {
+		t.Error("expected the old key to be recorded as retired")
+	}
+}
+
+func TestJWTService_Keys_MigrateFromSecret(t *testing.T) {
+	token, _ := NewJWTService("test-secret").Generate("user-123", "testuser")
+
+	keys, _ := NewKeySet("new", newTestEdKey(t, "new"))
+	if _, err := NewJWTServiceWithKeys("test-secret", keys, time.Hour).Validate(token); err != nil {
+		t.Errorf("expected HS256 token to validate within grace period, got %v", err)
+	}
+	if _, err := NewJWTServiceWithKeys("", keys, time.Hour).Validate(token); err == nil {
+		t.Error("expected HS256 token to be rejected without the secret")
+	}
+}
+
+func TestKeySet_JWKSRoundTrip(t *testing.T) {
+	keys, _ := NewKeySet("ed", newTestEdKey(t, "ed"), newTestRSAKey(t, "rsa"))
+	token, _ := NewJWTServiceWithKeys("", keys, time.Hour).Generate("user-123", "testuser")
+
+	data, err := json.Marshal(keys.JWKS())
+	if err != nil {
+		t.Fatalf("failed to marshal JWKS: %v", err)
+	}
+
+	public, err := ParseJWKS(data)
+	if err != nil {
+		t.Fatalf("failed to parse JWKS: %v", err)
+	}
+	if len(public.JWKS().Keys) != 2 {
+		t.Errorf("expected 2 keys, got %d", len(public.JWKS().Keys))
+	}
+
+	verifier := NewJWTServiceWithKeys("", public, 0)
+	if _, err := verifier.Validate(token); err != nil {
+		t.Errorf("expected public keys to validate token, got %v", err)
+	}
+	if _, err := verifier.Generate("user-123", "testuser"); err == nil {
+		t.Error("expected verify-only key set to refuse signing")
+	}
+}
+
+func TestKeySet_RejectsMissingActiveKey(t *testing.T) {
+	if _, err := NewKeySet("missing", newTestEdKey(t, "ed")); err == nil {
+		t.Error("expected error for unknown active kid")
+	}
+}
@@ -0,0 +1,315 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mr1hm/go-chat-moderator/internal/shared/mail"
+	"github.com/mr1hm/go-chat-moderator/internal/shared/redis"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrAccountLocked   = errors.New("account temporarily locked after too many failed logins")
+	ErrTooManyAttempts = errors.New("too many failed logins, try again later")
+)
+
+const unlockLinkExpiration = 24 * time.Hour
+
+// ThrottleError refuses a login attempt before the password is checked
+type ThrottleError struct {
+	Err        error // ErrAccountLocked or ErrTooManyAttempts
+	RetryAfter time.Duration
+}
+
+func (e *ThrottleError) Error() string { return e.Err.Error() }
+func (e *ThrottleError) Unwrap() error { return e.Err }
+
+// LoginPolicy limits password guessing. Failures are counted per account
+// and per IP within Window; after DelayAfter failures an account must wait
+// a doubling delay between attempts, and MaxFailures locks it.
+type LoginPolicy struct {
+	MaxFailures     int
+	MaxIPFailures   int
+	Window          time.Duration
+	LockoutDuration time.Duration
+	DelayAfter      int
+	MaxDelay        time.Duration
+}
+
+func DefaultLoginPolicy() *LoginPolicy {
+	return &LoginPolicy{
+		MaxFailures:     10,
+		MaxIPFailures:   100,
+		Window:          15 * time.Minute,
+		LockoutDuration: 15 * time.Minute,
+		DelayAfter:      3,
+		MaxDelay:        30 * time.Second,
+	}
+}
+
+// delay is how long an account waits after its nth failure
+func (p *LoginPolicy) delay(failures int) time.Duration {
+	if failures < p.DelayAfter {
+		return 0
+	}
+	d := time.Second << min(failures-p.DelayAfter, 16)
+	return min(d, p.MaxDelay)
+}
+
+// LockoutEvent describes an account locked by failed logins. UserID is empty
+// when the email isn't registered.
+type LockoutEvent struct {
+	UserID string
+	Email  string
+	IP     string
+	Until  time.Time
+}
+
+// LockoutService throttles logins and locks accounts under attack, emailing
+// their owners a link to unlock early
+type LockoutService struct {
+	store     LoginAttemptStore
+	policy    *LoginPolicy
+	users     UserRepository
+	tokens    UserTokenRepository
+	mailer    mail.Mailer
+	appURL    string
+	onLockout []func(*LockoutEvent)
+}
+
+func NewLockoutService(store LoginAttemptStore, policy *LoginPolicy, users UserRepository, tokens UserTokenRepository, mailer mail.Mailer, appURL string) *LockoutService {
+	return &LockoutService{
+		store:  store,
+		policy: policy,
+		users:  users,
+		tokens: tokens,
+		mailer: mailer,
+		appURL: appURL,
+	}
+}
+
+// OnLockout registers a callback run whenever an account gets locked
+func (s *LockoutService) OnLockout(fn func(*LockoutEvent)) {
+	s.onLockout = append(s.onLockout, fn)
+}
+
+// Check returns a *ThrottleError if a login for email from ip must not be
+// attempted yet. Other errors mean the state couldn't be read.
+func (s *LockoutService) Check(ctx context.Context, email, ip string) error {
+	status, err := s.store.Status(ctx, accountKey(email), ip)
+	if err != nil {
+		return err
+	}
+
+	if status.LockedFor > 0 {
+		return &ThrottleError{Err: ErrAccountLocked, RetryAfter: status.LockedFor}
+	}
+	if status.IPFailures >= s.policy.MaxIPFailures {
+		return &ThrottleError{Err: ErrTooManyAttempts, RetryAfter: status.IPResetIn}
+	}
+	if status.DelayedFor > 0 {
+		return &ThrottleError{Err: ErrTooManyAttempts, RetryAfter: status.DelayedFor}
+	}
+
+	return nil
+}
+
+// Fail records a failed login and delays or locks the account as the policy
+// says. It reports whether the account just got locked.
+func (s *LockoutService) Fail(ctx context.Context, email, ip string) (bool, error) {
+	account := accountKey(email)
+
+	failures, err := s.store.RecordFailure(ctx, account, ip, s.policy.Window)
+	if err != nil {
+		return false, err
+	}
+
+	if failures < s.policy.MaxFailures {
+		if d := s.policy.delay(failures); d > 0 {
+			return false, s.store.Delay(ctx, account, d)
+		}
+		return false, nil
+	}
+
+	if err := s.store.Lock(ctx, account, s.policy.LockoutDuration); err != nil {
+		return false, err
+	}
+
+	event := &LockoutEvent{Email: email, IP: ip, Until: time.Now().Add(s.policy.LockoutDuration)}
+	user, err := s.users.FindByEmail(email)
+	if err == nil {
+		event.UserID = user.ID
+		go func(user *User) {
+			if err := s.sendUnlock(context.Background(), user); err != nil {
+				log.Printf("error while sending unlock email: %v", err)
+			}
+		}(user)
+	} else if !errors.Is(err, ErrUserNotFound) {
+		log.Printf("error while finding locked user: %v", err)
+	}
+
+	for _, fn := range s.onLockout {
+		fn(event)
+	}
+
+	return true, nil
+}
+
+// Succeed clears an account's failures after a completed login
+func (s *LockoutService) Succeed(ctx context.Context, email string) error {
+	return s.store.Reset(ctx, accountKey(email))
+}
+
+// Unlock lifts a lockout and clears the account's failures
+func (s *LockoutService) Unlock(ctx context.Context, email string) error {
+	return s.store.Reset(ctx, accountKey(email))
+}
+
+// ConfirmUnlock consumes an emailed unlock token and unlocks its user
+func (s *LockoutService) ConfirmUnlock(ctx context.Context, raw string) (string, error) {
+	token, err := s.tokens.Consume(PurposeAccountUnlock, hashToken(raw))
+	if err != nil {
+		return "", err
+	}
+
+	user, err := s.users.FindByID(token.UserID)
+	if err != nil {
+		return "", fmt.Errorf("error while finding user: %w", err)
+	}
+
+	if err := s.Unlock(ctx, user.Email); err != nil {
+		return "", fmt.Errorf("error while unlocking account: %w", err)
+	}
+
+	return user.ID, nil
+}
+
+func (s *LockoutService) sendUnlock(ctx context.Context, user *User) error {
+	raw, err := randomToken()
+	if err != nil {
+		return fmt.Errorf("error while generating unlock token: %w", err)
+	}
+
+	if err := s.tokens.InvalidateUser(user.ID, PurposeAccountUnlock); err != nil {
+		return fmt.Errorf("error while invalidating unlock tokens: %w", err)
+	}
+	if err := s.tokens.Create(&UserToken{
+		UserID:    user.ID,
+		Purpose:   PurposeAccountUnlock,
+		TokenHash: hashToken(raw),
+		ExpiresAt: time.Now().Add(unlockLinkExpiration),
+	}); err != nil {
+		return fmt.Errorf("error while storing unlock token: %w", err)
+	}
+
+	link := s.appURL + "/unlock-account?token=" + url.QueryEscape(raw)
+	return s.mailer.Send(ctx, &mail.Message{
+		To:      user.Email,
+		Subject: "Your account has been locked",
+		Body: fmt.Sprintf("Hi %s,\n\nYour account was locked for %d minutes after too many failed login attempts.\n\n"+
+			"If this was you, unlock it now by opening:\n\n%s\n\n"+
+			"If it wasn't, someone may be guessing your password. Consider changing it once you're back in.\n",
+			user.Username, int(s.policy.LockoutDuration.Minutes()), link),
+	})
+}
+
+// Emails are matched case-insensitively so casing can't dodge the counters
+func accountKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// LoginStatus is the throttling state of an account and IP
+type LoginStatus struct {
+	LockedFor  time.Duration
+	DelayedFor time.Duration
+	IPFailures int
+	IPResetIn  time.Duration
+}
+
+type LoginAttemptStore interface {
+	Status(ctx context.Context, account, ip string) (*LoginStatus, error)
+	// RecordFailure counts a failure against both account and ip within
+	// window and returns the account's failures so far
+	RecordFailure(ctx context.Context, account, ip string, window time.Duration) (int, error)
+	Delay(ctx context.Context, account string, d time.Duration) error
+	Lock(ctx context.Context, account string, d time.Duration) error
+	// Reset clears an account's failures, delay and lock
+	Reset(ctx context.Context, account string) error
+}
+
+type redisLoginAttemptStore struct{}
+
+func NewLoginAttemptStore() LoginAttemptStore {
+	return &redisLoginAttemptStore{}
+}
+
+func (s *redisLoginAttemptStore) Status(ctx context.Context, account, ip string) (*LoginStatus, error) {
+	var locked, delayed, ipReset *goredis.DurationCmd
+	var ipFailures *goredis.StringCmd
+	_, err := redis.Client.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		locked = pipe.PTTL(ctx, "auth:login_lock:"+account)
+		delayed = pipe.PTTL(ctx, "auth:login_delay:"+account)
+		ipFailures = pipe.Get(ctx, "auth:login_failures_ip:"+ip)
+		ipReset = pipe.PTTL(ctx, "auth:login_failures_ip:"+ip)
+		return nil
+	})
+	if err != nil && !errors.Is(err, goredis.Nil) {
+		return nil, err
+	}
+
+	// Missing keys report negative TTLs
+	status := &LoginStatus{
+		LockedFor:  max(locked.Val(), 0),
+		DelayedFor: max(delayed.Val(), 0),
+		IPResetIn:  max(ipReset.Val(), 0),
+	}
+	if n, err := ipFailures.Int(); err == nil {
+		status.IPFailures = n
+	}
+
+	return status, nil
+}
+
+func (s *redisLoginAttemptStore) RecordFailure(ctx context.Context, account, ip string, window time.Duration) (int, error) {
+	var failures *goredis.IntCmd
+	_, err := redis.Client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		failures = pipe.Incr(ctx, "auth:login_failures:"+account)
+		pipe.ExpireNX(ctx, "auth:login_failures:"+account, window)
+		pipe.Incr(ctx, "auth:login_failures_ip:"+ip)
+		pipe.ExpireNX(ctx, "auth:login_failures_ip:"+ip, window)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(failures.Val()), nil
+}
+
+func (s *redisLoginAttemptStore) Delay(ctx context.Context, account string, d time.Duration) error {
+	return redis.Client.Set(ctx, "auth:login_delay:"+account, 1, d).Err()
+}
+
+func (s *redisLoginAttemptStore) Lock(ctx context.Context, account string, d time.Duration) error {
+	_, err := redis.Client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.Set(ctx, "auth:login_lock:"+account, 1, d)
+		// The lock replaces the count; failures start over once it ends
+		pipe.Del(ctx, "auth:login_failures:"+account, "auth:login_delay:"+account)
+		return nil
+	})
+	return err
+}
+
+func (s *redisLoginAttemptStore) Reset(ctx context.Context, account string) error {
+	return redis.Client.Del(ctx,
+		"auth:login_failures:"+account,
+		"auth:login_delay:"+account,
+		"auth:login_lock:"+account,
+	).Err()
+}
@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type mockLoginAttemptStore struct {
+	failures   map[string]int
+	ipFailures map[string]int
+	delayed    map[string]time.Duration
+	locked     map[string]time.Duration
+}
+
+func newMockLoginAttemptStore() *mockLoginAttemptStore {
+	return &mockLoginAttemptStore{
+		failures:   make(map[string]int),
+		ipFailures: make(map[string]int),
+		delayed:    make(map[string]time.Duration),
+		locked:     make(map[string]time.Duration),
+	}
+}
+
+func (m *mockLoginAttemptStore) Status(ctx context.Context, account, ip string) (*LoginStatus, error) {
+	return &LoginStatus{
+		LockedFor:  m.locked[account],
+		DelayedFor: m.delayed[account],
+		IPFailures: m.ipFailures[ip],
+		IPResetIn:  time.Minute,
+	}, nil
+}
+
+func (m *mockLoginAttemptStore) RecordFailure(ctx context.Context, account, ip string, window time.Duration) (int, error) {
+	m.failures[account]++
+	m.ipFailures[ip]++
+	return m.failures[account], nil
+}
+
+func (m *mockLoginAttemptStore) Delay(ctx context.Context, account string, d time.Duration) error {
+	m.delayed[account] = d
+	return nil
+}
+
+func (m *mockLoginAttemptStore) Lock(ctx context.Context, account string, d time.Duration) error {
+	m.locked[account] = d
+	delete(m.failures, account)
+	delete(m.delayed, account)
+	return nil
+}
+
+func (m *mockLoginAttemptStore) Reset(ctx context.Context, account string) error {
+	delete(m.failures, account)
+	delete(m.delayed, account)
+	delete(m.locked, account)
+	return nil
+}
+
+func newTestLockoutService() (*LockoutService, *mockLoginAttemptStore, *mockUserTokenRepo) {
+	users := newMockRepo()
+	users.users["user-123"] = &User{ID: "user-123", Email: "test@example.com", Username: "testuser"}
+	store := newMockLoginAttemptStore()
+	tokens := newMockUserTokenRepo()
+	return NewLockoutService(store, DefaultLoginPolicy(), users, tokens, &recordingMailer{}, "http://app.test"), store, tokens
+}
+
+func TestLoginPolicy_Delay(t *testing.T) {
+	policy := DefaultLoginPolicy()
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{6, 8 * time.Second},
+		{9, policy.MaxDelay},
+		{100, policy.MaxDelay},
+	}
+
+	for _, tt := range tests {
+		if got := policy.delay(tt.failures); got != tt.want {
+			t.Errorf("delay(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLockoutService_LocksAfterMaxFailures(t *testing.T) {
+	svc, store, _ := newTestLockoutService()
+	ctx := context.Background()
+
+	var events []*LockoutEvent
+	svc.OnLockout(func(e *LockoutEvent) { events = append(events, e) })
+
+	for i := 1; i < svc.policy.MaxFailures; i++ {
+		locked, err := svc.Fail(ctx, "Test@Example.com", "10.0.0.1")
+		if err != nil || locked {
+			t.Fatalf("failure %d: expected no lock, got %v, %v", i, locked, err)
+		}
+	}
+
+	var throttled *ThrottleError
+	if err := svc.Check(ctx, "test@example.com", "10.0.0.1"); !errors.As(err, &throttled) || !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("expected ErrTooManyAttempts while delayed, got %v", err)
+	}
+
+	locked, err := svc.Fail(ctx, "test@example.com", "10.0.0.1")
+	if err != nil || !locked {
+		t.Fatalf("expected lock, got %v, %v", locked, err)
+	}
+	if len(events) != 1 || events[0].UserID != "user-123" {
+		t.Errorf("expected one lockout event for user-123, got %+v", events)
+	}
+
+	err = svc.Check(ctx, "TEST@example.com", "10.0.0.2")
+	if !errors.As(err, &throttled) || !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("expected ErrAccountLocked, got %v", err)
+	}
+	if throttled.RetryAfter != svc.policy.LockoutDuration {
+		t.Errorf("expected retry after %v, got %v", svc.policy.LockoutDuration, throttled.RetryAfter)
+	}
+
+	if err := svc.Unlock(ctx, "test@example.com"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := svc.Check(ctx, "test@example.com", "10.0.0.2"); err != nil {
+		t.Errorf("expected unlocked account to pass, got %v", err)
+	}
+	if store.failures["test@example.com"] != 0 {
+		t.Error("expected failures to be cleared")
+	}
+}
+
+func TestLockoutService_ThrottlesIP(t *testing.T) {
+	svc, store, _ := newTestLockoutService()
+	store.ipFailures["10.0.0.1"] = svc.policy.MaxIPFailures
+
+	if err := svc.Check(context.Background(), "other@example.com", "10.0.0.1"); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("expected ErrTooManyAttempts, got %v", err)
+	}
+	if err := svc.Check(context.Background(), "other@example.com", "10.0.0.2"); err != nil {
+		t.Errorf("expected other IP to pass, got %v", err)
+	}
+}
+
+func TestLockoutService_ConfirmUnlock(t *testing.T) {
+	svc, store, tokens := newTestLockoutService()
+	ctx := context.Background()
+	store.locked["test@example.com"] = time.Minute
+
+	raw := "unlock-token"
+	tokens.Create(&UserToken{
+		UserID:    "user-123",
+		Purpose:   PurposeAccountUnlock,
+		TokenHash: hashToken(raw),
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+
+	userID, err := svc.ConfirmUnlock(ctx, raw)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if userID != "user-123" {
+		t.Errorf("expected user-123, got %s", userID)
+	}
+	if err := svc.Check(ctx, "test@example.com", "10.0.0.1"); err != nil {
+		t.Errorf("expected account to be unlocked, got %v", err)
+	}
+	if _, err := svc.ConfirmUnlock(ctx, raw); !errors.Is(err, ErrInvalidUserToken) {
+		t.Errorf("expected ErrInvalidUserToken on reuse, got %v", err)
+	}
+}
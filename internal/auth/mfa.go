@@ -0,0 +1,350 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mr1hm/go-chat-moderator/internal/shared/redis"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication already enabled")
+	ErrInvalidMFACode    = errors.New("invalid two-factor code")
+	ErrInvalidMFAToken   = errors.New("invalid or expired mfa token")
+	ErrMFARequired       = errors.New("two-factor authentication required")
+	ErrInvalidMFAPolicy  = errors.New("only moderator and admin can require two-factor authentication")
+)
+
+const (
+	mfaIssuer          = "go-chat-moderator"
+	recoveryCodeCount  = 10
+	mfaPendingTTL      = 5 * time.Minute
+	mfaPendingAttempts = 5
+	mfaPolicyCacheTTL  = 30 * time.Second
+
+	// MFAPolicySetting is the settings key holding the MFAPolicy as JSON
+	MFAPolicySetting = "mfa_required_roles"
+)
+
+// MFAService manages TOTP enrollment, second-factor login challenges and the
+// policy of which roles must use 2FA
+type MFAService struct {
+	repo     MFARepository
+	settings SettingsRepository
+	pending  MFAChallengeStore
+	now      func() time.Time
+
+	mu       sync.Mutex
+	policy   *MFAPolicy
+	policyAt time.Time
+}
+
+func NewMFAService(repo MFARepository, settings SettingsRepository, pending MFAChallengeStore) *MFAService {
+	return &MFAService{
+		repo:     repo,
+		settings: settings,
+		pending:  pending,
+		now:      time.Now,
+	}
+}
+
+// Enabled reports whether the user has a confirmed enrollment
+func (s *MFAService) Enabled(userID string) (bool, error) {
+	mfa, err := s.repo.Find(userID)
+	if errors.Is(err, ErrMFANotEnrolled) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return mfa.ConfirmedAt != nil, nil
+}
+
+// Enroll generates a new secret for the user. It stays inactive until
+// Confirm proves the user's authenticator produces matching codes.
+func (s *MFAService) Enroll(user *User) (*MFAEnrollment, error) {
+	enabled, err := s.Enabled(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error while finding enrollment: %w", err)
+	}
+	if enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return nil, fmt.Errorf("error while generating secret: %w", err)
+	}
+	if err := s.repo.Enroll(user.ID, secret); err != nil {
+		return nil, fmt.Errorf("error while storing enrollment: %w", err)
+	}
+
+	return &MFAEnrollment{
+		Secret: secret,
+		URI:    TOTPURI(mfaIssuer, user.Email, secret),
+	}, nil
+}
+
+// Confirm activates a pending enrollment with a TOTP code and returns the
+// recovery codes. They are only stored hashed, so this is the one time
+// they can be shown.
+func (s *MFAService) Confirm(userID, code string) ([]string, error) {
+	mfa, err := s.repo.Find(userID)
+	if err != nil {
+		return nil, err
+	}
+	if mfa.ConfirmedAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	step, ok := ValidateTOTP(mfa.Secret, strings.TrimSpace(code), s.now(), mfa.LastStep)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("error while generating recovery code: %w", err)
+		}
+		raw := hex.EncodeToString(b)
+		codes[i] = raw[:5] + "-" + raw[5:]
+		hashes[i] = hashToken(raw)
+	}
+
+	if err := s.repo.Confirm(userID, step, hashes); err != nil {
+		return nil, fmt.Errorf("error while confirming enrollment: %w", err)
+	}
+
+	return codes, nil
+}
+
+// Verify checks a TOTP code or, failing that, consumes a recovery code
+func (s *MFAService) Verify(userID, code string) error {
+	mfa, err := s.repo.Find(userID)
+	if err != nil {
+		return err
+	}
+	if mfa.ConfirmedAt == nil {
+		return ErrMFANotEnrolled
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) == totpDigits {
+		step, ok := ValidateTOTP(mfa.Secret, code, s.now(), mfa.LastStep)
+		if !ok {
+			return ErrInvalidMFACode
+		}
+		// Conditional so two requests racing with the same code can't both pass
+		advanced, err := s.repo.AdvanceStep(userID, step)
+		if err != nil {
+			return fmt.Errorf("error while recording code use: %w", err)
+		}
+		if !advanced {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	used, err := s.repo.UseRecoveryCode(userID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return fmt.Errorf("error while using recovery code: %w", err)
+	}
+	if !used {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// Disable removes a user's enrollment after checking a code. Users whose role
+// the policy covers can't turn it off.
+func (s *MFAService) Disable(user *User, code string) error {
+	if s.Required(user.Role) {
+		return ErrMFARequired
+	}
+	if err := s.Verify(user.ID, code); err != nil {
+		return err
+	}
+	return s.repo.Delete(user.ID)
+}
+
+// Challenge starts a second-factor login for a user whose password checked out
+func (s *MFAService) Challenge(ctx context.Context, userID string) (string, error) {
+	raw, err := randomToken()
+	if err != nil {
+		return "", fmt.Errorf("error while generating mfa token: %w", err)
+	}
+	if err := s.pending.Create(ctx, hashToken(raw), userID, mfaPendingTTL); err != nil {
+		return "", fmt.Errorf("error while storing mfa token: %w", err)
+	}
+	return raw, nil
+}
+
+// CompleteChallenge checks the code for a pending login and returns its user.
+// A challenge allows a few attempts and can only be completed once. The user
+// is also returned with ErrInvalidMFACode so failures can be counted.
+func (s *MFAService) CompleteChallenge(ctx context.Context, raw, code string) (string, error) {
+	hash := hashToken(raw)
+
+	userID, attempts, err := s.pending.Attempt(ctx, hash)
+	if err != nil {
+		return "", err
+	}
+	if attempts > mfaPendingAttempts {
+		if _, err := s.pending.Delete(ctx, hash); err != nil {
+			log.Printf("error while deleting mfa token: %v", err)
+		}
+		return "", ErrInvalidMFAToken
+	}
+
+	if err := s.Verify(userID, code); err != nil {
+		return userID, err
+	}
+
+	deleted, err := s.pending.Delete(ctx, hash)
+	if err != nil {
+		return "", fmt.Errorf("error while deleting mfa token: %w", err)
+	}
+	if !deleted {
+		return "", ErrInvalidMFAToken
+	}
+
+	return userID, nil
+}
+
+// Policy returns the roles that must use 2FA, cached briefly since it's read
+// on every privileged request
+func (s *MFAService) Policy() (*MFAPolicy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.policy != nil && s.now().Sub(s.policyAt) < mfaPolicyCacheTTL {
+		return s.policy, nil
+	}
+
+	value, err := s.settings.Get(MFAPolicySetting)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := &MFAPolicy{Roles: []string{}}
+	if value != "" {
+		if err := json.Unmarshal([]byte(value), policy); err != nil {
+			return nil, fmt.Errorf("error while parsing mfa policy: %w", err)
+		}
+	}
+
+	s.policy = policy
+	s.policyAt = s.now()
+	return policy, nil
+}
+
+func (s *MFAService) SetPolicy(policy *MFAPolicy) error {
+	for _, role := range policy.Roles {
+		if !IsValidRole(role) || role == RoleUser {
+			return ErrInvalidMFAPolicy
+		}
+	}
+
+	b, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	if err := s.settings.Set(MFAPolicySetting, string(b)); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.policy = policy
+	s.policyAt = s.now()
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Required reports whether the policy covers role. If the policy can't be
+// read, privileged roles are treated as covered.
+func (s *MFAService) Required(role string) bool {
+	if !HasRole(role, RoleModerator) {
+		return false
+	}
+
+	policy, err := s.Policy()
+	if err != nil {
+		log.Printf("error while loading mfa policy: %v", err)
+		return true
+	}
+	return slices.Contains(policy.Roles, role)
+}
+
+// Recovery codes are shown as xxxxx-xxxxx but accepted in any case, with or
+// without separators
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+// MFAChallengeStore holds logins waiting for a second factor
+type MFAChallengeStore interface {
+	Create(ctx context.Context, tokenHash, userID string, ttl time.Duration) error
+	// Attempt counts a try against a challenge and returns its user and the
+	// number of tries so far
+	Attempt(ctx context.Context, tokenHash string) (string, int, error)
+	Delete(ctx context.Context, tokenHash string) (bool, error)
+}
+
+type redisMFAChallengeStore struct{}
+
+func NewMFAChallengeStore() MFAChallengeStore {
+	return &redisMFAChallengeStore{}
+}
+
+func (s *redisMFAChallengeStore) Create(ctx context.Context, tokenHash, userID string, ttl time.Duration) error {
+	key := "auth:mfa_pending:" + tokenHash
+	_, err := redis.Client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.HSet(ctx, key, "user_id", userID, "attempts", 0)
+		pipe.Expire(ctx, key, ttl)
+		return nil
+	})
+	return err
+}
+
+func (s *redisMFAChallengeStore) Attempt(ctx context.Context, tokenHash string) (string, int, error) {
+	key := "auth:mfa_pending:" + tokenHash
+
+	var attempts *goredis.IntCmd
+	var userID *goredis.StringCmd
+	_, err := redis.Client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		attempts = pipe.HIncrBy(ctx, key, "attempts", 1)
+		userID = pipe.HGet(ctx, key, "user_id")
+		return nil
+	})
+	if errors.Is(err, goredis.Nil) {
+		// Expired or unknown; drop the counter HIncrBy just created
+		redis.Client.Del(ctx, key)
+		return "", 0, ErrInvalidMFAToken
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	return userID.Val(), int(attempts.Val()), nil
+}
+
+func (s *redisMFAChallengeStore) Delete(ctx context.Context, tokenHash string) (bool, error) {
+	n, err := redis.Client.Del(ctx, "auth:mfa_pending:"+tokenHash).Result()
+	return n > 0, err
+}
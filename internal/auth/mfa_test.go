@@ -0,0 +1,280 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mockMFARepo struct {
+	enrollments map[string]*MFA
+	recovery    map[string]map[string]bool // user -> hash -> used
+}
+
+func newMockMFARepo() *mockMFARepo {
+	return &mockMFARepo{
+		enrollments: make(map[string]*MFA),
+		recovery:    make(map[string]map[string]bool),
+	}
+}
+
+func (m *mockMFARepo) Find(userID string) (*MFA, error) {
+	mfa, ok := m.enrollments[userID]
+	if !ok {
+		return nil, ErrMFANotEnrolled
+	}
+	copied := *mfa
+	return &copied, nil
+}
+
+func (m *mockMFARepo) Enroll(userID, secret string) error {
+	if mfa, ok := m.enrollments[userID]; ok && mfa.ConfirmedAt != nil {
+		return nil
+	}
+	m.enrollments[userID] = &MFA{UserID: userID, Secret: secret}
+	return nil
+}
+
+func (m *mockMFARepo) Confirm(userID string, step int64, recoveryHashes []string) error {
+	now := time.Now()
+	m.enrollments[userID].ConfirmedAt = &now
+	m.enrollments[userID].LastStep = step
+	m.recovery[userID] = make(map[string]bool)
+	for _, hash := range recoveryHashes {
+		m.recovery[userID][hash] = false
+	}
+	return nil
+}
+
+func (m *mockMFARepo) AdvanceStep(userID string, step int64) (bool, error) {
+	if m.enrollments[userID].LastStep >= step {
+		return false, nil
+	}
+	m.enrollments[userID].LastStep = step
+	return true, nil
+}
+
+func (m *mockMFARepo) UseRecoveryCode(userID, hash string) (bool, error) {
+	used, ok := m.recovery[userID][hash]
+	if !ok || used {
+		return false, nil
+	}
+	m.recovery[userID][hash] = true
+	return true, nil
+}
+
+func (m *mockMFARepo) Delete(userID string) error {
+	delete(m.enrollments, userID)
+	delete(m.recovery, userID)
+	return nil
+}
+
+type mockSettingsRepo struct {
+	values map[string]string
+}
+
+func (m *mockSettingsRepo) Get(key string) (string, error) {
+	return m.values[key], nil
+}
+
+func (m *mockSettingsRepo) Set(key, value string) error {
+	m.values[key] = value
+	return nil
+}
+
+type mockChallenge struct {
+	userID   string
+	attempts int
+}
+
+type mockMFAChallengeStore struct {
+	challenges map[string]*mockChallenge
+}
+
+func (m *mockMFAChallengeStore) Create(ctx context.Context, tokenHash, userID string, ttl time.Duration) error {
+	m.challenges[tokenHash] = &mockChallenge{userID: userID}
+	return nil
+}
+
+func (m *mockMFAChallengeStore) Attempt(ctx context.Context, tokenHash string) (string, int, error) {
+	challenge, ok := m.challenges[tokenHash]
+	if !ok {
+		return "", 0, ErrInvalidMFAToken
+	}
+	challenge.attempts++
+	return challenge.userID, challenge.attempts, nil
+}
+
+func (m *mockMFAChallengeStore) Delete(ctx context.Context, tokenHash string) (bool, error) {
+	_, ok := m.challenges[tokenHash]
+	delete(m.challenges, tokenHash)
+	return ok, nil
+}
+
+var testMFAUser = &User{ID: "user-123", Email: "test@example.com", Role: RoleAdmin}
+
+func newTestMFAService() (*MFAService, *time.Time) {
+	now := time.Unix(1700000000, 0)
+	svc := NewMFAService(
+		newMockMFARepo(),
+		&mockSettingsRepo{values: make(map[string]string)},
+		&mockMFAChallengeStore{challenges: make(map[string]*mockChallenge)},
+	)
+	svc.now = func() time.Time { return now }
+	return svc, &now
+}
+
+func currentCode(t *testing.T, svc *MFAService, userID string, now time.Time) string {
+	t.Helper()
+	mfa, err := svc.repo.Find(userID)
+	if err != nil {
+		t.Fatalf("expected enrollment, got %v", err)
+	}
+	key, _ := totpEncoding.DecodeString(mfa.Secret)
+	return totpCode(key, now.Unix()/30)
+}
+
+func enrollTestUser(t *testing.T, svc *MFAService, now *time.Time) []string {
+	t.Helper()
+	if _, err := svc.Enroll(testMFAUser); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	codes, err := svc.Confirm(testMFAUser.ID, currentCode(t, svc, testMFAUser.ID, *now))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	*now = now.Add(30 * time.Second)
+	return codes
+}
+
+func TestMFAService_EnrollAndConfirm(t *testing.T) {
+	svc, now := newTestMFAService()
+
+	enrollment, err := svc.Enroll(testMFAUser)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if enrollment.Secret == "" || enrollment.URI == "" {
+		t.Fatalf("expected secret and uri, got %+v", enrollment)
+	}
+
+	if enabled, _ := svc.Enabled(testMFAUser.ID); enabled {
+		t.Error("expected enrollment to be inactive before confirmation")
+	}
+	if _, err := svc.Confirm(testMFAUser.ID, "000000"); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("expected ErrInvalidMFACode, got %v", err)
+	}
+
+	codes, err := svc.Confirm(testMFAUser.ID, currentCode(t, svc, testMFAUser.ID, *now))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Errorf("expected %d recovery codes, got %d", recoveryCodeCount, len(codes))
+	}
+	if enabled, _ := svc.Enabled(testMFAUser.ID); !enabled {
+		t.Error("expected enrollment to be active")
+	}
+	if _, err := svc.Enroll(testMFAUser); !errors.Is(err, ErrMFAAlreadyEnabled) {
+		t.Errorf("expected ErrMFAAlreadyEnabled, got %v", err)
+	}
+}
+
+func TestMFAService_Verify_RefusesReplay(t *testing.T) {
+	svc, now := newTestMFAService()
+	enrollTestUser(t, svc, now)
+
+	code := currentCode(t, svc, testMFAUser.ID, *now)
+	if err := svc.Verify(testMFAUser.ID, code); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := svc.Verify(testMFAUser.ID, code); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("expected replayed code to fail, got %v", err)
+	}
+}
+
+func TestMFAService_Verify_RecoveryCodeSingleUse(t *testing.T) {
+	svc, now := newTestMFAService()
+	codes := enrollTestUser(t, svc, now)
+
+	// Accepted without the separator and in upper case
+	code := strings.ToUpper(codes[0][:5] + codes[0][6:])
+	if err := svc.Verify(testMFAUser.ID, " "+code+" "); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := svc.Verify(testMFAUser.ID, codes[0]); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("expected used recovery code to fail, got %v", err)
+	}
+	if err := svc.Verify(testMFAUser.ID, codes[1]); err != nil {
+		t.Errorf("expected unused recovery code to work, got %v", err)
+	}
+}
+
+func TestMFAService_CompleteChallenge(t *testing.T) {
+	svc, now := newTestMFAService()
+	enrollTestUser(t, svc, now)
+	ctx := context.Background()
+
+	token, err := svc.Challenge(ctx, testMFAUser.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, err := svc.CompleteChallenge(ctx, token, "000000"); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("expected ErrInvalidMFACode, got %v", err)
+	}
+
+	userID, err := svc.CompleteChallenge(ctx, token, currentCode(t, svc, testMFAUser.ID, *now))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if userID != testMFAUser.ID {
+		t.Errorf("expected %s, got %s", testMFAUser.ID, userID)
+	}
+
+	*now = now.Add(30 * time.Second)
+	if _, err := svc.CompleteChallenge(ctx, token, currentCode(t, svc, testMFAUser.ID, *now)); !errors.Is(err, ErrInvalidMFAToken) {
+		t.Errorf("expected completed challenge to be unusable, got %v", err)
+	}
+}
+
+func TestMFAService_CompleteChallenge_AttemptLimit(t *testing.T) {
+	svc, now := newTestMFAService()
+	enrollTestUser(t, svc, now)
+	ctx := context.Background()
+
+	token, _ := svc.Challenge(ctx, testMFAUser.ID)
+	for range mfaPendingAttempts {
+		svc.CompleteChallenge(ctx, token, "000000")
+	}
+
+	if _, err := svc.CompleteChallenge(ctx, token, currentCode(t, svc, testMFAUser.ID, *now)); !errors.Is(err, ErrInvalidMFAToken) {
+		t.Errorf("expected ErrInvalidMFAToken after too many attempts, got %v", err)
+	}
+}
+
+func TestMFAService_Policy(t *testing.T) {
+	svc, now := newTestMFAService()
+
+	if svc.Required(RoleAdmin) {
+		t.Error("expected no roles to be covered by default")
+	}
+
+	if err := svc.SetPolicy(&MFAPolicy{Roles: []string{RoleUser}}); !errors.Is(err, ErrInvalidMFAPolicy) {
+		t.Errorf("expected ErrInvalidMFAPolicy, got %v", err)
+	}
+	if err := svc.SetPolicy(&MFAPolicy{Roles: []string{RoleAdmin}}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if !svc.Required(RoleAdmin) || svc.Required(RoleModerator) {
+		t.Error("expected only admin to be covered")
+	}
+
+	enrollTestUser(t, svc, now)
+	if err := svc.Disable(testMFAUser, currentCode(t, svc, testMFAUser.ID, *now)); !errors.Is(err, ErrMFARequired) {
+		t.Errorf("expected ErrMFARequired, got %v", err)
+	}
+}
@@ -3,26 +3,238 @@ package auth
 import "time"
 
 type User struct {
-	ID           string    `json:"id"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"` // Always omit
-	Username     string    `json:"username"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID           string     `json:"id"`
+	Email        string     `json:"email"`
+	PasswordHash string     `json:"-"` // Always omit
+	Username     string     `json:"username"`
+	DisplayName  string     `json:"display_name"`
+	Bio          string     `json:"bio"`
+	AvatarKey    string     `json:"-"`                    // Blob store key; empty without an avatar
+	AvatarURL    string     `json:"avatar_url,omitempty"` // Derived from AvatarKey
+	Role         string     `json:"role"`
+	Bot          bool       `json:"bot"`         // Authenticates only with API keys
+	VerifiedAt   *time.Time `json:"verified_at"` // Email confirmed; nil until then
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// PublicProfile is what other users can see about a user
+type PublicProfile struct {
+	ID          string    `json:"id"`
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio"`
+	AvatarURL   string    `json:"avatar_url,omitempty"`
+	Bot         bool      `json:"bot"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (u *User) Public() *PublicProfile {
+	return &PublicProfile{
+		ID:          u.ID,
+		Username:    u.Username,
+		DisplayName: u.DisplayName,
+		Bio:         u.Bio,
+		AvatarURL:   u.AvatarURL,
+		Bot:         u.Bot,
+		CreatedAt:   u.CreatedAt,
+	}
 }
 
 type RegisterRequest struct {
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=4"`
+	Password string `json:"password" binding:"required"` // Checked against PasswordPolicy
 	Username string `json:"username" binding:"required,min=3,max=32"`
 }
 
+type UpdateProfileRequest struct {
+	DisplayName string `json:"display_name" binding:"max=64"`
+	Bio         string `json:"bio" binding:"max=500"`
+}
+
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required"`
 }
 
 type AuthResponse struct {
-	Token string `json:"token"`
-	User  User   `json:"user"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	User         User   `json:"user"`
+}
+
+// RefreshToken is an opaque, single-use token. Rotating one issues its
+// successor in the same family; presenting a used token revokes the family.
+type RefreshToken struct {
+	ID        string
+	UserID    string
+	FamilyID  string
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+// Session is one login on a device. Its ID is also the family ID of the
+// refresh tokens issued for it and the "sid" claim of its access tokens.
+type Session struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"-"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	MFA        bool       `json:"mfa"` // Login completed a second factor
+	RevokedAt  *time.Time `json:"-"`
+	Current    bool       `json:"current"` // Session of the requesting token
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// UserToken purposes
+const (
+	PurposePasswordReset     = "password_reset"
+	PurposeEmailVerification = "email_verification"
+	PurposeAccountUnlock     = "account_unlock"
+)
+
+// UserToken is a single-use token sent by email. Only its hash is stored.
+type UserToken struct {
+	ID        string
+	UserID    string
+	Purpose   string
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+type UpdateUsernameRequest struct {
+	Username string `json:"username" binding:"required,min=3,max=32"`
+}
+
+type UpdateEmailRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"` // Current password
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"` // Checked against PasswordPolicy
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+type PasswordResetRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type UpdateRoleRequest struct {
+	Role   string `json:"role" binding:"required,oneof=user moderator admin"`
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// MFA is a user's TOTP enrollment; unconfirmed until a first code is verified
+type MFA struct {
+	UserID      string
+	Secret      string
+	LastStep    int64 // Last accepted TOTP step, to refuse replays
+	ConfirmedAt *time.Time
+	CreatedAt   time.Time
+}
+
+type MFAEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"` // Render as a QR code for authenticator apps
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"` // TOTP code, or a recovery code where allowed
+}
+
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// MFAChallenge is returned by Login instead of tokens when a second factor is needed
+type MFAChallenge struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+type MFAPolicy struct {
+	Roles []string `json:"roles"` // Global roles that must use 2FA for privileged routes
+}
+
+type UpdateMFAPolicyRequest struct {
+	Roles  []string `json:"roles" binding:"required,dive,oneof=moderator admin"`
+	Reason string   `json:"reason" binding:"max=500"`
+}
+
+type UnlockAccountRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// Identity links an account at an external OIDC provider to a user
+type Identity struct {
+	ID        string
+	UserID    string
+	Issuer    string
+	Subject   string
+	Email     string // As the provider reported it when linked
+	CreatedAt time.Time
+}
+
+type OIDCExchangeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// APIKey lets a bot or integration call the API without logging in. Only a
+// hash of the key is stored; the key itself is shown once, at creation.
+type APIKey struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // Start of the key, to tell keys apart
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	CreatedBy  string     `json:"created_by"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"` // nil never expires
+	RevokedAt  *time.Time `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// NewAPIKey is returned when a key is created, the only time Key is known
+type NewAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1,dive,oneof=rooms:read messages:write moderation:act"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"min=0,max=365"` // 0 never expires
+	Reason        string   `json:"reason" binding:"max=500"`                // Audited when admins create keys for others
+}
+
+type CreateBotRequest struct {
+	Username string `json:"username" binding:"required,min=3,max=32"`
+	Role     string `json:"role" binding:"omitempty,oneof=user moderator"`
+	Reason   string `json:"reason" binding:"max=500"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type PasswordResetConfirmRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"` // Checked against PasswordPolicy
 }
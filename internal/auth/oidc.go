@@ -0,0 +1,732 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/mr1hm/go-chat-moderator/internal/shared/redis"
+	goredis "github.com/redis/go-redis/v9"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidOIDCState   = errors.New("invalid or expired sso state")
+	ErrInvalidIDToken     = errors.New("invalid id token")
+	ErrEmailNotVerified   = errors.New("identity provider has not verified this email")
+	ErrOIDCSignupDisabled = errors.New("no account is linked to this identity")
+)
+
+const (
+	oidcStateTTL     = 10 * time.Minute
+	oidcLoginCodeTTL = time.Minute
+	oidcJWKSMinAge   = time.Minute // Unknown kids refetch the JWKS at most this often
+	oidcStateCookie  = "oidc_state"
+)
+
+// OIDCConfig describes the identity provider and how its users map onto ours
+type OIDCConfig struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string // Empty for public clients relying on PKCE alone
+	RedirectURL  string // This API's callback, e.g. http://localhost:8080/auth/oidc/callback
+	Scopes       []string
+	GroupsClaim  string
+	RoleMapping  map[string]string // IdP group -> global role
+	AllowSignup  bool              // Create accounts for unknown identities
+}
+
+// OIDCIdentity is the verified subset of an ID token we act on
+type OIDCIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string
+	Groups        []string
+	MFA           bool // The provider reported a second factor in amr
+}
+
+// OIDCProvider speaks the authorization code flow with one issuer
+type OIDCProvider struct {
+	config   OIDCConfig
+	client   *http.Client
+	issuer   string
+	authURL  string
+	tokenURL string
+	jwksURL  string
+
+	mu          sync.Mutex
+	keys        *KeySet
+	keysFetched time.Time
+}
+
+// NewOIDCProvider reads the issuer's discovery document and keys
+func NewOIDCProvider(ctx context.Context, config OIDCConfig) (*OIDCProvider, error) {
+	for group, role := range config.RoleMapping {
+		if !IsValidRole(role) {
+			return nil, fmt.Errorf("group %q maps to unknown role %q", group, role)
+		}
+	}
+
+	config.Scopes = validScopes(config.Scopes)
+	p := &OIDCProvider{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+
+	var discovery struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+	wellKnown := strings.TrimSuffix(config.IssuerURL, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, wellKnown, &discovery); err != nil {
+		return nil, fmt.Errorf("error while fetching discovery document: %w", err)
+	}
+	if discovery.Issuer != strings.TrimSuffix(config.IssuerURL, "/") && discovery.Issuer != config.IssuerURL {
+		return nil, fmt.Errorf("discovery issuer %q does not match %q", discovery.Issuer, config.IssuerURL)
+	}
+
+	p.issuer = discovery.Issuer
+	p.authURL = discovery.AuthorizationEndpoint
+	p.tokenURL = discovery.TokenEndpoint
+	p.jwksURL = discovery.JWKSURI
+
+	if err := p.refreshKeys(ctx); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *OIDCProvider) Issuer() string {
+	return p.issuer
+}
+
+// AuthCodeURL is where the browser is sent to sign in. The challenge is
+// derived from verifier with S256.
+func (p *OIDCProvider) AuthCodeURL(state, nonce, verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.config.ClientID)
+	v.Set("redirect_uri", p.config.RedirectURL)
+	v.Set("scope", strings.Join(p.config.Scopes, " "))
+	v.Set("state", state)
+	v.Set("nonce", nonce)
+	v.Set("code_challenge", base64.RawURLEncoding.EncodeToString(sum[:]))
+	v.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(p.authURL, "?") {
+		sep = "&"
+	}
+	return p.authURL + sep + v.Encode()
+}
+
+// Exchange redeems an authorization code and verifies the returned ID token
+func (p *OIDCProvider) Exchange(ctx context.Context, code, verifier, nonce string) (*OIDCIdentity, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("client_id", p.config.ClientID)
+	form.Set("code_verifier", verifier)
+	if p.config.ClientSecret != "" {
+		form.Set("client_secret", p.config.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error while calling token endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("error while reading token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode, body)
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, fmt.Errorf("error while unmarshaling token response: %w", err)
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("token response has no id_token: %w", ErrInvalidIDToken)
+	}
+
+	return p.verify(ctx, tokens.IDToken, nonce)
+}
+
+// verify checks an ID token's signature, issuer, audience, expiry and nonce
+func (p *OIDCProvider) verify(ctx context.Context, raw, nonce string) (*OIDCIdentity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := p.key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("unexpected algorithm %q: %w", token.Method.Alg(), ErrInvalidIDToken)
+		}
+		return key.Public, nil
+	},
+		jwt.WithIssuer(p.issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return nil, fmt.Errorf("nonce mismatch: %w", ErrInvalidIDToken)
+	}
+
+	identity := &OIDCIdentity{}
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Email, _ = claims["email"].(string)
+	identity.Username, _ = claims["preferred_username"].(string)
+	if identity.Subject == "" {
+		return nil, fmt.Errorf("missing sub: %w", ErrInvalidIDToken)
+	}
+
+	// Some providers send email_verified as a string
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = v
+	case string:
+		identity.EmailVerified = v == "true"
+	}
+
+	identity.Groups = stringList(claims[p.config.GroupsClaim])
+	for _, method := range stringList(claims["amr"]) {
+		if method == "mfa" || method == "otp" || method == "hwk" {
+			identity.MFA = true
+		}
+	}
+
+	return identity, nil
+}
+
+// Role maps an identity's groups to the most privileged configured role. It
+// returns "" when no mapping is configured so local roles are left alone.
+func (p *OIDCProvider) Role(identity *OIDCIdentity) string {
+	if len(p.config.RoleMapping) == 0 {
+		return ""
+	}
+
+	role := RoleUser
+	for _, group := range identity.Groups {
+		if mapped, ok := p.config.RoleMapping[group]; ok && roleRank[mapped] > roleRank[role] {
+			role = mapped
+		}
+	}
+	return role
+}
+
+// key looks up a signing key, refetching the JWKS once if the provider
+// has rotated to a kid we haven't seen
+func (p *OIDCProvider) key(ctx context.Context, kid string) (*SigningKey, error) {
+	p.mu.Lock()
+	keys, fetched := p.keys, p.keysFetched
+	p.mu.Unlock()
+
+	if key, ok := keys.Lookup(kid); ok {
+		return key, nil
+	}
+	if time.Since(fetched) < oidcJWKSMinAge {
+		return nil, fmt.Errorf("unknown kid %q: %w", kid, ErrInvalidIDToken)
+	}
+
+	if err := p.refreshKeys(ctx); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys.Lookup(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown kid %q: %w", kid, ErrInvalidIDToken)
+}
+
+func (p *OIDCProvider) refreshKeys(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.jwksURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error while fetching JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("error while reading JWKS: %w", err)
+	}
+	keys, err := ParseJWKS(body)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.keysFetched = time.Now()
+	p.mu.Unlock()
+
+	return nil
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func stringList(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// oidcState is kept between the redirect to the provider and the callback
+type oidcState struct {
+	Verifier string `json:"verifier"`
+	Nonce    string `json:"nonce"`
+}
+
+// oidcLogin is a completed SSO login waiting for the frontend to collect its tokens
+type oidcLogin struct {
+	UserID string `json:"user_id"`
+	MFA    bool   `json:"mfa"`
+}
+
+// OIDCService links provider identities to local users
+type OIDCService struct {
+	provider   *OIDCProvider
+	users      UserRepository
+	identities IdentityRepository
+	tickets    TicketStore
+}
+
+func NewOIDCService(provider *OIDCProvider, users UserRepository, identities IdentityRepository, tickets TicketStore) *OIDCService {
+	return &OIDCService{
+		provider:   provider,
+		users:      users,
+		identities: identities,
+		tickets:    tickets,
+	}
+}
+
+// Begin starts a login and returns the provider URL to redirect to, along
+// with the state the browser must present again at the callback
+func (s *OIDCService) Begin(ctx context.Context) (string, string, error) {
+	state, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := s.tickets.Put(ctx, "auth:oidc_state:"+hashToken(state), &oidcState{Verifier: verifier, Nonce: nonce}, oidcStateTTL); err != nil {
+		return "", "", fmt.Errorf("error while storing sso state: %w", err)
+	}
+
+	return s.provider.AuthCodeURL(state, nonce, verifier), state, nil
+}
+
+// Complete handles the provider's callback, returning the signed-in user,
+// whether the provider reported a second factor and, if the user's role was
+// synced from their groups, the change that was made
+func (s *OIDCService) Complete(ctx context.Context, state, code string) (*User, bool, *RoleChangeEvent, error) {
+	var pending oidcState
+	if err := s.tickets.Take(ctx, "auth:oidc_state:"+hashToken(state), &pending); err != nil {
+		return nil, false, nil, err
+	}
+
+	identity, err := s.provider.Exchange(ctx, code, pending.Verifier, pending.Nonce)
+	if err != nil {
+		return nil, false, nil, err
+	}
+
+	user, err := s.resolve(identity)
+	if err != nil {
+		return nil, false, nil, err
+	}
+
+	var change *RoleChangeEvent
+	if role := s.provider.Role(identity); role != "" && role != user.Role {
+		change = &RoleChangeEvent{UserID: user.ID, From: user.Role, To: role, Reason: "synced from identity provider groups"}
+		if err := s.users.UpdateRole(user.ID, role); err != nil {
+			return nil, false, nil, fmt.Errorf("error while syncing role: %w", err)
+		}
+		user.Role = role
+	}
+
+	return user, identity.MFA, change, nil
+}
+
+// resolve finds the user linked to an identity, links an existing account
+// with the same verified email, or creates one
+func (s *OIDCService) resolve(identity *OIDCIdentity) (*User, error) {
+	issuer := s.provider.Issuer()
+
+	linked, err := s.identities.FindBySubject(issuer, identity.Subject)
+	if err == nil {
+		return s.users.FindByID(linked.UserID)
+	}
+	if !errors.Is(err, ErrIdentityNotFound) {
+		return nil, fmt.Errorf("error while finding identity: %w", err)
+	}
+
+	// Only an email the provider vouches for may take over an account
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+
+	user, err := s.users.FindByEmail(identity.Email)
+	if errors.Is(err, ErrUserNotFound) {
+		if !s.provider.config.AllowSignup {
+			return nil, ErrOIDCSignupDisabled
+		}
+		user, err = s.signup(identity)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if user.VerifiedAt == nil {
+		if err := s.users.MarkVerified(user.ID); err != nil {
+			return nil, fmt.Errorf("error while marking user verified: %w", err)
+		}
+		now := time.Now()
+		user.VerifiedAt = &now
+	}
+
+	if err := s.identities.Create(&Identity{
+		UserID:  user.ID,
+		Issuer:  issuer,
+		Subject: identity.Subject,
+		Email:   identity.Email,
+	}); err != nil {
+		return nil, fmt.Errorf("error while linking identity: %w", err)
+	}
+
+	return user, nil
+}
+
+var usernameDisallowed = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// signup creates an account for a new identity. It gets an unusable random
+// password; the user can set one through the reset flow.
+func (s *OIDCService) signup(identity *OIDCIdentity) (*User, error) {
+	raw, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(raw), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("error while generating password hash: %w", err)
+	}
+
+	base := identity.Username
+	if base == "" {
+		base, _, _ = strings.Cut(identity.Email, "@")
+	}
+	base = usernameDisallowed.ReplaceAllString(base, "")
+	if len(base) > 26 {
+		base = base[:26]
+	}
+	for len(base) < 3 {
+		base += "_"
+	}
+
+	username := base
+	for attempt := 0; ; attempt++ {
+		user := &User{
+			Email:        identity.Email,
+			PasswordHash: string(hash),
+			Username:     username,
+			Role:         RoleUser,
+		}
+		err := s.users.Create(user)
+		if err == nil {
+			return user, nil
+		}
+		if !errors.Is(err, ErrUsernameExists) || attempt == 5 {
+			return nil, fmt.Errorf("error while creating user: %w", err)
+		}
+
+		suffix, err := randomToken()
+		if err != nil {
+			return nil, err
+		}
+		username = base + "-" + hashToken(suffix)[:5]
+	}
+}
+
+// IssueLoginCode hands a completed login to the frontend through a short-lived
+// single-use code, keeping tokens out of redirect URLs
+func (s *OIDCService) IssueLoginCode(ctx context.Context, userID string, mfa bool) (string, error) {
+	code, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	if err := s.tickets.Put(ctx, "auth:oidc_login:"+hashToken(code), &oidcLogin{UserID: userID, MFA: mfa}, oidcLoginCodeTTL); err != nil {
+		return "", fmt.Errorf("error while storing sso login: %w", err)
+	}
+	return code, nil
+}
+
+// RedeemLoginCode consumes a code from IssueLoginCode
+func (s *OIDCService) RedeemLoginCode(ctx context.Context, code string) (string, bool, error) {
+	var login oidcLogin
+	if err := s.tickets.Take(ctx, "auth:oidc_login:"+hashToken(code), &login); err != nil {
+		return "", false, err
+	}
+	return login.UserID, login.MFA, nil
+}
+
+// OIDCHandler serves single sign-on alongside password logins
+type OIDCHandler struct {
+	auth    *Handler
+	service *OIDCService
+	appURL  string
+}
+
+func NewOIDCHandler(authHandler *Handler, service *OIDCService, appURL string) *OIDCHandler {
+	return &OIDCHandler{
+		auth:    authHandler,
+		service: service,
+		appURL:  appURL,
+	}
+}
+
+// Login redirects the browser to the identity provider. The state is also
+// kept in a cookie so a callback only completes in the browser that started
+// the login.
+func (h *OIDCHandler) Login(c *gin.Context) {
+	target, state, err := h.service.Begin(c.Request.Context())
+	if err != nil {
+		log.Printf("error while starting sso login: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to start sso login",
+		})
+		return
+	}
+
+	h.setStateCookie(c, state, int(oidcStateTTL.Seconds()))
+	c.Redirect(http.StatusFound, target)
+}
+
+// Callback receives the provider's redirect and sends the browser back to the
+// frontend with a single-use code for POST /auth/oidc/exchange. Failures go
+// back to the login page with sso_error set.
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	cookie, _ := c.Cookie(oidcStateCookie)
+	h.setStateCookie(c, "", -1)
+
+	if providerErr := c.Query("error"); providerErr != "" {
+		h.fail(c, providerErr)
+		return
+	}
+
+	state := c.Query("state")
+	if cookie == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(state)) != 1 {
+		h.fail(c, ErrInvalidOIDCState.Error())
+		return
+	}
+
+	ctx := c.Request.Context()
+	user, mfa, roleChange, err := h.service.Complete(ctx, state, c.Query("code"))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidOIDCState), errors.Is(err, ErrEmailNotVerified), errors.Is(err, ErrOIDCSignupDisabled):
+			h.fail(c, err.Error())
+		default:
+			log.Printf("error while completing sso login: %v", err)
+			h.fail(c, "sso login failed")
+		}
+		return
+	}
+
+	if roleChange != nil {
+		if err := h.auth.InvalidateAccessTokens(ctx, user.ID); err != nil {
+			log.Printf("error while invalidating access tokens: %v", err)
+		}
+		h.auth.roleChanged(roleChange)
+	}
+
+	code, err := h.service.IssueLoginCode(ctx, user.ID, mfa)
+	if err != nil {
+		log.Printf("error while issuing sso login code: %v", err)
+		h.fail(c, "sso login failed")
+		return
+	}
+
+	// A fragment isn't sent to servers or kept in their logs
+	c.Redirect(http.StatusFound, h.appURL+"/sso/callback#code="+url.QueryEscape(code))
+}
+
+// setStateCookie stores the login state for the callback, or clears it when
+// maxAge is negative
+func (h *OIDCHandler) setStateCookie(c *gin.Context, state string, maxAge int) {
+	secure := strings.HasPrefix(h.service.provider.config.RedirectURL, "https://")
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, maxAge, "/auth/oidc", "", secure, true)
+}
+
+// Exchange trades the code from Callback for tokens, starting a session
+func (h *OIDCHandler) Exchange(c *gin.Context) {
+	var req OIDCExchangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	userID, mfa, err := h.service.RedeemLoginCode(c.Request.Context(), req.Code)
+	if err != nil {
+		if !errors.Is(err, ErrInvalidOIDCState) {
+			log.Printf("error while redeeming sso login code: %v", err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "invalid or expired sso code",
+		})
+		return
+	}
+
+	user, err := h.auth.service.GetUser(userID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "invalid or expired sso code",
+		})
+		return
+	}
+
+	resp, err := h.auth.startSession(c, user, mfa)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to generate token",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *OIDCHandler) fail(c *gin.Context, reason string) {
+	c.Redirect(http.StatusFound, h.appURL+"/login?sso_error="+url.QueryEscape(reason))
+}
+
+func RegisterOIDCRoutes(r *gin.Engine, authHandler *Handler, provider *OIDCProvider, appURL string) *OIDCHandler {
+	service := NewOIDCService(provider, NewUserRepository(), NewIdentityRepository(), NewTicketStore())
+	handler := NewOIDCHandler(authHandler, service, appURL)
+
+	r.GET("/auth/oidc/login", handler.Login)
+	r.GET("/auth/oidc/callback", handler.Callback)
+	r.POST("/auth/oidc/exchange", handler.Exchange)
+
+	return handler
+}
+
+// TicketStore keeps small single-use values, such as SSO state, for a short time
+type TicketStore interface {
+	Put(ctx context.Context, key string, value any, ttl time.Duration) error
+	// Take loads and deletes a value, returning ErrInvalidOIDCState if it
+	// is missing or expired
+	Take(ctx context.Context, key string, value any) error
+}
+
+type redisTicketStore struct{}
+
+func NewTicketStore() TicketStore {
+	return &redisTicketStore{}
+}
+
+func (s *redisTicketStore) Put(ctx context.Context, key string, value any, ttl time.Duration) error {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return redis.Client.Set(ctx, key, b, ttl).Err()
+}
+
+func (s *redisTicketStore) Take(ctx context.Context, key string, value any) error {
+	b, err := redis.Client.GetDel(ctx, key).Bytes()
+	if errors.Is(err, goredis.Nil) {
+		return ErrInvalidOIDCState
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, value)
+}
+
+// validScopes always includes openid, which makes the flow OIDC
+func validScopes(scopes []string) []string {
+	if !slices.Contains(scopes, "openid") {
+		scopes = append([]string{"openid"}, scopes...)
+	}
+	return scopes
+}
@@ -0,0 +1,373 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mr1hm/go-chat-moderator/internal/auth/oidctest"
+)
+
+// Mock ticket store for testing
+type mockTicketStore struct {
+	values map[string][]byte
+}
+
+func (m *mockTicketStore) Put(ctx context.Context, key string, value any, ttl time.Duration) error {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	m.values[key] = b
+	return nil
+}
+
+func (m *mockTicketStore) Take(ctx context.Context, key string, value any) error {
+	b, ok := m.values[key]
+	if !ok {
+		return ErrInvalidOIDCState
+	}
+	delete(m.values, key)
+	return json.Unmarshal(b, value)
+}
+
+// Mock identity repository for testing
+type mockIdentityRepo struct {
+	identities []*Identity
+}
+
+func (m *mockIdentityRepo) FindBySubject(issuer, subject string) (*Identity, error) {
+	for _, i := range m.identities {
+		if i.Issuer == issuer && i.Subject == subject {
+			return i, nil
+		}
+	}
+	return nil, ErrIdentityNotFound
+}
+
+func (m *mockIdentityRepo) Create(identity *Identity) error {
+	identity.ID = "identity-" + identity.Subject
+	m.identities = append(m.identities, identity)
+	return nil
+}
+
+func newTestOIDCService(t *testing.T, config OIDCConfig) (*OIDCService, *oidctest.Issuer, *mockUserRepo) {
+	t.Helper()
+	issuer := oidctest.Start("chat")
+	t.Cleanup(issuer.Close)
+
+	config.IssuerURL = issuer.URL
+	config.ClientID = "chat"
+	config.RedirectURL = "http://api.test/auth/oidc/callback"
+	config.GroupsClaim = "groups"
+
+	provider, err := NewOIDCProvider(context.Background(), config)
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+
+	users := newMockRepo()
+	svc := NewOIDCService(provider, users, &mockIdentityRepo{}, &mockTicketStore{values: make(map[string][]byte)})
+	return svc, issuer, users
+}
+
+// authorize follows Begin's URL to the issuer and returns the state and
+// code it redirects back with
+func authorize(t *testing.T, svc *OIDCService) (string, string) {
+	t.Helper()
+	target, _, err := svc.Begin(context.Background())
+	if err != nil {
+		t.Fatalf("failed to begin: %v", err)
+	}
+	return followToIssuer(t, target)
+}
+
+// followToIssuer sends the browser to an authorization URL and returns the
+// state and code the issuer redirects back with
+func followToIssuer(t *testing.T, target string) (string, string) {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(target)
+	if err != nil {
+		t.Fatalf("failed to authorize: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("expected redirect from issuer, got %d", resp.StatusCode)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("failed to parse redirect: %v", err)
+	}
+	return location.Query().Get("state"), location.Query().Get("code")
+}
+
+func TestOIDCService_Complete_SignupWithRoleMapping(t *testing.T) {
+	svc, issuer, users := newTestOIDCService(t, OIDCConfig{
+		AllowSignup: true,
+		RoleMapping: map[string]string{"chat-mods": RoleModerator, "chat-admins": RoleAdmin},
+	})
+	issuer.SetUser(oidctest.User{
+		Subject:       "sub-1",
+		Email:         "staff@example.com",
+		EmailVerified: true,
+		Username:      "staff member",
+		Groups:        []string{"everyone", "chat-mods"},
+		AMR:           []string{"pwd", "mfa"},
+	})
+
+	state, code := authorize(t, svc)
+	user, mfa, _, err := svc.Complete(context.Background(), state, code)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if user.Email != "staff@example.com" || user.Username != "staffmember" {
+		t.Errorf("unexpected user %+v", user)
+	}
+	if user.Role != RoleModerator {
+		t.Errorf("expected role %s, got %s", RoleModerator, user.Role)
+	}
+	if user.VerifiedAt == nil {
+		t.Error("expected user to be verified")
+	}
+	if !mfa {
+		t.Error("expected mfa from amr")
+	}
+
+	// A second login finds the same user through the linked identity
+	state, code = authorize(t, svc)
+	again, _, _, err := svc.Complete(context.Background(), state, code)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if again.ID != user.ID || len(users.users) != 1 {
+		t.Errorf("expected the linked user, got %+v", again)
+	}
+}
+
+func TestOIDCService_Complete_LinksExistingUser(t *testing.T) {
+	svc, issuer, users := newTestOIDCService(t, OIDCConfig{})
+	users.users["user-123"] = &User{ID: "user-123", Email: "test@example.com", Username: "testuser", Role: RoleAdmin}
+	issuer.SetUser(oidctest.User{Subject: "sub-1", Email: "test@example.com", EmailVerified: true})
+
+	state, code := authorize(t, svc)
+	user, mfa, _, err := svc.Complete(context.Background(), state, code)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if user.ID != "user-123" {
+		t.Errorf("expected user-123, got %s", user.ID)
+	}
+	// Without a role mapping the local role is kept
+	if user.Role != RoleAdmin {
+		t.Errorf("expected role to be kept, got %s", user.Role)
+	}
+	if mfa {
+		t.Error("expected no mfa")
+	}
+}
+
+func TestOIDCService_Complete_SyncsRole(t *testing.T) {
+	svc, issuer, users := newTestOIDCService(t, OIDCConfig{
+		RoleMapping: map[string]string{"chat-mods": RoleModerator},
+	})
+	users.users["user-123"] = &User{ID: "user-123", Email: "test@example.com", Username: "testuser", Role: RoleUser}
+	issuer.SetUser(oidctest.User{Subject: "sub-1", Email: "test@example.com", EmailVerified: true, Groups: []string{"chat-mods"}})
+
+	state, code := authorize(t, svc)
+	user, _, change, err := svc.Complete(context.Background(), state, code)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if user.Role != RoleModerator || users.users["user-123"].Role != RoleModerator {
+		t.Errorf("expected role %s, got %s", RoleModerator, user.Role)
+	}
+	if change == nil || change.UserID != "user-123" || change.From != RoleUser || change.To != RoleModerator {
+		t.Errorf("unexpected role change %+v", change)
+	}
+
+	// Once in sync, logging in again changes nothing
+	state, code = authorize(t, svc)
+	if _, _, change, err := svc.Complete(context.Background(), state, code); err != nil || change != nil {
+		t.Errorf("expected no role change, got %+v, %v", change, err)
+	}
+}
+
+func TestOIDCHandler_Callback(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	svc, issuer, users := newTestOIDCService(t, OIDCConfig{
+		RoleMapping: map[string]string{"chat-mods": RoleModerator},
+	})
+	users.users["user-123"] = &User{ID: "user-123", Email: "test@example.com", Username: "testuser", Role: RoleUser}
+	issuer.SetUser(oidctest.User{Subject: "sub-1", Email: "test@example.com", EmailVerified: true, Groups: []string{"chat-mods"}})
+
+	store := newMockRevocationStore()
+	authHandler := newRevocationTestHandler(store)
+	var changes []*RoleChangeEvent
+	authHandler.OnRoleChange(func(e *RoleChangeEvent) { changes = append(changes, e) })
+	h := NewOIDCHandler(authHandler, svc, "http://app.test")
+
+	r := gin.New()
+	r.GET("/auth/oidc/login", h.Login)
+	r.GET("/auth/oidc/callback", h.Callback)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/oidc/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("expected status %d, got %d", http.StatusFound, w.Code)
+	}
+	var cookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == oidcStateCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode || cookie.MaxAge <= 0 {
+		t.Fatalf("expected a short-lived HttpOnly SameSite=Lax state cookie, got %+v", cookie)
+	}
+
+	state, code := followToIssuer(t, w.Header().Get("Location"))
+	callback := "/auth/oidc/callback?state=" + url.QueryEscape(state) + "&code=" + url.QueryEscape(code)
+
+	// A callback from a browser that didn't start the login is refused
+	// without using up the state
+	for _, value := range []string{"", "other-state"} {
+		req := httptest.NewRequest(http.MethodGet, callback, nil)
+		if value != "" {
+			req.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: value})
+		}
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if location := w.Header().Get("Location"); !strings.Contains(location, "sso_error=") {
+			t.Errorf("cookie %q: expected an sso error, got redirect to %s", value, location)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, callback, nil)
+	req.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: cookie.Value})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if location := w.Header().Get("Location"); !strings.HasPrefix(location, "http://app.test/sso/callback#code=") {
+		t.Fatalf("expected redirect to the frontend, got %s", location)
+	}
+	for _, c := range w.Result().Cookies() {
+		if c.Name == oidcStateCookie && c.MaxAge >= 0 {
+			t.Error("expected the state cookie to be cleared")
+		}
+	}
+
+	// The synced role takes effect on the user's existing tokens
+	if store.versions["user-123"] != 1 {
+		t.Errorf("expected access tokens to be invalidated, got version %d", store.versions["user-123"])
+	}
+	if len(changes) != 1 || changes[0].From != RoleUser || changes[0].To != RoleModerator {
+		t.Errorf("expected one role change callback, got %+v", changes)
+	}
+}
+
+func TestOIDCService_Complete_UnverifiedEmail(t *testing.T) {
+	svc, issuer, users := newTestOIDCService(t, OIDCConfig{AllowSignup: true})
+	users.users["user-123"] = &User{ID: "user-123", Email: "test@example.com", Username: "testuser"}
+	issuer.SetUser(oidctest.User{Subject: "sub-1", Email: "test@example.com"})
+
+	state, code := authorize(t, svc)
+	if _, _, _, err := svc.Complete(context.Background(), state, code); !errors.Is(err, ErrEmailNotVerified) {
+		t.Errorf("expected ErrEmailNotVerified, got %v", err)
+	}
+}
+
+func TestOIDCService_Complete_SignupDisabled(t *testing.T) {
+	svc, issuer, users := newTestOIDCService(t, OIDCConfig{})
+	issuer.SetUser(oidctest.User{Subject: "sub-1", Email: "new@example.com", EmailVerified: true})
+
+	state, code := authorize(t, svc)
+	if _, _, _, err := svc.Complete(context.Background(), state, code); !errors.Is(err, ErrOIDCSignupDisabled) {
+		t.Errorf("expected ErrOIDCSignupDisabled, got %v", err)
+	}
+	if len(users.users) != 0 {
+		t.Error("expected no user to be created")
+	}
+}
+
+func TestOIDCService_Complete_StateSingleUse(t *testing.T) {
+	svc, _, _ := newTestOIDCService(t, OIDCConfig{AllowSignup: true})
+
+	state, code := authorize(t, svc)
+	if _, _, _, err := svc.Complete(context.Background(), state, code); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, _, _, err := svc.Complete(context.Background(), state, code); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Errorf("expected ErrInvalidOIDCState on reuse, got %v", err)
+	}
+	if _, _, _, err := svc.Complete(context.Background(), "forged", code); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Errorf("expected ErrInvalidOIDCState for unknown state, got %v", err)
+	}
+}
+
+func TestOIDCService_Complete_CodeFromAnotherLogin(t *testing.T) {
+	svc, _, _ := newTestOIDCService(t, OIDCConfig{AllowSignup: true})
+
+	// The code is bound to the first login's PKCE verifier
+	_, code := authorize(t, svc)
+	state, _ := authorize(t, svc)
+	if _, _, _, err := svc.Complete(context.Background(), state, code); err == nil {
+		t.Error("expected an error for a code from another login")
+	}
+}
+
+func TestOIDCProvider_Exchange_NonceMismatch(t *testing.T) {
+	svc, _, _ := newTestOIDCService(t, OIDCConfig{AllowSignup: true})
+
+	state, code := authorize(t, svc)
+	var pending oidcState
+	if err := svc.tickets.Take(context.Background(), "auth:oidc_state:"+hashToken(state), &pending); err != nil {
+		t.Fatalf("failed to load state: %v", err)
+	}
+
+	if _, err := svc.provider.Exchange(context.Background(), code, pending.Verifier, "other-nonce"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("expected ErrInvalidIDToken, got %v", err)
+	}
+}
+
+func TestOIDCProvider_Exchange_WrongAudience(t *testing.T) {
+	svc, issuer, _ := newTestOIDCService(t, OIDCConfig{AllowSignup: true})
+	issuer.Audience = "other-client"
+
+	state, code := authorize(t, svc)
+	if _, _, _, err := svc.Complete(context.Background(), state, code); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("expected ErrInvalidIDToken, got %v", err)
+	}
+}
+
+func TestOIDCProvider_Role(t *testing.T) {
+	p := &OIDCProvider{config: OIDCConfig{RoleMapping: map[string]string{"mods": RoleModerator, "admins": RoleAdmin}}}
+
+	tests := []struct {
+		groups []string
+		want   string
+	}{
+		{nil, RoleUser},
+		{[]string{"mods"}, RoleModerator},
+		{[]string{"admins", "mods"}, RoleAdmin},
+	}
+	for _, tt := range tests {
+		if got := p.Role(&OIDCIdentity{Groups: tt.groups}); got != tt.want {
+			t.Errorf("Role(%v) = %s, want %s", tt.groups, got, tt.want)
+		}
+	}
+
+	if got := (&OIDCProvider{}).Role(&OIDCIdentity{Groups: []string{"admins"}}); got != "" {
+		t.Errorf("expected no role without a mapping, got %s", got)
+	}
+}
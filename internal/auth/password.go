@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrWeakPassword = errors.New("password does not meet policy")
+
+// bcrypt ignores everything past 72 bytes
+const maxPasswordBytes = 72
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+var commonPasswords = parsePasswordList(commonPasswordList)
+
+// PasswordPolicy is checked whenever a password is set
+type PasswordPolicy struct {
+	MinLength   int
+	CheckCommon bool // Refuse passwords on the bundled common password list
+}
+
+func DefaultPasswordPolicy() *PasswordPolicy {
+	return &PasswordPolicy{
+		MinLength:   8,
+		CheckCommon: true,
+	}
+}
+
+// Validate returns an error wrapping ErrWeakPassword that says what is wrong.
+// Identifiers are values such as the email and username the password must
+// not repeat.
+func (p *PasswordPolicy) Validate(password string, identifiers ...string) error {
+	if len([]rune(password)) < p.MinLength {
+		return fmt.Errorf("%w: must be at least %d characters", ErrWeakPassword, p.MinLength)
+	}
+	if len(password) > maxPasswordBytes {
+		return fmt.Errorf("%w: must be at most %d bytes", ErrWeakPassword, maxPasswordBytes)
+	}
+
+	lower := strings.ToLower(password)
+	for _, id := range identifiers {
+		if id != "" && lower == strings.ToLower(id) {
+			return fmt.Errorf("%w: must not match your email or username", ErrWeakPassword)
+		}
+	}
+
+	if p.CheckCommon {
+		if _, ok := commonPasswords[lower]; ok {
+			return fmt.Errorf("%w: too common", ErrWeakPassword)
+		}
+	}
+
+	return nil
+}
+
+func parsePasswordList(list string) map[string]struct{} {
+	passwords := make(map[string]struct{})
+	scanner := bufio.NewScanner(strings.NewReader(list))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		passwords[strings.ToLower(line)] = struct{}{}
+	}
+	return passwords
+}
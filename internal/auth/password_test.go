@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicy_Validate(t *testing.T) {
+	policy := DefaultPasswordPolicy()
+
+	tests := []struct {
+		name     string
+		password string
+		wantErr  bool
+	}{
+		{"long enough", "correct-horse", false},
+		{"too short", "s3cr3t!", true},
+		{"common", "password123", true},
+		{"common any case", "PassWord123", true},
+		{"matches email", "test@example.com", true},
+		{"matches username", "TestUser99", true},
+		{"too long for bcrypt", strings.Repeat("x", 73), true},
+	}
+
+	for _, tt := range tests {
+		err := policy.Validate(tt.password, "test@example.com", "testuser99")
+		if tt.wantErr && !errors.Is(err, ErrWeakPassword) {
+			t.Errorf("%s: expected ErrWeakPassword, got %v", tt.name, err)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("%s: expected no error, got %v", tt.name, err)
+		}
+	}
+}
+
+func TestPasswordPolicy_Validate_CommonCheckDisabled(t *testing.T) {
+	policy := &PasswordPolicy{MinLength: 8}
+
+	if err := policy.Validate("password123"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
@@ -0,0 +1,446 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrUsernameRejected    = errors.New("username not allowed")
+	ErrDisplayNameRejected = errors.New("display name not allowed")
+	ErrBioRejected         = errors.New("bio not allowed")
+	ErrContentCheck        = errors.New("content check unavailable")
+	ErrUnknownDeletion     = errors.New("unknown account deletion policy")
+	ErrBotProfileChange    = errors.New("bot accounts are managed by admins")
+	ErrLastAdminDeletion   = errors.New("the last admin can't delete their account")
+)
+
+// Account deletion policies, deciding what happens to a user's messages
+const (
+	DeletionAnonymize = "anonymize" // Keep messages under a placeholder name
+	DeletionPurge     = "purge"     // Delete messages and their moderation history
+)
+
+// ContentChecker screens text users choose for themselves: usernames,
+// display names and bios. moderation.Scorer satisfies it; auth can't import moderation,
+// so main wires it with SetContentChecker.
+type ContentChecker interface {
+	Flags(text string) (bool, error)
+}
+
+// SetContentChecker enables moderation of usernames and profiles. Without
+// one, usernames are only checked for uniqueness.
+func (s *AuthService) SetContentChecker(checker ContentChecker) {
+	s.content = checker
+}
+
+// SetAccountDeletion sets what happens to messages when users delete their account
+func (s *AuthService) SetAccountDeletion(policy string) error {
+	if policy != DeletionAnonymize && policy != DeletionPurge {
+		return fmt.Errorf("%w: %s", ErrUnknownDeletion, policy)
+	}
+	s.deletion = policy
+	return nil
+}
+
+// AccountDeletion returns the configured deletion policy
+func (s *AuthService) AccountDeletion() string {
+	if s.deletion == "" {
+		return DeletionAnonymize
+	}
+	return s.deletion
+}
+
+// checkUsername refuses usernames the moderation provider flags
+func (s *AuthService) checkUsername(username string) error {
+	return s.checkText(username, ErrUsernameRejected)
+}
+
+// checkText returns rejected if the moderation provider flags text. Errors
+// from the provider refuse the text too, so nothing slips through an outage.
+func (s *AuthService) checkText(text string, rejected error) error {
+	if s.content == nil || text == "" {
+		return nil
+	}
+	flagged, err := s.content.Flags(text)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrContentCheck, err)
+	}
+	if flagged {
+		return rejected
+	}
+	return nil
+}
+
+// UpdateUsername renames a user, enforcing uniqueness and moderation
+func (s *AuthService) UpdateUsername(userID, username string) (*User, error) {
+	user, err := s.repo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Bot {
+		return nil, ErrBotProfileChange
+	}
+	if user.Username == username {
+		return user, nil
+	}
+
+	if err := s.checkUsername(username); err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateUsername(userID, username); err != nil {
+		return nil, err
+	}
+
+	user.Username = username
+	return user, nil
+}
+
+// GetPublicProfile returns what other users can see about a user
+func (s *AuthService) GetPublicProfile(userID string) (*PublicProfile, error) {
+	user, err := s.repo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	return user.Public(), nil
+}
+
+// UpdateProfile sets a user's display name and bio. Changed text is checked
+// by moderation; unchanged text isn't checked again.
+func (s *AuthService) UpdateProfile(userID, displayName, bio string) (*User, error) {
+	user, err := s.repo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	displayName, bio = strings.TrimSpace(displayName), strings.TrimSpace(bio)
+	if displayName != user.DisplayName {
+		if err := s.checkText(displayName, ErrDisplayNameRejected); err != nil {
+			return nil, err
+		}
+	}
+	if bio != user.Bio {
+		if err := s.checkText(bio, ErrBioRejected); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.repo.UpdateProfile(userID, displayName, bio); err != nil {
+		return nil, err
+	}
+
+	user.DisplayName, user.Bio = displayName, bio
+	return user, nil
+}
+
+// UpdateEmail changes a user's address after checking their password. The
+// new address is unverified until confirmed.
+func (s *AuthService) UpdateEmail(userID, password, email string) (*User, error) {
+	user, err := s.checkPassword(userID, password)
+	if err != nil {
+		return nil, err
+	}
+	if user.Email == email {
+		return user, nil
+	}
+
+	if err := s.repo.UpdateEmail(userID, email); err != nil {
+		return nil, err
+	}
+
+	user.Email = email
+	user.VerifiedAt = nil
+	return user, nil
+}
+
+// ChangePassword sets a new password after checking the current one
+func (s *AuthService) ChangePassword(userID, current, password string) error {
+	user, err := s.checkPassword(userID, current)
+	if err != nil {
+		return err
+	}
+
+	if err := s.passwords.Validate(password, user.Email, user.Username); err != nil {
+		return err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("error while generating password hash: %w", err)
+	}
+
+	return s.repo.UpdatePassword(userID, string(hash))
+}
+
+// DeleteAccount deletes a user after checking their password, handling
+// their messages by the configured policy
+func (s *AuthService) DeleteAccount(userID, password string) error {
+	user, err := s.checkPassword(userID, password)
+	if err != nil {
+		return err
+	}
+
+	if user.Role == RoleAdmin {
+		admins, err := s.repo.CountByRole(RoleAdmin)
+		if err != nil {
+			return fmt.Errorf("error while counting admins: %w", err)
+		}
+		if admins <= 1 {
+			return ErrLastAdminDeletion
+		}
+	}
+
+	if err := s.repo.Delete(userID, s.AccountDeletion() == DeletionPurge); err != nil {
+		return err
+	}
+	s.deleteAvatar(context.Background(), user.AvatarKey)
+
+	return nil
+}
+
+// checkPassword loads a user and confirms their password. Bots have no
+// usable password, so they always fail.
+func (s *AuthService) checkPassword(userID, password string) (*User, error) {
+	user, err := s.repo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Bot {
+		return nil, ErrBotProfileChange
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return user, nil
+}
+
+// UpdateUsername renames the current user. Access tokens carry the username,
+// so they are invalidated and clients refresh to pick up the new one.
+func (h *Handler) UpdateUsername(c *gin.Context) {
+	var req UpdateUsernameRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	claims := c.MustGet("claims").(*Claims)
+	ctx := c.Request.Context()
+
+	user, err := h.service.UpdateUsername(claims.UserID, req.Username)
+	if err != nil {
+		abortProfileError(c, err)
+		return
+	}
+
+	if user.Username != claims.Username {
+		if err := h.InvalidateAccessTokens(ctx, user.ID); err != nil {
+			log.Printf("error while invalidating access tokens: %v", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// GetUser returns another user's public profile
+func (h *Handler) GetUser(c *gin.Context) {
+	profile, err := h.service.GetPublicProfile(c.Param("id"))
+	if err != nil {
+		abortProfileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// UpdateProfile sets the current user's display name and bio
+func (h *Handler) UpdateProfile(c *gin.Context) {
+	var req UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	claims := c.MustGet("claims").(*Claims)
+
+	user, err := h.service.UpdateProfile(claims.UserID, req.DisplayName, req.Bio)
+	if err != nil {
+		abortProfileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// UpdateEmail changes the current user's address and emails a verification
+// link to the new one
+func (h *Handler) UpdateEmail(c *gin.Context) {
+	var req UpdateEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	claims := c.MustGet("claims").(*Claims)
+	ctx := c.Request.Context()
+
+	user, err := h.service.UpdateEmail(claims.UserID, req.Password, req.Email)
+	if err != nil {
+		abortProfileError(c, err)
+		return
+	}
+	if user.VerifiedAt != nil {
+		c.JSON(http.StatusOK, user)
+		return
+	}
+
+	// Earlier links were for the old address; Send invalidates them
+	if err := h.verifyService.Send(ctx, user); err != nil {
+		log.Printf("error while sending verification email: %v", err)
+	}
+	if err := h.InvalidateAccessTokens(ctx, user.ID); err != nil {
+		log.Printf("error while invalidating access tokens: %v", err)
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// ChangePassword sets a new password for the current user and logs out
+// every other session. The requesting session stays logged in.
+func (h *Handler) ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	claims := c.MustGet("claims").(*Claims)
+
+	if err := h.service.ChangePassword(claims.UserID, req.CurrentPassword, req.NewPassword); err != nil {
+		abortProfileError(c, err)
+		return
+	}
+
+	if err := h.revokeOtherSessions(c.Request.Context(), claims.UserID, claims.SessionID); err != nil {
+		log.Printf("error while revoking sessions after password change: %v", err)
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// DeleteAccount deletes the current user and logs them out everywhere
+func (h *Handler) DeleteAccount(c *gin.Context) {
+	var req DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	claims := c.MustGet("claims").(*Claims)
+	ctx := c.Request.Context()
+
+	if err := h.service.DeleteAccount(claims.UserID, req.Password); err != nil {
+		abortProfileError(c, err)
+		return
+	}
+
+	// Refresh tokens, sessions and API keys are gone with the account; this
+	// rejects outstanding access tokens and closes websockets
+	if err := h.InvalidateAccessTokens(ctx, claims.UserID); err != nil {
+		log.Printf("error while invalidating access tokens: %v", err)
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// revokeOtherSessions ends every session of a user except keepID and closes
+// their websockets. Tokens without a session can't be told apart, so when
+// keepID is empty every session is revoked.
+func (h *Handler) revokeOtherSessions(ctx context.Context, userID, keepID string) error {
+	if keepID == "" {
+		return h.revokeAllSessions(ctx, userID)
+	}
+
+	sessions, err := h.sessions.ListActive(userID)
+	if err != nil {
+		return fmt.Errorf("error while listing sessions: %w", err)
+	}
+
+	for _, session := range sessions {
+		if session.ID == keepID {
+			continue
+		}
+		if err := h.revokeSession(ctx, session.ID); err != nil {
+			return err
+		}
+		if err := h.revocations.Publish(ctx, &RevocationEvent{UserID: userID, SessionID: session.ID}); err != nil {
+			log.Printf("error while publishing revocation: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// abortProfileError answers a failed profile change
+func abortProfileError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrUserNotFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": ErrUserNotFound.Error(),
+		})
+	case errors.Is(err, ErrInvalidCredentials):
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "current password is incorrect",
+		})
+	case errors.Is(err, ErrUsernameExists), errors.Is(err, ErrEmailExists):
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+		})
+	case errors.Is(err, ErrUsernameRejected), errors.Is(err, ErrWeakPassword),
+		errors.Is(err, ErrDisplayNameRejected), errors.Is(err, ErrBioRejected),
+		errors.Is(err, ErrAvatarType), errors.Is(err, ErrAvatarDimensions):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+	case errors.Is(err, ErrAvatarTooLarge):
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error": err.Error(),
+		})
+	case errors.Is(err, ErrAvatarsDisabled):
+		c.AbortWithStatusJSON(http.StatusNotImplemented, gin.H{
+			"error": err.Error(),
+		})
+	case errors.Is(err, ErrBotProfileChange), errors.Is(err, ErrLastAdminDeletion):
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": err.Error(),
+		})
+	case errors.Is(err, ErrContentCheck):
+		log.Printf("error while checking profile: %v", err)
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"error": "couldn't check profile, try again later",
+		})
+	default:
+		log.Printf("error while updating profile: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to update profile",
+		})
+	}
+}
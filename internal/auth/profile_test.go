@@ -0,0 +1,339 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Mock content checker flagging a fixed set of words
+type mockContentChecker struct {
+	flagged map[string]bool
+	err     error
+}
+
+func (m *mockContentChecker) Flags(text string) (bool, error) {
+	return m.flagged[text], m.err
+}
+
+// Mock session repository for testing
+type mockSessionRepo struct {
+	sessions map[string]*Session
+}
+
+func newMockSessionRepo() *mockSessionRepo {
+	return &mockSessionRepo{
+		sessions: make(map[string]*Session),
+	}
+}
+
+func (m *mockSessionRepo) Create(session *Session) error {
+	m.sessions[session.ID] = session
+	return nil
+}
+
+func (m *mockSessionRepo) FindByID(id string) (*Session, error) {
+	if s, ok := m.sessions[id]; ok {
+		return s, nil
+	}
+	return nil, ErrSessionNotFound
+}
+
+func (m *mockSessionRepo) ListActive(userID string) ([]Session, error) {
+	var active []Session
+	for _, s := range m.sessions {
+		if s.UserID == userID && s.RevokedAt == nil {
+			active = append(active, *s)
+		}
+	}
+	return active, nil
+}
+
+func (m *mockSessionRepo) Touch(id string) error {
+	return nil
+}
+
+func (m *mockSessionRepo) Revoke(id string) error {
+	if s, ok := m.sessions[id]; ok {
+		now := time.Now()
+		s.RevokedAt = &now
+	}
+	return nil
+}
+
+func (m *mockSessionRepo) RevokeUser(userID string) error {
+	for _, s := range m.sessions {
+		if s.UserID == userID {
+			m.Revoke(s.ID)
+		}
+	}
+	return nil
+}
+
+const profilePassword = "correct-horse-123"
+
+func newTestProfileService(t *testing.T) (*AuthService, *mockUserRepo, *User) {
+	t.Helper()
+	repo := newMockRepo()
+	svc := NewAuthService(repo, DefaultPasswordPolicy())
+
+	user, err := svc.Register(&RegisterRequest{
+		Email:    "test@example.com",
+		Password: profilePassword,
+		Username: "testuser",
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	return svc, repo, user
+}
+
+func TestAuthService_UpdateUsername(t *testing.T) {
+	svc, repo, user := newTestProfileService(t)
+	repo.users["other-id"] = &User{ID: "other-id", Email: "other@example.com", Username: "taken"}
+
+	if _, err := svc.UpdateUsername(user.ID, "taken"); !errors.Is(err, ErrUsernameExists) {
+		t.Errorf("expected ErrUsernameExists, got %v", err)
+	}
+
+	updated, err := svc.UpdateUsername(user.ID, "renamed")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if updated.Username != "renamed" || repo.users[user.ID].Username != "renamed" {
+		t.Errorf("expected username renamed, got %s", repo.users[user.ID].Username)
+	}
+}
+
+func TestAuthService_UpdateUsername_Moderated(t *testing.T) {
+	svc, repo, user := newTestProfileService(t)
+	checker := &mockContentChecker{flagged: map[string]bool{"badword": true}}
+	svc.SetContentChecker(checker)
+
+	if _, err := svc.UpdateUsername(user.ID, "badword"); !errors.Is(err, ErrUsernameRejected) {
+		t.Errorf("expected ErrUsernameRejected, got %v", err)
+	}
+
+	// A provider outage refuses the name rather than letting it through
+	checker.err = errors.New("provider down")
+	if _, err := svc.UpdateUsername(user.ID, "fine"); !errors.Is(err, ErrContentCheck) {
+		t.Errorf("expected ErrContentCheck, got %v", err)
+	}
+	if repo.users[user.ID].Username != "testuser" {
+		t.Errorf("expected username unchanged, got %s", repo.users[user.ID].Username)
+	}
+
+	// Keeping the current name doesn't need a check
+	if _, err := svc.UpdateUsername(user.ID, "testuser"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func TestAuthService_Register_UsernameModerated(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewAuthService(repo, DefaultPasswordPolicy())
+	svc.SetContentChecker(&mockContentChecker{flagged: map[string]bool{"badword": true}})
+
+	_, err := svc.Register(&RegisterRequest{
+		Email:    "test@example.com",
+		Password: profilePassword,
+		Username: "badword",
+	})
+	if !errors.Is(err, ErrUsernameRejected) {
+		t.Errorf("expected ErrUsernameRejected, got %v", err)
+	}
+	if len(repo.users) != 0 {
+		t.Error("expected no user to be created")
+	}
+}
+
+func TestAuthService_UpdateProfile_Moderated(t *testing.T) {
+	svc, repo, user := newTestProfileService(t)
+	checker := &mockContentChecker{flagged: map[string]bool{"badword": true}}
+	svc.SetContentChecker(checker)
+
+	if _, err := svc.UpdateProfile(user.ID, "badword", "hello"); !errors.Is(err, ErrDisplayNameRejected) {
+		t.Errorf("expected ErrDisplayNameRejected, got %v", err)
+	}
+	if _, err := svc.UpdateProfile(user.ID, "Test", "badword"); !errors.Is(err, ErrBioRejected) {
+		t.Errorf("expected ErrBioRejected, got %v", err)
+	}
+
+	updated, err := svc.UpdateProfile(user.ID, " Test User ", "hello")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if updated.DisplayName != "Test User" || repo.users[user.ID].Bio != "hello" {
+		t.Errorf("unexpected profile %q %q", repo.users[user.ID].DisplayName, repo.users[user.ID].Bio)
+	}
+
+	// Unchanged text isn't checked again, so an outage doesn't block other edits
+	checker.err = errors.New("provider down")
+	if _, err := svc.UpdateProfile(user.ID, "Test User", ""); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if _, err := svc.UpdateProfile(user.ID, "Test User", "new bio"); !errors.Is(err, ErrContentCheck) {
+		t.Errorf("expected ErrContentCheck, got %v", err)
+	}
+}
+
+func TestHandler_GetUser_HidesPrivateFields(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	svc, repo, user := newTestProfileService(t)
+	repo.users[user.ID].Bio = "hello"
+	h := NewHandler(svc, NewJWTService("test-secret"), nil, nil, nil, nil, nil, nil, nil, nil)
+
+	r := gin.New()
+	r.GET("/users/:id", h.GetUser)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/"+user.ID, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var profile map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &profile); err != nil {
+		t.Fatal(err)
+	}
+	if profile["bio"] != "hello" {
+		t.Errorf("expected bio, got %v", profile["bio"])
+	}
+	for _, field := range []string{"email", "role", "verified_at"} {
+		if _, ok := profile[field]; ok {
+			t.Errorf("expected %s to be hidden", field)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestAuthService_UpdateEmail(t *testing.T) {
+	svc, repo, user := newTestProfileService(t)
+	repo.MarkVerified(user.ID)
+
+	if _, err := svc.UpdateEmail(user.ID, "wrong-password", "new@example.com"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("expected ErrInvalidCredentials, got %v", err)
+	}
+
+	updated, err := svc.UpdateEmail(user.ID, profilePassword, "new@example.com")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if updated.Email != "new@example.com" {
+		t.Errorf("expected new email, got %s", updated.Email)
+	}
+	if updated.VerifiedAt != nil || repo.users[user.ID].VerifiedAt != nil {
+		t.Error("expected new email to need verification")
+	}
+}
+
+func TestAuthService_ChangePassword(t *testing.T) {
+	svc, repo, user := newTestProfileService(t)
+
+	if err := svc.ChangePassword(user.ID, "wrong-password", "battery-staple-456"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("expected ErrInvalidCredentials, got %v", err)
+	}
+	if err := svc.ChangePassword(user.ID, profilePassword, "password123"); !errors.Is(err, ErrWeakPassword) {
+		t.Errorf("expected ErrWeakPassword, got %v", err)
+	}
+
+	if err := svc.ChangePassword(user.ID, profilePassword, "battery-staple-456"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(repo.users[user.ID].PasswordHash), []byte("battery-staple-456")); err != nil {
+		t.Error("expected new password to be stored")
+	}
+}
+
+func TestAuthService_DeleteAccount(t *testing.T) {
+	for _, policy := range []string{DeletionAnonymize, DeletionPurge} {
+		svc, repo, user := newTestProfileService(t)
+		if err := svc.SetAccountDeletion(policy); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if err := svc.DeleteAccount(user.ID, "wrong-password"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("%s: expected ErrInvalidCredentials, got %v", policy, err)
+		}
+
+		if err := svc.DeleteAccount(user.ID, profilePassword); err != nil {
+			t.Fatalf("%s: expected no error, got %v", policy, err)
+		}
+		if len(repo.deleted) != 1 || repo.deleted[0].purgeMessages != (policy == DeletionPurge) {
+			t.Errorf("%s: unexpected deletion %+v", policy, repo.deleted)
+		}
+	}
+}
+
+func TestAuthService_DeleteAccount_LastAdmin(t *testing.T) {
+	svc, repo, user := newTestProfileService(t)
+	repo.users[user.ID].Role = RoleAdmin
+
+	if err := svc.DeleteAccount(user.ID, profilePassword); !errors.Is(err, ErrLastAdminDeletion) {
+		t.Errorf("expected ErrLastAdminDeletion, got %v", err)
+	}
+
+	repo.users["other-id"] = &User{ID: "other-id", Email: "other@example.com", Username: "other", Role: RoleAdmin}
+	if err := svc.DeleteAccount(user.ID, profilePassword); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func TestAuthService_SetAccountDeletion_Unknown(t *testing.T) {
+	svc := NewAuthService(newMockRepo(), DefaultPasswordPolicy())
+
+	if err := svc.SetAccountDeletion("shred"); !errors.Is(err, ErrUnknownDeletion) {
+		t.Errorf("expected ErrUnknownDeletion, got %v", err)
+	}
+	if svc.AccountDeletion() != DeletionAnonymize {
+		t.Errorf("expected default %s, got %s", DeletionAnonymize, svc.AccountDeletion())
+	}
+}
+
+func TestHandler_ChangePassword_KeepsCurrentSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	svc, _, user := newTestProfileService(t)
+	sessions := newMockSessionRepo()
+	for _, id := range []string{"current", "laptop", "phone"} {
+		sessions.Create(&Session{ID: id, UserID: user.ID})
+	}
+	store := newMockRevocationStore()
+	h := NewHandler(svc, NewJWTService("test-secret"), NewRefreshService(newMockRefreshRepo()), sessions, store, nil, nil, nil, nil, nil)
+
+	r := gin.New()
+	r.PUT("/profile/password", func(c *gin.Context) {
+		c.Set("claims", &Claims{UserID: user.ID, SessionID: "current"})
+	}, h.ChangePassword)
+
+	w := httptest.NewRecorder()
+	body := `{"current_password":"` + profilePassword + `","new_password":"battery-staple-456"}`
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/profile/password", bytes.NewBufferString(body)))
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+	if sessions.sessions["current"].RevokedAt != nil {
+		t.Error("expected current session to stay active")
+	}
+	for _, id := range []string{"laptop", "phone"} {
+		if sessions.sessions[id].RevokedAt == nil || !store.sessions[id] {
+			t.Errorf("expected session %s to be revoked", id)
+		}
+	}
+	if len(store.events) != 2 {
+		t.Errorf("expected 2 revocation events, got %d", len(store.events))
+	}
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+)
+
+type RefreshService struct {
+	repo       RefreshTokenRepository
+	expiration time.Duration
+}
+
+func NewRefreshService(repo RefreshTokenRepository) *RefreshService {
+	return &RefreshService{
+		repo:       repo,
+		expiration: 30 * 24 * time.Hour,
+	}
+}
+
+// Issue creates a refresh token for a user. An empty familyID starts a new
+// family, i.e. a new login.
+func (s *RefreshService) Issue(userID, familyID string) (string, error) {
+	raw, err := randomToken()
+	if err != nil {
+		return "", fmt.Errorf("error while generating refresh token: %w", err)
+	}
+
+	if familyID == "" {
+		familyID = uuid.New().String()
+	}
+
+	if err := s.repo.Create(&RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(raw),
+		ExpiresAt: time.Now().Add(s.expiration),
+	}); err != nil {
+		return "", fmt.Errorf("error while storing refresh token: %w", err)
+	}
+
+	return raw, nil
+}
+
+// Rotate consumes a refresh token and returns its successor along with the
+// consumed token. Presenting an already used token revokes its whole family,
+// since either the legitimate client or an attacker holds a stolen copy.
+func (s *RefreshService) Rotate(raw string) (*RefreshToken, string, error) {
+	token, err := s.repo.FindByHash(hashToken(raw))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if token.RevokedAt != nil || time.Now().After(token.ExpiresAt) {
+		return nil, "", ErrInvalidRefreshToken
+	}
+
+	if token.UsedAt != nil {
+		return nil, "", s.revokeReused(token)
+	}
+
+	consumed, err := s.repo.MarkUsed(token.ID)
+	if err != nil {
+		return nil, "", fmt.Errorf("error while consuming refresh token: %w", err)
+	}
+	if !consumed {
+		// Lost a race with another request presenting the same token
+		return nil, "", s.revokeReused(token)
+	}
+
+	next, err := s.Issue(token.UserID, token.FamilyID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return token, next, nil
+}
+
+// Revoke revokes the family of a raw refresh token, ending that login
+func (s *RefreshService) Revoke(raw string) error {
+	token, err := s.repo.FindByHash(hashToken(raw))
+	if err != nil {
+		return err
+	}
+	return s.repo.RevokeFamily(token.FamilyID)
+}
+
+func (s *RefreshService) RevokeFamily(familyID string) error {
+	return s.repo.RevokeFamily(familyID)
+}
+
+func (s *RefreshService) RevokeUser(userID string) error {
+	return s.repo.RevokeUser(userID)
+}
+
+func (s *RefreshService) revokeReused(token *RefreshToken) error {
+	if err := s.repo.RevokeFamily(token.FamilyID); err != nil {
+		return fmt.Errorf("error while revoking refresh token family: %w", err)
+	}
+	return ErrRefreshTokenReused
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Only hashes are stored, so a database leak doesn't expose usable tokens
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// Mock refresh token repository for testing
+type mockRefreshRepo struct {
+	tokens map[string]*RefreshToken // hash -> token
+	nextID int
+}
+
+func newMockRefreshRepo() *mockRefreshRepo {
+	return &mockRefreshRepo{
+		tokens: make(map[string]*RefreshToken),
+	}
+}
+
+func (m *mockRefreshRepo) Create(token *RefreshToken) error {
+	m.nextID++
+	token.ID = fmt.Sprintf("token-%d", m.nextID)
+	m.tokens[token.TokenHash] = token
+	return nil
+}
+
+func (m *mockRefreshRepo) FindByHash(hash string) (*RefreshToken, error) {
+	if t, ok := m.tokens[hash]; ok {
+		copied := *t
+		return &copied, nil
+	}
+	return nil, ErrInvalidRefreshToken
+}
+
+func (m *mockRefreshRepo) MarkUsed(id string) (bool, error) {
+	for _, t := range m.tokens {
+		if t.ID == id {
+			if t.UsedAt != nil {
+				return false, nil
+			}
+			now := time.Now()
+			t.UsedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *mockRefreshRepo) RevokeFamily(familyID string) error {
+	now := time.Now()
+	for _, t := range m.tokens {
+		if t.FamilyID == familyID && t.RevokedAt == nil {
+			t.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *mockRefreshRepo) RevokeUser(userID string) error {
+	now := time.Now()
+	for _, t := range m.tokens {
+		if t.UserID == userID && t.RevokedAt == nil {
+			t.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func TestRefreshService_Rotate_Success(t *testing.T) {
+	repo := newMockRefreshRepo()
+	svc := NewRefreshService(repo)
+
+	raw, err := svc.Issue("user-123", "")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	consumed, next, err := svc.Rotate(raw)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if consumed.UserID != "user-123" {
+		t.Errorf("expected user_id 'user-123', got %s", consumed.UserID)
+	}
+	if next == "" || next == raw {
+		t.Error("expected a new refresh token")
+	}
+
+	nextToken, _ := repo.FindByHash(hashToken(next))
+	if nextToken.FamilyID != consumed.FamilyID {
+		t.Error("expected rotated token to stay in the same family")
+	}
+}
+
+func TestRefreshService_StoresHashOnly(t *testing.T) {
+	repo := newMockRefreshRepo()
+	svc := NewRefreshService(repo)
+
+	raw, _ := svc.Issue("user-123", "")
+
+	for hash := range repo.tokens {
+		if hash == raw {
+			t.Error("refresh token should be stored hashed, not in plain text")
+		}
+	}
+}
+
+func TestRefreshService_Rotate_ReuseRevokesFamily(t *testing.T) {
+	repo := newMockRefreshRepo()
+	svc := NewRefreshService(repo)
+
+	raw, _ := svc.Issue("user-123", "")
+	_, next, _ := svc.Rotate(raw)
+
+	// Presenting the first token again is reuse
+	_, _, err := svc.Rotate(raw)
+	if !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("expected ErrRefreshTokenReused, got %v", err)
+	}
+
+	// The legitimately rotated token is now revoked too
+	_, _, err = svc.Rotate(next)
+	if !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("expected ErrInvalidRefreshToken for revoked family, got %v", err)
+	}
+}
+
+func TestRefreshService_Rotate_Expired(t *testing.T) {
+	repo := newMockRefreshRepo()
+	svc := &RefreshService{repo: repo, expiration: -time.Minute}
+
+	raw, _ := svc.Issue("user-123", "")
+
+	_, _, err := svc.Rotate(raw)
+	if !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("expected ErrInvalidRefreshToken, got %v", err)
+	}
+}
+
+func TestRefreshService_Rotate_Unknown(t *testing.T) {
+	svc := NewRefreshService(newMockRefreshRepo())
+
+	_, _, err := svc.Rotate("not-a-token")
+	if !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("expected ErrInvalidRefreshToken, got %v", err)
+	}
+}
@@ -3,36 +3,61 @@ package auth
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/mr1hm/go-chat-moderator/internal/shared/sqlite"
 )
 
 var (
-	ErrUserNotFound   = errors.New("user not found")
-	ErrEmailExists    = errors.New("email already exists")
-	ErrUsernameExists = errors.New("username already exists")
+	ErrUserNotFound     = errors.New("user not found")
+	ErrEmailExists      = errors.New("email already exists")
+	ErrUsernameExists   = errors.New("username already exists")
+	ErrSessionNotFound  = errors.New("session not found")
+	ErrInvalidUserToken = errors.New("invalid or expired token")
+	ErrMFANotEnrolled   = errors.New("two-factor authentication not enrolled")
+	ErrIdentityNotFound = errors.New("identity not found")
+	ErrAPIKeyNotFound   = errors.New("api key not found")
 )
 
+// Matches CURRENT_TIMESTAMP so stored times compare correctly in SQL
+const sqliteTimeLayout = "2006-01-02 15:04:05"
+
 type UserRepository interface {
 	Create(user *User) error
 	FindByEmail(email string) (*User, error)
 	FindByID(id string) (*User, error)
+	UpdatePassword(id, passwordHash string) error
+	MarkVerified(id string) error
+	UpdateRole(id, role string) error
+	UpdateUsername(id, username string) error
+	UpdateEmail(id, email string) error
+	UpdateProfile(id, displayName, bio string) error
+	UpdateAvatar(id, key string) error
+	ListBots() ([]*User, error)
+	CountByRole(role string) (int, error)
+	Delete(id string, purgeMessages bool) error
 }
 
 type sqliteUserRepo struct{}
 
+const userColumns = `id, email, password_hash, username, display_name, bio, avatar_key, role, is_bot, verified_at, created_at, updated_at`
+
 func NewUserRepository() UserRepository {
 	return &sqliteUserRepo{}
 }
 
 func (r *sqliteUserRepo) Create(user *User) error {
 	user.ID = uuid.New().String()
+	if user.Role == "" {
+		user.Role = RoleUser
+	}
 
 	_, err := sqlite.DB.Exec(
-		`INSERT INTO users (id, email, password_hash, username) VALUES (?, ?, ?, ?)`,
-		user.ID, user.Email, user.PasswordHash, user.Username,
+		`INSERT INTO users (id, email, password_hash, username, role, is_bot) VALUES (?, ?, ?, ?, ?, ?)`,
+		user.ID, user.Email, user.PasswordHash, user.Username, user.Role, user.Bot,
 	)
 	if err != nil {
 		// Check for unique constraint violations
@@ -49,33 +74,871 @@ func (r *sqliteUserRepo) Create(user *User) error {
 }
 
 func (r *sqliteUserRepo) FindByEmail(email string) (*User, error) {
-	user := &User{}
-	err := sqlite.DB.QueryRow(
-		`SELECT id, email, password_hash, username, created_at, updated_at FROM users WHERE email = ?`,
+	return scanUser(sqlite.DB.QueryRow(
+		`SELECT `+userColumns+` FROM users WHERE email = ? AND deleted_at IS NULL`,
 		email,
-	).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Username, &user.CreatedAt, &user.UpdatedAt)
+	))
+}
 
-	if errors.Is(err, sql.ErrNoRows) {
-		return nil, ErrUserNotFound
+func (r *sqliteUserRepo) FindByID(id string) (*User, error) {
+	return scanUser(sqlite.DB.QueryRow(
+		`SELECT `+userColumns+` FROM users WHERE id = ? AND deleted_at IS NULL`,
+		id,
+	))
+}
+
+func (r *sqliteUserRepo) ListBots() ([]*User, error) {
+	rows, err := sqlite.DB.Query(
+		`SELECT ` + userColumns + `
+		 FROM users WHERE is_bot = 1 AND deleted_at IS NULL ORDER BY created_at`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error while querying bots: %w", err)
+	}
+	defer rows.Close()
+
+	bots := []*User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error while scanning bots: %w", err)
+		}
+		bots = append(bots, user)
 	}
 
-	return user, err
+	return bots, rows.Err()
 }
 
-func (r *sqliteUserRepo) FindByID(id string) (*User, error) {
-	user := &User{}
+func (r *sqliteUserRepo) CountByRole(role string) (int, error) {
+	var n int
 	err := sqlite.DB.QueryRow(
-		`SELECT id, email, password_hash, username, created_at, updated_at FROM users WHERE id = ?`,
-		id,
-	).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Username, &user.CreatedAt, &user.UpdatedAt)
+		`SELECT COUNT(*) FROM users WHERE role = ? AND deleted_at IS NULL`, role,
+	).Scan(&n)
+	return n, err
+}
 
+func scanUser(row interface{ Scan(...any) error }) (*User, error) {
+	user := &User{}
+	var verifiedAt sql.NullTime
+	err := row.Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Username, &user.DisplayName, &user.Bio,
+		&user.AvatarKey, &user.Role, &user.Bot, &verifiedAt, &user.CreatedAt, &user.UpdatedAt)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, ErrUserNotFound
 	}
-	return user, err
+	if err != nil {
+		return nil, err
+	}
+
+	if verifiedAt.Valid {
+		user.VerifiedAt = &verifiedAt.Time
+	}
+	user.AvatarURL = avatarURL(user.ID, user.AvatarKey)
+
+	return user, nil
+}
+
+func (r *sqliteUserRepo) UpdatePassword(id, passwordHash string) error {
+	res, err := sqlite.DB.Exec(
+		`UPDATE users SET password_hash = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, passwordHash, id,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *sqliteUserRepo) MarkVerified(id string) error {
+	_, err := sqlite.DB.Exec(
+		`UPDATE users SET verified_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = ? AND verified_at IS NULL`, id,
+	)
+	return err
+}
+
+func (r *sqliteUserRepo) UpdateRole(id, role string) error {
+	res, err := sqlite.DB.Exec(
+		`UPDATE users SET role = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, role, id,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *sqliteUserRepo) UpdateUsername(id, username string) error {
+	res, err := sqlite.DB.Exec(
+		`UPDATE users SET username = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NULL`, username, id,
+	)
+	if err != nil {
+		if isUniqueViolation(err, "username") {
+			return ErrUsernameExists
+		}
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// UpdateEmail changes the address and marks it unverified until confirmed
+func (r *sqliteUserRepo) UpdateEmail(id, email string) error {
+	res, err := sqlite.DB.Exec(
+		`UPDATE users SET email = ?, verified_at = NULL, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = ? AND deleted_at IS NULL`, email, id,
+	)
+	if err != nil {
+		if isUniqueViolation(err, "email") {
+			return ErrEmailExists
+		}
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *sqliteUserRepo) UpdateProfile(id, displayName, bio string) error {
+	res, err := sqlite.DB.Exec(
+		`UPDATE users SET display_name = ?, bio = ?, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = ? AND deleted_at IS NULL`, displayName, bio, id,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// UpdateAvatar points a user at a stored avatar; an empty key removes it
+func (r *sqliteUserRepo) UpdateAvatar(id, key string) error {
+	res, err := sqlite.DB.Exec(
+		`UPDATE users SET avatar_key = ?, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = ? AND deleted_at IS NULL`, key, id,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// Delete removes everything a user can log in with and scrubs their
+// personal data. The row is kept as a tombstone so rooms, moderation
+// history and the audit log still resolve; messages are either kept under
+// the placeholder name or deleted with their moderation history. Rooms the
+// user owns are handed over first.
+func (r *sqliteUserRepo) Delete(id string, purgeMessages bool) error {
+	tx, err := sqlite.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		`UPDATE users SET email = ?, username = ?, password_hash = '', role = ?, verified_at = NULL,
+		 display_name = '', bio = '', avatar_key = '', deleted_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = ? AND deleted_at IS NULL`,
+		id+"@deleted.invalid", deletedUsername(id), RoleUser, id,
+	)
+	if err != nil {
+		return fmt.Errorf("error while scrubbing user: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+
+	if err := handOverRooms(tx, id); err != nil {
+		return err
+	}
+
+	for _, table := range []string{
+		"refresh_tokens", "sessions", "user_tokens", "user_mfa", "mfa_recovery_codes",
+		"user_identities", "api_keys", "room_members",
+	} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE user_id = ?`, id); err != nil {
+			return fmt.Errorf("error while deleting %s: %w", table, err)
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM user_blocks WHERE blocker_id = ? OR blocked_id = ?`, id, id); err != nil {
+		return fmt.Errorf("error while deleting blocks: %w", err)
+	}
+
+	// Archives are deleted by the export worker once their link expires
+	if _, err := tx.Exec(
+		`UPDATE data_exports SET expires_at = CURRENT_TIMESTAMP WHERE user_id = ? AND status = 'ready'`, id,
+	); err != nil {
+		return fmt.Errorf("error while expiring data exports: %w", err)
+	}
+
+	if purgeMessages {
+		for _, query := range []string{
+			`DELETE FROM message_reports WHERE message_id IN (SELECT id FROM messages WHERE user_id = ?)`,
+			`DELETE FROM moderation_logs WHERE message_id IN (SELECT id FROM messages WHERE user_id = ?)`,
+			`DELETE FROM moderation_actions WHERE message_id IN (SELECT id FROM messages WHERE user_id = ?)`,
+			`DELETE FROM messages WHERE user_id = ?`,
+		} {
+			if _, err := tx.Exec(query, id); err != nil {
+				return fmt.Errorf("error while purging messages: %w", err)
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// handOverRooms makes the longest-standing moderator of each room the user
+// owns its new owner, or the longest-standing admin when the room has no
+// moderators. A room with neither is left to global admins, who act as
+// owners everywhere.
+func handOverRooms(tx *sql.Tx, userID string) error {
+	rows, err := tx.Query(`SELECT room_id FROM room_members WHERE user_id = ? AND role = 'owner'`, userID)
+	if err != nil {
+		return fmt.Errorf("error while finding owned rooms: %w", err)
+	}
+	var roomIDs []string
+	for rows.Next() {
+		var roomID string
+		if err := rows.Scan(&roomID); err != nil {
+			rows.Close()
+			return fmt.Errorf("error while scanning owned rooms: %w", err)
+		}
+		roomIDs = append(roomIDs, roomID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, roomID := range roomIDs {
+		var heir string
+		err := tx.QueryRow(
+			`SELECT user_id FROM room_members WHERE room_id = ? AND role = 'moderator' ORDER BY created_at, user_id LIMIT 1`,
+			roomID,
+		).Scan(&heir)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = tx.QueryRow(
+				`SELECT id FROM users WHERE role = ? AND deleted_at IS NULL AND id != ? ORDER BY created_at, id LIMIT 1`,
+				RoleAdmin, userID,
+			).Scan(&heir)
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("error while finding a new owner for room %s: %w", roomID, err)
+		}
+
+		if _, err := tx.Exec(
+			`INSERT INTO room_members (room_id, user_id, role) VALUES (?, ?, 'owner')
+			 ON CONFLICT (room_id, user_id) DO UPDATE SET role = excluded.role`,
+			roomID, heir,
+		); err != nil {
+			return fmt.Errorf("error while handing over room %s: %w", roomID, err)
+		}
+	}
+
+	return nil
+}
+
+// deletedUsername is the placeholder shown for a deleted user's messages
+func deletedUsername(id string) string {
+	return "deleted-" + strings.ReplaceAll(id, "-", "")[:12]
 }
 
 func isUniqueViolation(err error, field string) bool {
 	// SQLite unique constraint error contains "UNIQUE constraint failed"
 	return err != nil && strings.Contains(err.Error(), "UNIQUE") && strings.Contains(err.Error(), field)
 }
+
+// Refresh Token Repository
+type RefreshTokenRepository interface {
+	Create(token *RefreshToken) error
+	FindByHash(hash string) (*RefreshToken, error)
+	MarkUsed(id string) (bool, error)
+	RevokeFamily(familyID string) error
+	RevokeUser(userID string) error
+}
+
+type sqliteRefreshTokenRepo struct{}
+
+func NewRefreshTokenRepository() RefreshTokenRepository {
+	return &sqliteRefreshTokenRepo{}
+}
+
+func (r *sqliteRefreshTokenRepo) Create(token *RefreshToken) error {
+	token.ID = uuid.New().String()
+
+	_, err := sqlite.DB.Exec(
+		`INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, expires_at) VALUES (?, ?, ?, ?, ?)`,
+		token.ID, token.UserID, token.FamilyID, token.TokenHash, token.ExpiresAt.UTC().Format(sqliteTimeLayout),
+	)
+
+	return err
+}
+
+func (r *sqliteRefreshTokenRepo) FindByHash(hash string) (*RefreshToken, error) {
+	token := &RefreshToken{}
+	var usedAt, revokedAt sql.NullTime
+	err := sqlite.DB.QueryRow(
+		`SELECT id, user_id, family_id, token_hash, expires_at, used_at, revoked_at, created_at
+		 FROM refresh_tokens WHERE token_hash = ?`,
+		hash,
+	).Scan(&token.ID, &token.UserID, &token.FamilyID, &token.TokenHash, &token.ExpiresAt, &usedAt, &revokedAt, &token.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+
+	return token, nil
+}
+
+// MarkUsed consumes a token, reporting false if it was already consumed.
+// The conditional update makes concurrent refreshes race safely.
+func (r *sqliteRefreshTokenRepo) MarkUsed(id string) (bool, error) {
+	res, err := sqlite.DB.Exec(
+		`UPDATE refresh_tokens SET used_at = CURRENT_TIMESTAMP WHERE id = ? AND used_at IS NULL`, id,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+
+	return n == 1, err
+}
+
+func (r *sqliteRefreshTokenRepo) RevokeFamily(familyID string) error {
+	_, err := sqlite.DB.Exec(
+		`UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE family_id = ? AND revoked_at IS NULL`, familyID,
+	)
+	return err
+}
+
+func (r *sqliteRefreshTokenRepo) RevokeUser(userID string) error {
+	_, err := sqlite.DB.Exec(
+		`UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = ? AND revoked_at IS NULL`, userID,
+	)
+	return err
+}
+
+// Session Repository
+type SessionRepository interface {
+	Create(session *Session) error
+	FindByID(id string) (*Session, error)
+	ListActive(userID string) ([]Session, error)
+	Touch(id string) error
+	Revoke(id string) error
+	RevokeUser(userID string) error
+}
+
+type sqliteSessionRepo struct{}
+
+func NewSessionRepository() SessionRepository {
+	return &sqliteSessionRepo{}
+}
+
+func (r *sqliteSessionRepo) Create(session *Session) error {
+	session.ID = uuid.New().String()
+
+	_, err := sqlite.DB.Exec(
+		`INSERT INTO sessions (id, user_id, user_agent, ip, mfa) VALUES (?, ?, ?, ?, ?)`,
+		session.ID, session.UserID, session.UserAgent, session.IP, session.MFA,
+	)
+
+	return err
+}
+
+func (r *sqliteSessionRepo) FindByID(id string) (*Session, error) {
+	session := &Session{}
+	var revokedAt sql.NullTime
+	err := sqlite.DB.QueryRow(
+		`SELECT id, user_id, user_agent, ip, mfa, created_at, last_seen_at, revoked_at FROM sessions WHERE id = ?`,
+		id,
+	).Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP, &session.MFA, &session.CreatedAt, &session.LastSeenAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if revokedAt.Valid {
+		session.RevokedAt = &revokedAt.Time
+	}
+
+	return session, nil
+}
+
+// ListActive returns sessions that are not revoked and still hold a usable
+// refresh token, most recently seen first
+func (r *sqliteSessionRepo) ListActive(userID string) ([]Session, error) {
+	rows, err := sqlite.DB.Query(
+		`SELECT s.id, s.user_id, s.user_agent, s.ip, s.mfa, s.created_at, s.last_seen_at
+		 FROM sessions s
+		 WHERE s.user_id = ? AND s.revoked_at IS NULL
+		   AND EXISTS (
+		     SELECT 1 FROM refresh_tokens t
+		     WHERE t.family_id = s.id AND t.used_at IS NULL AND t.revoked_at IS NULL AND t.expires_at > ?
+		   )
+		 ORDER BY s.last_seen_at DESC`,
+		userID, time.Now().UTC().Format(sqliteTimeLayout),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(&s.ID, &s.UserID, &s.UserAgent, &s.IP, &s.MFA, &s.CreatedAt, &s.LastSeenAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+
+	return sessions, rows.Err()
+}
+
+func (r *sqliteSessionRepo) Touch(id string) error {
+	_, err := sqlite.DB.Exec(
+		`UPDATE sessions SET last_seen_at = CURRENT_TIMESTAMP WHERE id = ? AND revoked_at IS NULL`, id,
+	)
+	return err
+}
+
+func (r *sqliteSessionRepo) Revoke(id string) error {
+	_, err := sqlite.DB.Exec(
+		`UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE id = ? AND revoked_at IS NULL`, id,
+	)
+	return err
+}
+
+func (r *sqliteSessionRepo) RevokeUser(userID string) error {
+	_, err := sqlite.DB.Exec(
+		`UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = ? AND revoked_at IS NULL`, userID,
+	)
+	return err
+}
+
+// User Token Repository
+type UserTokenRepository interface {
+	Create(token *UserToken) error
+	Find(purpose, hash string) (*UserToken, error)
+	Consume(purpose, hash string) (*UserToken, error)
+	InvalidateUser(userID, purpose string) error
+}
+
+type sqliteUserTokenRepo struct{}
+
+func NewUserTokenRepository() UserTokenRepository {
+	return &sqliteUserTokenRepo{}
+}
+
+func (r *sqliteUserTokenRepo) Create(token *UserToken) error {
+	token.ID = uuid.New().String()
+
+	_, err := sqlite.DB.Exec(
+		`INSERT INTO user_tokens (id, user_id, purpose, token_hash, expires_at) VALUES (?, ?, ?, ?, ?)`,
+		token.ID, token.UserID, token.Purpose, token.TokenHash, token.ExpiresAt.UTC().Format(sqliteTimeLayout),
+	)
+
+	return err
+}
+
+// Find returns an unused, unexpired token without using it up
+func (r *sqliteUserTokenRepo) Find(purpose, hash string) (*UserToken, error) {
+	token := &UserToken{}
+	err := sqlite.DB.QueryRow(
+		`SELECT id, user_id, purpose, token_hash, expires_at, created_at FROM user_tokens
+		 WHERE purpose = ? AND token_hash = ? AND used_at IS NULL AND expires_at > ?`,
+		purpose, hash, time.Now().UTC().Format(sqliteTimeLayout),
+	).Scan(&token.ID, &token.UserID, &token.Purpose, &token.TokenHash, &token.ExpiresAt, &token.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidUserToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// Consume marks an unused, unexpired token as used and returns it. The
+// conditional update lets only one of several concurrent requests succeed.
+func (r *sqliteUserTokenRepo) Consume(purpose, hash string) (*UserToken, error) {
+	token := &UserToken{}
+	err := sqlite.DB.QueryRow(
+		`UPDATE user_tokens SET used_at = CURRENT_TIMESTAMP
+		 WHERE purpose = ? AND token_hash = ? AND used_at IS NULL AND expires_at > ?
+		 RETURNING id, user_id, purpose, token_hash, expires_at, created_at`,
+		purpose, hash, time.Now().UTC().Format(sqliteTimeLayout),
+	).Scan(&token.ID, &token.UserID, &token.Purpose, &token.TokenHash, &token.ExpiresAt, &token.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidUserToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// InvalidateUser uses up every outstanding token of a purpose for a user
+func (r *sqliteUserTokenRepo) InvalidateUser(userID, purpose string) error {
+	_, err := sqlite.DB.Exec(
+		`UPDATE user_tokens SET used_at = CURRENT_TIMESTAMP WHERE user_id = ? AND purpose = ? AND used_at IS NULL`,
+		userID, purpose,
+	)
+	return err
+}
+
+// Key Retirement Repository
+type KeyRetirementRepository interface {
+	// Retire records at as the retirement time of each kid not already
+	// recorded and returns the recorded time of every kid
+	Retire(kids []string, at time.Time) (map[string]time.Time, error)
+	// Reinstate forgets a key's retirement
+	Reinstate(kid string) error
+}
+
+type sqliteKeyRetirementRepo struct{}
+
+func NewKeyRetirementRepository() KeyRetirementRepository {
+	return &sqliteKeyRetirementRepo{}
+}
+
+func (r *sqliteKeyRetirementRepo) Retire(kids []string, at time.Time) (map[string]time.Time, error) {
+	retiredAt := make(map[string]time.Time, len(kids))
+	for _, kid := range kids {
+		var t time.Time
+		err := sqlite.DB.QueryRow(
+			`INSERT INTO jwt_key_retirements (kid, retired_at) VALUES (?, ?)
+			 ON CONFLICT (kid) DO UPDATE SET kid = kid
+			 RETURNING retired_at`,
+			kid, at.UTC().Format(sqliteTimeLayout),
+		).Scan(&t)
+		if err != nil {
+			return nil, err
+		}
+		retiredAt[kid] = t
+	}
+
+	return retiredAt, nil
+}
+
+func (r *sqliteKeyRetirementRepo) Reinstate(kid string) error {
+	_, err := sqlite.DB.Exec(`DELETE FROM jwt_key_retirements WHERE kid = ?`, kid)
+	return err
+}
+
+// MFA Repository
+type MFARepository interface {
+	Find(userID string) (*MFA, error)
+	Enroll(userID, secret string) error
+	Confirm(userID string, step int64, recoveryHashes []string) error
+	AdvanceStep(userID string, step int64) (bool, error)
+	UseRecoveryCode(userID, hash string) (bool, error)
+	Delete(userID string) error
+}
+
+type sqliteMFARepo struct{}
+
+func NewMFARepository() MFARepository {
+	return &sqliteMFARepo{}
+}
+
+func (r *sqliteMFARepo) Find(userID string) (*MFA, error) {
+	mfa := &MFA{}
+	var confirmedAt sql.NullTime
+	err := sqlite.DB.QueryRow(
+		`SELECT user_id, secret, last_step, confirmed_at, created_at FROM user_mfa WHERE user_id = ?`, userID,
+	).Scan(&mfa.UserID, &mfa.Secret, &mfa.LastStep, &confirmedAt, &mfa.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMFANotEnrolled
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if confirmedAt.Valid {
+		mfa.ConfirmedAt = &confirmedAt.Time
+	}
+
+	return mfa, nil
+}
+
+// Enroll stores a new unconfirmed secret, replacing an unconfirmed one
+func (r *sqliteMFARepo) Enroll(userID, secret string) error {
+	_, err := sqlite.DB.Exec(
+		`INSERT INTO user_mfa (user_id, secret) VALUES (?, ?)
+		 ON CONFLICT (user_id) DO UPDATE SET secret = excluded.secret, last_step = 0, created_at = CURRENT_TIMESTAMP
+		 WHERE user_mfa.confirmed_at IS NULL`,
+		userID, secret,
+	)
+	return err
+}
+
+// Confirm activates an enrollment and replaces the user's recovery codes
+func (r *sqliteMFARepo) Confirm(userID string, step int64, recoveryHashes []string) error {
+	tx, err := sqlite.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		`UPDATE user_mfa SET confirmed_at = CURRENT_TIMESTAMP, last_step = ? WHERE user_id = ?`, step, userID,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	for _, hash := range recoveryHashes {
+		if _, err := tx.Exec(
+			`INSERT INTO mfa_recovery_codes (id, user_id, code_hash) VALUES (?, ?, ?)`,
+			uuid.New().String(), userID, hash,
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// AdvanceStep records an accepted TOTP step, reporting false if an equal or
+// later step was already used
+func (r *sqliteMFARepo) AdvanceStep(userID string, step int64) (bool, error) {
+	res, err := sqlite.DB.Exec(
+		`UPDATE user_mfa SET last_step = ? WHERE user_id = ? AND last_step < ?`, step, userID, step,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+
+	return n == 1, err
+}
+
+func (r *sqliteMFARepo) UseRecoveryCode(userID, hash string) (bool, error) {
+	res, err := sqlite.DB.Exec(
+		`UPDATE mfa_recovery_codes SET used_at = CURRENT_TIMESTAMP
+		 WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`,
+		userID, hash,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+
+	return n == 1, err
+}
+
+func (r *sqliteMFARepo) Delete(userID string) error {
+	if _, err := sqlite.DB.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	_, err := sqlite.DB.Exec(`DELETE FROM user_mfa WHERE user_id = ?`, userID)
+	return err
+}
+
+// Settings Repository
+type SettingsRepository interface {
+	Get(key string) (string, error) // "" when unset
+	Set(key, value string) error
+}
+
+type sqliteSettingsRepo struct{}
+
+func NewSettingsRepository() SettingsRepository {
+	return &sqliteSettingsRepo{}
+}
+
+func (r *sqliteSettingsRepo) Get(key string) (string, error) {
+	var value string
+	err := sqlite.DB.QueryRow(`SELECT value FROM settings WHERE key = ?`, key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return value, err
+}
+
+func (r *sqliteSettingsRepo) Set(key, value string) error {
+	_, err := sqlite.DB.Exec(
+		`INSERT INTO settings (key, value) VALUES (?, ?)
+		 ON CONFLICT (key) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP`,
+		key, value,
+	)
+	return err
+}
+
+// Identity Repository
+type IdentityRepository interface {
+	FindBySubject(issuer, subject string) (*Identity, error)
+	Create(identity *Identity) error
+}
+
+type sqliteIdentityRepo struct{}
+
+func NewIdentityRepository() IdentityRepository {
+	return &sqliteIdentityRepo{}
+}
+
+func (r *sqliteIdentityRepo) FindBySubject(issuer, subject string) (*Identity, error) {
+	identity := &Identity{}
+	err := sqlite.DB.QueryRow(
+		`SELECT id, user_id, issuer, subject, email, created_at FROM user_identities WHERE issuer = ? AND subject = ?`,
+		issuer, subject,
+	).Scan(&identity.ID, &identity.UserID, &identity.Issuer, &identity.Subject, &identity.Email, &identity.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrIdentityNotFound
+	}
+	return identity, err
+}
+
+func (r *sqliteIdentityRepo) Create(identity *Identity) error {
+	identity.ID = uuid.New().String()
+
+	_, err := sqlite.DB.Exec(
+		`INSERT INTO user_identities (id, user_id, issuer, subject, email) VALUES (?, ?, ?, ?, ?)`,
+		identity.ID, identity.UserID, identity.Issuer, identity.Subject, identity.Email,
+	)
+	return err
+}
+
+// API Key Repository
+type APIKeyRepository interface {
+	Create(key *APIKey) error
+	// FindActive returns an unrevoked, unexpired key by hash
+	FindActive(hash string) (*APIKey, error)
+	ListByUser(userID string) ([]*APIKey, error)
+	Revoke(userID, id string) error
+	Touch(id string) error
+}
+
+type sqliteAPIKeyRepo struct{}
+
+func NewAPIKeyRepository() APIKeyRepository {
+	return &sqliteAPIKeyRepo{}
+}
+
+func (r *sqliteAPIKeyRepo) Create(key *APIKey) error {
+	key.ID = uuid.New().String()
+	key.CreatedAt = time.Now().UTC()
+
+	var expiresAt any
+	if key.ExpiresAt != nil {
+		expiresAt = key.ExpiresAt.UTC().Format(sqliteTimeLayout)
+	}
+
+	_, err := sqlite.DB.Exec(
+		`INSERT INTO api_keys (id, user_id, name, prefix, key_hash, scopes, created_by, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		key.ID, key.UserID, key.Name, key.Prefix, key.KeyHash, strings.Join(key.Scopes, ","), key.CreatedBy, expiresAt,
+	)
+
+	return err
+}
+
+const apiKeyColumns = `id, user_id, name, prefix, key_hash, scopes, created_by, last_used_at, expires_at, revoked_at, created_at`
+
+func (r *sqliteAPIKeyRepo) FindActive(hash string) (*APIKey, error) {
+	key, err := scanAPIKey(sqlite.DB.QueryRow(
+		`SELECT `+apiKeyColumns+` FROM api_keys
+		 WHERE key_hash = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)`,
+		hash, time.Now().UTC().Format(sqliteTimeLayout),
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAPIKeyNotFound
+	}
+
+	return key, err
+}
+
+// ListByUser returns a user's unrevoked keys, newest first. Expired keys are
+// included so their owners can see why they stopped working.
+func (r *sqliteAPIKeyRepo) ListByUser(userID string) ([]*APIKey, error) {
+	rows, err := sqlite.DB.Query(
+		`SELECT `+apiKeyColumns+` FROM api_keys
+		 WHERE user_id = ? AND revoked_at IS NULL ORDER BY created_at DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error while querying api keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error while scanning api keys: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+func (r *sqliteAPIKeyRepo) Revoke(userID, id string) error {
+	res, err := sqlite.DB.Exec(
+		`UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP WHERE id = ? AND user_id = ? AND revoked_at IS NULL`, id, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func (r *sqliteAPIKeyRepo) Touch(id string) error {
+	_, err := sqlite.DB.Exec(`UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP WHERE id = ?`, id)
+	return err
+}
+
+func scanAPIKey(row interface{ Scan(...any) error }) (*APIKey, error) {
+	key := &APIKey{}
+	var scopes string
+	var lastUsedAt, expiresAt, revokedAt sql.NullTime
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.KeyHash, &scopes, &key.CreatedBy,
+		&lastUsedAt, &expiresAt, &revokedAt, &key.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	key.Scopes = strings.Split(scopes, ",")
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+
+	return key, nil
+}
@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mr1hm/go-chat-moderator/internal/shared/sqlite"
+)
+
+// newTestDB migrates a fresh SQLite database for repository tests
+func newTestDB(t *testing.T) {
+	t.Helper()
+	sqlite.Init(filepath.Join(t.TempDir(), "test.db"))
+	t.Cleanup(sqlite.Close)
+	sqlite.Migrate()
+}
+
+func TestUserRepository_Delete_PurgesReportedMessages(t *testing.T) {
+	newTestDB(t)
+	repo := NewUserRepository()
+
+	author := &User{Email: "author@example.com", PasswordHash: "x", Username: "author", Role: RoleUser}
+	reporter := &User{Email: "reporter@example.com", PasswordHash: "x", Username: "reporter", Role: RoleUser}
+	for _, u := range []*User{author, reporter} {
+		if err := repo.Create(u); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+
+	for _, query := range []string{
+		`INSERT INTO rooms (id, name, created_by) VALUES ('room-1', 'general', '` + reporter.ID + `')`,
+		`INSERT INTO messages (id, room_id, user_id, content) VALUES ('msg-1', 'room-1', '` + author.ID + `', 'hello')`,
+		`INSERT INTO message_reports (id, message_id, reporter_id, reason) VALUES ('report-1', 'msg-1', '` + reporter.ID + `', 'spam')`,
+		`INSERT INTO moderation_logs (id, message_id, toxicity_score, is_flagged) VALUES ('log-1', 'msg-1', 0.9, 1)`,
+	} {
+		if _, err := sqlite.DB.Exec(query); err != nil {
+			t.Fatalf("failed to seed %q: %v", query, err)
+		}
+	}
+
+	if err := repo.Delete(author.ID, true); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for _, table := range []string{"messages", "message_reports", "moderation_logs"} {
+		var n int
+		if err := sqlite.DB.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&n); err != nil {
+			t.Fatalf("failed to count %s: %v", table, err)
+		}
+		if n != 0 {
+			t.Errorf("expected %s to be purged, %d rows left", table, n)
+		}
+	}
+}
+
+func TestUserRepository_Delete_HandsOverOwnedRooms(t *testing.T) {
+	newTestDB(t)
+	repo := NewUserRepository()
+
+	owner := &User{Email: "owner@example.com", PasswordHash: "x", Username: "owner", Role: RoleUser}
+	senior := &User{Email: "senior@example.com", PasswordHash: "x", Username: "senior", Role: RoleUser}
+	junior := &User{Email: "junior@example.com", PasswordHash: "x", Username: "junior", Role: RoleUser}
+	admin := &User{Email: "admin@example.com", PasswordHash: "x", Username: "admin", Role: RoleAdmin}
+	for _, u := range []*User{owner, senior, junior, admin} {
+		if err := repo.Create(u); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+
+	for _, query := range []string{
+		`INSERT INTO rooms (id, name, created_by) VALUES ('moderated', 'moderated', '` + owner.ID + `')`,
+		`INSERT INTO rooms (id, name, created_by) VALUES ('unmoderated', 'unmoderated', '` + owner.ID + `')`,
+		`INSERT INTO room_members (room_id, user_id, role) VALUES ('moderated', '` + owner.ID + `', 'owner')`,
+		`INSERT INTO room_members (room_id, user_id, role, created_at) VALUES ('moderated', '` + junior.ID + `', 'moderator', '2024-02-01 00:00:00')`,
+		`INSERT INTO room_members (room_id, user_id, role, created_at) VALUES ('moderated', '` + senior.ID + `', 'moderator', '2024-01-01 00:00:00')`,
+		`INSERT INTO room_members (room_id, user_id, role) VALUES ('unmoderated', '` + owner.ID + `', 'owner')`,
+		`INSERT INTO room_members (room_id, user_id, role) VALUES ('unmoderated', '` + junior.ID + `', 'member')`,
+	} {
+		if _, err := sqlite.DB.Exec(query); err != nil {
+			t.Fatalf("failed to seed %q: %v", query, err)
+		}
+	}
+
+	if err := repo.Delete(owner.ID, false); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for roomID, want := range map[string]string{"moderated": senior.ID, "unmoderated": admin.ID} {
+		var got string
+		if err := sqlite.DB.QueryRow(
+			`SELECT user_id FROM room_members WHERE room_id = ? AND role = 'owner'`, roomID,
+		).Scan(&got); err != nil {
+			t.Fatalf("expected %s to have an owner, got %v", roomID, err)
+		}
+		if got != want {
+			t.Errorf("expected %s to be owned by %s, got %s", roomID, want, got)
+		}
+	}
+}
+
+func TestKeyRetirementRepository_KeepsEarliestRetirement(t *testing.T) {
+	newTestDB(t)
+	repo := NewKeyRetirementRepository()
+
+	first := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	if _, err := repo.Retire([]string{"old"}, first); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// A restart retiring the same key again keeps the original time
+	retiredAt, err := repo.Retire([]string{"old", secretKID}, time.Now())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !retiredAt["old"].Equal(first) {
+		t.Errorf("expected %v, got %v", first, retiredAt["old"])
+	}
+	if _, ok := retiredAt[secretKID]; !ok {
+		t.Error("expected the secret to be recorded")
+	}
+
+	if err := repo.Reinstate("old"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	later := time.Now().UTC().Truncate(time.Second)
+	if retiredAt, _ := repo.Retire([]string{"old"}, later); !retiredAt["old"].Equal(later) {
+		t.Errorf("expected a reinstated key to be retired afresh at %v, got %v", later, retiredAt["old"])
+	}
+}
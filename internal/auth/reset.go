@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/mr1hm/go-chat-moderator/internal/shared/mail"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordResetService emails single-use reset links and applies new passwords
+type PasswordResetService struct {
+	users      UserRepository
+	tokens     UserTokenRepository
+	mailer     mail.Mailer
+	appURL     string
+	passwords  *PasswordPolicy
+	expiration time.Duration
+}
+
+func NewPasswordResetService(users UserRepository, tokens UserTokenRepository, mailer mail.Mailer, appURL string, passwords *PasswordPolicy) *PasswordResetService {
+	return &PasswordResetService{
+		users:      users,
+		tokens:     tokens,
+		mailer:     mailer,
+		appURL:     appURL,
+		passwords:  passwords,
+		expiration: time.Hour,
+	}
+}
+
+// Request emails a reset link if the address belongs to a user. Unknown
+// addresses succeed silently so callers can't probe for accounts.
+func (s *PasswordResetService) Request(ctx context.Context, email string) error {
+	user, err := s.users.FindByEmail(email)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error while finding user: %w", err)
+	}
+
+	raw, err := randomToken()
+	if err != nil {
+		return fmt.Errorf("error while generating reset token: %w", err)
+	}
+
+	if err := s.tokens.Create(&UserToken{
+		UserID:    user.ID,
+		Purpose:   PurposePasswordReset,
+		TokenHash: hashToken(raw),
+		ExpiresAt: time.Now().Add(s.expiration),
+	}); err != nil {
+		return fmt.Errorf("error while storing reset token: %w", err)
+	}
+
+	link := s.appURL + "/reset-password?token=" + url.QueryEscape(raw)
+	return s.mailer.Send(ctx, &mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse this link within %d minutes to choose a new password:\n\n%s\n\n"+
+			"If you didn't ask for a reset, you can ignore this email.\n",
+			user.Username, int(s.expiration.Minutes()), link),
+	})
+}
+
+// Reset consumes a reset token and sets a new password, returning the user
+// whose sessions must now be invalidated
+func (s *PasswordResetService) Reset(raw, password string) (string, error) {
+	// The password is checked before the token is consumed so a rejected
+	// password doesn't burn the link
+	token, err := s.tokens.Find(PurposePasswordReset, hashToken(raw))
+	if err != nil {
+		return "", err
+	}
+
+	user, err := s.users.FindByID(token.UserID)
+	if err != nil {
+		return "", fmt.Errorf("error while finding user: %w", err)
+	}
+
+	if err := s.passwords.Validate(password, user.Email, user.Username); err != nil {
+		return "", err
+	}
+
+	if _, err := s.tokens.Consume(PurposePasswordReset, token.TokenHash); err != nil {
+		return "", err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("error while generating password hash: %w", err)
+	}
+
+	if err := s.users.UpdatePassword(token.UserID, string(hash)); err != nil {
+		return "", fmt.Errorf("error while updating password: %w", err)
+	}
+
+	// Older links requested before this reset must not work either
+	if err := s.tokens.InvalidateUser(token.UserID, PurposePasswordReset); err != nil {
+		return "", fmt.Errorf("error while invalidating reset tokens: %w", err)
+	}
+
+	return token.UserID, nil
+}
@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mr1hm/go-chat-moderator/internal/shared/mail"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Mock user token repository for testing
+type mockUserTokenRepo struct {
+	tokens map[string]*UserToken // hash -> token
+}
+
+func newMockUserTokenRepo() *mockUserTokenRepo {
+	return &mockUserTokenRepo{
+		tokens: make(map[string]*UserToken),
+	}
+}
+
+func (m *mockUserTokenRepo) Create(token *UserToken) error {
+	token.ID = "token-" + token.TokenHash[:8]
+	m.tokens[token.TokenHash] = token
+	return nil
+}
+
+func (m *mockUserTokenRepo) Find(purpose, hash string) (*UserToken, error) {
+	t, ok := m.tokens[hash]
+	if !ok || t.Purpose != purpose || t.UsedAt != nil || time.Now().After(t.ExpiresAt) {
+		return nil, ErrInvalidUserToken
+	}
+	return t, nil
+}
+
+func (m *mockUserTokenRepo) Consume(purpose, hash string) (*UserToken, error) {
+	t, err := m.Find(purpose, hash)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	t.UsedAt = &now
+	return t, nil
+}
+
+func (m *mockUserTokenRepo) InvalidateUser(userID, purpose string) error {
+	now := time.Now()
+	for _, t := range m.tokens {
+		if t.UserID == userID && t.Purpose == purpose && t.UsedAt == nil {
+			t.UsedAt = &now
+		}
+	}
+	return nil
+}
+
+// Mailer that keeps sent messages in memory
+type recordingMailer struct {
+	sent []*mail.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg *mail.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// tokenFromMail extracts the token query parameter from the link in a message
+func tokenFromMail(t *testing.T, msg *mail.Message) string {
+	t.Helper()
+	i := strings.Index(msg.Body, "http")
+	if i < 0 {
+		t.Fatal("expected a link in the message")
+	}
+	link := strings.Fields(msg.Body[i:])[0]
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatalf("failed to parse link: %v", err)
+	}
+	return u.Query().Get("token")
+}
+
+func newTestResetService() (*PasswordResetService, *mockUserRepo, *recordingMailer) {
+	users := newMockRepo()
+	users.users["user-123"] = &User{ID: "user-123", Email: "test@example.com", Username: "testuser"}
+	mailer := &recordingMailer{}
+	return NewPasswordResetService(users, newMockUserTokenRepo(), mailer, "http://app.test", DefaultPasswordPolicy()), users, mailer
+}
+
+func TestPasswordResetService_Request_UnknownEmail(t *testing.T) {
+	svc, _, mailer := newTestResetService()
+
+	if err := svc.Request(context.Background(), "nobody@example.com"); err != nil {
+		t.Fatalf("expected no error for unknown email, got %v", err)
+	}
+	if len(mailer.sent) != 0 {
+		t.Errorf("expected no mail, got %d", len(mailer.sent))
+	}
+}
+
+func TestPasswordResetService_Reset_Success(t *testing.T) {
+	svc, users, mailer := newTestResetService()
+
+	if err := svc.Request(context.Background(), "test@example.com"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(mailer.sent) != 1 || mailer.sent[0].To != "test@example.com" {
+		t.Fatalf("expected one mail to test@example.com, got %+v", mailer.sent)
+	}
+
+	userID, err := svc.Reset(tokenFromMail(t, mailer.sent[0]), "new-password")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if userID != "user-123" {
+		t.Errorf("expected user-123, got %s", userID)
+	}
+
+	hash := users.users["user-123"].PasswordHash
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte("new-password")) != nil {
+		t.Error("expected password to be updated")
+	}
+}
+
+func TestPasswordResetService_Reset_SingleUse(t *testing.T) {
+	svc, _, mailer := newTestResetService()
+
+	svc.Request(context.Background(), "test@example.com")
+	svc.Request(context.Background(), "test@example.com")
+	first, second := tokenFromMail(t, mailer.sent[0]), tokenFromMail(t, mailer.sent[1])
+
+	if _, err := svc.Reset(first, "new-password"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := svc.Reset(first, "other-password"); !errors.Is(err, ErrInvalidUserToken) {
+		t.Errorf("expected ErrInvalidUserToken on reuse, got %v", err)
+	}
+	if _, err := svc.Reset(second, "other-password"); !errors.Is(err, ErrInvalidUserToken) {
+		t.Errorf("expected older link to be invalidated, got %v", err)
+	}
+}
+
+func TestPasswordResetService_Reset_Expired(t *testing.T) {
+	svc, _, mailer := newTestResetService()
+	svc.expiration = -time.Minute
+
+	svc.Request(context.Background(), "test@example.com")
+
+	if _, err := svc.Reset(tokenFromMail(t, mailer.sent[0]), "new-password"); !errors.Is(err, ErrInvalidUserToken) {
+		t.Errorf("expected ErrInvalidUserToken, got %v", err)
+	}
+}
+
+func TestPasswordResetService_Reset_WeakPasswordKeepsLink(t *testing.T) {
+	svc, _, mailer := newTestResetService()
+
+	svc.Request(context.Background(), "test@example.com")
+	token := tokenFromMail(t, mailer.sent[0])
+
+	if _, err := svc.Reset(token, "password"); !errors.Is(err, ErrWeakPassword) {
+		t.Fatalf("expected ErrWeakPassword, got %v", err)
+	}
+	if _, err := svc.Reset(token, "new-password"); err != nil {
+		t.Errorf("expected link to still work, got %v", err)
+	}
+}
+
+func TestPasswordResetService_Reset_PasswordMatchingIdentifierKeepsLink(t *testing.T) {
+	svc, _, mailer := newTestResetService()
+
+	svc.Request(context.Background(), "test@example.com")
+	token := tokenFromMail(t, mailer.sent[0])
+
+	for _, password := range []string{"test@example.com", "TestUser"} {
+		if _, err := svc.Reset(token, password); !errors.Is(err, ErrWeakPassword) {
+			t.Errorf("expected ErrWeakPassword for %q, got %v", password, err)
+		}
+	}
+	if _, err := svc.Reset(token, "new-password"); err != nil {
+		t.Errorf("expected link to still work, got %v", err)
+	}
+}
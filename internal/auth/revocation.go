@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mr1hm/go-chat-moderator/internal/shared/redis"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+var ErrTokenRevoked = errors.New("token revoked")
+
+// RevocationChannel carries RevocationEvents to every API instance so open
+// websockets authenticated with a revoked token are closed
+const RevocationChannel = "auth:revocations"
+
+// RevocationEvent identifies connections to drop: those of an API key when
+// APIKeyID is set, a single token when TokenID is set, every token of a login
+// when SessionID is set, otherwise every token of UserID older than TokenVersion
+type RevocationEvent struct {
+	UserID       string `json:"user_id"`
+	TokenID      string `json:"token_id,omitempty"`
+	SessionID    string `json:"session_id,omitempty"`
+	TokenVersion int    `json:"token_version,omitempty"`
+	APIKeyID     string `json:"api_key_id,omitempty"`
+}
+
+// Matches reports whether a connection authenticated with claims must be closed
+func (e *RevocationEvent) Matches(claims *Claims) bool {
+	if e.APIKeyID != "" {
+		return claims.APIKeyID == e.APIKeyID
+	}
+	if e.TokenID != "" {
+		return claims.ID == e.TokenID
+	}
+	if e.SessionID != "" {
+		return claims.SessionID == e.SessionID
+	}
+	return claims.UserID == e.UserID && claims.TokenVersion < e.TokenVersion
+}
+
+type RevocationStore interface {
+	RevokeToken(ctx context.Context, tokenID string, until time.Time) error
+	IsTokenRevoked(ctx context.Context, tokenID string) (bool, error)
+	RevokeSession(ctx context.Context, sessionID string, ttl time.Duration) error
+	IsSessionRevoked(ctx context.Context, sessionID string) (bool, error)
+	TokenVersion(ctx context.Context, userID string) (int, error)
+	BumpTokenVersion(ctx context.Context, userID string) (int, error)
+	Publish(ctx context.Context, event *RevocationEvent) error
+}
+
+type redisRevocationStore struct{}
+
+func NewRevocationStore() RevocationStore {
+	return &redisRevocationStore{}
+}
+
+// RevokeToken denylists a token until it would have expired anyway
+func (s *redisRevocationStore) RevokeToken(ctx context.Context, tokenID string, until time.Time) error {
+	ttl := time.Until(until)
+	if ttl <= 0 {
+		return nil
+	}
+	return redis.Client.Set(ctx, "auth:revoked:"+tokenID, 1, ttl).Err()
+}
+
+func (s *redisRevocationStore) IsTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	n, err := redis.Client.Exists(ctx, "auth:revoked:"+tokenID).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// RevokeSession denylists every access token of a login. ttl only needs to
+// cover the access token lifetime; refresh tokens are revoked in SQLite.
+func (s *redisRevocationStore) RevokeSession(ctx context.Context, sessionID string, ttl time.Duration) error {
+	return redis.Client.Set(ctx, "auth:revoked_session:"+sessionID, 1, ttl).Err()
+}
+
+func (s *redisRevocationStore) IsSessionRevoked(ctx context.Context, sessionID string) (bool, error) {
+	n, err := redis.Client.Exists(ctx, "auth:revoked_session:"+sessionID).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (s *redisRevocationStore) TokenVersion(ctx context.Context, userID string) (int, error) {
+	version, err := redis.Client.Get(ctx, "auth:token_version:"+userID).Int()
+	if errors.Is(err, goredis.Nil) {
+		return 0, nil
+	}
+	return version, err
+}
+
+func (s *redisRevocationStore) BumpTokenVersion(ctx context.Context, userID string) (int, error) {
+	version, err := redis.Client.Incr(ctx, "auth:token_version:"+userID).Result()
+	return int(version), err
+}
+
+func (s *redisRevocationStore) Publish(ctx context.Context, event *RevocationEvent) error {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("error while marshaling revocation event: %w", err)
+	}
+	return redis.Client.Publish(ctx, RevocationChannel, b).Err()
+}
@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Mock revocation store for testing
+type mockRevocationStore struct {
+	revoked  map[string]bool
+	sessions map[string]bool
+	versions map[string]int
+	events   []*RevocationEvent
+}
+
+func newMockRevocationStore() *mockRevocationStore {
+	return &mockRevocationStore{
+		revoked:  make(map[string]bool),
+		sessions: make(map[string]bool),
+		versions: make(map[string]int),
+	}
+}
+
+func (m *mockRevocationStore) RevokeToken(ctx context.Context, tokenID string, until time.Time) error {
+	m.revoked[tokenID] = true
+	return nil
+}
+
+func (m *mockRevocationStore) IsTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	return m.revoked[tokenID], nil
+}
+
+func (m *mockRevocationStore) RevokeSession(ctx context.Context, sessionID string, ttl time.Duration) error {
+	m.sessions[sessionID] = true
+	return nil
+}
+
+func (m *mockRevocationStore) IsSessionRevoked(ctx context.Context, sessionID string) (bool, error) {
+	return m.sessions[sessionID], nil
+}
+
+func (m *mockRevocationStore) TokenVersion(ctx context.Context, userID string) (int, error) {
+	return m.versions[userID], nil
+}
+
+func (m *mockRevocationStore) BumpTokenVersion(ctx context.Context, userID string) (int, error) {
+	m.versions[userID]++
+	return m.versions[userID], nil
+}
+
+func (m *mockRevocationStore) Publish(ctx context.Context, event *RevocationEvent) error {
+	m.events = append(m.events, event)
+	return nil
+}
+
+func newRevocationTestHandler(store RevocationStore) *Handler {
+	return NewHandler(nil, NewJWTService("test-secret"), nil, nil, store, nil, nil, nil, nil, nil)
+}
+
+func TestHandler_Authenticate_Valid(t *testing.T) {
+	store := newMockRevocationStore()
+	h := newRevocationTestHandler(store)
+	user := &User{ID: "user-123", Username: "testuser"}
+
+	token, err := h.generateToken(context.Background(), user, "session-1", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	claims, err := h.Authenticate(context.Background(), token)
+	if err != nil {
+		t.Fatalf("expected token to be accepted, got: %v", err)
+	}
+	if claims.ID == "" {
+		t.Error("expected token to carry a jti")
+	}
+	if claims.SessionID != "session-1" {
+		t.Errorf("expected session ID session-1, got %s", claims.SessionID)
+	}
+}
+
+func TestHandler_Authenticate_RevokedToken(t *testing.T) {
+	store := newMockRevocationStore()
+	h := newRevocationTestHandler(store)
+	ctx := context.Background()
+
+	token, _ := h.generateToken(ctx, &User{ID: "user-123", Username: "testuser"}, "session-1", false)
+	claims, _ := h.Authenticate(ctx, token)
+
+	store.RevokeToken(ctx, claims.ID, claims.ExpiresAt.Time)
+
+	if _, err := h.Authenticate(ctx, token); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("expected ErrTokenRevoked, got: %v", err)
+	}
+}
+
+func TestHandler_Authenticate_RevokedSession(t *testing.T) {
+	store := newMockRevocationStore()
+	h := newRevocationTestHandler(store)
+	ctx := context.Background()
+	user := &User{ID: "user-123", Username: "testuser"}
+
+	revokedToken, _ := h.generateToken(ctx, user, "session-1", false)
+	otherToken, _ := h.generateToken(ctx, user, "session-2", false)
+
+	store.RevokeSession(ctx, "session-1", time.Minute)
+
+	if _, err := h.Authenticate(ctx, revokedToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("expected ErrTokenRevoked, got: %v", err)
+	}
+	if _, err := h.Authenticate(ctx, otherToken); err != nil {
+		t.Errorf("expected other session's token to be accepted, got: %v", err)
+	}
+}
+
+func TestHandler_Authenticate_StaleTokenVersion(t *testing.T) {
+	store := newMockRevocationStore()
+	h := newRevocationTestHandler(store)
+	ctx := context.Background()
+	user := &User{ID: "user-123", Username: "testuser"}
+
+	oldToken, _ := h.generateToken(ctx, user, "session-1", false)
+	store.BumpTokenVersion(ctx, user.ID)
+	newToken, _ := h.generateToken(ctx, user, "session-1", false)
+
+	if _, err := h.Authenticate(ctx, oldToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("expected ErrTokenRevoked for old token, got: %v", err)
+	}
+	if _, err := h.Authenticate(ctx, newToken); err != nil {
+		t.Errorf("expected new token to be accepted, got: %v", err)
+	}
+}
+
+func TestRevocationEvent_Matches(t *testing.T) {
+	claims := &Claims{UserID: "user-123", TokenVersion: 1, SessionID: "session-1"}
+	claims.ID = "jti-1"
+
+	tests := []struct {
+		name  string
+		event RevocationEvent
+		want  bool
+	}{
+		{"same token", RevocationEvent{UserID: "user-123", TokenID: "jti-1"}, true},
+		{"other token", RevocationEvent{UserID: "user-123", TokenID: "jti-2"}, false},
+		{"same session", RevocationEvent{UserID: "user-123", SessionID: "session-1"}, true},
+		{"other session", RevocationEvent{UserID: "user-123", SessionID: "session-2"}, false},
+		{"newer version", RevocationEvent{UserID: "user-123", TokenVersion: 2}, true},
+		{"same version", RevocationEvent{UserID: "user-123", TokenVersion: 1}, false},
+		{"other user", RevocationEvent{UserID: "user-456", TokenVersion: 2}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.event.Matches(claims); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Global roles, from least to most privileged
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+var roleRank = map[string]int{
+	RoleUser:      1,
+	RoleModerator: 2,
+	RoleAdmin:     3,
+}
+
+// RoleChangeEvent describes a global role changed outside the admin API,
+// such as one synced from identity provider groups at login
+type RoleChangeEvent struct {
+	UserID string
+	From   string
+	To     string
+	Reason string
+}
+
+// OnRoleChange registers a callback run whenever a role changes outside the
+// admin API
+func (h *Handler) OnRoleChange(fn func(*RoleChangeEvent)) {
+	h.onRoleChange = append(h.onRoleChange, fn)
+}
+
+func (h *Handler) roleChanged(event *RoleChangeEvent) {
+	for _, fn := range h.onRoleChange {
+		fn(event)
+	}
+}
+
+func IsValidRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// HasRole reports whether role grants at least the privileges of required.
+// Unknown roles grant nothing.
+func HasRole(role, required string) bool {
+	return roleRank[role] > 0 && roleRank[role] >= roleRank[required]
+}
+
+// RequireRole rejects requests whose token lacks at least the given global
+// role, or lacks a second factor when the MFA policy covers the caller's
+// role. Bots can't use a second factor and are exempt. It must run after
+// AuthMiddleware.
+func (h *Handler) RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := c.MustGet("claims").(*Claims)
+		if !ok || !HasRole(claims.Role, role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "forbidden",
+			})
+			return
+		}
+
+		if !claims.MFA && !claims.Bot && h.mfaService != nil && h.mfaService.Required(claims.Role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": ErrMFARequired.Error(),
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHasRole(t *testing.T) {
+	tests := []struct {
+		role     string
+		required string
+		want     bool
+	}{
+		{RoleAdmin, RoleModerator, true},
+		{RoleAdmin, RoleAdmin, true},
+		{RoleModerator, RoleModerator, true},
+		{RoleModerator, RoleAdmin, false},
+		{RoleUser, RoleModerator, false},
+		{RoleUser, RoleUser, true},
+		{"", RoleUser, false},
+		{"superuser", RoleUser, false},
+	}
+
+	for _, tt := range tests {
+		if got := HasRole(tt.role, tt.required); got != tt.want {
+			t.Errorf("HasRole(%q, %q) = %v, want %v", tt.role, tt.required, got, tt.want)
+		}
+	}
+}
+
+func TestHandler_RequireRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := newRevocationTestHandler(newMockRevocationStore())
+
+	for _, tt := range []struct {
+		role string
+		want int
+	}{
+		{RoleUser, http.StatusForbidden},
+		{RoleModerator, http.StatusOK},
+		{RoleAdmin, http.StatusOK},
+	} {
+		r := gin.New()
+		r.GET("/", func(c *gin.Context) {
+			c.Set("claims", &Claims{UserID: "user-123", Role: tt.role})
+		}, h.RequireRole(RoleModerator), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if w.Code != tt.want {
+			t.Errorf("role %q: expected status %d, got %d", tt.role, tt.want, w.Code)
+		}
+	}
+}
+
+func TestHandler_RequireRole_MFAPolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	svc, _ := newTestMFAService()
+	svc.SetPolicy(&MFAPolicy{Roles: []string{RoleModerator}})
+	h := NewHandler(nil, NewJWTService("test-secret"), nil, nil, newMockRevocationStore(), nil, nil, svc, nil, nil)
+
+	for _, tt := range []struct {
+		role string
+		mfa  bool
+		want int
+	}{
+		{RoleModerator, false, http.StatusForbidden},
+		{RoleModerator, true, http.StatusOK},
+		{RoleAdmin, false, http.StatusOK},
+	} {
+		r := gin.New()
+		r.GET("/", func(c *gin.Context) {
+			c.Set("claims", &Claims{UserID: "user-123", Role: tt.role, MFA: tt.mfa})
+		}, h.RequireRole(RoleModerator), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if w.Code != tt.want {
+			t.Errorf("role %q mfa=%v: expected status %d, got %d", tt.role, tt.mfa, tt.want, w.Code)
+		}
+	}
+}
@@ -4,22 +4,37 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/mr1hm/go-chat-moderator/internal/shared/blob"
 	"golang.org/x/crypto/bcrypt"
 )
 
 var ErrInvalidCredentials = errors.New("invalid credentials")
 
 type AuthService struct {
-	repo UserRepository
+	repo      UserRepository
+	passwords *PasswordPolicy
+	content   ContentChecker // Optional moderation of usernames and profiles
+	deletion  string         // DeletionAnonymize or DeletionPurge
+
+	avatars      blob.Store // Nil disables avatar uploads
+	avatarPolicy AvatarPolicy
 }
 
-func NewAuthService(repo UserRepository) *AuthService {
+func NewAuthService(repo UserRepository, passwords *PasswordPolicy) *AuthService {
 	return &AuthService{
-		repo: repo,
+		repo:      repo,
+		passwords: passwords,
 	}
 }
 
 func (s *AuthService) Register(req *RegisterRequest) (*User, error) {
+	if err := s.passwords.Validate(req.Password, req.Email, req.Username); err != nil {
+		return nil, err
+	}
+	if err := s.checkUsername(req.Username); err != nil {
+		return nil, err
+	}
+
 	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return nil, fmt.Errorf("error while generating password hash: %w", err)
@@ -29,6 +44,7 @@ func (s *AuthService) Register(req *RegisterRequest) (*User, error) {
 		Email:        req.Email,
 		PasswordHash: string(hash),
 		Username:     req.Username,
+		Role:         RoleUser,
 	}
 
 	if err := s.repo.Create(user); err != nil {
@@ -47,6 +63,11 @@ func (s *AuthService) Login(req *LoginRequest) (*User, error) {
 		return nil, err
 	}
 
+	// Bots only authenticate with API keys
+	if user.Bot {
+		return nil, ErrInvalidCredentials
+	}
+
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
 		return nil, ErrInvalidCredentials
 	}
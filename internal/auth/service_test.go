@@ -3,6 +3,7 @@ package auth
 import (
 	"errors"
 	"testing"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -12,6 +13,12 @@ type mockUserRepo struct {
 	users       map[string]*User
 	createErr   error
 	findByEmail func(email string) (*User, error)
+	deleted     []deletedUser
+}
+
+type deletedUser struct {
+	id            string
+	purgeMessages bool
 }
 
 func newMockRepo() *mockUserRepo {
@@ -57,13 +64,119 @@ func (m *mockUserRepo) FindByID(id string) (*User, error) {
 	return nil, ErrUserNotFound
 }
 
+func (m *mockUserRepo) UpdatePassword(id, passwordHash string) error {
+	u, ok := m.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	u.PasswordHash = passwordHash
+	return nil
+}
+
+func (m *mockUserRepo) MarkVerified(id string) error {
+	u, ok := m.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	now := time.Now()
+	u.VerifiedAt = &now
+	return nil
+}
+
+func (m *mockUserRepo) UpdateRole(id, role string) error {
+	u, ok := m.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	u.Role = role
+	return nil
+}
+
+func (m *mockUserRepo) ListBots() ([]*User, error) {
+	bots := []*User{}
+	for _, u := range m.users {
+		if u.Bot {
+			bots = append(bots, u)
+		}
+	}
+	return bots, nil
+}
+
+func (m *mockUserRepo) UpdateUsername(id, username string) error {
+	for _, u := range m.users {
+		if u.ID != id && u.Username == username {
+			return ErrUsernameExists
+		}
+	}
+	u, ok := m.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	u.Username = username
+	return nil
+}
+
+func (m *mockUserRepo) UpdateEmail(id, email string) error {
+	for _, u := range m.users {
+		if u.ID != id && u.Email == email {
+			return ErrEmailExists
+		}
+	}
+	u, ok := m.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	u.Email = email
+	u.VerifiedAt = nil
+	return nil
+}
+
+func (m *mockUserRepo) UpdateProfile(id, displayName, bio string) error {
+	u, ok := m.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	u.DisplayName = displayName
+	u.Bio = bio
+	return nil
+}
+
+func (m *mockUserRepo) UpdateAvatar(id, key string) error {
+	u, ok := m.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	u.AvatarKey = key
+	u.AvatarURL = avatarURL(id, key)
+	return nil
+}
+
+func (m *mockUserRepo) CountByRole(role string) (int, error) {
+	n := 0
+	for _, u := range m.users {
+		if u.Role == role {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *mockUserRepo) Delete(id string, purgeMessages bool) error {
+	if _, ok := m.users[id]; !ok {
+		return ErrUserNotFound
+	}
+	delete(m.users, id)
+	m.deleted = append(m.deleted, deletedUser{id, purgeMessages})
+	return nil
+}
+
 func TestAuthService_Register_Success(t *testing.T) {
 	repo := newMockRepo()
-	svc := NewAuthService(repo)
+	svc := NewAuthService(repo, DefaultPasswordPolicy())
 
 	req := &RegisterRequest{
 		Email:    "test@example.com",
-		Password: "password123",
+		Password: "correct-horse-123",
 		Username: "testuser",
 	}
 
@@ -92,14 +205,32 @@ func TestAuthService_Register_Success(t *testing.T) {
 	}
 }
 
+func TestAuthService_Register_WeakPassword(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewAuthService(repo, DefaultPasswordPolicy())
+
+	_, err := svc.Register(&RegisterRequest{
+		Email:    "test@example.com",
+		Password: "password123",
+		Username: "testuser",
+	})
+
+	if !errors.Is(err, ErrWeakPassword) {
+		t.Errorf("expected ErrWeakPassword, got %v", err)
+	}
+	if len(repo.users) != 0 {
+		t.Error("expected no user to be created")
+	}
+}
+
 func TestAuthService_Register_EmailExists(t *testing.T) {
 	repo := newMockRepo()
-	svc := NewAuthService(repo)
+	svc := NewAuthService(repo, DefaultPasswordPolicy())
 
 	// Create first user
 	req := &RegisterRequest{
 		Email:    "test@example.com",
-		Password: "password123",
+		Password: "correct-horse-123",
 		Username: "testuser1",
 	}
 	svc.Register(req)
@@ -107,7 +238,7 @@ func TestAuthService_Register_EmailExists(t *testing.T) {
 	// Try to create another user with same email
 	req2 := &RegisterRequest{
 		Email:    "test@example.com",
-		Password: "password456",
+		Password: "correct-horse-456",
 		Username: "testuser2",
 	}
 	_, err := svc.Register(req2)
@@ -119,12 +250,12 @@ func TestAuthService_Register_EmailExists(t *testing.T) {
 
 func TestAuthService_Register_UsernameExists(t *testing.T) {
 	repo := newMockRepo()
-	svc := NewAuthService(repo)
+	svc := NewAuthService(repo, DefaultPasswordPolicy())
 
 	// Create first user
 	req := &RegisterRequest{
 		Email:    "test1@example.com",
-		Password: "password123",
+		Password: "correct-horse-123",
 		Username: "testuser",
 	}
 	svc.Register(req)
@@ -132,7 +263,7 @@ func TestAuthService_Register_UsernameExists(t *testing.T) {
 	// Try to create another user with same username
 	req2 := &RegisterRequest{
 		Email:    "test2@example.com",
-		Password: "password456",
+		Password: "correct-horse-456",
 		Username: "testuser",
 	}
 	_, err := svc.Register(req2)
@@ -144,10 +275,10 @@ func TestAuthService_Register_UsernameExists(t *testing.T) {
 
 func TestAuthService_Login_Success(t *testing.T) {
 	repo := newMockRepo()
-	svc := NewAuthService(repo)
+	svc := NewAuthService(repo, DefaultPasswordPolicy())
 
 	// Register user first
-	password := "password123"
+	password := "correct-horse-123"
 	req := &RegisterRequest{
 		Email:    "test@example.com",
 		Password: password,
@@ -173,11 +304,11 @@ func TestAuthService_Login_Success(t *testing.T) {
 
 func TestAuthService_Login_UserNotFound(t *testing.T) {
 	repo := newMockRepo()
-	svc := NewAuthService(repo)
+	svc := NewAuthService(repo, DefaultPasswordPolicy())
 
 	loginReq := &LoginRequest{
 		Email:    "nonexistent@example.com",
-		Password: "password123",
+		Password: "correct-horse-123",
 	}
 
 	_, err := svc.Login(loginReq)
@@ -188,7 +319,7 @@ func TestAuthService_Login_UserNotFound(t *testing.T) {
 
 func TestAuthService_Login_WrongPassword(t *testing.T) {
 	repo := newMockRepo()
-	svc := NewAuthService(repo)
+	svc := NewAuthService(repo, DefaultPasswordPolicy())
 
 	// Register user first
 	req := &RegisterRequest{
@@ -212,12 +343,12 @@ func TestAuthService_Login_WrongPassword(t *testing.T) {
 
 func TestAuthService_GetUser_Success(t *testing.T) {
 	repo := newMockRepo()
-	svc := NewAuthService(repo)
+	svc := NewAuthService(repo, DefaultPasswordPolicy())
 
 	// Register user first
 	req := &RegisterRequest{
 		Email:    "test@example.com",
-		Password: "password123",
+		Password: "correct-horse-123",
 		Username: "testuser",
 	}
 	registeredUser, _ := svc.Register(req)
@@ -235,7 +366,7 @@ func TestAuthService_GetUser_Success(t *testing.T) {
 
 func TestAuthService_GetUser_NotFound(t *testing.T) {
 	repo := newMockRepo()
-	svc := NewAuthService(repo)
+	svc := NewAuthService(repo, DefaultPasswordPolicy())
 
 	_, err := svc.GetUser("nonexistent-id")
 	if !errors.Is(err, ErrUserNotFound) {
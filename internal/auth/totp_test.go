@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B SHA1 vectors, truncated to 6 digits
+func TestTOTPCode_RFC6238(t *testing.T) {
+	key := []byte("12345678901234567890")
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		if got := totpCode(key, tt.unix/30); got != tt.want {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111111, 0)
+
+	step, ok := ValidateTOTP(secret, "050471", now, 0)
+	if !ok || step != 1111111111/30 {
+		t.Fatalf("expected code to validate at step %d, got %d, %v", 1111111111/30, step, ok)
+	}
+
+	// Previous step is within the drift window
+	if _, ok := ValidateTOTP(secret, "081804", now, 0); !ok {
+		t.Error("expected code from the previous step to validate")
+	}
+
+	if _, ok := ValidateTOTP(secret, "050471", now, step); ok {
+		t.Error("expected replayed code to be refused")
+	}
+	if _, ok := ValidateTOTP(secret, "000000", now, 0); ok {
+		t.Error("expected wrong code to be refused")
+	}
+	if _, ok := ValidateTOTP(secret, "050471", now.Add(5*time.Minute), 0); ok {
+		t.Error("expected code outside the drift window to be refused")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("go-chat-moderator", "test@example.com", "ABC")
+
+	if !strings.HasPrefix(uri, "otpauth://totp/go-chat-moderator:test@example.com?") {
+		t.Errorf("unexpected label in %s", uri)
+	}
+	for _, part := range []string{"secret=ABC", "issuer=go-chat-moderator", "digits=6", "period=30"} {
+		if !strings.Contains(uri, part) {
+			t.Errorf("expected %s in %s", part, uri)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/mr1hm/go-chat-moderator/internal/shared/mail"
+)
+
+var ErrAlreadyVerified = errors.New("email already verified")
+
+// VerificationService emails confirmation links and marks addresses verified
+type VerificationService struct {
+	users      UserRepository
+	tokens     UserTokenRepository
+	mailer     mail.Mailer
+	appURL     string
+	expiration time.Duration
+}
+
+func NewVerificationService(users UserRepository, tokens UserTokenRepository, mailer mail.Mailer, appURL string) *VerificationService {
+	return &VerificationService{
+		users:      users,
+		tokens:     tokens,
+		mailer:     mailer,
+		appURL:     appURL,
+		expiration: 24 * time.Hour,
+	}
+}
+
+// Send emails a new verification link, invalidating earlier ones
+func (s *VerificationService) Send(ctx context.Context, user *User) error {
+	if user.VerifiedAt != nil {
+		return ErrAlreadyVerified
+	}
+
+	raw, err := randomToken()
+	if err != nil {
+		return fmt.Errorf("error while generating verification token: %w", err)
+	}
+
+	if err := s.tokens.InvalidateUser(user.ID, PurposeEmailVerification); err != nil {
+		return fmt.Errorf("error while invalidating verification tokens: %w", err)
+	}
+	if err := s.tokens.Create(&UserToken{
+		UserID:    user.ID,
+		Purpose:   PurposeEmailVerification,
+		TokenHash: hashToken(raw),
+		ExpiresAt: time.Now().Add(s.expiration),
+	}); err != nil {
+		return fmt.Errorf("error while storing verification token: %w", err)
+	}
+
+	link := s.appURL + "/verify-email?token=" + url.QueryEscape(raw)
+	return s.mailer.Send(ctx, &mail.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nConfirm your email address within %d hours by opening:\n\n%s\n\n"+
+			"If you didn't create an account, you can ignore this email.\n",
+			user.Username, int(s.expiration.Hours()), link),
+	})
+}
+
+// Confirm consumes a verification token and marks its user verified
+func (s *VerificationService) Confirm(raw string) (string, error) {
+	token, err := s.tokens.Consume(PurposeEmailVerification, hashToken(raw))
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.users.MarkVerified(token.UserID); err != nil {
+		return "", fmt.Errorf("error while marking user verified: %w", err)
+	}
+
+	return token.UserID, nil
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func newTestVerificationService() (*VerificationService, *mockUserRepo, *recordingMailer) {
+	users := newMockRepo()
+	users.users["user-123"] = &User{ID: "user-123", Email: "test@example.com", Username: "testuser"}
+	mailer := &recordingMailer{}
+	return NewVerificationService(users, newMockUserTokenRepo(), mailer, "http://app.test"), users, mailer
+}
+
+func TestVerificationService_Confirm_Success(t *testing.T) {
+	svc, users, mailer := newTestVerificationService()
+
+	if err := svc.Send(context.Background(), users.users["user-123"]); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(mailer.sent) != 1 || mailer.sent[0].To != "test@example.com" {
+		t.Fatalf("expected one mail to test@example.com, got %+v", mailer.sent)
+	}
+
+	userID, err := svc.Confirm(tokenFromMail(t, mailer.sent[0]))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if userID != "user-123" {
+		t.Errorf("expected user-123, got %s", userID)
+	}
+	if users.users["user-123"].VerifiedAt == nil {
+		t.Error("expected user to be marked verified")
+	}
+}
+
+func TestVerificationService_Send_InvalidatesEarlierLinks(t *testing.T) {
+	svc, users, mailer := newTestVerificationService()
+	user := users.users["user-123"]
+
+	svc.Send(context.Background(), user)
+	svc.Send(context.Background(), user)
+
+	if _, err := svc.Confirm(tokenFromMail(t, mailer.sent[0])); !errors.Is(err, ErrInvalidUserToken) {
+		t.Errorf("expected ErrInvalidUserToken for superseded link, got %v", err)
+	}
+	if _, err := svc.Confirm(tokenFromMail(t, mailer.sent[1])); err != nil {
+		t.Errorf("expected latest link to work, got %v", err)
+	}
+}
+
+func TestVerificationService_Send_AlreadyVerified(t *testing.T) {
+	svc, users, mailer := newTestVerificationService()
+	users.MarkVerified("user-123")
+
+	if err := svc.Send(context.Background(), users.users["user-123"]); !errors.Is(err, ErrAlreadyVerified) {
+		t.Errorf("expected ErrAlreadyVerified, got %v", err)
+	}
+	if len(mailer.sent) != 0 {
+		t.Errorf("expected no mail, got %d", len(mailer.sent))
+	}
+}
@@ -0,0 +1,249 @@
+package chat
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mr1hm/go-chat-moderator/internal/audit"
+	"github.com/mr1hm/go-chat-moderator/internal/auth"
+	"github.com/mr1hm/go-chat-moderator/internal/webhooks"
+)
+
+var errBanned = errors.New("you are banned from this room")
+
+// KickMember removes a member from a room and closes their connections to
+// it on every instance. With a duration they're also banned for that long.
+// Routed behind RequireRoomRole(moderator).
+func (h *Handler) KickMember(c *gin.Context) {
+	var req KickRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	roomID, userID := c.Param("id"), c.Param("userID")
+	if !h.canRemove(c, roomID, userID) {
+		return
+	}
+
+	event := &KickEvent{RoomID: roomID, UserID: userID, Reason: strings.TrimSpace(req.Reason)}
+	if req.DurationMinutes > 0 {
+		ban, ok := h.ban(c, roomID, userID, event.Reason, req.DurationMinutes)
+		if !ok {
+			return
+		}
+		event.Banned, event.BannedUntil = true, ban.ExpiresAt
+	} else if err := h.memberRepo.Remove(roomID, userID); err != nil && !errors.Is(err, ErrNotMember) {
+		log.Printf("error while kicking member: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to kick member",
+		})
+		return
+	}
+
+	if err := h.auditRepo.Append(audit.NewEntry(
+		c.GetString("user_id"), audit.ActionRoomKick, "room_member", roomID+":"+userID, event.Reason,
+		nil, gin.H{"banned_until": event.BannedUntil},
+	)); err != nil {
+		log.Printf("error while writing audit entry: %v", err)
+	}
+	h.publishKick(c, event)
+
+	if err := h.webhooks.Emit(webhooks.EventRoomMemberKicked, gin.H{
+		"room_id":      roomID,
+		"user_id":      userID,
+		"moderator_id": c.GetString("user_id"),
+		"reason":       event.Reason,
+		"banned_until": event.BannedUntil,
+	}); err != nil {
+		log.Printf("error while emitting webhook: %v", err)
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// BanMember bans a user from a room, removing their membership and closing
+// their connections to it. Routed behind RequireRoomRole(moderator).
+func (h *Handler) BanMember(c *gin.Context) {
+	var req BanRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	roomID, userID := c.Param("id"), c.Param("userID")
+	if !h.canRemove(c, roomID, userID) {
+		return
+	}
+
+	reason := strings.TrimSpace(req.Reason)
+	ban, ok := h.ban(c, roomID, userID, reason, req.DurationMinutes)
+	if !ok {
+		return
+	}
+
+	if err := h.auditRepo.Append(audit.NewEntry(
+		c.GetString("user_id"), audit.ActionRoomBan, "room_member", roomID+":"+userID, reason,
+		nil, gin.H{"expires_at": ban.ExpiresAt},
+	)); err != nil {
+		log.Printf("error while writing audit entry: %v", err)
+	}
+	h.publishKick(c, &KickEvent{RoomID: roomID, UserID: userID, Reason: reason, Banned: true, BannedUntil: ban.ExpiresAt})
+
+	if err := h.webhooks.Emit(webhooks.EventRoomMemberBanned, gin.H{
+		"room_id":      roomID,
+		"user_id":      userID,
+		"moderator_id": ban.BannedBy,
+		"reason":       reason,
+		"expires_at":   ban.ExpiresAt,
+	}); err != nil {
+		log.Printf("error while emitting webhook: %v", err)
+	}
+
+	c.JSON(http.StatusOK, ban)
+}
+
+func (h *Handler) UnbanMember(c *gin.Context) {
+	roomID, userID := c.Param("id"), c.Param("userID")
+
+	if err := h.banRepo.Unban(roomID, userID); err != nil {
+		if errors.Is(err, ErrNotBanned) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": ErrNotBanned.Error(),
+			})
+			return
+		}
+		log.Printf("error while unbanning member: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to unban member",
+		})
+		return
+	}
+
+	if err := h.auditRepo.Append(audit.NewEntry(
+		c.GetString("user_id"), audit.ActionRoomUnban, "room_member", roomID+":"+userID, "", nil, nil,
+	)); err != nil {
+		log.Printf("error while writing audit entry: %v", err)
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListBans returns a room's active bans
+func (h *Handler) ListBans(c *gin.Context) {
+	bans, err := h.banRepo.ListByRoom(c.Param("id"))
+	if err != nil {
+		log.Printf("error while listing bans: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to list bans",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, bans)
+}
+
+// canRemove checks that the caller outranks a user in the room. Room
+// moderators can remove members and owners can also remove moderators;
+// nobody can remove the owner, themselves or a global moderator. It writes
+// the response and returns false when they can't.
+func (h *Handler) canRemove(c *gin.Context, roomID, userID string) bool {
+	if userID == c.GetString("user_id") {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "you can't remove yourself, leave the room instead",
+		})
+		return false
+	}
+
+	user, err := h.userRepo.FindByID(userID)
+	if err != nil {
+		if errors.Is(err, auth.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": auth.ErrUserNotFound.Error(),
+			})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to get user",
+		})
+		return false
+	}
+
+	role, err := h.memberRepo.Role(roomID, userID)
+	if err != nil && !errors.Is(err, ErrNotMember) {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to get member",
+		})
+		return false
+	}
+
+	if auth.HasRole(user.Role, auth.RoleModerator) || (role != "" && HasRoomRole(role, c.GetString("room_role"))) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "you can't remove someone with the same or a higher role",
+		})
+		return false
+	}
+
+	return true
+}
+
+// ban stores a ban lasting minutes, or forever when minutes is 0. It writes
+// the response and returns false on failure.
+func (h *Handler) ban(c *gin.Context, roomID, userID, reason string, minutes int) (*RoomBan, bool) {
+	ban := &RoomBan{
+		RoomID:   roomID,
+		UserID:   userID,
+		BannedBy: c.GetString("user_id"),
+		Reason:   reason,
+	}
+	if minutes > 0 {
+		expiresAt := time.Now().UTC().Add(time.Duration(minutes) * time.Minute).Truncate(time.Second)
+		ban.ExpiresAt = &expiresAt
+	}
+
+	if err := h.banRepo.Ban(ban); err != nil {
+		log.Printf("error while banning member: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to ban member",
+		})
+		return nil, false
+	}
+
+	return ban, true
+}
+
+// checkBan refuses users banned from a room. It writes the response and
+// returns false when they're banned or the check fails.
+func (h *Handler) checkBan(c *gin.Context, roomID, userID string) bool {
+	banned, err := h.banRepo.IsBanned(roomID, userID)
+	if err != nil {
+		log.Printf("error while checking ban: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to check ban",
+		})
+		return false
+	}
+	if banned {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": errBanned.Error(),
+		})
+		return false
+	}
+
+	return true
+}
+
+func (h *Handler) publishKick(c *gin.Context, event *KickEvent) {
+	if err := h.hub.PublishKick(c.Request.Context(), event); err != nil {
+		log.Printf("error while publishing kick: %v", err)
+	}
+}
@@ -1,10 +1,13 @@
 package chat
 
 import (
+	"encoding/json"
 	"log"
+	"sync"
+	"time"
 
-	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/mr1hm/go-chat-moderator/internal/auth"
 )
 
 type Client struct {
@@ -14,17 +17,45 @@ type Client struct {
 	UserID   string
 	Username string
 	RoomID   string
+	Claims   *auth.Claims // Token the connection was opened with, checked on revocation
+	RoomRole string       // Effective room role when the connection was opened
+	lastSeen time.Time    // Last session touch, only used by ReadPump
+
+	blockMtx sync.RWMutex
+	blocked  map[string]bool // Authors whose messages aren't delivered to this client
 }
 
-func NewClient(hub *Hub, conn *websocket.Conn, userID, username, roomID string) *Client {
+func NewClient(hub *Hub, conn *websocket.Conn, claims *auth.Claims, roomID string) *Client {
 	return &Client{
 		Hub:      hub,
 		Conn:     conn,
 		Send:     make(chan []byte, 256),
-		UserID:   userID,
-		Username: username,
+		UserID:   claims.UserID,
+		Username: claims.Username,
 		RoomID:   roomID,
+		Claims:   claims,
+	}
+}
+
+// hasBlocked reports whether the client's user blocked userID
+func (c *Client) hasBlocked(userID string) bool {
+	c.blockMtx.RLock()
+	defer c.blockMtx.RUnlock()
+	return c.blocked[userID]
+}
+
+func (c *Client) setBlocked(userID string, blocked bool) {
+	c.blockMtx.Lock()
+	defer c.blockMtx.Unlock()
+
+	if !blocked {
+		delete(c.blocked, userID)
+		return
+	}
+	if c.blocked == nil {
+		c.blocked = make(map[string]bool)
 	}
+	c.blocked[userID] = true
 }
 
 // ReadPump reads messages from WebSocket and broadcasts to hub
@@ -34,6 +65,8 @@ func (c *Client) ReadPump() {
 		c.Conn.Close()
 	}()
 
+	c.Hub.touchSession(c)
+
 	for {
 		var req SendMessageRequest
 		err := c.Conn.ReadJSON(&req)
@@ -41,24 +74,37 @@ func (c *Client) ReadPump() {
 			log.Printf("read error: %v", err)
 			break
 		}
+		c.Hub.touchSession(c)
 
-		msg := &Message{
-			RoomID:           c.RoomID,
-			UserID:           c.UserID,
-			Username:         c.Username,
-			Content:          req.Content,
-			ModerationStatus: "pending",
+		if ok, reason := c.Hub.canPost(c.Claims, c.RoomID); !ok {
+			c.sendError(reason)
+			continue
 		}
 
-		msg.ID = uuid.New().String()
+		c.Hub.Post(&Message{
+			RoomID:   c.RoomID,
+			UserID:   c.UserID,
+			Username: c.Username,
+			Bot:      c.Claims.Bot,
+			Content:  req.Content,
+		})
+	}
+}
 
-		// Publish to Redis (broadcasts to all instances)
-		c.Hub.PublishMessage(msg)
+// sendError tells only this client why its last message was rejected
+func (c *Client) sendError(reason string) {
+	data, err := json.Marshal(WSMessage{
+		Type:    "error",
+		Payload: map[string]string{"error": reason},
+	})
+	if err != nil {
+		log.Printf("error while marshaling WSMessage: %v", err)
+		return
+	}
 
-		go func(m *Message) {
-			c.Hub.messageRepo.Create(m)
-			c.Hub.QueueForModeration(m)
-		}(msg)
+	select {
+	case c.Send <- data:
+	default:
 	}
 }
 
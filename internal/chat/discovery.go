@@ -0,0 +1,106 @@
+package chat
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultRoomPageSize = 50
+	maxRoomPageSize     = 100
+	maxRoomTags         = 10
+)
+
+var (
+	errInvalidCursor = errors.New("invalid cursor")
+	errInvalidTag    = errors.New("tags are 1-32 lowercase letters, digits and dashes")
+
+	tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+)
+
+// roomFilter reads the discovery query params: q, tag, sort (new, active,
+// members), limit and cursor
+func roomFilter(c *gin.Context) (RoomFilter, error) {
+	filter := RoomFilter{
+		Query: strings.TrimSpace(c.Query("q")),
+		Sort:  c.DefaultQuery("sort", RoomSortNew),
+		Limit: defaultRoomPageSize,
+	}
+	if _, ok := roomSortKeys[filter.Sort]; !ok {
+		return filter, errors.New("sort must be new, active or members")
+	}
+
+	if tag := c.Query("tag"); tag != "" {
+		tags, err := normalizeTags([]string{tag})
+		if err != nil {
+			return filter, err
+		}
+		filter.Tag = tags[0]
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return filter, errors.New("limit must be a positive number")
+		}
+		filter.Limit = min(n, maxRoomPageSize)
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		after, err := decodeRoomCursor(cursor)
+		if err != nil || after.Sort != filter.Sort {
+			return filter, errInvalidCursor
+		}
+		filter.After = after
+	}
+
+	return filter, nil
+}
+
+func encodeRoomCursor(cursor *RoomCursor) string {
+	if cursor == nil {
+		return ""
+	}
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeRoomCursor(s string) (*RoomCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	cursor := &RoomCursor{}
+	if err := json.Unmarshal(data, cursor); err != nil || cursor.ID == "" {
+		return nil, errInvalidCursor
+	}
+	return cursor, nil
+}
+
+// normalizeTags lowercases and de-duplicates tags, keeping their order
+func normalizeTags(tags []string) ([]string, error) {
+	if len(tags) > maxRoomTags {
+		return nil, errors.New("a room can have at most 10 tags")
+	}
+
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !tagPattern.MatchString(tag) {
+			return nil, errInvalidTag
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+
+	return normalized, nil
+}
@@ -0,0 +1,41 @@
+package chat
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tags, err := normalizeTags([]string{" Go ", "web-dev", "go"})
+	if err != nil {
+		t.Fatalf("normalizeTags: %v", err)
+	}
+	if want := []string{"go", "web-dev"}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("tags = %v, want %v", tags, want)
+	}
+
+	for _, bad := range []string{"", "-go", "two words", "emoji🙂", "a,b"} {
+		if _, err := normalizeTags([]string{bad}); err == nil {
+			t.Errorf("normalizeTags(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestRoomCursor_RoundTrip(t *testing.T) {
+	cursor := &RoomCursor{Sort: RoomSortMembers, Count: 12, ID: "room-1"}
+
+	decoded, err := decodeRoomCursor(encodeRoomCursor(cursor))
+	if err != nil {
+		t.Fatalf("decodeRoomCursor: %v", err)
+	}
+	if *decoded != *cursor {
+		t.Errorf("decoded %+v, want %+v", decoded, cursor)
+	}
+
+	if _, err := decodeRoomCursor("not a cursor"); err == nil {
+		t.Error("decoded a malformed cursor")
+	}
+	if encodeRoomCursor(nil) != "" {
+		t.Error("the last page has a cursor")
+	}
+}
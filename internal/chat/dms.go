@@ -0,0 +1,201 @@
+package chat
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/mr1hm/go-chat-moderator/internal/auth"
+)
+
+// DM room IDs carry this prefix, so a room ID alone says whether it's a DM
+const dmPrefix = "dm-"
+
+var errBlockedByParticipant = errors.New("you can't message this user")
+
+// IsDM reports whether a room ID belongs to a DM
+func IsDM(roomID string) bool {
+	return strings.HasPrefix(roomID, dmPrefix)
+}
+
+// DMRoomID is the room ID of the 1:1 DM between two users. It doesn't depend
+// on their order, so either side opens the same conversation.
+func DMRoomID(a, b string) string {
+	if a > b {
+		a, b = b, a
+	}
+	sum := sha256.Sum256([]byte(a + ":" + b))
+	return dmPrefix + hex.EncodeToString(sum[:16])
+}
+
+// groupDMRoomID is a fresh ID for a group DM; every group is a new conversation
+func groupDMRoomID() string {
+	return dmPrefix + strings.ReplaceAll(uuid.New().String(), "-", "")
+}
+
+// OpenDM opens the DM between the current user and the given users, or
+// returns it if a 1:1 DM already exists. Anyone who has blocked the caller
+// can't be added.
+func (h *Handler) OpenDM(c *gin.Context) {
+	var req OpenDMRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	userID := c.GetString("user_id")
+	others := make([]string, 0, len(req.UserIDs))
+	seen := map[string]bool{userID: true}
+	for _, id := range req.UserIDs {
+		if !seen[id] {
+			seen[id] = true
+			others = append(others, id)
+		}
+	}
+	if len(others) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "a dm needs someone besides you",
+		})
+		return
+	}
+	sort.Strings(others)
+
+	for _, id := range others {
+		if _, err := h.userRepo.FindByID(id); err != nil {
+			if errors.Is(err, auth.ErrUserNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{
+					"error": auth.ErrUserNotFound.Error(),
+				})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to get user",
+			})
+			return
+		}
+
+		blocked, err := h.blockRepo.IsBlocked(id, userID)
+		if err != nil {
+			log.Printf("error while checking block: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to open dm",
+			})
+			return
+		}
+		if blocked {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": errBlockedByParticipant.Error(),
+			})
+			return
+		}
+	}
+
+	room := &Room{ID: groupDMRoomID(), CreatedBy: userID}
+	if len(others) == 1 {
+		room.ID = DMRoomID(userID, others[0])
+	}
+
+	created, err := h.roomRepo.CreateDM(room, append([]string{userID}, others...))
+	if err != nil {
+		log.Printf("error while opening dm: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to open dm",
+		})
+		return
+	}
+
+	participants, err := h.memberRepo.ListByRoom(room.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to get participants",
+		})
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, &DMConversation{Room: room, Participants: participants})
+}
+
+// ListDMs returns the current user's DMs, most recently active first
+func (h *Handler) ListDMs(c *gin.Context) {
+	dms, err := h.roomRepo.ListDMs(c.GetString("user_id"))
+	if err != nil {
+		log.Printf("error while listing dms: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to list dms",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dms)
+}
+
+// ReportMessage flags a message for moderators. Anyone who can see the
+// message's room may report it, which is how DM participants reach
+// moderators who otherwise can't read DMs.
+func (h *Handler) ReportMessage(c *gin.Context) {
+	var req ReportMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	msg, err := h.messageRepo.FindByID(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, ErrMessageNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": ErrMessageNotFound.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to get message",
+		})
+		return
+	}
+
+	claims := c.MustGet("claims").(*auth.Claims)
+	if _, _, ok := h.visibleRoom(c, msg.RoomID, claims); !ok {
+		return
+	}
+	if msg.UserID == claims.UserID {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "you can't report your own message",
+		})
+		return
+	}
+
+	report := &MessageReport{
+		MessageID:  msg.ID,
+		ReporterID: claims.UserID,
+		Reason:     strings.TrimSpace(req.Reason),
+	}
+	if err := h.reportRepo.Create(report); err != nil {
+		if errors.Is(err, ErrAlreadyReported) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": ErrAlreadyReported.Error(),
+			})
+			return
+		}
+		log.Printf("error while reporting message: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to report message",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, report)
+}
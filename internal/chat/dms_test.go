@@ -0,0 +1,22 @@
+package chat
+
+import "testing"
+
+func TestDMRoomID(t *testing.T) {
+	ab := DMRoomID("alice", "bob")
+	if ab != DMRoomID("bob", "alice") {
+		t.Error("DMRoomID depends on argument order")
+	}
+	if ab == DMRoomID("alice", "carol") {
+		t.Error("different pairs got the same DM room ID")
+	}
+	if !IsDM(ab) {
+		t.Errorf("IsDM(%q) = false", ab)
+	}
+	if !IsDM(groupDMRoomID()) {
+		t.Error("group DM room IDs aren't recognised as DMs")
+	}
+	if IsDM("4f9c2c1e-8a3b-4c55-9d1e-2b7f6a0c9e11") {
+		t.Error("room UUIDs are recognised as DMs")
+	}
+}
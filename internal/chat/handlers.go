@@ -1,19 +1,34 @@
 package chat
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"github.com/mr1hm/go-chat-moderator/internal/audit"
 	"github.com/mr1hm/go-chat-moderator/internal/auth"
+	"github.com/mr1hm/go-chat-moderator/internal/webhooks"
 )
 
 type Handler struct {
 	roomRepo    RoomRepository
+	memberRepo  RoomMemberRepository
 	messageRepo MessageRepository
+	blockRepo   BlockRepository
+	inviteRepo  InviteRepository
+	reportRepo  ReportRepository
+	banRepo     BanRepository
+	userRepo    auth.UserRepository
+	auditRepo   audit.Repository
+	webhooks    *webhooks.Dispatcher
 	hub         *Hub
-	jwtService  *auth.JWTService
+	authHandler *auth.Handler
+	appURL      string // Frontend base URL for invite links
 }
 
 var upgrader = websocket.Upgrader{
@@ -22,12 +37,21 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-func NewHandler(hub *Hub, jwtService *auth.JWTService) *Handler {
+func NewHandler(hub *Hub, authHandler *auth.Handler, appURL string) *Handler {
 	return &Handler{
 		roomRepo:    NewRoomRepository(),
+		memberRepo:  NewRoomMemberRepository(),
 		messageRepo: NewMessageRepository(),
+		blockRepo:   NewBlockRepository(),
+		inviteRepo:  NewInviteRepository(),
+		reportRepo:  NewReportRepository(),
+		banRepo:     NewBanRepository(),
+		userRepo:    auth.NewUserRepository(),
+		auditRepo:   audit.NewRepository(),
+		webhooks:    webhooks.NewDispatcher(),
 		hub:         hub,
-		jwtService:  jwtService,
+		authHandler: authHandler,
+		appURL:      appURL,
 	}
 }
 
@@ -40,10 +64,26 @@ func (h *Handler) CreateRoom(c *gin.Context) {
 		return
 	}
 
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
 	userID, _ := c.Get("user_id")
 	room := &Room{
-		Name:      req.Name,
-		CreatedBy: userID.(string),
+		Name:            req.Name,
+		Description:     strings.TrimSpace(req.Description),
+		Topic:           strings.TrimSpace(req.Topic),
+		Tags:            tags,
+		CreatedBy:       userID.(string),
+		Visibility:      req.Visibility,
+		RequireVerified: req.RequireVerified,
+	}
+	if room.Visibility == "" {
+		room.Visibility = RoomPublic
 	}
 
 	if err := h.roomRepo.Create(room); err != nil {
@@ -53,46 +93,315 @@ func (h *Handler) CreateRoom(c *gin.Context) {
 		return
 	}
 
+	if err := h.memberRepo.SetRole(room.ID, room.CreatedBy, RoomRoleOwner); err != nil {
+		log.Printf("error while adding room owner: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to create room",
+		})
+		return
+	}
+
 	c.JSON(http.StatusCreated, room)
 }
 
+// ListRooms returns a page of public rooms and the private rooms the caller
+// belongs to, with member and online counts. Global moderators see every
+// room. Query params: q, tag, sort (new, active, members), limit, cursor
 func (h *Handler) ListRooms(c *gin.Context) {
-	rooms, err := h.roomRepo.List()
+	filter, err := roomFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	claims := c.MustGet("claims").(*auth.Claims)
+	if !auth.HasRole(claims.Role, auth.RoleModerator) {
+		filter.ViewerID = claims.UserID
+	}
+
+	rooms, next, err := h.roomRepo.Search(filter)
 	if err != nil {
+		log.Printf("error while listing rooms: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "failed to list rooms",
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, rooms)
+	// Counts are best effort; the listing still works without Redis
+	ids := make([]string, len(rooms))
+	for i, room := range rooms {
+		ids[i] = room.ID
+	}
+	online, err := h.hub.OnlineCounts(c.Request.Context(), ids)
+	if err != nil {
+		log.Printf("error while loading online counts: %v", err)
+	}
+	for _, room := range rooms {
+		room.OnlineCount = online[room.ID]
+	}
+
+	c.JSON(http.StatusOK, &RoomPage{Rooms: rooms, NextCursor: encodeRoomCursor(next)})
 }
 
 func (h *Handler) GetRoom(c *gin.Context) {
-	id := c.Param("id")
-	room, err := h.roomRepo.FindByID(id)
+	room, _, ok := h.visibleRoom(c, c.Param("id"), c.MustGet("claims").(*auth.Claims))
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, room)
+}
+
+// UpdateRoom renames a room and changes its description, topic and
+// settings. Archiving makes a room read-only. Routed behind
+// RequireRoomRole(owner).
+func (h *Handler) UpdateRoom(c *gin.Context) {
+	var req UpdateRoomRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	room := c.MustGet("room").(*Room)
+
+	before := roomSettings(room)
+	if req.Name != nil {
+		room.Name = strings.TrimSpace(*req.Name)
+		if room.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "room name can't be blank",
+			})
+			return
+		}
+	}
+	if req.Description != nil {
+		room.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.Topic != nil {
+		room.Topic = strings.TrimSpace(*req.Topic)
+	}
+	if req.Tags != nil {
+		tags, err := normalizeTags(*req.Tags)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		room.Tags = tags
+	}
+	if req.Visibility != nil {
+		room.Visibility = *req.Visibility
+	}
+	if req.RequireVerified != nil {
+		room.RequireVerified = *req.RequireVerified
+	}
+	if req.Archived != nil && *req.Archived != (room.ArchivedAt != nil) {
+		room.ArchivedAt = nil
+		if *req.Archived {
+			now := time.Now().UTC().Truncate(time.Second)
+			room.ArchivedAt = &now
+		}
+	}
+
+	if err := h.roomRepo.Update(room); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to update room",
+		})
+		return
+	}
+
+	if err := h.auditRepo.Append(audit.NewEntry(
+		c.GetString("user_id"), audit.ActionRoomUpdate, "room", room.ID, "",
+		before, roomSettings(room),
+	)); err != nil {
+		log.Printf("error while writing audit entry: %v", err)
+	}
+	h.publishRoomUpdate(c, &RoomUpdatedEvent{Room: room})
+
+	c.JSON(http.StatusOK, room)
+}
+
+// DeleteRoom removes a room and everything in it, then closes its
+// connections. Routed behind RequireRoomRole(owner).
+func (h *Handler) DeleteRoom(c *gin.Context) {
+	room := c.MustGet("room").(*Room)
+
+	if err := h.roomRepo.Delete(room.ID); err != nil && !errors.Is(err, ErrRoomNotFound) {
+		log.Printf("error while deleting room: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to delete room",
+		})
+		return
+	}
+
+	if err := h.auditRepo.Append(audit.NewEntry(
+		c.GetString("user_id"), audit.ActionRoomDelete, "room", room.ID, "",
+		roomSettings(room), nil,
+	)); err != nil {
+		log.Printf("error while writing audit entry: %v", err)
+	}
+	h.publishRoomUpdate(c, &RoomUpdatedEvent{Room: room, Deleted: true})
+
+	c.Status(http.StatusNoContent)
+}
+
+// TransferRoom makes another member the room's owner; the previous owner
+// stays on as a moderator. Routed behind RequireRoomRole(owner).
+func (h *Handler) TransferRoom(c *gin.Context) {
+	var req TransferRoomRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	room := c.MustGet("room").(*Room)
+
+	previous, err := h.memberRepo.TransferOwnership(room.ID, req.UserID)
 	if err != nil {
-		if err == ErrRoomNotFound {
-			c.JSON(http.StatusNotFound, gin.H{
-				"error": ErrRoomNotFound.Error(),
+		if errors.Is(err, ErrNotMember) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "the new owner must be a member of the room",
 			})
 			return
 		}
+		log.Printf("error while transferring room: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to get room",
+			"error": "failed to transfer room",
 		})
 		return
 	}
 
+	if err := h.auditRepo.Append(audit.NewEntry(
+		c.GetString("user_id"), audit.ActionRoomTransfer, "room", room.ID, req.Reason,
+		gin.H{"owner_id": previous},
+		gin.H{"owner_id": req.UserID},
+	)); err != nil {
+		log.Printf("error while writing audit entry: %v", err)
+	}
+	h.publishRoomUpdate(c, &RoomUpdatedEvent{Room: room, OwnerID: req.UserID})
+
 	c.JSON(http.StatusOK, room)
 }
 
+// roomSettings is the audited state of a room
+func roomSettings(room *Room) gin.H {
+	return gin.H{
+		"name":             room.Name,
+		"description":      room.Description,
+		"topic":            room.Topic,
+		"tags":             room.Tags,
+		"visibility":       room.Visibility,
+		"require_verified": room.RequireVerified,
+		"archived":         room.ArchivedAt != nil,
+	}
+}
+
+func (h *Handler) publishRoomUpdate(c *gin.Context, event *RoomUpdatedEvent) {
+	if err := h.hub.PublishRoomUpdate(c.Request.Context(), event); err != nil {
+		log.Printf("error while publishing room update: %v", err)
+	}
+}
+
+func (h *Handler) ListMembers(c *gin.Context) {
+	room, _, ok := h.visibleRoom(c, c.Param("id"), c.MustGet("claims").(*auth.Claims))
+	if !ok {
+		return
+	}
+
+	members, err := h.memberRepo.ListByRoom(room.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to list members",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, members)
+}
+
+// SetMemberRole makes a user a moderator or plain member of a room.
+// Ownership can't be granted or taken away here. Routed behind
+// RequireRoomRole(owner).
+func (h *Handler) SetMemberRole(c *gin.Context) {
+	var req SetMemberRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	roomID, userID := c.MustGet("room").(*Room).ID, c.Param("userID")
+
+	if _, err := h.userRepo.FindByID(userID); err != nil {
+		if errors.Is(err, auth.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": auth.ErrUserNotFound.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to get user",
+		})
+		return
+	}
+
+	previous, err := h.memberRepo.Role(roomID, userID)
+	if err != nil && !errors.Is(err, ErrNotMember) {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to get member",
+		})
+		return
+	}
+	if previous == RoomRoleOwner {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "the owner's role can't be changed",
+		})
+		return
+	}
+
+	if err := h.memberRepo.SetRole(roomID, userID, req.Role); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to set member role",
+		})
+		return
+	}
+
+	if err := h.auditRepo.Append(audit.NewEntry(
+		c.GetString("user_id"), audit.ActionRoomRoleChange, "room_member", roomID+":"+userID, req.Reason,
+		gin.H{"role": previous},
+		gin.H{"role": req.Role},
+	)); err != nil {
+		log.Printf("error while writing audit entry: %v", err)
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
 func (h *Handler) GetMessages(c *gin.Context) {
 	roomID := c.Param("id")
+	room, _, ok := h.visibleRoom(c, roomID, c.MustGet("claims").(*auth.Claims))
+	if !ok {
+		return
+	}
+	// Bans end membership, but an owner can still add a banned user back as
+	// a member; the ban keeps them out of the history until it's lifted
+	if room.Visibility == RoomPrivate && !h.checkBan(c, roomID, c.GetString("user_id")) {
+		return
+	}
+
 	limitStr := c.DefaultQuery("limit", "50")
 	limit, _ := strconv.Atoi(limitStr)
 
-	messages, err := h.messageRepo.FindByRoom(roomID, limit)
+	messages, err := h.messageRepo.FindByRoom(roomID, c.GetString("user_id"), limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "failed to get messages for room",
@@ -103,9 +412,51 @@ func (h *Handler) GetMessages(c *gin.Context) {
 	c.JSON(http.StatusOK, messages)
 }
 
+// SendMessage posts a message over HTTP, for bots and integrations that
+// don't hold a websocket open
+func (h *Handler) SendMessage(c *gin.Context) {
+	var req SendMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	roomID := c.Param("id")
+	claims := c.MustGet("claims").(*auth.Claims)
+	if _, _, ok := h.visibleRoom(c, roomID, claims); !ok {
+		return
+	}
+
+	if ok, reason := h.hub.canPost(claims, roomID); !ok {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": reason,
+		})
+		return
+	}
+
+	msg := &Message{
+		RoomID:   roomID,
+		UserID:   claims.UserID,
+		Username: claims.Username,
+		Bot:      claims.Bot,
+		Content:  req.Content,
+	}
+	h.hub.Post(msg)
+
+	c.JSON(http.StatusAccepted, msg)
+}
+
+// HandleWebSocket opens a room connection. Browsers pass their access token
+// as ?token=; bots may send an API key with the rooms:read scope in the
+// Authorization header instead.
 func (h *Handler) HandleWebSocket(c *gin.Context) {
 	roomID := c.Param("roomID")
 	token := c.Query("token")
+	if token == "" {
+		token = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	}
 
 	if token == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{
@@ -114,18 +465,34 @@ func (h *Handler) HandleWebSocket(c *gin.Context) {
 		return
 	}
 
-	claims, err := h.jwtService.Validate(token)
+	claims, err := h.authHandler.Authenticate(c.Request.Context(), token)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"error": "invalid token",
 		})
 		return
 	}
+	if !claims.HasScope(auth.ScopeRoomsRead) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "api key lacks the rooms:read scope",
+		})
+		return
+	}
+
+	_, roomRole, ok := h.visibleRoom(c, roomID, claims)
+	if !ok {
+		return
+	}
+	if !h.checkBan(c, roomID, claims.UserID) {
+		return
+	}
 
-	// Verify room exists
-	if _, err := h.roomRepo.FindByID(roomID); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "room not found",
+	// Block changes after this arrive over BlockChannel
+	blocked, err := h.blockRepo.BlockedIDs(claims.UserID)
+	if err != nil {
+		log.Printf("error while loading blocks: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to load blocks",
 		})
 		return
 	}
@@ -135,25 +502,227 @@ func (h *Handler) HandleWebSocket(c *gin.Context) {
 		return
 	}
 
-	client := NewClient(h.hub, conn, claims.UserID, claims.Username, roomID)
+	client := NewClient(h.hub, conn, claims, roomID)
+	client.RoomRole = roomRole
+	for _, id := range blocked {
+		client.setBlocked(id, true)
+	}
 	h.hub.register <- client
 
 	go client.WritePump()
 	go client.ReadPump()
 }
 
-func RegisterRoutes(r *gin.Engine, hub *Hub, authHandler *auth.Handler) *Handler {
-	handler := NewHandler(hub, authHandler.JWTService())
+// ListBlocks returns the users the current user has blocked
+func (h *Handler) ListBlocks(c *gin.Context) {
+	blocks, err := h.blockRepo.List(c.GetString("user_id"))
+	if err != nil {
+		log.Printf("error while listing blocks: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to list blocks",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, blocks)
+}
+
+// BlockUser stops a user's messages reaching the current user, in history
+// and live on every instance
+func (h *Handler) BlockUser(c *gin.Context) {
+	blockerID, blockedID := c.GetString("user_id"), c.Param("userID")
+	if blockerID == blockedID {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "you can't block yourself",
+		})
+		return
+	}
+
+	if _, err := h.userRepo.FindByID(blockedID); err != nil {
+		if errors.Is(err, auth.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": auth.ErrUserNotFound.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to get user",
+		})
+		return
+	}
 
+	if err := h.blockRepo.Block(blockerID, blockedID); err != nil {
+		log.Printf("error while blocking user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to block user",
+		})
+		return
+	}
+
+	if err := h.hub.PublishBlock(c.Request.Context(), &BlockEvent{BlockerID: blockerID, BlockedID: blockedID, Blocked: true}); err != nil {
+		log.Printf("error while publishing block: %v", err)
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) UnblockUser(c *gin.Context) {
+	blockerID, blockedID := c.GetString("user_id"), c.Param("userID")
+
+	if err := h.blockRepo.Unblock(blockerID, blockedID); err != nil {
+		if errors.Is(err, ErrNotBlocked) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": ErrNotBlocked.Error(),
+			})
+			return
+		}
+		log.Printf("error while unblocking user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to unblock user",
+		})
+		return
+	}
+
+	if err := h.hub.PublishBlock(c.Request.Context(), &BlockEvent{BlockerID: blockerID, BlockedID: blockedID}); err != nil {
+		log.Printf("error while publishing block: %v", err)
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// roomRole is a user's effective role in a room: global admins act as owners
+// and global moderators as moderators everywhere except DMs, which only
+// their participants can see. Non-members get "".
+func (h *Handler) roomRole(roomID string, claims *auth.Claims) (string, error) {
+	if IsDM(roomID) {
+		role, err := h.memberRepo.Role(roomID, claims.UserID)
+		if errors.Is(err, ErrNotMember) {
+			return "", nil
+		}
+		return role, err
+	}
+	if auth.HasRole(claims.Role, auth.RoleAdmin) {
+		return RoomRoleOwner, nil
+	}
+
+	role, err := h.memberRepo.Role(roomID, claims.UserID)
+	if err != nil && !errors.Is(err, ErrNotMember) {
+		return "", err
+	}
+
+	if auth.HasRole(claims.Role, auth.RoleModerator) && !HasRoomRole(role, RoomRoleModerator) {
+		role = RoomRoleModerator
+	}
+
+	return role, nil
+}
+
+// visibleRoom loads a room and the caller's effective role in it. Private
+// rooms answer 404 to non-members so their existence isn't revealed. When
+// the caller can't see the room it writes the response and returns false.
+func (h *Handler) visibleRoom(c *gin.Context, roomID string, claims *auth.Claims) (*Room, string, bool) {
+	room, err := h.roomRepo.FindByID(roomID)
+	if err != nil {
+		if errors.Is(err, ErrRoomNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": ErrRoomNotFound.Error(),
+			})
+			return nil, "", false
+		}
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to get room",
+		})
+		return nil, "", false
+	}
+
+	role, err := h.roomRole(roomID, claims)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to get room role",
+		})
+		return nil, "", false
+	}
+
+	if !canView(room, role) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": ErrRoomNotFound.Error(),
+		})
+		return nil, "", false
+	}
+
+	return room, role, true
+}
+
+// canView reports whether someone with an effective room role may see a room
+func canView(room *Room, role string) bool {
+	return room.Visibility != RoomPrivate || role != ""
+}
+
+// RequireRoomRole rejects requests from users without at least the given
+// role in the room named by the :id parameter, answering 404 for rooms that
+// don't exist or that the caller can't see. It must run after
+// AuthMiddleware and stores the room as "room" and the effective role as
+// "room_role".
+func (h *Handler) RequireRoomRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		room, effective, ok := h.visibleRoom(c, c.Param("id"), c.MustGet("claims").(*auth.Claims))
+		if !ok {
+			return
+		}
+		if !HasRoomRole(effective, role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "forbidden",
+			})
+			return
+		}
+
+		c.Set("room", room)
+		c.Set("room_role", effective)
+		c.Next()
+	}
+}
+
+func RegisterRoutes(r *gin.Engine, hub *Hub, authHandler *auth.Handler, appURL string) *Handler {
+	handler := NewHandler(hub, authHandler, appURL)
+
+	// API keys may read rooms and post; managing rooms needs a user token
 	rooms := r.Group("/rooms")
-	rooms.Use(authHandler.AuthMiddleware())
+	read := authHandler.AuthMiddleware(auth.ScopeRoomsRead)
+	write := authHandler.AuthMiddleware(auth.ScopeMessagesWrite)
+	manage := authHandler.AuthMiddleware()
 	{
-		rooms.POST("", handler.CreateRoom)
-		rooms.GET("", handler.ListRooms)
-		rooms.GET("/:id", handler.GetRoom)
-		rooms.GET("/:id/messages", handler.GetMessages)
+		rooms.POST("", manage, handler.CreateRoom)
+		rooms.GET("", read, handler.ListRooms)
+		rooms.GET("/:id", read, handler.GetRoom)
+		rooms.PATCH("/:id", manage, handler.RequireRoomRole(RoomRoleOwner), handler.UpdateRoom)
+		rooms.DELETE("/:id", manage, handler.RequireRoomRole(RoomRoleOwner), handler.DeleteRoom)
+		rooms.POST("/:id/transfer", manage, handler.RequireRoomRole(RoomRoleOwner), handler.TransferRoom)
+		rooms.GET("/:id/members", read, handler.ListMembers)
+		rooms.PUT("/:id/members/:userID", manage, handler.RequireRoomRole(RoomRoleOwner), handler.SetMemberRole)
+		rooms.GET("/:id/messages", read, handler.GetMessages)
+		rooms.POST("/:id/messages", write, handler.SendMessage)
+		rooms.POST("/:id/join", manage, handler.JoinRoom)
+		rooms.POST("/:id/leave", manage, handler.LeaveRoom)
+		rooms.POST("/:id/members/:userID/kick", manage, handler.RequireRoomRole(RoomRoleModerator), handler.KickMember)
+		rooms.GET("/:id/bans", manage, handler.RequireRoomRole(RoomRoleModerator), handler.ListBans)
+		rooms.PUT("/:id/bans/:userID", manage, handler.RequireRoomRole(RoomRoleModerator), handler.BanMember)
+		rooms.DELETE("/:id/bans/:userID", manage, handler.RequireRoomRole(RoomRoleModerator), handler.UnbanMember)
+		rooms.GET("/:id/invites", manage, handler.RequireRoomRole(RoomRoleModerator), handler.ListInvites)
+		rooms.POST("/:id/invites", manage, handler.RequireRoomRole(RoomRoleModerator), handler.CreateInvite)
+		rooms.DELETE("/:id/invites/:inviteID", manage, handler.RequireRoomRole(RoomRoleModerator), handler.RevokeInvite)
 	}
 
+	r.POST("/invites/:token", manage, handler.AcceptInvite)
+
+	r.GET("/dms", manage, handler.ListDMs)
+	r.POST("/dms", manage, handler.OpenDM)
+
+	r.POST("/messages/:id/report", manage, handler.ReportMessage)
+
+	r.GET("/blocks", manage, handler.ListBlocks)
+	r.PUT("/blocks/:userID", manage, handler.BlockUser)
+	r.DELETE("/blocks/:userID", manage, handler.UnblockUser)
+
 	r.GET("/ws/:roomID", handler.HandleWebSocket)
 
 	return handler
@@ -0,0 +1,74 @@
+package chat
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mr1hm/go-chat-moderator/internal/auth"
+	"github.com/mr1hm/go-chat-moderator/internal/shared/sqlite"
+)
+
+func TestRequireRoomRole_ResolvesRoom(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sqlite.Init(filepath.Join(t.TempDir(), "test.db"))
+	t.Cleanup(sqlite.Close)
+	sqlite.Migrate()
+
+	users := auth.NewUserRepository()
+	admin := &auth.User{Email: "admin@example.com", PasswordHash: "x", Username: "admin", Role: auth.RoleAdmin}
+	member := &auth.User{Email: "member@example.com", PasswordHash: "x", Username: "member", Role: auth.RoleUser}
+	for _, u := range []*auth.User{admin, member} {
+		if err := users.Create(u); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+
+	h := NewHandler(nil, nil, "http://app.test")
+	public := &Room{Name: "general", CreatedBy: admin.ID, Visibility: RoomPublic}
+	private := &Room{Name: "staff", CreatedBy: admin.ID, Visibility: RoomPrivate}
+	for _, room := range []*Room{public, private} {
+		if err := h.roomRepo.Create(room); err != nil {
+			t.Fatalf("failed to create room: %v", err)
+		}
+	}
+
+	r := gin.New()
+	r.PUT("/rooms/:id/members/:userID", func(c *gin.Context) {
+		caller := admin
+		if c.GetHeader("X-Test-User") == member.ID {
+			caller = member
+		}
+		c.Set("claims", &auth.Claims{UserID: caller.ID, Role: caller.Role})
+		c.Set("user_id", caller.ID)
+	}, h.RequireRoomRole(RoomRoleOwner), h.SetMemberRole)
+
+	tests := []struct {
+		name   string
+		caller string
+		roomID string
+		want   int
+	}{
+		{"missing room", admin.ID, "missing", http.StatusNotFound},
+		{"private room hidden from non-members", member.ID, private.ID, http.StatusNotFound},
+		{"public room needs the role", member.ID, public.ID, http.StatusForbidden},
+		{"admin acts as owner", admin.ID, public.ID, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPut, "/rooms/"+tt.roomID+"/members/"+member.ID, bytes.NewBufferString(`{"role":"moderator"}`))
+		req.Header.Set("X-Test-User", tt.caller)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d: %s", tt.name, tt.want, w.Code, w.Body.String())
+		}
+	}
+
+	if role, err := h.memberRepo.Role(public.ID, member.ID); err != nil || role != RoomRoleModerator {
+		t.Errorf("expected member to be a moderator, got %q, %v", role, err)
+	}
+}
@@ -3,9 +3,13 @@ package chat
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"sync"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/mr1hm/go-chat-moderator/internal/auth"
 	"github.com/mr1hm/go-chat-moderator/internal/shared/redis"
 )
 
@@ -15,9 +19,24 @@ type Hub struct {
 	unregister  chan *Client
 	broadcast   chan *Message
 	messageRepo MessageRepository
+	roomRepo    RoomRepository
+	memberRepo  RoomMemberRepository
+	blockRepo   BlockRepository
+	banRepo     BanRepository
+	sessions    auth.SessionRepository
 	mtx         sync.RWMutex
+
+	instanceID    string        // Names this instance's online counts in Redis
+	presenceDirty chan struct{} // Connections changed since counts were written
 }
 
+// BlockChannel carries BlockEvents to every API instance. It is outside
+// "chat:*", which carries room traffic.
+const BlockChannel = "blocks:changed"
+
+// Websocket activity updates a session's last-seen time at most this often
+const sessionTouchInterval = time.Minute
+
 func NewHub() *Hub {
 	return &Hub{
 		rooms:       make(map[string]map[*Client]bool),
@@ -25,12 +44,23 @@ func NewHub() *Hub {
 		unregister:  make(chan *Client),
 		broadcast:   make(chan *Message),
 		messageRepo: NewMessageRepository(),
+		roomRepo:    NewRoomRepository(),
+		memberRepo:  NewRoomMemberRepository(),
+		blockRepo:   NewBlockRepository(),
+		banRepo:     NewBanRepository(),
+		sessions:    auth.NewSessionRepository(),
+
+		instanceID:    uuid.New().String(),
+		presenceDirty: make(chan struct{}, 1),
 	}
 }
 
 func (h *Hub) Run() {
 	// Subscribe to Redis for cross-instance messaging
 	go h.subscribeRedis()
+	go h.subscribeRevocations()
+	go h.subscribeBlocks()
+	go h.publishPresence()
 
 	for {
 		select {
@@ -52,6 +82,7 @@ func (h *Hub) addClient(client *Client) {
 		h.rooms[client.RoomID] = make(map[*Client]bool)
 	}
 	h.rooms[client.RoomID][client] = true
+	h.presenceChanged()
 
 	log.Printf("Client %s joined room %s", client.UserID, client.RoomID)
 }
@@ -63,7 +94,11 @@ func (h *Hub) removeClient(client *Client) {
 	if clients, ok := h.rooms[client.RoomID]; ok {
 		if _, ok := clients[client]; ok {
 			delete(clients, client)
+			if len(clients) == 0 {
+				delete(h.rooms, client.RoomID)
+			}
 			close(client.Send)
+			h.presenceChanged()
 			log.Printf("Client %s left room %s", client.UserID, client.RoomID)
 		}
 	}
@@ -80,6 +115,9 @@ func (h *Hub) broadcastToRoom(msg *Message) {
 	})
 
 	for client := range clients {
+		if client.hasBlocked(msg.UserID) {
+			continue
+		}
 		select {
 		case client.Send <- data:
 		default:
@@ -133,7 +171,19 @@ func (h *Hub) subscribeRedis() {
 		switch wsMsg.Type {
 		case "moderation_update", "message":
 			// Broadcast moderation update or regular messages as is
-			h.broadcastRaw(roomID, []byte(msg.Payload))
+			h.broadcastRaw(roomID, authorOf(&wsMsg), []byte(msg.Payload))
+		case "room_updated":
+			h.broadcastRaw(roomID, "", []byte(msg.Payload))
+			if payload, ok := wsMsg.Payload.(map[string]any); ok && payload["deleted"] == true {
+				h.disconnectRoom(roomID)
+			}
+		case "kicked":
+			// Control message: only the kicked user hears it, then their
+			// connections to the room close
+			if payload, ok := wsMsg.Payload.(map[string]any); ok {
+				userID, _ := payload["user_id"].(string)
+				h.kickFromRoom(roomID, userID, []byte(msg.Payload))
+			}
 		default:
 			// Legacy: Assume it's a raw message, wrap it
 			var message Message
@@ -146,12 +196,17 @@ func (h *Hub) subscribeRedis() {
 	}
 }
 
-func (h *Hub) broadcastRaw(roomID string, data []byte) {
+// broadcastRaw sends a pre-encoded event to a room, skipping clients that
+// blocked authorID. Events without an author go to everyone.
+func (h *Hub) broadcastRaw(roomID, authorID string, data []byte) {
 	h.mtx.RLock()
 	clients := h.rooms[roomID]
 	h.mtx.RUnlock()
 
 	for client := range clients {
+		if authorID != "" && client.hasBlocked(authorID) {
+			continue
+		}
 		select {
 		case client.Send <- data:
 		default:
@@ -159,3 +214,231 @@ func (h *Hub) broadcastRaw(roomID string, data []byte) {
 		}
 	}
 }
+
+// authorOf returns the user_id of a message event's payload, if it has one
+func authorOf(wsMsg *WSMessage) string {
+	payload, ok := wsMsg.Payload.(map[string]any)
+	if !ok {
+		return ""
+	}
+	authorID, _ := payload["user_id"].(string)
+	return authorID
+}
+
+// PublishRoomUpdate sends a room_updated event to the room's connections on
+// every instance. A deleted room's connections are closed after the event.
+func (h *Hub) PublishRoomUpdate(ctx context.Context, event *RoomUpdatedEvent) error {
+	data, err := json.Marshal(WSMessage{Type: "room_updated", Payload: event})
+	if err != nil {
+		return err
+	}
+	return redis.Client.Publish(ctx, "chat:"+event.Room.ID, data).Err()
+}
+
+// PublishKick closes a user's connections to a room on every instance
+func (h *Hub) PublishKick(ctx context.Context, event *KickEvent) error {
+	data, err := json.Marshal(WSMessage{Type: "kicked", Payload: event})
+	if err != nil {
+		return err
+	}
+	return redis.Client.Publish(ctx, "chat:"+event.RoomID, data).Err()
+}
+
+// kickFromRoom sends an event to a user's clients in a room and unregisters them
+func (h *Hub) kickFromRoom(roomID, userID string, data []byte) {
+	if userID == "" {
+		return
+	}
+
+	var kicked []*Client
+	h.mtx.RLock()
+	for client := range h.rooms[roomID] {
+		if client.UserID == userID {
+			kicked = append(kicked, client)
+		}
+	}
+	h.mtx.RUnlock()
+
+	for _, client := range kicked {
+		select {
+		case client.Send <- data:
+		default:
+		}
+		log.Printf("Kicking %s from room %s", userID, roomID)
+		h.unregister <- client
+	}
+}
+
+// disconnectRoom unregisters every client in a room
+func (h *Hub) disconnectRoom(roomID string) {
+	h.mtx.RLock()
+	clients := make([]*Client, 0, len(h.rooms[roomID]))
+	for client := range h.rooms[roomID] {
+		clients = append(clients, client)
+	}
+	h.mtx.RUnlock()
+
+	for _, client := range clients {
+		h.unregister <- client
+	}
+}
+
+// PublishBlock tells every instance that a block changed
+func (h *Hub) PublishBlock(ctx context.Context, event *BlockEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return redis.Client.Publish(ctx, BlockChannel, data).Err()
+}
+
+// subscribeBlocks applies block changes made on any instance to open connections
+func (h *Hub) subscribeBlocks() {
+	ctx := context.Background()
+	pubsub := redis.Client.Subscribe(ctx, BlockChannel)
+	defer pubsub.Close()
+
+	for msg := range pubsub.Channel() {
+		var event BlockEvent
+		if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+			log.Printf("error while unmarshaling block event: %v", err)
+			continue
+		}
+
+		h.applyBlock(&event)
+	}
+}
+
+// applyBlock updates the blocker's open connections
+func (h *Hub) applyBlock(event *BlockEvent) {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+
+	for _, clients := range h.rooms {
+		for client := range clients {
+			if client.UserID == event.BlockerID {
+				client.setBlocked(event.BlockedID, event.Blocked)
+			}
+		}
+	}
+}
+
+// touchSession records activity on the login a client connected with
+func (h *Hub) touchSession(client *Client) {
+	if client.Claims.SessionID == "" || time.Since(client.lastSeen) < sessionTouchInterval {
+		return
+	}
+	client.lastSeen = time.Now()
+
+	if err := h.sessions.Touch(client.Claims.SessionID); err != nil {
+		log.Printf("error while touching session: %v", err)
+	}
+}
+
+// canPost reports whether a user may post in a room. API keys need the
+// messages:write scope, nobody can write into a DM with someone who blocked
+// them, banned users can't post, private rooms and DMs take members only
+// (global moderators and admins may post in private rooms), archived rooms
+// are read-only, and rooms can require a verified email. A failed lookup
+// refuses the message.
+func (h *Hub) canPost(claims *auth.Claims, roomID string) (bool, string) {
+	if !claims.HasScope(auth.ScopeMessagesWrite) {
+		return false, "api key lacks the messages:write scope"
+	}
+	if IsDM(roomID) {
+		blocked, err := h.blockRepo.BlockedInRoom(roomID, claims.UserID)
+		if err != nil {
+			log.Printf("error while checking blocks in %s: %v", roomID, err)
+			return false, "failed to send message"
+		}
+		if blocked {
+			return false, errBlockedByParticipant.Error()
+		}
+	}
+
+	banned, err := h.banRepo.IsBanned(roomID, claims.UserID)
+	if err != nil {
+		log.Printf("error while checking ban in %s: %v", roomID, err)
+		return false, "failed to send message"
+	}
+	if banned {
+		return false, errBanned.Error()
+	}
+
+	room, err := h.roomRepo.FindByID(roomID)
+	if errors.Is(err, ErrRoomNotFound) {
+		return false, ErrRoomNotFound.Error()
+	}
+	if err != nil {
+		log.Printf("error while finding room %s: %v", roomID, err)
+		return false, "failed to send message"
+	}
+	if room.Visibility == RoomPrivate && (IsDM(roomID) || !auth.HasRole(claims.Role, auth.RoleModerator)) {
+		if _, err := h.memberRepo.Role(roomID, claims.UserID); err != nil {
+			if errors.Is(err, ErrNotMember) {
+				return false, ErrRoomNotFound.Error()
+			}
+			log.Printf("error while checking membership of %s: %v", roomID, err)
+			return false, "failed to send message"
+		}
+	}
+	if room.ArchivedAt != nil {
+		return false, "this room is archived"
+	}
+	if room.RequireVerified && !claims.Verified {
+		return false, "verify your email address to post in this room"
+	}
+
+	return true, ""
+}
+
+// Post sends a message to everyone in its room on every instance, then
+// stores it and queues it for moderation
+func (h *Hub) Post(msg *Message) {
+	msg.ID = uuid.New().String()
+	msg.ModerationStatus = "pending"
+
+	// Publish to Redis (broadcasts to all instances)
+	h.PublishMessage(msg)
+
+	go func(m *Message) {
+		h.messageRepo.Create(m)
+		h.QueueForModeration(m)
+	}(msg)
+}
+
+// subscribeRevocations closes connections opened with tokens revoked on any instance
+func (h *Hub) subscribeRevocations() {
+	ctx := context.Background()
+	pubsub := redis.Client.Subscribe(ctx, auth.RevocationChannel)
+	defer pubsub.Close()
+
+	for msg := range pubsub.Channel() {
+		var event auth.RevocationEvent
+		if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+			log.Printf("error while unmarshaling revocation event: %v", err)
+			continue
+		}
+
+		h.disconnectWhere(event.Matches)
+	}
+}
+
+// disconnectWhere unregisters every client whose token matches
+func (h *Hub) disconnectWhere(match func(*auth.Claims) bool) {
+	var matched []*Client
+	h.mtx.RLock()
+	for _, clients := range h.rooms {
+		for client := range clients {
+			if match(client.Claims) {
+				matched = append(matched, client)
+			}
+		}
+	}
+	h.mtx.RUnlock()
+
+	for _, client := range matched {
+		log.Printf("Closing revoked connection for %s in room %s", client.UserID, client.RoomID)
+		h.unregister <- client
+	}
+}
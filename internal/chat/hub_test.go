@@ -0,0 +1,206 @@
+package chat
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/mr1hm/go-chat-moderator/internal/auth"
+	"github.com/mr1hm/go-chat-moderator/internal/shared/sqlite"
+)
+
+func newTestClient(hub *Hub, userID, roomID string) *Client {
+	client := &Client{
+		Hub:    hub,
+		Send:   make(chan []byte, 4),
+		UserID: userID,
+		RoomID: roomID,
+		Claims: &auth.Claims{UserID: userID},
+	}
+	hub.addClient(client)
+	return client
+}
+
+func received(client *Client) int {
+	n := 0
+	for {
+		select {
+		case <-client.Send:
+			n++
+		default:
+			return n
+		}
+	}
+}
+
+func TestHub_BroadcastSkipsBlockedAuthor(t *testing.T) {
+	hub := NewHub()
+	blocker := newTestClient(hub, "blocker", "room-1")
+	other := newTestClient(hub, "other", "room-1")
+
+	hub.applyBlock(&BlockEvent{BlockerID: "blocker", BlockedID: "author", Blocked: true})
+
+	hub.broadcastToRoom(&Message{RoomID: "room-1", UserID: "author", Content: "hi"})
+	if n := received(blocker); n != 0 {
+		t.Errorf("blocker received %d messages, want 0", n)
+	}
+	if n := received(other); n != 1 {
+		t.Errorf("other received %d messages, want 1", n)
+	}
+
+	// Messages from other instances arrive as typed events
+	data, _ := json.Marshal(WSMessage{Type: "message", Payload: &Message{RoomID: "room-1", UserID: "author"}})
+	var wsMsg WSMessage
+	json.Unmarshal(data, &wsMsg)
+	hub.broadcastRaw("room-1", authorOf(&wsMsg), data)
+	if n := received(blocker); n != 0 {
+		t.Errorf("blocker received %d relayed messages, want 0", n)
+	}
+	if n := received(other); n != 1 {
+		t.Errorf("other received %d relayed messages, want 1", n)
+	}
+}
+
+func TestHub_ApplyBlock_Unblock(t *testing.T) {
+	hub := NewHub()
+	blocker := newTestClient(hub, "blocker", "room-1")
+
+	hub.applyBlock(&BlockEvent{BlockerID: "blocker", BlockedID: "author", Blocked: true})
+	hub.applyBlock(&BlockEvent{BlockerID: "blocker", BlockedID: "author", Blocked: false})
+
+	hub.broadcastToRoom(&Message{RoomID: "room-1", UserID: "author"})
+	if n := received(blocker); n != 1 {
+		t.Errorf("blocker received %d messages after unblocking, want 1", n)
+	}
+}
+
+func TestHub_BroadcastRaw_NoAuthorReachesEveryone(t *testing.T) {
+	hub := NewHub()
+	blocker := newTestClient(hub, "blocker", "room-1")
+	hub.applyBlock(&BlockEvent{BlockerID: "blocker", BlockedID: "author", Blocked: true})
+
+	hub.broadcastRaw("room-1", "", []byte(`{"type":"moderation_update"}`))
+	if n := received(blocker); n != 1 {
+		t.Errorf("blocker received %d events, want 1", n)
+	}
+}
+
+func TestHub_DisconnectRoom(t *testing.T) {
+	hub := NewHub()
+	deleted := newTestClient(hub, "alice", "room-1")
+	other := newTestClient(hub, "bob", "room-2")
+
+	go func() {
+		for client := range hub.unregister {
+			hub.removeClient(client)
+		}
+	}()
+	hub.disconnectRoom("room-1")
+
+	if _, open := <-deleted.Send; open {
+		t.Error("client in the deleted room is still connected")
+	}
+	select {
+	case _, open := <-other.Send:
+		if !open {
+			t.Error("client in another room was disconnected")
+		}
+	default:
+	}
+}
+
+func TestHub_KickFromRoom(t *testing.T) {
+	hub := NewHub()
+	kicked := newTestClient(hub, "alice", "room-1")
+	elsewhere := newTestClient(hub, "alice", "room-2")
+	other := newTestClient(hub, "bob", "room-1")
+
+	go func() {
+		for client := range hub.unregister {
+			hub.removeClient(client)
+		}
+	}()
+	hub.kickFromRoom("room-1", "alice", []byte(`{"type":"kicked"}`))
+
+	if data, open := <-kicked.Send; !open || string(data) != `{"type":"kicked"}` {
+		t.Errorf("kicked client got %q, want the kicked event", data)
+	}
+	if _, open := <-kicked.Send; open {
+		t.Error("kicked client is still connected")
+	}
+	if n := received(elsewhere); n != 0 {
+		t.Errorf("the user's client in another room received %d events, want 0", n)
+	}
+	if n := received(other); n != 0 {
+		t.Errorf("other client received %d events, want 0", n)
+	}
+}
+
+func TestHub_LeftPrivateRoom(t *testing.T) {
+	sqlite.Init(filepath.Join(t.TempDir(), "test.db"))
+	t.Cleanup(sqlite.Close)
+	sqlite.Migrate()
+
+	users := auth.NewUserRepository()
+	owner := &auth.User{Email: "owner@example.com", PasswordHash: "x", Username: "owner", Role: auth.RoleUser}
+	alice := &auth.User{Email: "alice@example.com", PasswordHash: "x", Username: "alice", Role: auth.RoleUser}
+	for _, u := range []*auth.User{owner, alice} {
+		if err := users.Create(u); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+
+	hub := NewHub()
+	room := &Room{Name: "staff", CreatedBy: owner.ID, Visibility: RoomPrivate}
+	if err := hub.roomRepo.Create(room); err != nil {
+		t.Fatalf("failed to create room: %v", err)
+	}
+	if err := hub.memberRepo.Join(room.ID, alice.ID); err != nil {
+		t.Fatalf("failed to join room: %v", err)
+	}
+
+	left := newTestClient(hub, alice.ID, room.ID)
+	other := newTestClient(hub, owner.ID, room.ID)
+	if ok, reason := hub.canPost(left.Claims, room.ID); !ok {
+		t.Fatalf("expected a member to post, got %q", reason)
+	}
+
+	go func() {
+		for client := range hub.unregister {
+			hub.removeClient(client)
+		}
+	}()
+	// What LeaveRoom does: drop the membership, then kick every connection
+	if err := hub.memberRepo.Remove(room.ID, alice.ID); err != nil {
+		t.Fatalf("failed to leave room: %v", err)
+	}
+	hub.kickFromRoom(room.ID, alice.ID, []byte(`{"type":"kicked"}`))
+
+	<-left.Send
+	if _, open := <-left.Send; open {
+		t.Error("the user who left is still connected")
+	}
+	hub.broadcastRaw(room.ID, "", []byte(`{"type":"message"}`))
+	if n := received(other); n != 1 {
+		t.Errorf("remaining member received %d messages, want 1", n)
+	}
+	if ok, _ := hub.canPost(left.Claims, room.ID); ok {
+		t.Error("expected the user who left to be refused")
+	}
+	if ok, reason := hub.canPost(&auth.Claims{UserID: "mod", Role: auth.RoleModerator}, room.ID); !ok {
+		t.Errorf("expected a global moderator to post, got %q", reason)
+	}
+}
+
+func TestHub_OnlineUsersCountsDistinctUsers(t *testing.T) {
+	hub := NewHub()
+	newTestClient(hub, "alice", "room-1")
+	newTestClient(hub, "alice", "room-1")
+	newTestClient(hub, "bob", "room-1")
+	newTestClient(hub, "bob", "room-2")
+
+	counts := hub.onlineUsers()
+	if counts["room-1"] != 2 || counts["room-2"] != 1 {
+		t.Errorf("online users = %v, want room-1: 2, room-2: 1", counts)
+	}
+}
@@ -0,0 +1,247 @@
+package chat
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mr1hm/go-chat-moderator/internal/auth"
+)
+
+// Invites last a week unless the creator asks otherwise
+const defaultInviteTTL = 7 * 24 * time.Hour
+
+// CreateInvite makes an invite link for a room. The link holds a token
+// that is only returned here; the server keeps its SHA-256 hash. Routed
+// behind RequireRoomRole(moderator).
+func (h *Handler) CreateInvite(c *gin.Context) {
+	var req CreateInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ttl := defaultInviteTTL
+	if req.ExpiresInHours > 0 {
+		ttl = time.Duration(req.ExpiresInHours) * time.Hour
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to generate invite",
+		})
+		return
+	}
+
+	invite := &RoomInvite{
+		RoomID:    c.Param("id"),
+		CreatedBy: c.GetString("user_id"),
+		TokenHash: hashToken(token),
+		MaxUses:   req.MaxUses,
+		ExpiresAt: time.Now().UTC().Add(ttl).Truncate(time.Second),
+	}
+	if err := h.inviteRepo.Create(invite); err != nil {
+		log.Printf("error while creating invite: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to create invite",
+		})
+		return
+	}
+
+	invite.URL = h.appURL + "/invite/" + token
+	c.JSON(http.StatusCreated, invite)
+}
+
+// ListInvites returns a room's invites, without their links
+func (h *Handler) ListInvites(c *gin.Context) {
+	invites, err := h.inviteRepo.ListByRoom(c.Param("id"))
+	if err != nil {
+		log.Printf("error while listing invites: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to list invites",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, invites)
+}
+
+func (h *Handler) RevokeInvite(c *gin.Context) {
+	if err := h.inviteRepo.Revoke(c.Param("id"), c.Param("inviteID")); err != nil {
+		if errors.Is(err, ErrInviteNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": ErrInviteNotFound.Error(),
+			})
+			return
+		}
+		log.Printf("error while revoking invite: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to revoke invite",
+		})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// AcceptInvite joins the current user to the invite's room. Members who
+// follow a link again don't use it up.
+func (h *Handler) AcceptInvite(c *gin.Context) {
+	invite, err := h.inviteRepo.FindByTokenHash(hashToken(c.Param("token")))
+	if err != nil {
+		if errors.Is(err, ErrInviteNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": ErrInviteNotFound.Error(),
+			})
+			return
+		}
+		log.Printf("error while finding invite: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to accept invite",
+		})
+		return
+	}
+
+	room, err := h.roomRepo.FindByID(invite.RoomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to get room",
+		})
+		return
+	}
+
+	userID := c.GetString("user_id")
+	if !h.checkBan(c, room.ID, userID) {
+		return
+	}
+	if _, err := h.memberRepo.Role(room.ID, userID); err == nil {
+		c.JSON(http.StatusOK, room)
+		return
+	} else if !errors.Is(err, ErrNotMember) {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to get member",
+		})
+		return
+	}
+
+	if !invite.Usable(time.Now()) {
+		c.JSON(http.StatusGone, gin.H{
+			"error": ErrInviteExpired.Error(),
+		})
+		return
+	}
+	if err := h.inviteRepo.Redeem(invite, userID); err != nil {
+		if errors.Is(err, ErrInviteExpired) {
+			c.JSON(http.StatusGone, gin.H{
+				"error": ErrInviteExpired.Error(),
+			})
+			return
+		}
+		log.Printf("error while redeeming invite: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to accept invite",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, room)
+}
+
+// JoinRoom makes the current user a member of a public room. Private rooms
+// need an invite.
+func (h *Handler) JoinRoom(c *gin.Context) {
+	claims := c.MustGet("claims").(*auth.Claims)
+	room, _, ok := h.visibleRoom(c, c.Param("id"), claims)
+	if !ok {
+		return
+	}
+
+	if !h.checkBan(c, room.ID, claims.UserID) {
+		return
+	}
+	if _, err := h.memberRepo.Role(room.ID, claims.UserID); err == nil {
+		c.JSON(http.StatusOK, room)
+		return
+	} else if !errors.Is(err, ErrNotMember) {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to get member",
+		})
+		return
+	}
+
+	if room.Visibility == RoomPrivate {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "this room is private, ask a member for an invite",
+		})
+		return
+	}
+
+	if err := h.memberRepo.Join(room.ID, claims.UserID); err != nil {
+		log.Printf("error while joining room: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to join room",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, room)
+}
+
+// LeaveRoom removes the current user from a room and closes their
+// connections to it on every instance. The owner has to stay.
+func (h *Handler) LeaveRoom(c *gin.Context) {
+	roomID, userID := c.Param("id"), c.GetString("user_id")
+
+	role, err := h.memberRepo.Role(roomID, userID)
+	if err != nil {
+		if errors.Is(err, ErrNotMember) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": ErrNotMember.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to get member",
+		})
+		return
+	}
+	if role == RoomRoleOwner {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "the owner can't leave the room",
+		})
+		return
+	}
+
+	if err := h.memberRepo.Remove(roomID, userID); err != nil && !errors.Is(err, ErrNotMember) {
+		log.Printf("error while leaving room: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to leave room",
+		})
+		return
+	}
+	h.publishKick(c, &KickEvent{RoomID: roomID, UserID: userID, Reason: "you left the room"})
+
+	c.Status(http.StatusNoContent)
+}
+
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
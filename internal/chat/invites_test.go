@@ -0,0 +1,44 @@
+package chat
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRoomInvite_Usable(t *testing.T) {
+	now := time.Now()
+	revoked := now.Add(-time.Minute)
+
+	tests := []struct {
+		name   string
+		invite RoomInvite
+		want   bool
+	}{
+		{"unlimited", RoomInvite{ExpiresAt: now.Add(time.Hour)}, true},
+		{"uses left", RoomInvite{ExpiresAt: now.Add(time.Hour), MaxUses: 2, Uses: 1}, true},
+		{"used up", RoomInvite{ExpiresAt: now.Add(time.Hour), MaxUses: 2, Uses: 2}, false},
+		{"expired", RoomInvite{ExpiresAt: now.Add(-time.Second)}, false},
+		{"revoked", RoomInvite{ExpiresAt: now.Add(time.Hour), RevokedAt: &revoked}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.invite.Usable(now); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestCanView(t *testing.T) {
+	public := &Room{Visibility: RoomPublic}
+	private := &Room{Visibility: RoomPrivate}
+
+	if !canView(public, "") {
+		t.Error("expected anyone to see a public room")
+	}
+	if canView(private, "") {
+		t.Error("expected non-members not to see a private room")
+	}
+	if !canView(private, RoomRoleMember) {
+		t.Error("expected members to see a private room")
+	}
+}
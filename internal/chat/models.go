@@ -3,9 +3,169 @@ package chat
 import "time"
 
 type Room struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	CreatedBy string    `json:"created_by"`
+	ID              string     `json:"id"`
+	Name            string     `json:"name"`
+	Description     string     `json:"description"`
+	Topic           string     `json:"topic"`
+	Tags            []string   `json:"tags"`
+	CreatedBy       string     `json:"created_by"`
+	Kind            string     `json:"kind"`                  // RoomKindRoom or RoomKindDM
+	Visibility      string     `json:"visibility"`            // RoomPublic or RoomPrivate
+	RequireVerified bool       `json:"require_verified"`      // Only verified emails may post
+	ArchivedAt      *time.Time `json:"archived_at,omitempty"` // Archived rooms are read-only
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// RoomListing is a room as shown in discovery. OnlineCount is the number of
+// users connected to the room, summed over API instances.
+type RoomListing struct {
+	*Room
+	MemberCount    int       `json:"member_count"`
+	OnlineCount    int       `json:"online_count"`
+	LastActivityAt time.Time `json:"last_activity_at"` // Latest message, or creation
+}
+
+// RoomPage is one page of room listings
+type RoomPage struct {
+	Rooms      []*RoomListing `json:"rooms"`
+	NextCursor string         `json:"next_cursor,omitempty"` // Absent on the last page
+}
+
+// Room listing orders
+const (
+	RoomSortNew     = "new"
+	RoomSortActive  = "active"
+	RoomSortMembers = "members"
+)
+
+// RoomFilter selects and orders rooms for discovery
+type RoomFilter struct {
+	ViewerID string // Hide private rooms ViewerID isn't in; empty shows every room
+	Query    string // Part of the room name
+	Tag      string
+	Sort     string
+	Limit    int
+	After    *RoomCursor // Continue after this room
+}
+
+// RoomCursor marks the last room of a page by its sort key and ID. Clients
+// get it encoded as an opaque string.
+type RoomCursor struct {
+	Sort  string `json:"s"`
+	Key   string `json:"k,omitempty"` // Time sort keys
+	Count int    `json:"n,omitempty"` // Member count sort key
+	ID    string `json:"i"`
+}
+
+// RoomUpdatedEvent is the payload of the room_updated websocket event, sent
+// to a room's connections whenever its settings, owner or existence change
+type RoomUpdatedEvent struct {
+	Room    *Room  `json:"room"`
+	OwnerID string `json:"owner_id,omitempty"` // Set when ownership was transferred
+	Deleted bool   `json:"deleted,omitempty"`  // The room is gone and connections will close
+}
+
+// Room visibility. Anyone can find and join public rooms; private rooms are
+// hidden from non-members, who need an invite to join.
+const (
+	RoomPublic  = "public"
+	RoomPrivate = "private"
+)
+
+// Room kinds. DMs are private rooms whose members are the participants;
+// they are left out of room listings and nobody holds a room role above
+// member in them.
+const (
+	RoomKindRoom = "room"
+	RoomKindDM   = "dm"
+)
+
+// DMConversation is a DM room with its participants, as listed for one of them
+type DMConversation struct {
+	*Room
+	Participants  []*RoomMember `json:"participants"`
+	LastMessageAt *time.Time    `json:"last_message_at,omitempty"`
+}
+
+// MessageReport is a user flagging a message for moderators. Message and
+// RoomKind are filled in when moderators list reports.
+type MessageReport struct {
+	ID               string     `json:"id"`
+	MessageID        string     `json:"message_id"`
+	ReporterID       string     `json:"reporter_id"`
+	ReporterUsername string     `json:"reporter_username,omitempty"`
+	Reason           string     `json:"reason"`
+	CreatedAt        time.Time  `json:"created_at"`
+	ResolvedAt       *time.Time `json:"resolved_at,omitempty"`
+	Message          *Message   `json:"message,omitempty"`
+	RoomKind         string     `json:"room_kind,omitempty"`
+}
+
+// RoomBan keeps a user out of a room until it expires. Bans without an
+// expiry are permanent.
+type RoomBan struct {
+	RoomID    string     `json:"room_id"`
+	UserID    string     `json:"user_id"`
+	Username  string     `json:"username,omitempty"`
+	BannedBy  string     `json:"banned_by"`
+	Reason    string     `json:"reason"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// KickEvent is the payload of the kicked websocket event. It goes only to
+// the removed user's connections, which then close.
+type KickEvent struct {
+	RoomID      string     `json:"room_id"`
+	UserID      string     `json:"user_id"`
+	Reason      string     `json:"reason,omitempty"`
+	BannedUntil *time.Time `json:"banned_until,omitempty"`
+	Banned      bool       `json:"banned"`
+}
+
+// RoomInvite lets anyone holding its link join a room, until it expires,
+// runs out of uses or is revoked
+type RoomInvite struct {
+	ID        string     `json:"id"`
+	RoomID    string     `json:"room_id"`
+	CreatedBy string     `json:"created_by"`
+	TokenHash string     `json:"-"`
+	MaxUses   int        `json:"max_uses"` // 0 is unlimited
+	Uses      int        `json:"uses"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	URL       string     `json:"url,omitempty"` // Only returned on creation
+}
+
+// Usable reports whether the invite can still be redeemed
+func (i *RoomInvite) Usable(now time.Time) bool {
+	return i.RevokedAt == nil && now.Before(i.ExpiresAt) && (i.MaxUses == 0 || i.Uses < i.MaxUses)
+}
+
+// Room roles, from least to most privileged
+const (
+	RoomRoleMember    = "member"
+	RoomRoleModerator = "moderator"
+	RoomRoleOwner     = "owner"
+)
+
+var roomRoleRank = map[string]int{
+	RoomRoleMember:    1,
+	RoomRoleModerator: 2,
+	RoomRoleOwner:     3,
+}
+
+// HasRoomRole reports whether role grants at least the privileges of required
+func HasRoomRole(role, required string) bool {
+	return roomRoleRank[role] > 0 && roomRoleRank[role] >= roomRoleRank[required]
+}
+
+type RoomMember struct {
+	RoomID    string    `json:"room_id"`
+	UserID    string    `json:"user_id"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
@@ -14,13 +174,81 @@ type Message struct {
 	RoomID           string    `json:"room_id"`
 	UserID           string    `json:"user_id"`
 	Username         string    `json:"username,omitempty"`
+	Bot              bool      `json:"bot"` // Posted by a bot account
 	Content          string    `json:"content"`
 	ModerationStatus string    `json:"moderation_status"`
 	CreatedAt        time.Time `json:"created_at"`
 }
 
+// Block hides a user's messages from the user who blocked them
+type Block struct {
+	UserID    string    `json:"user_id"` // The blocked user
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BlockEvent tells every API instance that a block changed, so the
+// blocker's open websockets start or stop receiving the user's messages
+type BlockEvent struct {
+	BlockerID string `json:"blocker_id"`
+	BlockedID string `json:"blocked_id"`
+	Blocked   bool   `json:"blocked"`
+}
+
 type CreateRoomRequest struct {
-	Name string `json:"name" binding:"required,min=1,max=100"`
+	Name            string   `json:"name" binding:"required,min=1,max=100"`
+	Description     string   `json:"description" binding:"max=500"`
+	Topic           string   `json:"topic" binding:"max=200"`
+	Tags            []string `json:"tags" binding:"max=10"`
+	Visibility      string   `json:"visibility" binding:"omitempty,oneof=public private"` // Defaults to public
+	RequireVerified bool     `json:"require_verified"`
+}
+
+type CreateInviteRequest struct {
+	ExpiresInHours int `json:"expires_in_hours" binding:"omitempty,min=1,max=720"` // Defaults to a week
+	MaxUses        int `json:"max_uses" binding:"omitempty,min=0,max=1000"`
+}
+
+type SetMemberRoleRequest struct {
+	Role   string `json:"role" binding:"required,oneof=member moderator"`
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// UpdateRoomRequest changes only the fields that are set
+type UpdateRoomRequest struct {
+	Name            *string   `json:"name" binding:"omitempty,min=1,max=100"`
+	Description     *string   `json:"description" binding:"omitempty,max=500"`
+	Topic           *string   `json:"topic" binding:"omitempty,max=200"`
+	Tags            *[]string `json:"tags" binding:"omitempty,max=10"`
+	Visibility      *string   `json:"visibility" binding:"omitempty,oneof=public private"`
+	RequireVerified *bool     `json:"require_verified"`
+	Archived        *bool     `json:"archived"`
+}
+
+// KickRequest removes a member from a room. A duration also bans them for
+// that long.
+type KickRequest struct {
+	Reason          string `json:"reason" binding:"max=500"`
+	DurationMinutes int    `json:"duration_minutes" binding:"omitempty,min=0,max=525600"`
+}
+
+// BanRequest bans a user from a room; without a duration the ban is permanent
+type BanRequest struct {
+	Reason          string `json:"reason" binding:"max=500"`
+	DurationMinutes int    `json:"duration_minutes" binding:"omitempty,min=0,max=525600"`
+}
+
+type TransferRoomRequest struct {
+	UserID string `json:"user_id" binding:"required"`
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+type OpenDMRequest struct {
+	UserIDs []string `json:"user_ids" binding:"required,min=1,max=9"` // Other participants
+}
+
+type ReportMessageRequest struct {
+	Reason string `json:"reason" binding:"required,min=1,max=500"`
 }
 
 type SendMessageRequest struct {
@@ -29,6 +257,6 @@ type SendMessageRequest struct {
 
 // Websocket Message Types
 type WSMessage struct {
-	Type    string      `json:"type"` // message, join, leave, error
+	Type    string      `json:"type"` // message, join, leave, error, room_updated, kicked
 	Payload interface{} `json:"payload"`
 }
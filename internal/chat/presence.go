@@ -0,0 +1,121 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/mr1hm/go-chat-moderator/internal/shared/redis"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// Online counts are shared through Redis. Each instance keeps a hash of
+// roomID -> connected users under presenceKeyPrefix+instanceID and
+// registers itself in presenceInstancesKey, scored by its last write. Hashes
+// expire, so a crashed instance's users drop out of the counts.
+const (
+	presenceKeyPrefix    = "presence:"
+	presenceInstancesKey = "presence:instances"
+	presenceInterval     = 10 * time.Second
+	presenceTTL          = 3 * presenceInterval
+)
+
+// presenceChanged asks for the online counts to be written soon
+func (h *Hub) presenceChanged() {
+	select {
+	case h.presenceDirty <- struct{}{}:
+	default:
+	}
+}
+
+// publishPresence writes this instance's online counts when connections
+// change, and regularly so they don't expire
+func (h *Hub) publishPresence() {
+	ticker := time.NewTicker(presenceInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-h.presenceDirty:
+		}
+		if err := h.writePresence(context.Background()); err != nil {
+			log.Printf("error while publishing presence: %v", err)
+		}
+	}
+}
+
+func (h *Hub) writePresence(ctx context.Context) error {
+	counts := h.onlineUsers()
+	key := presenceKeyPrefix + h.instanceID
+	now := time.Now()
+
+	_, err := redis.Client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		if len(counts) > 0 {
+			pipe.HSet(ctx, key, counts)
+			pipe.Expire(ctx, key, presenceTTL)
+		}
+		pipe.ZAdd(ctx, presenceInstancesKey, goredis.Z{Score: float64(now.Unix()), Member: h.instanceID})
+		pipe.ZRemRangeByScore(ctx, presenceInstancesKey, "-inf", strconv.FormatInt(now.Add(-presenceTTL).Unix(), 10))
+		return nil
+	})
+
+	return err
+}
+
+// onlineUsers counts the distinct users connected to each room on this instance
+func (h *Hub) onlineUsers() map[string]any {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+
+	counts := make(map[string]any, len(h.rooms))
+	for roomID, clients := range h.rooms {
+		users := make(map[string]bool, len(clients))
+		for client := range clients {
+			users[client.UserID] = true
+		}
+		if len(users) > 0 {
+			counts[roomID] = len(users)
+		}
+	}
+
+	return counts
+}
+
+// OnlineCounts returns how many users are connected to each room across
+// every instance. A user connected through two instances counts twice.
+func (h *Hub) OnlineCounts(ctx context.Context, roomIDs []string) (map[string]int, error) {
+	counts := make(map[string]int, len(roomIDs))
+	if len(roomIDs) == 0 {
+		return counts, nil
+	}
+
+	since := strconv.FormatInt(time.Now().Add(-presenceTTL).Unix(), 10)
+	instances, err := redis.Client.ZRangeByScore(ctx, presenceInstancesKey, &goredis.ZRangeBy{Min: since, Max: "+inf"}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := redis.Client.Pipeline()
+	results := make([]*goredis.SliceCmd, len(instances))
+	for i, instanceID := range instances {
+		results[i] = pipe.HMGet(ctx, presenceKeyPrefix+instanceID, roomIDs...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, goredis.Nil) {
+		return nil, err
+	}
+
+	for _, result := range results {
+		for i, value := range result.Val() {
+			if s, ok := value.(string); ok {
+				n, _ := strconv.Atoi(s)
+				counts[roomIDs[i]] += n
+			}
+		}
+	}
+
+	return counts, nil
+}
@@ -4,6 +4,9 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/mr1hm/go-chat-moderator/internal/shared/sqlite"
@@ -12,14 +15,31 @@ import (
 var (
 	ErrRoomNotFound    = errors.New("room not found")
 	ErrMessageNotFound = errors.New("message not found")
+	ErrNotMember       = errors.New("not a member of this room")
+	ErrNotBlocked      = errors.New("user is not blocked")
+	ErrInviteNotFound  = errors.New("invite not found")
+	ErrInviteExpired   = errors.New("invite has expired or been used up")
+	ErrAlreadyReported = errors.New("message already reported")
+	ErrNotBanned       = errors.New("user is not banned from this room")
 )
 
+// Matches CURRENT_TIMESTAMP so stored times compare correctly in SQL
+const sqliteTimeLayout = "2006-01-02 15:04:05"
+
 type RoomRepository interface {
 	Create(room *Room) error
 	FindByID(id string) (*Room, error)
-	List() ([]*Room, error)
+	Search(filter RoomFilter) ([]*RoomListing, *RoomCursor, error)
+	Update(room *Room) error
+	Delete(id string) error
+	CreateDM(room *Room, memberIDs []string) (bool, error)
+	ListDMs(userID string) ([]*DMConversation, error)
 }
 
+// roomColumns selects from rooms aliased as r
+const roomColumns = `r.id, r.name, r.description, r.topic, r.created_by, r.kind, r.visibility, r.require_verified, r.archived_at, r.created_at,
+	(SELECT GROUP_CONCAT(t.tag) FROM room_tags t WHERE t.room_id = r.id) AS tags`
+
 type sqliteRoomRepo struct{}
 
 func NewRoomRepository() RoomRepository {
@@ -28,19 +48,29 @@ func NewRoomRepository() RoomRepository {
 
 func (r *sqliteRoomRepo) Create(room *Room) error {
 	room.ID = uuid.New().String()
-	_, err := sqlite.DB.Exec(
-		`INSERT INTO rooms (id, name, created_by) VALUES (?, ?, ?)`,
-		room.ID, room.Name, room.CreatedBy,
-	)
+	room.Kind = RoomKindRoom
 
-	return err
+	tx, err := sqlite.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		`INSERT INTO rooms (id, name, description, topic, created_by, kind, visibility, require_verified) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		room.ID, room.Name, room.Description, room.Topic, room.CreatedBy, RoomKindRoom, room.Visibility, room.RequireVerified,
+	); err != nil {
+		return err
+	}
+	if err := setRoomTags(tx, room.ID, room.Tags); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (r *sqliteRoomRepo) FindByID(id string) (*Room, error) {
-	room := &Room{}
-	err := sqlite.DB.QueryRow(
-		`SELECT id, name, created_by, created_at FROM rooms WHERE id = ?`, id,
-	).Scan(&room.ID, &room.Name, &room.CreatedBy, &room.CreatedAt)
+	room, err := scanRoom(sqlite.DB.QueryRow(`SELECT `+roomColumns+` FROM rooms r WHERE r.id = ?`, id))
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, ErrRoomNotFound
 	}
@@ -48,34 +78,577 @@ func (r *sqliteRoomRepo) FindByID(id string) (*Room, error) {
 	return room, err
 }
 
-func (r *sqliteRoomRepo) List() ([]*Room, error) {
-	rows, err := sqlite.DB.Query(`SELECT id, name, created_by, created_at FROM rooms ORDER BY created_at DESC`)
+// Sort keys of Search, by RoomFilter.Sort
+var roomSortKeys = map[string]string{
+	RoomSortNew:     "created_at",
+	RoomSortActive:  "last_activity",
+	RoomSortMembers: "member_count",
+}
+
+// Search returns a page of rooms, leaving out DMs, and the cursor of the
+// next page if there is one. Rooms are ordered by the sort key, newest or
+// largest first, with ties broken by ID so pages never overlap.
+func (r *sqliteRoomRepo) Search(filter RoomFilter) ([]*RoomListing, *RoomCursor, error) {
+	key, ok := roomSortKeys[filter.Sort]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown room sort %q", filter.Sort)
+	}
+
+	where, args := []string{"r.kind = ?"}, []any{RoomKindRoom}
+	if filter.ViewerID != "" {
+		where = append(where, "(r.visibility = ? OR EXISTS (SELECT 1 FROM room_members m WHERE m.room_id = r.id AND m.user_id = ?))")
+		args = append(args, RoomPublic, filter.ViewerID)
+	}
+	if filter.Query != "" {
+		where = append(where, `r.name LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+likeEscaper.Replace(filter.Query)+"%")
+	}
+	if filter.Tag != "" {
+		where = append(where, "EXISTS (SELECT 1 FROM room_tags t WHERE t.room_id = r.id AND t.tag = ?)")
+		args = append(args, filter.Tag)
+	}
+
+	query := `SELECT * FROM (
+		SELECT ` + roomColumns + `,
+		 (SELECT COUNT(*) FROM room_members m WHERE m.room_id = r.id) AS member_count,
+		 COALESCE((SELECT MAX(created_at) FROM messages WHERE room_id = r.id), r.created_at) AS last_activity
+		 FROM rooms r
+		 WHERE ` + strings.Join(where, " AND ") + `)`
+	if after := filter.After; after != nil {
+		var value any = after.Key
+		if filter.Sort == RoomSortMembers {
+			value = after.Count
+		}
+		query += ` WHERE ` + key + ` < ? OR (` + key + ` = ? AND id < ?)`
+		args = append(args, value, value, after.ID)
+	}
+	query += ` ORDER BY ` + key + ` DESC, id DESC LIMIT ?`
+	args = append(args, filter.Limit+1)
+
+	rows, err := sqlite.DB.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("error while querying rooms (list): %w", err)
+		return nil, nil, fmt.Errorf("error while querying rooms: %w", err)
 	}
 	defer rows.Close()
 
-	var rooms []*Room
+	listings := []*RoomListing{}
 	for rows.Next() {
-		room := &Room{}
-		if err := rows.Scan(
-			&room.ID,
-			&room.Name,
-			&room.CreatedBy,
-			&room.CreatedAt,
+		listing := &RoomListing{}
+		var lastActivity string
+		room, err := scanRoom(rows, &listing.MemberCount, &lastActivity)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error while scanning rooms: %w", err)
+		}
+		listing.Room = room
+		// COALESCE loses the column's DATETIME type, so it comes back as text
+		if t, err := time.Parse(sqliteTimeLayout, lastActivity); err == nil {
+			listing.LastActivityAt = t
+		}
+		listings = append(listings, listing)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if len(listings) <= filter.Limit {
+		return listings, nil, nil
+	}
+	listings = listings[:filter.Limit]
+	last := listings[len(listings)-1]
+	next := &RoomCursor{Sort: filter.Sort, ID: last.ID}
+	switch filter.Sort {
+	case RoomSortNew:
+		next.Key = last.CreatedAt.UTC().Format(sqliteTimeLayout)
+	case RoomSortActive:
+		next.Key = last.LastActivityAt.UTC().Format(sqliteTimeLayout)
+	case RoomSortMembers:
+		next.Count = last.MemberCount
+	}
+
+	return listings, next, nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// setRoomTags replaces a room's tags
+func setRoomTags(tx *sql.Tx, roomID string, tags []string) error {
+	if _, err := tx.Exec(`DELETE FROM room_tags WHERE room_id = ?`, roomID); err != nil {
+		return fmt.Errorf("error while clearing room tags: %w", err)
+	}
+	for _, tag := range tags {
+		if _, err := tx.Exec(`INSERT INTO room_tags (room_id, tag) VALUES (?, ?)`, roomID, tag); err != nil {
+			return fmt.Errorf("error while tagging room: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// scanRoom reads roomColumns, then any extra columns into extra
+func scanRoom(row interface{ Scan(...any) error }, extra ...any) (*Room, error) {
+	room := &Room{}
+	var archivedAt sql.NullTime
+	var tags sql.NullString
+	dest := append([]any{
+		&room.ID,
+		&room.Name,
+		&room.Description,
+		&room.Topic,
+		&room.CreatedBy,
+		&room.Kind,
+		&room.Visibility,
+		&room.RequireVerified,
+		&archivedAt,
+		&room.CreatedAt,
+		&tags,
+	}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	if archivedAt.Valid {
+		room.ArchivedAt = &archivedAt.Time
+	}
+	room.Tags = []string{}
+	if tags.String != "" {
+		room.Tags = strings.Split(tags.String, ",")
+		sort.Strings(room.Tags)
+	}
+
+	return room, nil
+}
+
+func (r *sqliteRoomRepo) Update(room *Room) error {
+	var archivedAt any
+	if room.ArchivedAt != nil {
+		archivedAt = room.ArchivedAt.UTC().Format(sqliteTimeLayout)
+	}
+
+	tx, err := sqlite.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		`UPDATE rooms SET name = ?, description = ?, topic = ?, visibility = ?, require_verified = ?, archived_at = ? WHERE id = ?`,
+		room.Name, room.Description, room.Topic, room.Visibility, room.RequireVerified, archivedAt, room.ID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrRoomNotFound
+	}
+	if err := setRoomTags(tx, room.ID, room.Tags); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete removes a room with its messages, their moderation history and
+// reports, its memberships and its invites
+func (r *sqliteRoomRepo) Delete(id string) error {
+	tx, err := sqlite.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	const roomMessages = `SELECT id FROM messages WHERE room_id = ?`
+	for _, stmt := range []string{
+		`DELETE FROM message_reports WHERE message_id IN (` + roomMessages + `)`,
+		`DELETE FROM moderation_actions WHERE message_id IN (` + roomMessages + `)`,
+		`DELETE FROM moderation_logs WHERE message_id IN (` + roomMessages + `)`,
+		`DELETE FROM messages WHERE room_id = ?`,
+		`DELETE FROM room_invites WHERE room_id = ?`,
+		`DELETE FROM room_bans WHERE room_id = ?`,
+		`DELETE FROM room_tags WHERE room_id = ?`,
+		`DELETE FROM room_members WHERE room_id = ?`,
+	} {
+		if _, err := tx.Exec(stmt, id); err != nil {
+			return fmt.Errorf("error while deleting room: %w", err)
+		}
+	}
+
+	res, err := tx.Exec(`DELETE FROM rooms WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("error while deleting room: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrRoomNotFound
+	}
+
+	return tx.Commit()
+}
+
+// CreateDM creates a DM room with its participants as members. Opening an
+// existing DM again re-adds anyone who left; it reports false then.
+func (r *sqliteRoomRepo) CreateDM(room *Room, memberIDs []string) (bool, error) {
+	room.Kind = RoomKindDM
+	room.Visibility = RoomPrivate
+	room.Tags = []string{}
+
+	tx, err := sqlite.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		`INSERT INTO rooms (id, name, created_by, kind, visibility) VALUES (?, ?, ?, ?, ?) ON CONFLICT (id) DO NOTHING`,
+		room.ID, room.Name, room.CreatedBy, room.Kind, room.Visibility,
+	)
+	if err != nil {
+		return false, fmt.Errorf("error while creating dm: %w", err)
+	}
+	created, _ := res.RowsAffected()
+
+	for _, userID := range memberIDs {
+		if _, err := tx.Exec(
+			`INSERT INTO room_members (room_id, user_id, role) VALUES (?, ?, ?) ON CONFLICT DO NOTHING`,
+			room.ID, userID, RoomRoleMember,
 		); err != nil {
-			return nil, fmt.Errorf("error while scanning rooms: %w", err)
+			return false, fmt.Errorf("error while adding dm participant: %w", err)
+		}
+	}
+
+	if err := tx.QueryRow(`SELECT created_by, created_at FROM rooms WHERE id = ?`, room.ID).Scan(&room.CreatedBy, &room.CreatedAt); err != nil {
+		return false, err
+	}
+
+	return created == 1, tx.Commit()
+}
+
+// ListDMs returns userID's DMs, most recently active first
+func (r *sqliteRoomRepo) ListDMs(userID string) ([]*DMConversation, error) {
+	rows, err := sqlite.DB.Query(
+		`SELECT `+roomColumns+`,
+		 (SELECT MAX(created_at) FROM messages WHERE room_id = r.id) AS last_message_at
+		 FROM rooms r
+		 JOIN room_members m ON m.room_id = r.id AND m.user_id = ?
+		 WHERE r.kind = ?
+		 ORDER BY COALESCE(last_message_at, r.created_at) DESC`,
+		userID, RoomKindDM,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error while querying dms: %w", err)
+	}
+	defer rows.Close()
+
+	dms := []*DMConversation{}
+	byID := make(map[string]*DMConversation)
+	for rows.Next() {
+		var lastMessageAt sql.NullString
+		room, err := scanRoom(rows, &lastMessageAt)
+		if err != nil {
+			return nil, fmt.Errorf("error while scanning dms: %w", err)
+		}
+		dm := &DMConversation{Room: room, Participants: []*RoomMember{}}
+		// MAX() loses the column's DATETIME type, so it comes back as text
+		if lastMessageAt.Valid {
+			if t, err := time.Parse(sqliteTimeLayout, lastMessageAt.String); err == nil {
+				dm.LastMessageAt = &t
+			}
+		}
+		dms = append(dms, dm)
+		byID[dm.ID] = dm
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	members, err := sqlite.DB.Query(
+		`SELECT m.room_id, m.user_id, u.username, m.role, m.created_at
+		 FROM room_members m
+		 JOIN rooms r ON r.id = m.room_id AND r.kind = ?
+		 JOIN users u ON m.user_id = u.id
+		 WHERE m.room_id IN (SELECT room_id FROM room_members WHERE user_id = ?)
+		 ORDER BY m.created_at`,
+		RoomKindDM, userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error while querying dm participants: %w", err)
+	}
+	defer members.Close()
+
+	for members.Next() {
+		m := &RoomMember{}
+		if err := members.Scan(&m.RoomID, &m.UserID, &m.Username, &m.Role, &m.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error while scanning dm participants: %w", err)
+		}
+		if dm, ok := byID[m.RoomID]; ok {
+			dm.Participants = append(dm.Participants, m)
+		}
+	}
+
+	return dms, members.Err()
+}
+
+// Room Member Repository
+type RoomMemberRepository interface {
+	SetRole(roomID, userID, role string) error
+	Role(roomID, userID string) (string, error)
+	ListByRoom(roomID string) ([]*RoomMember, error)
+	Join(roomID, userID string) error
+	TransferOwnership(roomID, userID string) (string, error)
+	Remove(roomID, userID string) error
+}
+
+type sqliteRoomMemberRepo struct{}
+
+func NewRoomMemberRepository() RoomMemberRepository {
+	return &sqliteRoomMemberRepo{}
+}
+
+// SetRole adds a member or changes their role
+func (r *sqliteRoomMemberRepo) SetRole(roomID, userID, role string) error {
+	_, err := sqlite.DB.Exec(
+		`INSERT INTO room_members (room_id, user_id, role) VALUES (?, ?, ?)
+		 ON CONFLICT (room_id, user_id) DO UPDATE SET role = excluded.role`,
+		roomID, userID, role,
+	)
+
+	return err
+}
+
+// TransferOwnership makes a member the room's owner and the previous owner a
+// moderator. It returns the previous owner's ID.
+func (r *sqliteRoomMemberRepo) TransferOwnership(roomID, userID string) (string, error) {
+	tx, err := sqlite.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var previous string
+	err = tx.QueryRow(
+		`SELECT user_id FROM room_members WHERE room_id = ? AND role = ?`, roomID, RoomRoleOwner,
+	).Scan(&previous)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE room_members SET role = ? WHERE room_id = ? AND role = ?`,
+		RoomRoleModerator, roomID, RoomRoleOwner,
+	); err != nil {
+		return "", fmt.Errorf("error while demoting room owner: %w", err)
+	}
+	res, err := tx.Exec(
+		`UPDATE room_members SET role = ? WHERE room_id = ? AND user_id = ?`,
+		RoomRoleOwner, roomID, userID,
+	)
+	if err != nil {
+		return "", fmt.Errorf("error while transferring room ownership: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", ErrNotMember
+	}
+
+	return previous, tx.Commit()
+}
+
+// Join adds a plain member. Existing members keep their role.
+func (r *sqliteRoomMemberRepo) Join(roomID, userID string) error {
+	_, err := sqlite.DB.Exec(
+		`INSERT INTO room_members (room_id, user_id, role) VALUES (?, ?, ?) ON CONFLICT DO NOTHING`,
+		roomID, userID, RoomRoleMember,
+	)
+
+	return err
+}
+
+func (r *sqliteRoomMemberRepo) Remove(roomID, userID string) error {
+	res, err := sqlite.DB.Exec(
+		`DELETE FROM room_members WHERE room_id = ? AND user_id = ?`, roomID, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotMember
+	}
+
+	return nil
+}
+
+func (r *sqliteRoomMemberRepo) Role(roomID, userID string) (string, error) {
+	var role string
+	err := sqlite.DB.QueryRow(
+		`SELECT role FROM room_members WHERE room_id = ? AND user_id = ?`, roomID, userID,
+	).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotMember
+	}
+
+	return role, err
+}
+
+func (r *sqliteRoomMemberRepo) ListByRoom(roomID string) ([]*RoomMember, error) {
+	rows, err := sqlite.DB.Query(
+		`SELECT m.room_id, m.user_id, u.username, m.role, m.created_at
+		 FROM room_members m
+		 JOIN users u ON m.user_id = u.id
+		 WHERE m.room_id = ?
+		 ORDER BY m.created_at`,
+		roomID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error while querying room members: %w", err)
+	}
+	defer rows.Close()
+
+	members := []*RoomMember{}
+	for rows.Next() {
+		m := &RoomMember{}
+		if err := rows.Scan(&m.RoomID, &m.UserID, &m.Username, &m.Role, &m.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error while scanning room members: %w", err)
+		}
+		members = append(members, m)
+	}
+
+	return members, rows.Err()
+}
+
+// Invite Repository
+type InviteRepository interface {
+	Create(invite *RoomInvite) error
+	FindByTokenHash(tokenHash string) (*RoomInvite, error)
+	ListByRoom(roomID string) ([]*RoomInvite, error)
+	Revoke(roomID, id string) error
+	Redeem(invite *RoomInvite, userID string) error
+}
+
+type sqliteInviteRepo struct{}
+
+func NewInviteRepository() InviteRepository {
+	return &sqliteInviteRepo{}
+}
+
+const inviteColumns = `id, room_id, created_by, token_hash, max_uses, uses, expires_at, revoked_at, created_at`
+
+func (r *sqliteInviteRepo) Create(invite *RoomInvite) error {
+	invite.ID = uuid.New().String()
+	invite.CreatedAt = time.Now().UTC()
+
+	_, err := sqlite.DB.Exec(
+		`INSERT INTO room_invites (id, room_id, created_by, token_hash, max_uses, expires_at, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		invite.ID, invite.RoomID, invite.CreatedBy, invite.TokenHash, invite.MaxUses,
+		invite.ExpiresAt.UTC().Format(sqliteTimeLayout), invite.CreatedAt.Format(sqliteTimeLayout),
+	)
+
+	return err
+}
+
+func (r *sqliteInviteRepo) FindByTokenHash(tokenHash string) (*RoomInvite, error) {
+	invite, err := scanInvite(sqlite.DB.QueryRow(
+		`SELECT `+inviteColumns+` FROM room_invites WHERE token_hash = ?`, tokenHash,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInviteNotFound
+	}
+
+	return invite, err
+}
+
+func (r *sqliteInviteRepo) ListByRoom(roomID string) ([]*RoomInvite, error) {
+	rows, err := sqlite.DB.Query(
+		`SELECT `+inviteColumns+` FROM room_invites WHERE room_id = ? ORDER BY created_at DESC`, roomID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error while querying invites: %w", err)
+	}
+	defer rows.Close()
+
+	invites := []*RoomInvite{}
+	for rows.Next() {
+		invite, err := scanInvite(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error while scanning invites: %w", err)
 		}
-		rooms = append(rooms, room)
+		invites = append(invites, invite)
+	}
+
+	return invites, rows.Err()
+}
+
+func (r *sqliteInviteRepo) Revoke(roomID, id string) error {
+	res, err := sqlite.DB.Exec(
+		`UPDATE room_invites SET revoked_at = CURRENT_TIMESTAMP
+		 WHERE id = ? AND room_id = ? AND revoked_at IS NULL`, id, roomID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrInviteNotFound
+	}
+
+	return nil
+}
+
+// Redeem uses up one use of an invite and adds userID to its room. The use
+// is only counted if the invite is still valid, so concurrent redemptions
+// can't exceed max_uses.
+func (r *sqliteInviteRepo) Redeem(invite *RoomInvite, userID string) error {
+	tx, err := sqlite.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		`UPDATE room_invites SET uses = uses + 1
+		 WHERE id = ? AND revoked_at IS NULL AND expires_at > ? AND (max_uses = 0 OR uses < max_uses)`,
+		invite.ID, time.Now().UTC().Format(sqliteTimeLayout),
+	)
+	if err != nil {
+		return fmt.Errorf("error while redeeming invite: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrInviteExpired
+	}
+
+	if _, err := tx.Exec(
+		`INSERT INTO room_members (room_id, user_id, role) VALUES (?, ?, ?) ON CONFLICT DO NOTHING`,
+		invite.RoomID, userID, RoomRoleMember,
+	); err != nil {
+		return fmt.Errorf("error while adding member: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func scanInvite(row interface{ Scan(...any) error }) (*RoomInvite, error) {
+	invite := &RoomInvite{}
+	var revokedAt sql.NullTime
+	if err := row.Scan(
+		&invite.ID,
+		&invite.RoomID,
+		&invite.CreatedBy,
+		&invite.TokenHash,
+		&invite.MaxUses,
+		&invite.Uses,
+		&invite.ExpiresAt,
+		&revokedAt,
+		&invite.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+	if revokedAt.Valid {
+		invite.RevokedAt = &revokedAt.Time
 	}
 
-	return rooms, rows.Err()
+	return invite, nil
 }
 
 // Message Repository
 type MessageRepository interface {
 	Create(msg *Message) error
-	FindByRoom(roomID string, limit int) ([]*Message, error)
+	FindByID(id string) (*Message, error)
+	FindByRoom(roomID, viewerID string, limit int) ([]*Message, error)
 	UpdateStatus(id, status string) error
 }
 
@@ -97,13 +670,32 @@ func (r *sqliteMessageRepo) Create(msg *Message) error {
 	return err
 }
 
-func (r *sqliteMessageRepo) FindByRoom(roomID string, limit int) ([]*Message, error) {
+func (r *sqliteMessageRepo) FindByID(id string) (*Message, error) {
+	msg := &Message{}
+	err := sqlite.DB.QueryRow(
+		`SELECT m.id, m.room_id, m.user_id, u.username, u.is_bot, m.content, m.moderation_status, m.created_at
+		 FROM messages m
+		 JOIN users u ON m.user_id = u.id
+		 WHERE m.id = ?`, id,
+	).Scan(&msg.ID, &msg.RoomID, &msg.UserID, &msg.Username, &msg.Bot, &msg.Content, &msg.ModerationStatus, &msg.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMessageNotFound
+	}
+
+	return msg, err
+}
+
+// FindByRoom returns a room's latest messages, leaving out authors the
+// viewer has blocked
+func (r *sqliteMessageRepo) FindByRoom(roomID, viewerID string, limit int) ([]*Message, error) {
 	rows, err := sqlite.DB.Query(
-		`SELECT m.id, m.room_id, m.user_id, u.username, m.content, m.moderation_status, m.created_at
+		`SELECT m.id, m.room_id, m.user_id, u.username, u.is_bot, m.content, m.moderation_status, m.created_at
 		 FROM messages m
 		 JOIN users u ON m.user_id = u.id
-		 WHERE m.room_id = ? ORDER BY m.created_at DESC LIMIT ?`,
-		roomID, limit,
+		 WHERE m.room_id = ?
+		 AND NOT EXISTS (SELECT 1 FROM user_blocks b WHERE b.blocker_id = ? AND b.blocked_id = m.user_id)
+		 ORDER BY m.created_at DESC LIMIT ?`,
+		roomID, viewerID, limit,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("error while querying messages by room: %w", err)
@@ -118,6 +710,7 @@ func (r *sqliteMessageRepo) FindByRoom(roomID string, limit int) ([]*Message, er
 			&msg.RoomID,
 			&msg.UserID,
 			&msg.Username,
+			&msg.Bot,
 			&msg.Content,
 			&msg.ModerationStatus,
 			&msg.CreatedAt,
@@ -139,3 +732,285 @@ func (r *sqliteMessageRepo) UpdateStatus(id, status string) error {
 	_, err := sqlite.DB.Exec(`UPDATE messages SET moderation_status = ? WHERE id = ?`, status, id)
 	return err
 }
+
+// Block Repository
+type BlockRepository interface {
+	Block(blockerID, blockedID string) error
+	Unblock(blockerID, blockedID string) error
+	List(blockerID string) ([]*Block, error)
+	BlockedIDs(blockerID string) ([]string, error)
+	IsBlocked(blockerID, blockedID string) (bool, error)
+	BlockedInRoom(roomID, blockedID string) (bool, error)
+}
+
+type sqliteBlockRepo struct{}
+
+func NewBlockRepository() BlockRepository {
+	return &sqliteBlockRepo{}
+}
+
+// Block is idempotent; blocking someone twice keeps the first time
+func (r *sqliteBlockRepo) Block(blockerID, blockedID string) error {
+	_, err := sqlite.DB.Exec(
+		`INSERT INTO user_blocks (blocker_id, blocked_id) VALUES (?, ?) ON CONFLICT DO NOTHING`,
+		blockerID, blockedID,
+	)
+
+	return err
+}
+
+func (r *sqliteBlockRepo) Unblock(blockerID, blockedID string) error {
+	res, err := sqlite.DB.Exec(
+		`DELETE FROM user_blocks WHERE blocker_id = ? AND blocked_id = ?`, blockerID, blockedID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotBlocked
+	}
+
+	return nil
+}
+
+func (r *sqliteBlockRepo) List(blockerID string) ([]*Block, error) {
+	rows, err := sqlite.DB.Query(
+		`SELECT b.blocked_id, u.username, b.created_at
+		 FROM user_blocks b
+		 JOIN users u ON b.blocked_id = u.id
+		 WHERE b.blocker_id = ?
+		 ORDER BY b.created_at DESC`,
+		blockerID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error while querying blocks: %w", err)
+	}
+	defer rows.Close()
+
+	blocks := []*Block{}
+	for rows.Next() {
+		b := &Block{}
+		if err := rows.Scan(&b.UserID, &b.Username, &b.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error while scanning blocks: %w", err)
+		}
+		blocks = append(blocks, b)
+	}
+
+	return blocks, rows.Err()
+}
+
+func (r *sqliteBlockRepo) BlockedIDs(blockerID string) ([]string, error) {
+	rows, err := sqlite.DB.Query(`SELECT blocked_id FROM user_blocks WHERE blocker_id = ?`, blockerID)
+	if err != nil {
+		return nil, fmt.Errorf("error while querying blocks: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error while scanning blocks: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+func (r *sqliteBlockRepo) IsBlocked(blockerID, blockedID string) (bool, error) {
+	var blocked bool
+	err := sqlite.DB.QueryRow(
+		`SELECT EXISTS (SELECT 1 FROM user_blocks WHERE blocker_id = ? AND blocked_id = ?)`, blockerID, blockedID,
+	).Scan(&blocked)
+
+	return blocked, err
+}
+
+// BlockedInRoom reports whether any member of a room has blocked blockedID
+func (r *sqliteBlockRepo) BlockedInRoom(roomID, blockedID string) (bool, error) {
+	var blocked bool
+	err := sqlite.DB.QueryRow(
+		`SELECT EXISTS (
+		 SELECT 1 FROM user_blocks b JOIN room_members m ON m.user_id = b.blocker_id
+		 WHERE m.room_id = ? AND b.blocked_id = ?)`, roomID, blockedID,
+	).Scan(&blocked)
+
+	return blocked, err
+}
+
+// Report Repository
+type ReportRepository interface {
+	Create(report *MessageReport) error
+	ListOpen(limit int) ([]*MessageReport, error)
+	Resolve(messageID string) error
+}
+
+type sqliteReportRepo struct{}
+
+func NewReportRepository() ReportRepository {
+	return &sqliteReportRepo{}
+}
+
+// Create records a report. Each user can report a message once.
+func (r *sqliteReportRepo) Create(report *MessageReport) error {
+	report.ID = uuid.New().String()
+	report.CreatedAt = time.Now().UTC()
+
+	_, err := sqlite.DB.Exec(
+		`INSERT INTO message_reports (id, message_id, reporter_id, reason, created_at) VALUES (?, ?, ?, ?, ?)`,
+		report.ID, report.MessageID, report.ReporterID, report.Reason, report.CreatedAt.Format(sqliteTimeLayout),
+	)
+	if err != nil && strings.Contains(err.Error(), "UNIQUE") {
+		return ErrAlreadyReported
+	}
+
+	return err
+}
+
+// ListOpen returns unresolved reports with their messages, oldest first.
+// Messages in DMs are included; reports are how moderators see into DMs.
+func (r *sqliteReportRepo) ListOpen(limit int) ([]*MessageReport, error) {
+	rows, err := sqlite.DB.Query(
+		`SELECT rp.id, rp.message_id, rp.reporter_id, ru.username, rp.reason, rp.created_at,
+		 m.room_id, m.user_id, mu.username, mu.is_bot, m.content, m.moderation_status, m.created_at, ro.kind
+		 FROM message_reports rp
+		 JOIN users ru ON ru.id = rp.reporter_id
+		 JOIN messages m ON m.id = rp.message_id
+		 JOIN users mu ON mu.id = m.user_id
+		 JOIN rooms ro ON ro.id = m.room_id
+		 WHERE rp.resolved_at IS NULL
+		 ORDER BY rp.created_at LIMIT ?`,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error while querying reports: %w", err)
+	}
+	defer rows.Close()
+
+	reports := []*MessageReport{}
+	for rows.Next() {
+		rp := &MessageReport{Message: &Message{}}
+		if err := rows.Scan(
+			&rp.ID, &rp.MessageID, &rp.ReporterID, &rp.ReporterUsername, &rp.Reason, &rp.CreatedAt,
+			&rp.Message.RoomID, &rp.Message.UserID, &rp.Message.Username, &rp.Message.Bot,
+			&rp.Message.Content, &rp.Message.ModerationStatus, &rp.Message.CreatedAt, &rp.RoomKind,
+		); err != nil {
+			return nil, fmt.Errorf("error while scanning reports: %w", err)
+		}
+		rp.Message.ID = rp.MessageID
+		reports = append(reports, rp)
+	}
+
+	return reports, rows.Err()
+}
+
+// Resolve closes every open report on a message
+func (r *sqliteReportRepo) Resolve(messageID string) error {
+	_, err := sqlite.DB.Exec(
+		`UPDATE message_reports SET resolved_at = CURRENT_TIMESTAMP WHERE message_id = ? AND resolved_at IS NULL`,
+		messageID,
+	)
+
+	return err
+}
+
+// Ban Repository
+type BanRepository interface {
+	Ban(ban *RoomBan) error
+	Unban(roomID, userID string) error
+	IsBanned(roomID, userID string) (bool, error)
+	ListByRoom(roomID string) ([]*RoomBan, error)
+}
+
+type sqliteBanRepo struct{}
+
+func NewBanRepository() BanRepository {
+	return &sqliteBanRepo{}
+}
+
+// Ban bans a user from a room and removes their membership. Banning again
+// replaces the previous ban.
+func (r *sqliteBanRepo) Ban(ban *RoomBan) error {
+	ban.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	var expiresAt any
+	if ban.ExpiresAt != nil {
+		expiresAt = ban.ExpiresAt.UTC().Format(sqliteTimeLayout)
+	}
+
+	tx, err := sqlite.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		`INSERT INTO room_bans (room_id, user_id, banned_by, reason, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?)
+		 ON CONFLICT (room_id, user_id) DO UPDATE SET
+		 banned_by = excluded.banned_by, reason = excluded.reason, expires_at = excluded.expires_at, created_at = excluded.created_at`,
+		ban.RoomID, ban.UserID, ban.BannedBy, ban.Reason, expiresAt, ban.CreatedAt.Format(sqliteTimeLayout),
+	); err != nil {
+		return fmt.Errorf("error while banning user: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM room_members WHERE room_id = ? AND user_id = ?`, ban.RoomID, ban.UserID); err != nil {
+		return fmt.Errorf("error while removing banned member: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func (r *sqliteBanRepo) Unban(roomID, userID string) error {
+	res, err := sqlite.DB.Exec(`DELETE FROM room_bans WHERE room_id = ? AND user_id = ?`, roomID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotBanned
+	}
+
+	return nil
+}
+
+// IsBanned reports whether a user has an unexpired ban from a room
+func (r *sqliteBanRepo) IsBanned(roomID, userID string) (bool, error) {
+	var banned bool
+	err := sqlite.DB.QueryRow(
+		`SELECT EXISTS (SELECT 1 FROM room_bans WHERE room_id = ? AND user_id = ? AND (expires_at IS NULL OR expires_at > ?))`,
+		roomID, userID, time.Now().UTC().Format(sqliteTimeLayout),
+	).Scan(&banned)
+
+	return banned, err
+}
+
+// ListByRoom returns a room's unexpired bans, newest first
+func (r *sqliteBanRepo) ListByRoom(roomID string) ([]*RoomBan, error) {
+	rows, err := sqlite.DB.Query(
+		`SELECT b.room_id, b.user_id, u.username, b.banned_by, b.reason, b.expires_at, b.created_at
+		 FROM room_bans b
+		 JOIN users u ON b.user_id = u.id
+		 WHERE b.room_id = ? AND (b.expires_at IS NULL OR b.expires_at > ?)
+		 ORDER BY b.created_at DESC`,
+		roomID, time.Now().UTC().Format(sqliteTimeLayout),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error while querying bans: %w", err)
+	}
+	defer rows.Close()
+
+	bans := []*RoomBan{}
+	for rows.Next() {
+		ban := &RoomBan{}
+		var expiresAt sql.NullTime
+		if err := rows.Scan(
+			&ban.RoomID, &ban.UserID, &ban.Username, &ban.BannedBy, &ban.Reason, &expiresAt, &ban.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("error while scanning bans: %w", err)
+		}
+		if expiresAt.Valid {
+			ban.ExpiresAt = &expiresAt.Time
+		}
+		bans = append(bans, ban)
+	}
+
+	return bans, rows.Err()
+}
@@ -0,0 +1,125 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+const readme = `This archive holds the personal data stored about your account.
+
+profile.json      Account details, linked sign-on accounts and API keys (never the keys themselves)
+messages.json     Every message you posted, in all rooms (also messages.csv)
+rooms.json        Rooms you created and rooms you are a member of
+moderation.json   Automated moderation results and moderator decisions on your
+                  messages (also moderation_results.csv and moderation_decisions.csv)
+sessions.json     Your logins, with device and IP address (also sessions.csv)
+blocks.json       Users you have blocked
+
+Times are UTC.
+`
+
+// WriteArchive writes a as a ZIP of JSON files, with CSV copies of the
+// tabular parts
+func WriteArchive(w io.Writer, a *Archive, generatedAt time.Time) error {
+	zw := zip.NewWriter(w)
+
+	files := []struct {
+		name  string
+		write func(io.Writer) error
+	}{
+		{"README.txt", func(w io.Writer) error {
+			_, err := fmt.Fprintf(w, "%s\nGenerated %s.\n", readme, generatedAt.UTC().Format(time.RFC3339))
+			return err
+		}},
+		{"profile.json", writeJSON(a.Profile)},
+		{"messages.json", writeJSON(a.Messages)},
+		{"messages.csv", writeCSV(
+			[]string{"id", "room_id", "room_name", "content", "moderation_status", "created_at"},
+			a.Messages, func(m Message) []string {
+				return []string{m.ID, m.RoomID, m.RoomName, m.Content, m.ModerationStatus, formatCSVTime(&m.CreatedAt)}
+			},
+		)},
+		{"rooms.json", writeJSON(map[string]any{
+			"created":     a.RoomsCreated,
+			"memberships": a.Memberships,
+		})},
+		{"moderation.json", writeJSON(map[string]any{
+			"results":   a.ModerationResults,
+			"decisions": a.ModerationDecisions,
+		})},
+		{"moderation_results.csv", writeCSV(
+			[]string{"message_id", "provider", "toxicity_score", "category", "flagged", "processed_at"},
+			a.ModerationResults, func(r ModerationResult) []string {
+				return []string{r.MessageID, r.Provider, strconv.FormatFloat(r.ToxicityScore, 'f', -1, 64),
+					r.Category, strconv.FormatBool(r.Flagged), formatCSVTime(&r.ProcessedAt)}
+			},
+		)},
+		{"moderation_decisions.csv", writeCSV(
+			[]string{"message_id", "action", "reason", "created_at"},
+			a.ModerationDecisions, func(d ModerationDecision) []string {
+				return []string{d.MessageID, d.Action, d.Reason, formatCSVTime(&d.CreatedAt)}
+			},
+		)},
+		{"sessions.json", writeJSON(a.Sessions)},
+		{"sessions.csv", writeCSV(
+			[]string{"id", "user_agent", "ip", "mfa", "created_at", "last_seen_at", "revoked_at"},
+			a.Sessions, func(s Session) []string {
+				return []string{s.ID, s.UserAgent, s.IP, strconv.FormatBool(s.MFA),
+					formatCSVTime(&s.CreatedAt), formatCSVTime(&s.LastSeenAt), formatCSVTime(s.RevokedAt)}
+			},
+		)},
+		{"blocks.json", writeJSON(a.Blocks)},
+	}
+
+	for _, f := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     f.name,
+			Method:   zip.Deflate,
+			Modified: generatedAt,
+		})
+		if err != nil {
+			return fmt.Errorf("error while adding %s: %w", f.name, err)
+		}
+		if err := f.write(fw); err != nil {
+			return fmt.Errorf("error while writing %s: %w", f.name, err)
+		}
+	}
+
+	return zw.Close()
+}
+
+func writeJSON(v any) func(io.Writer) error {
+	return func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+}
+
+func writeCSV[T any](header []string, rows []T, record func(T) []string) func(io.Writer) error {
+	return func(w io.Writer) error {
+		cw := csv.NewWriter(w)
+		if err := cw.Write(header); err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if err := cw.Write(record(row)); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+}
+
+func formatCSVTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
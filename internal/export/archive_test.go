@@ -0,0 +1,219 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func testArchive() *Archive {
+	created := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	return &Archive{
+		Profile: Profile{ID: "user-1", Email: "test@example.com", Username: "testuser", Role: "user", CreatedAt: created},
+		Messages: []Message{
+			{ID: "msg-1", RoomID: "room-1", RoomName: "general", Content: "hello, \"world\"", ModerationStatus: "allowed", CreatedAt: created},
+		},
+		RoomsCreated:      []Room{{ID: "room-1", Name: "general", CreatedAt: created}},
+		ModerationResults: []ModerationResult{{MessageID: "msg-1", Provider: "local", ToxicityScore: 0.12, ProcessedAt: created}},
+		Sessions:          []Session{{ID: "session-1", UserAgent: "curl", IP: "127.0.0.1", CreatedAt: created, LastSeenAt: created}},
+	}
+}
+
+func readZip(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("expected valid zip, got %v", err)
+	}
+
+	files := make(map[string][]byte)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("error while opening %s: %v", f.Name, err)
+		}
+		files[f.Name], _ = io.ReadAll(rc)
+		rc.Close()
+	}
+	return files
+}
+
+func TestWriteArchive(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteArchive(&buf, testArchive(), time.Now()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	files := readZip(t, buf.Bytes())
+
+	for _, name := range []string{
+		"README.txt", "profile.json", "messages.json", "messages.csv", "rooms.json",
+		"moderation.json", "moderation_results.csv", "moderation_decisions.csv", "sessions.json", "sessions.csv", "blocks.json",
+	} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("expected %s in archive", name)
+		}
+	}
+
+	var profile Profile
+	if err := json.Unmarshal(files["profile.json"], &profile); err != nil || profile.Email != "test@example.com" {
+		t.Errorf("unexpected profile.json: %v %s", err, files["profile.json"])
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(files["messages.csv"])).ReadAll()
+	if err != nil {
+		t.Fatalf("expected valid csv, got %v", err)
+	}
+	if len(records) != 2 || records[1][3] != "hello, \"world\"" {
+		t.Errorf("unexpected messages.csv: %v", records)
+	}
+
+	var moderation map[string][]json.RawMessage
+	if err := json.Unmarshal(files["moderation.json"], &moderation); err != nil {
+		t.Fatalf("expected valid moderation.json, got %v", err)
+	}
+	if len(moderation["results"]) != 1 {
+		t.Errorf("unexpected moderation.json: %s", files["moderation.json"])
+	}
+}
+
+// Mock repositories for testing the worker
+type mockJobRepo struct {
+	jobs map[string]*Job
+}
+
+func (m *mockJobRepo) Create(job *Job) error {
+	m.jobs[job.ID] = job
+	return nil
+}
+
+func (m *mockJobRepo) FindByID(id string) (*Job, error) {
+	if job, ok := m.jobs[id]; ok {
+		return job, nil
+	}
+	return nil, ErrJobNotFound
+}
+
+func (m *mockJobRepo) ListByUser(userID string) ([]*Job, error) {
+	return nil, nil
+}
+
+func (m *mockJobRepo) CountInProgress(userID string) (int, error) {
+	return 0, nil
+}
+
+func (m *mockJobRepo) Due(limit int, lease time.Duration) ([]*Job, error) {
+	var due []*Job
+	for _, job := range m.jobs {
+		if job.Status == StatusPending {
+			due = append(due, job)
+		}
+	}
+	return due, nil
+}
+
+func (m *mockJobRepo) Claim(job *Job, lease time.Duration) (bool, error) {
+	if job.Status != StatusPending {
+		return false, nil
+	}
+	job.Status = StatusRunning
+	return true, nil
+}
+
+func (m *mockJobRepo) Update(job *Job) error {
+	m.jobs[job.ID] = job
+	return nil
+}
+
+func (m *mockJobRepo) Expired(limit int) ([]*Job, error) {
+	var expired []*Job
+	for _, job := range m.jobs {
+		if job.Status == StatusReady && job.ExpiresAt != nil && !time.Now().Before(*job.ExpiresAt) {
+			expired = append(expired, job)
+		}
+	}
+	return expired, nil
+}
+
+type mockDataRepo struct {
+	err error
+}
+
+func (m *mockDataRepo) Collect(userID string) (*Archive, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return testArchive(), nil
+}
+
+func newTestWorker(t *testing.T, data DataRepository) (*Worker, *mockJobRepo) {
+	jobs := &mockJobRepo{jobs: map[string]*Job{
+		"job-1": {ID: "job-1", UserID: "user-1", Status: StatusPending},
+	}}
+	return &Worker{jobs: jobs, data: data, dir: t.TempDir(), linkTTL: time.Hour}, jobs
+}
+
+func TestWorker_BuildAndExpire(t *testing.T) {
+	w, jobs := newTestWorker(t, &mockDataRepo{})
+
+	w.processDue()
+
+	job := jobs.jobs["job-1"]
+	if job.Status != StatusReady || job.ExpiresAt == nil || job.Size == 0 {
+		t.Fatalf("expected ready job with expiry and size, got %+v", job)
+	}
+	data, err := os.ReadFile(job.FilePath)
+	if err != nil {
+		t.Fatalf("expected archive on disk, got %v", err)
+	}
+	if _, ok := readZip(t, data)["messages.json"]; !ok {
+		t.Error("expected messages.json in archive")
+	}
+
+	entries, _ := os.ReadDir(w.dir)
+	if len(entries) != 1 {
+		t.Errorf("expected only the archive in the export directory, got %d entries", len(entries))
+	}
+
+	past := time.Now().Add(-time.Minute)
+	job.ExpiresAt = &past
+	path := job.FilePath
+	w.removeExpired()
+
+	if job.Status != StatusExpired || job.FilePath != "" {
+		t.Errorf("expected expired job, got %+v", job)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("expected archive to be deleted")
+	}
+}
+
+func TestWorker_BuildFailure(t *testing.T) {
+	w, jobs := newTestWorker(t, &mockDataRepo{err: errors.New("database is locked")})
+
+	w.processDue()
+
+	job := jobs.jobs["job-1"]
+	if job.Status != StatusFailed || job.FilePath != "" {
+		t.Errorf("expected failed job, got %+v", job)
+	}
+	if job.Error == "" || job.Error == "database is locked" {
+		t.Errorf("expected a generic error for the user, got %q", job.Error)
+	}
+}
+
+func TestTokenMatches(t *testing.T) {
+	job := &Job{TokenHash: hashToken("secret-token")}
+
+	if !tokenMatches(job, "secret-token") {
+		t.Error("expected token to match")
+	}
+	if tokenMatches(job, "other-token") || tokenMatches(job, "") {
+		t.Error("expected wrong or empty token not to match")
+	}
+}
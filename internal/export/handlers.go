@@ -0,0 +1,188 @@
+package export
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mr1hm/go-chat-moderator/internal/auth"
+	"github.com/mr1hm/go-chat-moderator/internal/shared/ratelimit"
+)
+
+type Handler struct {
+	jobs   JobRepository
+	appURL string
+}
+
+func NewHandler(appURL string) *Handler {
+	return &Handler{
+		jobs:   NewJobRepository(),
+		appURL: appURL,
+	}
+}
+
+// CreateExport queues an archive of the current user's data. The download
+// link is only ever shown here; it works once the job is ready.
+func (h *Handler) CreateExport(c *gin.Context) {
+	userID := c.GetString("user_id")
+	ctx := c.Request.Context()
+
+	inProgress, err := h.jobs.CountInProgress(userID)
+	if err != nil {
+		log.Printf("error while counting exports: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to create export",
+		})
+		return
+	}
+	if inProgress > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "an export is already in progress",
+		})
+		return
+	}
+
+	allowed, err := ratelimit.Allow(ctx, "data_export:"+userID, 3, 24*time.Hour)
+	if err != nil {
+		log.Printf("error while checking rate limit: %v", err)
+	}
+	if !allowed && err == nil {
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error": "too many exports, try again tomorrow",
+		})
+		return
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to generate download token",
+		})
+		return
+	}
+
+	job := &Job{
+		UserID:    userID,
+		TokenHash: hashToken(token),
+	}
+	if err := h.jobs.Create(job); err != nil {
+		log.Printf("error while creating export: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to create export",
+		})
+		return
+	}
+
+	job.DownloadURL = h.appURL + "/api/exports/" + job.ID + "/download?token=" + url.QueryEscape(token)
+	c.JSON(http.StatusAccepted, job)
+}
+
+func (h *Handler) ListExports(c *gin.Context) {
+	jobs, err := h.jobs.ListByUser(c.GetString("user_id"))
+	if err != nil {
+		log.Printf("error while listing exports: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to list exports",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, jobs)
+}
+
+func (h *Handler) GetExport(c *gin.Context) {
+	job, err := h.jobs.FindByID(c.Param("id"))
+	if errors.Is(err, ErrJobNotFound) || (err == nil && job.UserID != c.GetString("user_id")) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": ErrJobNotFound.Error(),
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("error while finding export: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to get export",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// Download serves a ready archive to anyone holding its link, so it can be
+// opened directly in a browser
+func (h *Handler) Download(c *gin.Context) {
+	job, err := h.jobs.FindByID(c.Param("id"))
+	if errors.Is(err, ErrJobNotFound) || (err == nil && !tokenMatches(job, c.Query("token"))) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": ErrJobNotFound.Error(),
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("error while finding export: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to get export",
+		})
+		return
+	}
+
+	switch {
+	case job.Status == StatusPending || job.Status == StatusRunning:
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "export is not ready yet",
+		})
+	case job.Status == StatusExpired || (job.ExpiresAt != nil && !time.Now().Before(*job.ExpiresAt)):
+		c.JSON(http.StatusGone, gin.H{
+			"error": "download link has expired",
+		})
+	case job.Status == StatusReady:
+		c.Header("Cache-Control", "no-store")
+		c.FileAttachment(job.FilePath, "export-"+job.CreatedAt.UTC().Format("2006-01-02")+".zip")
+	default:
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "export failed, request a new one",
+		})
+	}
+}
+
+func tokenMatches(job *Job, token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(job.TokenHash), []byte(hashToken(token))) == 1
+}
+
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func RegisterRoutes(r *gin.Engine, authHandler *auth.Handler, appURL string) *Handler {
+	handler := NewHandler(appURL)
+
+	r.GET("/exports/:id/download", handler.Download)
+
+	ex := r.Group("/exports")
+	ex.Use(authHandler.AuthMiddleware())
+	{
+		ex.POST("", handler.CreateExport)
+		ex.GET("", handler.ListExports)
+		ex.GET("/:id", handler.GetExport)
+	}
+
+	return handler
+}
@@ -0,0 +1,134 @@
+package export
+
+import "time"
+
+// Job statuses
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusReady   = "ready"
+	StatusFailed  = "failed"
+	StatusExpired = "expired" // Archive deleted after its link expired
+)
+
+// Job builds one archive of a user's data. The archive can be downloaded
+// with the job's token until ExpiresAt.
+type Job struct {
+	ID          string     `json:"id"`
+	UserID      string     `json:"-"`
+	Status      string     `json:"status"`
+	TokenHash   string     `json:"-"`
+	FilePath    string     `json:"-"`
+	Size        int64      `json:"size,omitempty"` // Archive size in bytes
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	StartedAt   *time.Time `json:"-"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	DownloadURL string     `json:"download_url,omitempty"` // Only returned on creation
+}
+
+// Archive is everything held about a user, as written to the ZIP
+type Archive struct {
+	Profile             Profile
+	Messages            []Message
+	RoomsCreated        []Room
+	Memberships         []Membership
+	ModerationResults   []ModerationResult
+	ModerationDecisions []ModerationDecision
+	Sessions            []Session
+	Blocks              []Block
+}
+
+type Profile struct {
+	ID          string     `json:"id"`
+	Email       string     `json:"email"`
+	Username    string     `json:"username"`
+	DisplayName string     `json:"display_name"`
+	Bio         string     `json:"bio"`
+	Role        string     `json:"role"`
+	Bot         bool       `json:"bot"`
+	VerifiedAt  *time.Time `json:"verified_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	MFAEnabled  bool       `json:"mfa_enabled"`
+	Identities  []Identity `json:"identities"`
+	APIKeys     []APIKey   `json:"api_keys"`
+}
+
+// Identity is a linked single sign-on account
+type Identity struct {
+	Issuer    string    `json:"issuer"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type APIKey struct {
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     string     `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+type Message struct {
+	ID               string    `json:"id"`
+	RoomID           string    `json:"room_id"`
+	RoomName         string    `json:"room_name"`
+	Content          string    `json:"content"`
+	ModerationStatus string    `json:"moderation_status"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+type Room struct {
+	ID              string    `json:"id"`
+	Name            string    `json:"name"`
+	RequireVerified bool      `json:"require_verified"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+type Membership struct {
+	RoomID    string    `json:"room_id"`
+	RoomName  string    `json:"room_name"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ModerationResult is an automated score of one of the user's messages.
+// Shadow evaluations never affect the user and are left out.
+type ModerationResult struct {
+	MessageID     string    `json:"message_id"`
+	Provider      string    `json:"provider"`
+	ToxicityScore float64   `json:"toxicity_score"`
+	Category      string    `json:"category"`
+	Flagged       bool      `json:"flagged"`
+	ProcessedAt   time.Time `json:"processed_at"`
+}
+
+// ModerationDecision is a moderator's review of one of the user's messages.
+// The moderator isn't named; that is someone else's data.
+type ModerationDecision struct {
+	MessageID string    `json:"message_id"`
+	Action    string    `json:"action"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Block is a user the exporting user has blocked
+type Block struct {
+	UserID    string    `json:"user_id"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Session struct {
+	ID         string     `json:"id"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	MFA        bool       `json:"mfa"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
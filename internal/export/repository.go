@@ -0,0 +1,337 @@
+package export
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mr1hm/go-chat-moderator/internal/shared/sqlite"
+)
+
+var ErrJobNotFound = errors.New("export not found")
+
+// Matches CURRENT_TIMESTAMP so stored times compare correctly in SQL
+const sqliteTimeLayout = "2006-01-02 15:04:05"
+
+type JobRepository interface {
+	Create(job *Job) error
+	FindByID(id string) (*Job, error)
+	ListByUser(userID string) ([]*Job, error)
+	CountInProgress(userID string) (int, error)
+	Due(limit int, lease time.Duration) ([]*Job, error)
+	Claim(job *Job, lease time.Duration) (bool, error)
+	Update(job *Job) error
+	Expired(limit int) ([]*Job, error)
+}
+
+type sqliteJobRepo struct{}
+
+func NewJobRepository() JobRepository {
+	return &sqliteJobRepo{}
+}
+
+func (r *sqliteJobRepo) Create(job *Job) error {
+	job.ID = uuid.New().String()
+	job.Status = StatusPending
+	job.CreatedAt = time.Now().UTC()
+
+	_, err := sqlite.DB.Exec(
+		`INSERT INTO data_exports (id, user_id, status, token_hash, created_at) VALUES (?, ?, ?, ?, ?)`,
+		job.ID, job.UserID, job.Status, job.TokenHash, job.CreatedAt.Format(sqliteTimeLayout),
+	)
+
+	return err
+}
+
+const jobColumns = `id, user_id, status, token_hash, file_path, size, error, created_at, started_at, completed_at, expires_at`
+
+func (r *sqliteJobRepo) FindByID(id string) (*Job, error) {
+	job, err := scanJob(sqlite.DB.QueryRow(
+		`SELECT `+jobColumns+` FROM data_exports WHERE id = ?`, id,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrJobNotFound
+	}
+
+	return job, err
+}
+
+func (r *sqliteJobRepo) ListByUser(userID string) ([]*Job, error) {
+	return r.query(
+		`SELECT `+jobColumns+` FROM data_exports WHERE user_id = ? ORDER BY created_at DESC`, userID,
+	)
+}
+
+// CountInProgress counts a user's exports that are queued or being built
+func (r *sqliteJobRepo) CountInProgress(userID string) (int, error) {
+	var n int
+	err := sqlite.DB.QueryRow(
+		`SELECT COUNT(*) FROM data_exports WHERE user_id = ? AND status IN (?, ?)`,
+		userID, StatusPending, StatusRunning,
+	).Scan(&n)
+	return n, err
+}
+
+// Due returns queued jobs, and running jobs whose worker hasn't finished
+// within lease (it most likely crashed)
+func (r *sqliteJobRepo) Due(limit int, lease time.Duration) ([]*Job, error) {
+	return r.query(
+		`SELECT `+jobColumns+` FROM data_exports
+		 WHERE status = ? OR (status = ? AND started_at <= ?) ORDER BY created_at LIMIT ?`,
+		StatusPending, StatusRunning, time.Now().UTC().Add(-lease).Format(sqliteTimeLayout), limit,
+	)
+}
+
+// Claim marks a due job running. It reports false if another worker won.
+func (r *sqliteJobRepo) Claim(job *Job, lease time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	res, err := sqlite.DB.Exec(
+		`UPDATE data_exports SET status = ?, started_at = ?
+		 WHERE id = ? AND (status = ? OR (status = ? AND started_at <= ?))`,
+		StatusRunning, now.Format(sqliteTimeLayout),
+		job.ID, StatusPending, StatusRunning, now.Add(-lease).Format(sqliteTimeLayout),
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if n == 1 {
+		job.Status = StatusRunning
+		job.StartedAt = &now
+	}
+
+	return n == 1, err
+}
+
+func (r *sqliteJobRepo) Update(job *Job) error {
+	_, err := sqlite.DB.Exec(
+		`UPDATE data_exports SET status = ?, file_path = ?, size = ?, error = ?, completed_at = ?, expires_at = ? WHERE id = ?`,
+		job.Status, job.FilePath, job.Size, job.Error, formatTime(job.CompletedAt), formatTime(job.ExpiresAt), job.ID,
+	)
+
+	return err
+}
+
+// Expired returns ready jobs whose download link has expired
+func (r *sqliteJobRepo) Expired(limit int) ([]*Job, error) {
+	return r.query(
+		`SELECT `+jobColumns+` FROM data_exports WHERE status = ? AND expires_at <= ? ORDER BY expires_at LIMIT ?`,
+		StatusReady, time.Now().UTC().Format(sqliteTimeLayout), limit,
+	)
+}
+
+func (r *sqliteJobRepo) query(query string, args ...any) ([]*Job, error) {
+	rows, err := sqlite.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error while querying exports: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []*Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error while scanning exports: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanJob(s scanner) (*Job, error) {
+	job := &Job{}
+	var startedAt, completedAt, expiresAt sql.NullTime
+	if err := s.Scan(
+		&job.ID,
+		&job.UserID,
+		&job.Status,
+		&job.TokenHash,
+		&job.FilePath,
+		&job.Size,
+		&job.Error,
+		&job.CreatedAt,
+		&startedAt,
+		&completedAt,
+		&expiresAt,
+	); err != nil {
+		return nil, err
+	}
+	job.StartedAt = nullTime(startedAt)
+	job.CompletedAt = nullTime(completedAt)
+	job.ExpiresAt = nullTime(expiresAt)
+
+	return job, nil
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func formatTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(sqliteTimeLayout)
+}
+
+// DataRepository gathers everything held about a user
+type DataRepository interface {
+	Collect(userID string) (*Archive, error)
+}
+
+type sqliteDataRepo struct{}
+
+func NewDataRepository() DataRepository {
+	return &sqliteDataRepo{}
+}
+
+func (r *sqliteDataRepo) Collect(userID string) (*Archive, error) {
+	a := &Archive{}
+
+	var verifiedAt sql.NullTime
+	err := sqlite.DB.QueryRow(
+		`SELECT id, email, username, display_name, bio, role, is_bot, verified_at, created_at, updated_at,
+		 EXISTS (SELECT 1 FROM user_mfa WHERE user_id = users.id AND confirmed_at IS NOT NULL)
+		 FROM users WHERE id = ? AND deleted_at IS NULL`, userID,
+	).Scan(&a.Profile.ID, &a.Profile.Email, &a.Profile.Username, &a.Profile.DisplayName, &a.Profile.Bio, &a.Profile.Role, &a.Profile.Bot,
+		&verifiedAt, &a.Profile.CreatedAt, &a.Profile.UpdatedAt, &a.Profile.MFAEnabled)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading profile: %w", err)
+	}
+	a.Profile.VerifiedAt = nullTime(verifiedAt)
+
+	if a.Profile.Identities, err = collect(
+		`SELECT issuer, email, created_at FROM user_identities WHERE user_id = ? ORDER BY created_at`, userID,
+		func(s scanner, i *Identity) error {
+			return s.Scan(&i.Issuer, &i.Email, &i.CreatedAt)
+		},
+	); err != nil {
+		return nil, fmt.Errorf("error while reading identities: %w", err)
+	}
+
+	if a.Profile.APIKeys, err = collect(
+		`SELECT name, prefix, scopes, created_at, last_used_at, expires_at, revoked_at
+		 FROM api_keys WHERE user_id = ? ORDER BY created_at`, userID,
+		func(s scanner, k *APIKey) error {
+			var lastUsedAt, expiresAt, revokedAt sql.NullTime
+			if err := s.Scan(&k.Name, &k.Prefix, &k.Scopes, &k.CreatedAt, &lastUsedAt, &expiresAt, &revokedAt); err != nil {
+				return err
+			}
+			k.LastUsedAt, k.ExpiresAt, k.RevokedAt = nullTime(lastUsedAt), nullTime(expiresAt), nullTime(revokedAt)
+			return nil
+		},
+	); err != nil {
+		return nil, fmt.Errorf("error while reading api keys: %w", err)
+	}
+
+	if a.Messages, err = collect(
+		`SELECT m.id, m.room_id, COALESCE(r.name, ''), m.content, m.moderation_status, m.created_at
+		 FROM messages m LEFT JOIN rooms r ON r.id = m.room_id
+		 WHERE m.user_id = ? ORDER BY m.created_at`, userID,
+		func(s scanner, m *Message) error {
+			return s.Scan(&m.ID, &m.RoomID, &m.RoomName, &m.Content, &m.ModerationStatus, &m.CreatedAt)
+		},
+	); err != nil {
+		return nil, fmt.Errorf("error while reading messages: %w", err)
+	}
+
+	if a.RoomsCreated, err = collect(
+		`SELECT id, name, require_verified, created_at FROM rooms WHERE created_by = ? ORDER BY created_at`, userID,
+		func(s scanner, r *Room) error {
+			return s.Scan(&r.ID, &r.Name, &r.RequireVerified, &r.CreatedAt)
+		},
+	); err != nil {
+		return nil, fmt.Errorf("error while reading rooms: %w", err)
+	}
+
+	if a.Memberships, err = collect(
+		`SELECT rm.room_id, COALESCE(r.name, ''), rm.role, rm.created_at
+		 FROM room_members rm LEFT JOIN rooms r ON r.id = rm.room_id
+		 WHERE rm.user_id = ? ORDER BY rm.created_at`, userID,
+		func(s scanner, m *Membership) error {
+			return s.Scan(&m.RoomID, &m.RoomName, &m.Role, &m.CreatedAt)
+		},
+	); err != nil {
+		return nil, fmt.Errorf("error while reading memberships: %w", err)
+	}
+
+	if a.ModerationResults, err = collect(
+		`SELECT l.message_id, l.provider, COALESCE(l.toxicity_score, 0), l.category, l.is_flagged, l.processed_at
+		 FROM moderation_logs l JOIN messages m ON m.id = l.message_id
+		 WHERE m.user_id = ? AND l.is_shadow = 0 AND l.error = '' ORDER BY l.processed_at`, userID,
+		func(s scanner, r *ModerationResult) error {
+			return s.Scan(&r.MessageID, &r.Provider, &r.ToxicityScore, &r.Category, &r.Flagged, &r.ProcessedAt)
+		},
+	); err != nil {
+		return nil, fmt.Errorf("error while reading moderation results: %w", err)
+	}
+
+	if a.ModerationDecisions, err = collect(
+		`SELECT a.message_id, a.action, a.reason, a.created_at
+		 FROM moderation_actions a JOIN messages m ON m.id = a.message_id
+		 WHERE m.user_id = ? ORDER BY a.created_at`, userID,
+		func(s scanner, d *ModerationDecision) error {
+			return s.Scan(&d.MessageID, &d.Action, &d.Reason, &d.CreatedAt)
+		},
+	); err != nil {
+		return nil, fmt.Errorf("error while reading moderation decisions: %w", err)
+	}
+
+	if a.Sessions, err = collect(
+		`SELECT id, user_agent, ip, mfa, created_at, last_seen_at, revoked_at
+		 FROM sessions WHERE user_id = ? ORDER BY created_at`, userID,
+		func(s scanner, sess *Session) error {
+			var revokedAt sql.NullTime
+			if err := s.Scan(&sess.ID, &sess.UserAgent, &sess.IP, &sess.MFA, &sess.CreatedAt, &sess.LastSeenAt, &revokedAt); err != nil {
+				return err
+			}
+			sess.RevokedAt = nullTime(revokedAt)
+			return nil
+		},
+	); err != nil {
+		return nil, fmt.Errorf("error while reading sessions: %w", err)
+	}
+
+	if a.Blocks, err = collect(
+		`SELECT b.blocked_id, u.username, b.created_at
+		 FROM user_blocks b JOIN users u ON u.id = b.blocked_id
+		 WHERE b.blocker_id = ? ORDER BY b.created_at`, userID,
+		func(s scanner, b *Block) error {
+			return s.Scan(&b.UserID, &b.Username, &b.CreatedAt)
+		},
+	); err != nil {
+		return nil, fmt.Errorf("error while reading blocks: %w", err)
+	}
+
+	return a, nil
+}
+
+// collect runs a query and scans every row into a new T
+func collect[T any](query string, userID string, scan func(scanner, *T) error) ([]T, error) {
+	rows, err := sqlite.DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []T{}
+	for rows.Next() {
+		var item T
+		if err := scan(rows, &item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
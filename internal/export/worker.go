@@ -0,0 +1,155 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	claimLease = 10 * time.Minute
+	batchSize  = 5
+)
+
+// Worker builds queued archives and deletes them once their link expires
+type Worker struct {
+	jobs    JobRepository
+	data    DataRepository
+	dir     string
+	linkTTL time.Duration
+	ticker  *time.Ticker
+}
+
+func NewWorker(dir string, linkTTL time.Duration) *Worker {
+	return &Worker{
+		jobs:    NewJobRepository(),
+		data:    NewDataRepository(),
+		dir:     dir,
+		linkTTL: linkTTL,
+		ticker:  time.NewTicker(2 * time.Second),
+	}
+}
+
+func (w *Worker) Run(ctx context.Context) {
+	log.Println("Export worker started")
+
+	if err := os.MkdirAll(w.dir, 0o700); err != nil {
+		log.Printf("error while creating export directory: %v", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.ticker.C:
+			w.processDue()
+			w.removeExpired()
+		}
+	}
+}
+
+func (w *Worker) processDue() {
+	jobs, err := w.jobs.Due(batchSize, claimLease)
+	if err != nil {
+		log.Printf("error while loading due exports: %v", err)
+		return
+	}
+
+	for _, job := range jobs {
+		claimed, err := w.jobs.Claim(job, claimLease)
+		if err != nil {
+			log.Printf("error while claiming export [ %s ]: %v", job.ID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		w.build(job)
+	}
+}
+
+// build writes the archive for a claimed job and marks it ready or failed
+func (w *Worker) build(job *Job) {
+	path, size, err := w.writeArchive(job)
+	now := time.Now().UTC()
+	job.CompletedAt = &now
+
+	if err != nil {
+		log.Printf("error while building export [ %s ]: %v", job.ID, err)
+		job.Status = StatusFailed
+		job.Error = "failed to build archive"
+	} else {
+		expiresAt := now.Add(w.linkTTL)
+		job.Status = StatusReady
+		job.FilePath = path
+		job.Size = size
+		job.ExpiresAt = &expiresAt
+	}
+
+	if err := w.jobs.Update(job); err != nil {
+		log.Printf("error while updating export [ %s ]: %v", job.ID, err)
+		return
+	}
+
+	log.Printf("Export [ %s ] %s (%d bytes)", job.ID, job.Status, job.Size)
+}
+
+// writeArchive writes to a temporary file and renames it, so a crash never
+// leaves a truncated archive behind under the final name
+func (w *Worker) writeArchive(job *Job) (string, int64, error) {
+	archive, err := w.data.Collect(job.UserID)
+	if err != nil {
+		return "", 0, err
+	}
+
+	path := filepath.Join(w.dir, job.ID+".zip")
+	tmp, err := os.CreateTemp(w.dir, job.ID+"-*.tmp")
+	if err != nil {
+		return "", 0, fmt.Errorf("error while creating archive file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := WriteArchive(tmp, archive, time.Now()); err != nil {
+		tmp.Close()
+		return "", 0, err
+	}
+	info, err := tmp.Stat()
+	if err != nil {
+		tmp.Close()
+		return "", 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", 0, err
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", 0, fmt.Errorf("error while saving archive: %w", err)
+	}
+
+	return path, info.Size(), nil
+}
+
+func (w *Worker) removeExpired() {
+	jobs, err := w.jobs.Expired(batchSize)
+	if err != nil {
+		log.Printf("error while loading expired exports: %v", err)
+		return
+	}
+
+	for _, job := range jobs {
+		if err := os.Remove(job.FilePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("error while deleting export [ %s ]: %v", job.ID, err)
+			continue
+		}
+
+		job.Status = StatusExpired
+		job.FilePath = ""
+		if err := w.jobs.Update(job); err != nil {
+			log.Printf("error while updating export [ %s ]: %v", job.ID, err)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package moderation
+
+import (
+	"fmt"
+
+	"github.com/mr1hm/go-chat-moderator/internal/shared/sqlite"
+)
+
+// SQLite stores CURRENT_TIMESTAMP as text in this layout, so range filters
+// compare against strings formatted the same way
+const sqliteTimeLayout = "2006-01-02 15:04:05"
+
+type AnalyticsRepository interface {
+	FlagRates(filter AnalyticsFilter, groupBy string) ([]*FlagRate, error)
+	ScoreHistogram(filter AnalyticsFilter, provider string, bins int) ([]*HistogramBin, error)
+	TopOffenders(filter AnalyticsFilter, limit int) ([]*Offender, error)
+	QueueLatency(filter AnalyticsFilter) ([]*QueueLatency, error)
+	ProviderErrorRates(filter AnalyticsFilter) ([]*ProviderErrorRate, error)
+	ModeratorActionCounts(filter AnalyticsFilter) ([]*ModeratorActionCount, error)
+}
+
+type sqliteAnalyticsRepo struct{}
+
+func NewAnalyticsRepository() AnalyticsRepository {
+	return &sqliteAnalyticsRepo{}
+}
+
+// FlagRates buckets primary results over time, grouped by room, category or nothing
+func (r *sqliteAnalyticsRepo) FlagRates(filter AnalyticsFilter, groupBy string) ([]*FlagRate, error) {
+	group := `''`
+	switch groupBy {
+	case "room":
+		group = `m.room_id`
+	case "category":
+		group = `l.category`
+	}
+
+	where, args := timeRange("l.processed_at", filter)
+	rows, err := sqlite.DB.Query(
+		`SELECT `+bucketExpr("l.processed_at", filter.Bucket)+`, `+group+`, COUNT(*), SUM(l.is_flagged)
+		 FROM moderation_logs l
+		 JOIN messages m ON m.id = l.message_id
+		 WHERE l.is_shadow = 0 AND l.error = ''`+where+`
+		 GROUP BY 1, 2 ORDER BY 1, 2`,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error while querying flag rates: %w", err)
+	}
+	defer rows.Close()
+
+	rates := []*FlagRate{}
+	for rows.Next() {
+		rate := &FlagRate{}
+		if err := rows.Scan(&rate.Bucket, &rate.Group, &rate.Total, &rate.Flagged); err != nil {
+			return nil, fmt.Errorf("error while scanning flag rates: %w", err)
+		}
+		rate.Rate = ratio(rate.Flagged, rate.Total)
+		rates = append(rates, rate)
+	}
+
+	return rates, rows.Err()
+}
+
+// ScoreHistogram counts scores into equal-width bins over [0, 1]. Without a
+// provider only primary results are counted.
+func (r *sqliteAnalyticsRepo) ScoreHistogram(filter AnalyticsFilter, provider string, bins int) ([]*HistogramBin, error) {
+	where, args := timeRange("l.processed_at", filter)
+	if provider != "" {
+		where += ` AND l.provider = ?`
+		args = append(args, provider)
+	} else {
+		where += ` AND l.is_shadow = 0`
+	}
+
+	rows, err := sqlite.DB.Query(
+		`SELECT MIN(CAST(l.toxicity_score * ? AS INTEGER), ? - 1), COUNT(*)
+		 FROM moderation_logs l
+		 WHERE l.error = ''`+where+`
+		 GROUP BY 1`,
+		append([]any{bins, bins}, args...)...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error while querying score histogram: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[int]int)
+	for rows.Next() {
+		var bin, count int
+		if err := rows.Scan(&bin, &count); err != nil {
+			return nil, fmt.Errorf("error while scanning score histogram: %w", err)
+		}
+		counts[bin] = count
+	}
+
+	return buildHistogram(bins, counts), rows.Err()
+}
+
+// TopOffenders ranks users by how many of their messages were flagged or removed
+func (r *sqliteAnalyticsRepo) TopOffenders(filter AnalyticsFilter, limit int) ([]*Offender, error) {
+	where, args := timeRange("m.created_at", filter)
+	rows, err := sqlite.DB.Query(
+		`SELECT u.id, u.username, COUNT(*),
+		        SUM(m.moderation_status = 'flagged'), SUM(m.moderation_status = 'removed')
+		 FROM messages m
+		 JOIN users u ON u.id = m.user_id
+		 WHERE 1 = 1`+where+`
+		 GROUP BY u.id
+		 HAVING SUM(m.moderation_status IN ('flagged', 'removed')) > 0
+		 ORDER BY SUM(m.moderation_status IN ('flagged', 'removed')) DESC, COUNT(*) DESC
+		 LIMIT ?`,
+		append(args, limit)...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error while querying top offenders: %w", err)
+	}
+	defer rows.Close()
+
+	offenders := []*Offender{}
+	for rows.Next() {
+		o := &Offender{}
+		if err := rows.Scan(&o.UserID, &o.Username, &o.Messages, &o.Flagged, &o.Removed); err != nil {
+			return nil, fmt.Errorf("error while scanning top offenders: %w", err)
+		}
+		offenders = append(offenders, o)
+	}
+
+	return offenders, rows.Err()
+}
+
+// QueueLatency measures the time from message creation to its primary moderation result
+func (r *sqliteAnalyticsRepo) QueueLatency(filter AnalyticsFilter) ([]*QueueLatency, error) {
+	where, args := timeRange("l.processed_at", filter)
+	rows, err := sqlite.DB.Query(
+		`SELECT `+bucketExpr("processed_at", filter.Bucket)+`, COUNT(*), AVG(seconds), MAX(seconds)
+		 FROM (
+		 	SELECT l.processed_at, (julianday(l.processed_at) - julianday(m.created_at)) * 86400 AS seconds
+		 	FROM moderation_logs l
+		 	JOIN messages m ON m.id = l.message_id
+		 	WHERE l.is_shadow = 0 AND l.error = ''`+where+`
+		 )
+		 GROUP BY 1 ORDER BY 1`,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error while querying queue latency: %w", err)
+	}
+	defer rows.Close()
+
+	latencies := []*QueueLatency{}
+	for rows.Next() {
+		l := &QueueLatency{}
+		if err := rows.Scan(&l.Bucket, &l.Count, &l.AvgSeconds, &l.MaxSeconds); err != nil {
+			return nil, fmt.Errorf("error while scanning queue latency: %w", err)
+		}
+		latencies = append(latencies, l)
+	}
+
+	return latencies, rows.Err()
+}
+
+// ProviderErrorRates compares failed provider calls to all calls, per provider version
+func (r *sqliteAnalyticsRepo) ProviderErrorRates(filter AnalyticsFilter) ([]*ProviderErrorRate, error) {
+	where, args := timeRange("l.processed_at", filter)
+	rows, err := sqlite.DB.Query(
+		`SELECT `+bucketExpr("l.processed_at", filter.Bucket)+`, l.provider, l.provider_version, COUNT(*), SUM(l.error != '')
+		 FROM moderation_logs l
+		 WHERE 1 = 1`+where+`
+		 GROUP BY 1, 2, 3 ORDER BY 1, 2, 3`,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error while querying provider error rates: %w", err)
+	}
+	defer rows.Close()
+
+	rates := []*ProviderErrorRate{}
+	for rows.Next() {
+		rate := &ProviderErrorRate{}
+		if err := rows.Scan(&rate.Bucket, &rate.Provider, &rate.Version, &rate.Calls, &rate.Errors); err != nil {
+			return nil, fmt.Errorf("error while scanning provider error rates: %w", err)
+		}
+		rate.Rate = ratio(rate.Errors, rate.Calls)
+		rates = append(rates, rate)
+	}
+
+	return rates, rows.Err()
+}
+
+func (r *sqliteAnalyticsRepo) ModeratorActionCounts(filter AnalyticsFilter) ([]*ModeratorActionCount, error) {
+	where, args := timeRange("a.created_at", filter)
+	rows, err := sqlite.DB.Query(
+		`SELECT a.moderator_id, COALESCE(u.username, ''), a.action, COUNT(*)
+		 FROM moderation_actions a
+		 LEFT JOIN users u ON u.id = a.moderator_id
+		 WHERE 1 = 1`+where+`
+		 GROUP BY a.moderator_id, a.action
+		 ORDER BY COUNT(*) DESC`,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error while querying moderator action counts: %w", err)
+	}
+	defer rows.Close()
+
+	counts := []*ModeratorActionCount{}
+	for rows.Next() {
+		count := &ModeratorActionCount{}
+		if err := rows.Scan(&count.ModeratorID, &count.Username, &count.Action, &count.Count); err != nil {
+			return nil, fmt.Errorf("error while scanning moderator action counts: %w", err)
+		}
+		counts = append(counts, count)
+	}
+
+	return counts, rows.Err()
+}
+
+func bucketExpr(column, bucket string) string {
+	switch bucket {
+	case "hour":
+		return `strftime('%Y-%m-%dT%H:00:00Z', ` + column + `)`
+	case "week":
+		return `strftime('%Y-W%W', ` + column + `)`
+	default:
+		return `strftime('%Y-%m-%d', ` + column + `)`
+	}
+}
+
+func timeRange(column string, filter AnalyticsFilter) (string, []any) {
+	var where string
+	var args []any
+	if !filter.From.IsZero() {
+		where += ` AND ` + column + ` >= ?`
+		args = append(args, filter.From.UTC().Format(sqliteTimeLayout))
+	}
+	if !filter.To.IsZero() {
+		where += ` AND ` + column + ` < ?`
+		args = append(args, filter.To.UTC().Format(sqliteTimeLayout))
+	}
+
+	return where, args
+}
+
+func buildHistogram(bins int, counts map[int]int) []*HistogramBin {
+	histogram := make([]*HistogramBin, bins)
+	width := 1 / float64(bins)
+	for i := range histogram {
+		histogram[i] = &HistogramBin{
+			Min:   float64(i) * width,
+			Max:   float64(i+1) * width,
+			Count: counts[i],
+		}
+	}
+
+	return histogram
+}
+
+func ratio(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total)
+}
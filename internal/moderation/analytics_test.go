@@ -0,0 +1,88 @@
+package moderation
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAnalyticsFilter(t *testing.T) {
+	filter, err := parseAnalyticsFilter("2026-01-01", "2026-01-02T12:00:00Z", "hour")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if !filter.From.Equal(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected from: %v", filter.From)
+	}
+	if !filter.To.Equal(time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected to: %v", filter.To)
+	}
+}
+
+func TestParseAnalyticsFilter_Unbounded(t *testing.T) {
+	filter, err := parseAnalyticsFilter("", "", "day")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if !filter.From.IsZero() || !filter.To.IsZero() {
+		t.Error("expected zero from/to for empty params")
+	}
+
+	where, args := timeRange("processed_at", filter)
+	if where != "" || len(args) != 0 {
+		t.Errorf("expected no range clause, got %q %v", where, args)
+	}
+}
+
+func TestParseAnalyticsFilter_Invalid(t *testing.T) {
+	tests := []struct {
+		name             string
+		from, to, bucket string
+	}{
+		{"bad bucket", "", "", "month"},
+		{"bad from", "yesterday", "", "day"},
+		{"bad to", "", "01/02/2026", "day"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseAnalyticsFilter(tt.from, tt.to, tt.bucket); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestTimeRange_FormatsForSQLite(t *testing.T) {
+	filter := AnalyticsFilter{
+		From: time.Date(2026, 3, 4, 5, 6, 7, 0, time.FixedZone("PST", -8*3600)),
+	}
+
+	where, args := timeRange("l.processed_at", filter)
+	if where != " AND l.processed_at >= ?" {
+		t.Errorf("unexpected clause: %q", where)
+	}
+	if len(args) != 1 || args[0] != "2026-03-04 13:06:07" {
+		t.Errorf("expected UTC sqlite timestamp, got %v", args)
+	}
+}
+
+func TestBuildHistogram(t *testing.T) {
+	histogram := buildHistogram(4, map[int]int{0: 3, 3: 1})
+
+	if len(histogram) != 4 {
+		t.Fatalf("expected 4 bins, got %d", len(histogram))
+	}
+
+	expected := []int{3, 0, 0, 1}
+	for i, bin := range histogram {
+		if bin.Count != expected[i] {
+			t.Errorf("bin %d: expected count %d, got %d", i, expected[i], bin.Count)
+		}
+	}
+
+	if histogram[1].Min != 0.25 || histogram[1].Max != 0.5 {
+		t.Errorf("unexpected bin bounds: %+v", histogram[1])
+	}
+}
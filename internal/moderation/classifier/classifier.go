@@ -0,0 +1,148 @@
+package classifier
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var ErrUntrained = errors.New("classifier has no training data for both classes")
+
+const (
+	clean = 0
+	toxic = 1
+)
+
+// Example is a labeled message used for training
+type Example struct {
+	Text  string
+	Toxic bool
+}
+
+// Model is a multinomial naive Bayes classifier over word unigrams and bigrams.
+// It satisfies moderation.Provider.
+type Model struct {
+	TrainedAt   time.Time         `json:"trained_at"`
+	Docs        [2]int            `json:"docs"`
+	TokenCounts [2]map[string]int `json:"token_counts"`
+	TokenTotals [2]int            `json:"token_totals"`
+	VocabSize   int               `json:"vocab_size"`
+}
+
+func Train(examples []Example) *Model {
+	m := &Model{
+		TrainedAt:   time.Now().UTC(),
+		TokenCounts: [2]map[string]int{{}, {}},
+	}
+
+	vocab := make(map[string]struct{})
+	for _, ex := range examples {
+		class := clean
+		if ex.Toxic {
+			class = toxic
+		}
+		m.Docs[class]++
+
+		for _, tok := range Tokenize(ex.Text) {
+			m.TokenCounts[class][tok]++
+			m.TokenTotals[class]++
+			vocab[tok] = struct{}{}
+		}
+	}
+	m.VocabSize = len(vocab)
+
+	return m
+}
+
+func (m *Model) Name() string {
+	return "local-nb"
+}
+
+// Version identifies the training run, so shadow and analytics results can be
+// attributed to a specific model file
+func (m *Model) Version() string {
+	return fmt.Sprintf("%s-%d", m.TrainedAt.Format("20060102T150405Z"), m.Docs[clean]+m.Docs[toxic])
+}
+
+// Analyze returns the posterior probability that text is toxic
+func (m *Model) Analyze(text string) (float64, error) {
+	if m.Docs[clean] == 0 || m.Docs[toxic] == 0 {
+		return 0, ErrUntrained
+	}
+
+	total := float64(m.Docs[clean] + m.Docs[toxic])
+	var logProb [2]float64
+	for class := range logProb {
+		logProb[class] = math.Log(float64(m.Docs[class]) / total)
+	}
+
+	for _, tok := range Tokenize(text) {
+		for class := range logProb {
+			// Laplace smoothing so unseen tokens don't zero out a class
+			count := float64(m.TokenCounts[class][tok] + 1)
+			logProb[class] += math.Log(count / float64(m.TokenTotals[class]+m.VocabSize+1))
+		}
+	}
+
+	// P(toxic | text) = 1 / (1 + exp(log P(clean) - log P(toxic)))
+	return 1 / (1 + math.Exp(logProb[clean]-logProb[toxic])), nil
+}
+
+// Tokenize lowercases text and returns its words followed by adjacent word pairs
+func Tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	tokens := make([]string, 0, 2*len(words))
+	tokens = append(tokens, words...)
+	for i := 1; i < len(words); i++ {
+		tokens = append(tokens, words[i-1]+" "+words[i])
+	}
+
+	return tokens
+}
+
+func (m *Model) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error while creating model directory: %w", err)
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("error while marshaling model: %w", err)
+	}
+
+	// Write then rename so a running worker never reads a partial file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return fmt.Errorf("error while writing model: %w", err)
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func Load(path string) (*Model, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading model: %w", err)
+	}
+
+	m := &Model{}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("error while unmarshaling model: %w", err)
+	}
+	for class := range m.TokenCounts {
+		if m.TokenCounts[class] == nil {
+			m.TokenCounts[class] = map[string]int{}
+		}
+	}
+
+	return m, nil
+}
@@ -0,0 +1,81 @@
+package classifier
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func trainingSet() []Example {
+	return []Example{
+		{Text: "you are a total clown go away", Toxic: true},
+		{Text: "absolute clown behaviour, get lost", Toxic: true},
+		{Text: "nobody wants you here clown", Toxic: true},
+		{Text: "good morning everyone", Toxic: false},
+		{Text: "thanks for the help with the deploy", Toxic: false},
+		{Text: "see you all at standup", Toxic: false},
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	got := Tokenize("Hello, World! hi")
+	want := []string{"hello", "world", "hi", "hello world", "world hi"}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestModel_Analyze(t *testing.T) {
+	m := Train(trainingSet())
+
+	toxicScore, err := m.Analyze("what a clown")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	cleanScore, err := m.Analyze("good morning, thanks everyone")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if toxicScore < 0.5 {
+		t.Errorf("expected toxic score >= 0.5, got %f", toxicScore)
+	}
+	if cleanScore >= 0.5 {
+		t.Errorf("expected clean score < 0.5, got %f", cleanScore)
+	}
+}
+
+func TestModel_Analyze_Untrained(t *testing.T) {
+	m := Train([]Example{{Text: "only clean data", Toxic: false}})
+
+	_, err := m.Analyze("anything")
+	if !errors.Is(err, ErrUntrained) {
+		t.Errorf("expected ErrUntrained, got %v", err)
+	}
+}
+
+func TestModel_SaveLoad(t *testing.T) {
+	m := Train(trainingSet())
+	path := filepath.Join(t.TempDir(), "model.json")
+
+	if err := m.Save(path); err != nil {
+		t.Fatalf("expected no error saving, got %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("expected no error loading, got %v", err)
+	}
+
+	if loaded.Version() != m.Version() {
+		t.Errorf("expected version %s, got %s", m.Version(), loaded.Version())
+	}
+
+	want, _ := m.Analyze("clown")
+	got, _ := loaded.Analyze("clown")
+	if want != got {
+		t.Errorf("expected score %f after reload, got %f", want, got)
+	}
+}
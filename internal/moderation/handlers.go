@@ -0,0 +1,331 @@
+package moderation
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mr1hm/go-chat-moderator/internal/audit"
+	"github.com/mr1hm/go-chat-moderator/internal/auth"
+	"github.com/mr1hm/go-chat-moderator/internal/chat"
+	"github.com/mr1hm/go-chat-moderator/internal/webhooks"
+)
+
+type Handler struct {
+	auditRepo     audit.Repository
+	webhooks      *webhooks.Dispatcher
+	logRepo       ModerationLogRepository
+	actionRepo    ModerationActionRepository
+	analyticsRepo AnalyticsRepository
+	messageRepo   chat.MessageRepository
+	reportRepo    chat.ReportRepository
+}
+
+func NewHandler() *Handler {
+	return &Handler{
+		auditRepo:     audit.NewRepository(),
+		webhooks:      webhooks.NewDispatcher(),
+		logRepo:       NewModerationLogRepository(),
+		actionRepo:    NewModerationActionRepository(),
+		analyticsRepo: NewAnalyticsRepository(),
+		messageRepo:   chat.NewMessageRepository(),
+		reportRepo:    chat.NewReportRepository(),
+	}
+}
+
+func (h *Handler) ApproveMessage(c *gin.Context) {
+	h.review(c, ActionApprove, "approved", audit.ActionMessageApprove, webhooks.EventMessageApproved)
+}
+
+func (h *Handler) RemoveMessage(c *gin.Context) {
+	h.review(c, ActionRemove, "removed", audit.ActionMessageRemove, webhooks.EventMessageRemoved)
+}
+
+// review records a moderator decision on a message and applies its status
+func (h *Handler) review(c *gin.Context, action, status, auditAction, event string) {
+	var req ModerationActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	msg, err := h.messageRepo.FindByID(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, chat.ErrMessageNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": chat.ErrMessageNotFound.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to get message",
+		})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	modAction := &ModerationAction{
+		MessageID:   msg.ID,
+		ModeratorID: userID.(string),
+		Action:      action,
+		Reason:      req.Reason,
+	}
+	if err := h.actionRepo.Create(modAction); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to record moderation action",
+		})
+		return
+	}
+
+	if err := h.messageRepo.UpdateStatus(msg.ID, status); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to update message status",
+		})
+		return
+	}
+
+	// A decision on a message answers any reports about it
+	if err := h.reportRepo.Resolve(msg.ID); err != nil {
+		log.Printf("error while resolving reports: %v", err)
+	}
+
+	if err := h.auditRepo.Append(audit.NewEntry(
+		modAction.ModeratorID, auditAction, "message", msg.ID, req.Reason,
+		gin.H{"moderation_status": msg.ModerationStatus},
+		gin.H{"moderation_status": status},
+	)); err != nil {
+		log.Printf("error while writing audit entry: %v", err)
+	}
+
+	if err := publishStatus(c.Request.Context(), msg.RoomID, msg.ID, status); err != nil {
+		log.Printf("error while publishing moderation update: %v", err)
+	}
+
+	if err := h.webhooks.Emit(event, gin.H{
+		"message_id":      msg.ID,
+		"room_id":         msg.RoomID,
+		"user_id":         msg.UserID,
+		"previous_status": msg.ModerationStatus,
+		"status":          status,
+		"moderator_id":    modAction.ModeratorID,
+		"reason":          req.Reason,
+	}); err != nil {
+		log.Printf("error while emitting webhook: %v", err)
+	}
+
+	c.JSON(http.StatusOK, modAction)
+}
+
+// ListReports returns unresolved user reports with the reported messages,
+// including messages in DMs. Optional query param: limit
+func (h *Handler) ListReports(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+
+	reports, err := h.reportRepo.ListOpen(limit)
+	if err != nil {
+		log.Printf("error while listing reports: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to list reports",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, reports)
+}
+
+// ShadowReport compares primary and shadow results.
+// Optional query params: provider, version, limit
+func (h *Handler) ShadowReport(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+
+	report, err := h.logRepo.ShadowReport(ShadowFilter{
+		Provider: c.Query("provider"),
+		Version:  c.Query("version"),
+	}, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to build shadow report",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// Analytics
+// Every endpoint accepts from/to (RFC 3339 or YYYY-MM-DD) and bucket (hour, day, week)
+
+func (h *Handler) FlagRates(c *gin.Context) {
+	filter, ok := bindAnalyticsFilter(c)
+	if !ok {
+		return
+	}
+
+	groupBy := c.Query("group")
+	if groupBy != "" && groupBy != "room" && groupBy != "category" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "group must be room or category",
+		})
+		return
+	}
+
+	rates, err := h.analyticsRepo.FlagRates(filter, groupBy)
+	respondAnalytics(c, rates, err)
+}
+
+func (h *Handler) ScoreHistogram(c *gin.Context) {
+	filter, ok := bindAnalyticsFilter(c)
+	if !ok {
+		return
+	}
+
+	bins, err := strconv.Atoi(c.DefaultQuery("bins", "10"))
+	if err != nil || bins <= 0 || bins > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "bins must be between 1 and 100",
+		})
+		return
+	}
+
+	histogram, err := h.analyticsRepo.ScoreHistogram(filter, c.Query("provider"), bins)
+	respondAnalytics(c, histogram, err)
+}
+
+func (h *Handler) TopOffenders(c *gin.Context) {
+	filter, ok := bindAnalyticsFilter(c)
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit <= 0 {
+		limit = 10
+	}
+
+	offenders, err := h.analyticsRepo.TopOffenders(filter, limit)
+	respondAnalytics(c, offenders, err)
+}
+
+func (h *Handler) QueueLatency(c *gin.Context) {
+	filter, ok := bindAnalyticsFilter(c)
+	if !ok {
+		return
+	}
+
+	latency, err := h.analyticsRepo.QueueLatency(filter)
+	respondAnalytics(c, latency, err)
+}
+
+func (h *Handler) ProviderErrorRates(c *gin.Context) {
+	filter, ok := bindAnalyticsFilter(c)
+	if !ok {
+		return
+	}
+
+	rates, err := h.analyticsRepo.ProviderErrorRates(filter)
+	respondAnalytics(c, rates, err)
+}
+
+func (h *Handler) ModeratorActionCounts(c *gin.Context) {
+	filter, ok := bindAnalyticsFilter(c)
+	if !ok {
+		return
+	}
+
+	counts, err := h.analyticsRepo.ModeratorActionCounts(filter)
+	respondAnalytics(c, counts, err)
+}
+
+// bindAnalyticsFilter parses the shared analytics query params, writing a 400 on failure
+func bindAnalyticsFilter(c *gin.Context) (AnalyticsFilter, bool) {
+	filter, err := parseAnalyticsFilter(c.Query("from"), c.Query("to"), c.DefaultQuery("bucket", "day"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return filter, false
+	}
+
+	return filter, true
+}
+
+func parseAnalyticsFilter(from, to, bucket string) (AnalyticsFilter, error) {
+	filter := AnalyticsFilter{Bucket: bucket}
+	if bucket != "hour" && bucket != "day" && bucket != "week" {
+		return filter, errors.New("bucket must be hour, day or week")
+	}
+
+	var err error
+	if filter.From, err = parseDate(from); err != nil {
+		return filter, fmt.Errorf("invalid from: %w", err)
+	}
+	if filter.To, err = parseDate(to); err != nil {
+		return filter, fmt.Errorf("invalid to: %w", err)
+	}
+
+	return filter, nil
+}
+
+func parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
+func respondAnalytics(c *gin.Context, data any, err error) {
+	if err != nil {
+		log.Printf("analytics error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to query analytics",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, data)
+}
+
+func RegisterRoutes(r *gin.Engine, authHandler *auth.Handler) *Handler {
+	handler := NewHandler()
+
+	// Moderator bots may act on messages with the moderation:act scope
+	act := r.Group("/moderation/messages")
+	act.Use(authHandler.AuthMiddleware(auth.ScopeModerationAct), authHandler.RequireRole(auth.RoleModerator))
+	{
+		act.POST("/:id/approve", handler.ApproveMessage)
+		act.POST("/:id/remove", handler.RemoveMessage)
+	}
+
+	mod := r.Group("/moderation")
+	mod.Use(authHandler.AuthMiddleware(), authHandler.RequireRole(auth.RoleModerator))
+	{
+		mod.GET("/reports", handler.ListReports)
+		mod.GET("/shadow", handler.ShadowReport)
+
+		analytics := mod.Group("/analytics")
+		analytics.GET("/flag-rates", handler.FlagRates)
+		analytics.GET("/score-histogram", handler.ScoreHistogram)
+		analytics.GET("/top-offenders", handler.TopOffenders)
+		analytics.GET("/queue-latency", handler.QueueLatency)
+		analytics.GET("/provider-errors", handler.ProviderErrorRates)
+		analytics.GET("/moderator-actions", handler.ModeratorActionCounts)
+	}
+
+	return handler
+}
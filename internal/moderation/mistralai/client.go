@@ -9,10 +9,14 @@ import (
 	"time"
 )
 
-const apiURL = "https://api.mistral.ai/v1/moderations"
+const (
+	apiURL       = "https://api.mistral.ai/v1/moderations"
+	defaultModel = "mistral-moderation-latest"
+)
 
 type Client struct {
 	apiKey     string
+	model      string
 	httpClient *http.Client
 }
 
@@ -39,54 +43,88 @@ type ModerationResponse struct {
 }
 
 func NewClient(apiKey string) *Client {
+	return NewClientWithModel(apiKey, defaultModel)
+}
+
+func NewClientWithModel(apiKey, model string) *Client {
+	if model == "" {
+		model = defaultModel
+	}
 	return &Client{
 		apiKey: apiKey,
+		model:  model,
 		httpClient: &http.Client{
 			Timeout: 5 * time.Second,
 		},
 	}
 }
 
+func (c *Client) Name() string {
+	return "mistralai"
+}
+
+func (c *Client) Version() string {
+	return c.model
+}
+
 func (c *Client) Analyze(text string) (float64, error) {
+	score, _, err := c.AnalyzeCategory(text)
+	return score, err
+}
+
+// AnalyzeCategory returns the highest category score and the name of that category
+func (c *Client) AnalyzeCategory(text string) (float64, string, error) {
 	reqBody := ModerationRequest{
 		Input: text,
-		Model: "mistral-moderation-latest",
+		Model: c.model,
 	}
 
 	b, err := json.Marshal(reqBody)
 	if err != nil {
-		return 0, fmt.Errorf("error while marshaling ModerationRequest: %w", err)
+		return 0, "", fmt.Errorf("error while marshaling ModerationRequest: %w", err)
 	}
 
 	req, err := http.NewRequest(http.MethodPost, apiURL, bytes.NewReader(b))
 	if err != nil {
-		return 0, fmt.Errorf("error while creating request: %w", err)
+		return 0, "", fmt.Errorf("error while creating request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+c.apiKey)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return 0, fmt.Errorf("error while doing request: %w", err)
+		return 0, "", fmt.Errorf("error while doing request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return 0, fmt.Errorf("API error %d: %s", resp.StatusCode, body)
+		return 0, "", fmt.Errorf("API error %d: %s", resp.StatusCode, body)
 	}
 
 	var result ModerationResponse
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return 0, fmt.Errorf("error while decoding response body: %w", err)
+		return 0, "", fmt.Errorf("error while decoding response body: %w", err)
 	}
 
 	if len(result.Results) == 0 {
-		return 0, nil
+		return 0, "", nil
 	}
 
 	scores := result.Results[0].CategoryScores
-	maxScore := max(scores.Sexual, scores.HateAndExtremism, scores.Violence, scores.SelfHarm)
+	maxScore, category := scores.Sexual, "sexual"
+	for _, cat := range []struct {
+		name  string
+		score float64
+	}{
+		{"hate_and_extremism", scores.HateAndExtremism},
+		{"violence", scores.Violence},
+		{"selfharm", scores.SelfHarm},
+	} {
+		if cat.score > maxScore {
+			maxScore, category = cat.score, cat.name
+		}
+	}
 
-	return maxScore, nil
+	return maxScore, category, nil
 }
@@ -3,9 +3,115 @@ package moderation
 import "time"
 
 type ModerationLog struct {
-	ID            string    `json:"id"`
-	MessageID     string    `json:"message_id"`
-	ToxicityScore float64   `json:"toxicity_score"`
-	IsFlagged     bool      `json:"is_flagged"`
-	ProcessedAt   time.Time `json:"processed_at"`
+	ID              string    `json:"id"`
+	MessageID       string    `json:"message_id"`
+	Provider        string    `json:"provider"`
+	ProviderVersion string    `json:"provider_version"`
+	Threshold       float64   `json:"threshold"`
+	IsShadow        bool      `json:"is_shadow"`
+	ToxicityScore   float64   `json:"toxicity_score"`
+	Category        string    `json:"category,omitempty"`
+	IsFlagged       bool      `json:"is_flagged"`
+	Error           string    `json:"error,omitempty"` // Set when the provider call failed
+	ProcessedAt     time.Time `json:"processed_at"`
+}
+
+// Shadow evaluation
+type ShadowFilter struct {
+	Provider string
+	Version  string
+}
+
+type ShadowResult struct {
+	Provider  string  `json:"provider"`
+	Version   string  `json:"version"`
+	Score     float64 `json:"score"`
+	IsFlagged bool    `json:"is_flagged"`
+}
+
+type ShadowDisagreement struct {
+	MessageID   string       `json:"message_id"`
+	RoomID      string       `json:"room_id"`
+	Content     string       `json:"content"`
+	Primary     ShadowResult `json:"primary"`
+	Shadow      ShadowResult `json:"shadow"`
+	ProcessedAt time.Time    `json:"processed_at"`
+}
+
+type ShadowReport struct {
+	Compared         int                   `json:"compared"`
+	Disagreements    int                   `json:"disagreements"`
+	DisagreementRate float64               `json:"disagreement_rate"`
+	Messages         []*ShadowDisagreement `json:"messages"`
+}
+
+// Moderator review decisions
+const (
+	ActionApprove = "approve"
+	ActionRemove  = "remove"
+)
+
+type ModerationAction struct {
+	ID          string    `json:"id"`
+	MessageID   string    `json:"message_id"`
+	ModeratorID string    `json:"moderator_id"`
+	Action      string    `json:"action"`
+	Reason      string    `json:"reason,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type ModerationActionRequest struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// Analytics
+type AnalyticsFilter struct {
+	From   time.Time // Zero means unbounded
+	To     time.Time
+	Bucket string // hour, day or week
+}
+
+type FlagRate struct {
+	Bucket  string  `json:"bucket"`
+	Group   string  `json:"group"`
+	Total   int     `json:"total"`
+	Flagged int     `json:"flagged"`
+	Rate    float64 `json:"rate"`
+}
+
+type HistogramBin struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Count int     `json:"count"`
+}
+
+type Offender struct {
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+	Messages int    `json:"messages"`
+	Flagged  int    `json:"flagged"`
+	Removed  int    `json:"removed"`
+}
+
+type QueueLatency struct {
+	Bucket     string  `json:"bucket"`
+	Count      int     `json:"count"`
+	AvgSeconds float64 `json:"avg_seconds"`
+	MaxSeconds float64 `json:"max_seconds"`
+}
+
+type ProviderErrorRate struct {
+	Bucket   string  `json:"bucket"`
+	Provider string  `json:"provider"`
+	Version  string  `json:"version"`
+	Calls    int     `json:"calls"`
+	Errors   int     `json:"errors"`
+	Rate     float64 `json:"rate"`
+}
+
+type ModeratorActionCount struct {
+	ModeratorID string `json:"moderator_id"`
+	Username    string `json:"username"`
+	Action      string `json:"action"`
+	Count       int    `json:"count"`
 }
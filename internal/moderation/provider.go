@@ -0,0 +1,72 @@
+package moderation
+
+import (
+	"fmt"
+
+	"github.com/mr1hm/go-chat-moderator/internal/moderation/classifier"
+	"github.com/mr1hm/go-chat-moderator/internal/moderation/mistralai"
+	"github.com/mr1hm/go-chat-moderator/internal/shared/config"
+)
+
+// Provider scores message content for toxicity on a 0-1 scale.
+// Name and Version identify the results in moderation_logs.
+type Provider interface {
+	Name() string
+	Version() string
+	Analyze(text string) (float64, error)
+}
+
+// CategoryProvider is implemented by providers that can attribute their score
+// to the highest-scoring category
+type CategoryProvider interface {
+	Provider
+	AnalyzeCategory(text string) (float64, string, error)
+}
+
+// analyze scores text, including its category when the provider reports one
+func analyze(p Provider, text string) (float64, string, error) {
+	if cp, ok := p.(CategoryProvider); ok {
+		return cp.AnalyzeCategory(text)
+	}
+	score, err := p.Analyze(text)
+	return score, "", err
+}
+
+// Scorer pairs a provider with the threshold at which it flags a message
+type Scorer struct {
+	Provider  Provider
+	Threshold float64
+}
+
+func (s Scorer) IsFlagged(score float64) bool {
+	return score >= s.Threshold
+}
+
+// Flags scores text and reports whether it crosses the threshold
+func (s Scorer) Flags(text string) (bool, error) {
+	score, _, err := analyze(s.Provider, text)
+	if err != nil {
+		return false, err
+	}
+	return s.IsFlagged(score), nil
+}
+
+// NewProvider builds a provider by name. For the local classifier, model is
+// the path of the trained model file.
+func NewProvider(name, model string) (Provider, error) {
+	switch name {
+	case "mistralai":
+		return mistralai.NewClientWithModel(config.LoadMistralAIConfig().Key, model), nil
+	case "local":
+		if model == "" {
+			model = config.LoadClassifierConfig().ModelPath
+		}
+		m, err := classifier.Load(model)
+		if err != nil {
+			return nil, fmt.Errorf("error while loading classifier: %w", err)
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("unknown moderation provider: %s", name)
+	}
+}
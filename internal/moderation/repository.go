@@ -1,12 +1,16 @@
 package moderation
 
 import (
+	"fmt"
+
 	"github.com/google/uuid"
+	"github.com/mr1hm/go-chat-moderator/internal/moderation/classifier"
 	"github.com/mr1hm/go-chat-moderator/internal/shared/sqlite"
 )
 
 type ModerationLogRepository interface {
 	Create(log *ModerationLog) error
+	ShadowReport(filter ShadowFilter, limit int) (*ShadowReport, error)
 }
 type sqliteModerationLogRepo struct{}
 
@@ -22,11 +26,142 @@ func (r *sqliteModerationLogRepo) Create(log *ModerationLog) error {
 	if log.IsFlagged {
 		flagged = 1
 	}
+	shadow := 0
+	if log.IsShadow {
+		shadow = 1
+	}
+
+	_, err := sqlite.DB.Exec(
+		`INSERT INTO moderation_logs (id, message_id, provider, provider_version, threshold, is_shadow, toxicity_score, category, is_flagged, error)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		log.ID, log.MessageID, log.Provider, log.ProviderVersion, log.Threshold, shadow, log.ToxicityScore, log.Category, flagged, log.Error,
+	)
+
+	return err
+}
+
+// ShadowReport pairs each primary result with the shadow results for the same
+// message and reports how often their flag decisions differ
+func (r *sqliteModerationLogRepo) ShadowReport(filter ShadowFilter, limit int) (*ShadowReport, error) {
+	where := `p.is_shadow = 0 AND p.error = ''`
+	var args []any
+	if filter.Provider != "" {
+		where += ` AND s.provider = ?`
+		args = append(args, filter.Provider)
+	}
+	if filter.Version != "" {
+		where += ` AND s.provider_version = ?`
+		args = append(args, filter.Version)
+	}
+
+	report := &ShadowReport{}
+	err := sqlite.DB.QueryRow(
+		`SELECT COUNT(*), COALESCE(SUM(p.is_flagged != s.is_flagged), 0)
+		 FROM moderation_logs p
+		 JOIN moderation_logs s ON s.message_id = p.message_id AND s.is_shadow = 1 AND s.error = ''
+		 WHERE `+where,
+		args...,
+	).Scan(&report.Compared, &report.Disagreements)
+	if err != nil {
+		return nil, fmt.Errorf("error while counting shadow results: %w", err)
+	}
+	if report.Compared > 0 {
+		report.DisagreementRate = float64(report.Disagreements) / float64(report.Compared)
+	}
+
+	rows, err := sqlite.DB.Query(
+		`SELECT p.message_id, m.room_id, m.content,
+		        p.provider, p.provider_version, p.toxicity_score, p.is_flagged,
+		        s.provider, s.provider_version, s.toxicity_score, s.is_flagged, s.processed_at
+		 FROM moderation_logs p
+		 JOIN moderation_logs s ON s.message_id = p.message_id AND s.is_shadow = 1 AND s.error = ''
+		 JOIN messages m ON m.id = p.message_id
+		 WHERE `+where+` AND p.is_flagged != s.is_flagged
+		 ORDER BY s.processed_at DESC LIMIT ?`,
+		append(args, limit)...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error while querying shadow disagreements: %w", err)
+	}
+	defer rows.Close()
+
+	report.Messages = []*ShadowDisagreement{}
+	for rows.Next() {
+		d := &ShadowDisagreement{}
+		if err := rows.Scan(
+			&d.MessageID,
+			&d.RoomID,
+			&d.Content,
+			&d.Primary.Provider,
+			&d.Primary.Version,
+			&d.Primary.Score,
+			&d.Primary.IsFlagged,
+			&d.Shadow.Provider,
+			&d.Shadow.Version,
+			&d.Shadow.Score,
+			&d.Shadow.IsFlagged,
+			&d.ProcessedAt,
+		); err != nil {
+			return nil, fmt.Errorf("error while scanning shadow disagreements: %w", err)
+		}
+		report.Messages = append(report.Messages, d)
+	}
+
+	return report, rows.Err()
+}
+
+// Moderator Action Repository
+type ModerationActionRepository interface {
+	Create(action *ModerationAction) error
+	TrainingExamples() ([]classifier.Example, error)
+}
+
+type sqliteModerationActionRepo struct{}
+
+func NewModerationActionRepository() ModerationActionRepository {
+	return &sqliteModerationActionRepo{}
+}
+
+func (r *sqliteModerationActionRepo) Create(action *ModerationAction) error {
+	action.ID = uuid.New().String()
 
 	_, err := sqlite.DB.Exec(
-		`INSERT INTO moderation_logs (id, message_id, toxicity_score, is_flagged) VALUES (?, ?, ?, ?)`,
-		log.ID, log.MessageID, log.ToxicityScore, flagged,
+		`INSERT INTO moderation_actions (id, message_id, moderator_id, action, reason) VALUES (?, ?, ?, ?, ?)`,
+		action.ID, action.MessageID, action.ModeratorID, action.Action, action.Reason,
 	)
 
 	return err
 }
+
+// TrainingExamples labels each reviewed message with the most recent moderator
+// decision on it: removed messages are toxic, approved ones are clean
+func (r *sqliteModerationActionRepo) TrainingExamples() ([]classifier.Example, error) {
+	rows, err := sqlite.DB.Query(
+		`SELECT m.content, a.action
+		 FROM moderation_actions a
+		 JOIN messages m ON m.id = a.message_id
+		 WHERE a.rowid = (
+		 	SELECT latest.rowid FROM moderation_actions latest
+		 	WHERE latest.message_id = a.message_id
+		 	ORDER BY latest.created_at DESC, latest.rowid DESC LIMIT 1
+		 )`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error while querying training examples: %w", err)
+	}
+	defer rows.Close()
+
+	var examples []classifier.Example
+	for rows.Next() {
+		var content, action string
+		if err := rows.Scan(&content, &action); err != nil {
+			return nil, fmt.Errorf("error while scanning training examples: %w", err)
+		}
+		examples = append(examples, classifier.Example{
+			Text:  content,
+			Toxic: action == ActionRemove,
+		})
+	}
+
+	return examples, rows.Err()
+}
@@ -3,25 +3,28 @@ package moderation
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"strings"
 	"time"
 
 	"github.com/mr1hm/go-chat-moderator/internal/chat"
-	"github.com/mr1hm/go-chat-moderator/internal/moderation/mistralai"
 	"github.com/mr1hm/go-chat-moderator/internal/shared/redis"
+	"github.com/mr1hm/go-chat-moderator/internal/webhooks"
 )
 
 const (
-	queueKey       = "moderation:pending"
-	toxicThreshold = 0.70
-	maxRetries     = 5
+	queueKey   = "moderation:pending"
+	maxRetries = 5
 )
 
 type Worker struct {
-	mistralai   *mistralai.Client
+	primary     Scorer
+	shadow      *Scorer // Optional candidate, scored but never acted on
 	messageRepo chat.MessageRepository
 	logRepo     ModerationLogRepository
+	webhooks    *webhooks.Dispatcher
+	publish     func(ctx context.Context, roomID, messageID, status string) error
 	ticker      *time.Ticker
 }
 
@@ -30,11 +33,14 @@ type QueueItem struct {
 	RetryCount int          `json:"retry_count"`
 }
 
-func NewWorker(apiKey string) *Worker {
+func NewWorker(primary Scorer, shadow *Scorer) *Worker {
 	return &Worker{
-		mistralai:   mistralai.NewClient(apiKey),
+		primary:     primary,
+		shadow:      shadow,
 		messageRepo: chat.NewMessageRepository(),
 		logRepo:     NewModerationLogRepository(),
+		webhooks:    webhooks.NewDispatcher(),
+		publish:     publishStatus,
 		ticker:      time.NewTicker(time.Second),
 	}
 }
@@ -65,9 +71,17 @@ func (w *Worker) processNext(ctx context.Context) {
 		return
 	}
 
-	// Call MistralAI API
-	score, err := w.mistralai.Analyze(item.Message.Content)
+	w.moderate(ctx, item)
+}
+
+// moderate scores a queued message, applies the primary result and logs it,
+// then scores it with the shadow provider if there is one
+func (w *Worker) moderate(ctx context.Context, item QueueItem) {
+	// Score with the primary provider
+	score, category, err := analyze(w.primary.Provider, item.Message.Content)
 	if err != nil {
+		w.logError(item.Message.ID, w.primary, false, err)
+
 		// If rate-limited, re-queue and back off
 		if strings.Contains(err.Error(), "429") {
 			if item.RetryCount >= maxRetries {
@@ -89,41 +103,103 @@ func (w *Worker) processNext(ctx context.Context) {
 			return
 		}
 
-		log.Printf("MistralAI API error: %v", err)
+		log.Printf("%s API error: %v", w.primary.Provider.Name(), err)
 		return
 	}
 
 	// Determine status
 	status := "approved"
-	isFlagged := false
-	if score >= toxicThreshold {
+	isFlagged := w.primary.IsFlagged(score)
+	if isFlagged {
 		status = "flagged"
-		isFlagged = true
 	}
 
 	// Update message status
 	w.messageRepo.UpdateStatus(item.Message.ID, status)
 
-	b, err := json.Marshal(chat.WSMessage{
-		Type: "moderation_update",
-		Payload: map[string]string{
-			"message_id": item.Message.ID,
-			"status":     status,
-		},
+	if err := w.publish(ctx, item.Message.RoomID, item.Message.ID, status); err != nil {
+		log.Printf("error while publishing moderation update: %v", err)
+	}
+
+	// Log moderation result
+	w.logRepo.Create(&ModerationLog{
+		MessageID:       item.Message.ID,
+		Provider:        w.primary.Provider.Name(),
+		ProviderVersion: w.primary.Provider.Version(),
+		Threshold:       w.primary.Threshold,
+		ToxicityScore:   score,
+		Category:        category,
+		IsFlagged:       isFlagged,
 	})
+
+	log.Printf("Moderated message [ %s ]: score=%.2f status=%s", item.Message.ID, score, status)
+
+	if isFlagged {
+		if err := w.webhooks.Emit(webhooks.EventMessageFlagged, map[string]any{
+			"message_id": item.Message.ID,
+			"room_id":    item.Message.RoomID,
+			"user_id":    item.Message.UserID,
+			"content":    item.Message.Content,
+			"score":      score,
+			"category":   category,
+			"provider":   w.primary.Provider.Name(),
+		}); err != nil {
+			log.Printf("error while emitting webhook: %v", err)
+		}
+	}
+
+	if w.shadow != nil {
+		w.evaluateShadow(&item.Message)
+	}
+}
+
+// evaluateShadow scores a message with the candidate provider and records the
+// result for comparison. The message status is never changed here.
+func (w *Worker) evaluateShadow(msg *chat.Message) {
+	score, category, err := analyze(w.shadow.Provider, msg.Content)
 	if err != nil {
-		log.Printf("error while marshaling WSMessage: %v", err)
+		log.Printf("shadow %s error for message [ %s ]: %v", w.shadow.Provider.Name(), msg.ID, err)
+		w.logError(msg.ID, *w.shadow, true, err)
 		return
 	}
 
-	redis.Client.Publish(ctx, "chat:"+item.Message.RoomID, b)
+	w.logRepo.Create(&ModerationLog{
+		MessageID:       msg.ID,
+		Provider:        w.shadow.Provider.Name(),
+		ProviderVersion: w.shadow.Provider.Version(),
+		Threshold:       w.shadow.Threshold,
+		IsShadow:        true,
+		ToxicityScore:   score,
+		Category:        category,
+		IsFlagged:       w.shadow.IsFlagged(score),
+	})
+}
 
-	// Log moderation result
+// logError records a failed provider call so error rates can be reported
+func (w *Worker) logError(messageID string, scorer Scorer, isShadow bool, err error) {
 	w.logRepo.Create(&ModerationLog{
-		MessageID:     item.Message.ID,
-		ToxicityScore: score,
-		IsFlagged:     isFlagged,
+		MessageID:       messageID,
+		Provider:        scorer.Provider.Name(),
+		ProviderVersion: scorer.Provider.Version(),
+		Threshold:       scorer.Threshold,
+		IsShadow:        isShadow,
+		Error:           err.Error(),
 	})
+}
 
-	log.Printf("Moderated message [ %s ]: score=%.2f status=%s", item.Message.ID, score, status)
+// publishStatus tells every API instance to update a message's status for
+// clients connected to its room
+func publishStatus(ctx context.Context, roomID, messageID, status string) error {
+	b, err := json.Marshal(chat.WSMessage{
+		Type: "moderation_update",
+		Payload: map[string]string{
+			"message_id": messageID,
+			"status":     status,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error while marshaling WSMessage: %w", err)
+	}
+
+	return redis.Client.Publish(ctx, "chat:"+roomID, b).Err()
 }
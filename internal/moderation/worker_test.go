@@ -0,0 +1,168 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/mr1hm/go-chat-moderator/internal/chat"
+	"github.com/mr1hm/go-chat-moderator/internal/shared/sqlite"
+	"github.com/mr1hm/go-chat-moderator/internal/webhooks"
+)
+
+type fakeProvider struct {
+	name, version string
+	score         float64
+	err           error
+}
+
+func (p *fakeProvider) Name() string    { return p.name }
+func (p *fakeProvider) Version() string { return p.version }
+func (p *fakeProvider) Analyze(string) (float64, error) {
+	return p.score, p.err
+}
+
+// newTestWorker migrates a fresh database and returns a worker whose
+// status updates are recorded instead of published to Redis
+func newTestWorker(t *testing.T, primary Scorer, shadow *Scorer) (*Worker, *[]string) {
+	t.Helper()
+	sqlite.Init(filepath.Join(t.TempDir(), "test.db"))
+	t.Cleanup(sqlite.Close)
+	sqlite.Migrate()
+
+	published := &[]string{}
+	return &Worker{
+		primary:     primary,
+		shadow:      shadow,
+		messageRepo: chat.NewMessageRepository(),
+		logRepo:     NewModerationLogRepository(),
+		webhooks:    webhooks.NewDispatcher(),
+		publish: func(_ context.Context, _, messageID, status string) error {
+			*published = append(*published, messageID+":"+status)
+			return nil
+		},
+	}, published
+}
+
+func createTestMessage(t *testing.T, id string) *chat.Message {
+	t.Helper()
+	if _, err := sqlite.DB.Exec(
+		`INSERT OR IGNORE INTO users (id, email, password_hash, username) VALUES ('author', 'author@example.com', 'x', 'author')`,
+	); err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	if _, err := sqlite.DB.Exec(
+		`INSERT OR IGNORE INTO rooms (id, name, created_by) VALUES ('room-1', 'general', 'author')`,
+	); err != nil {
+		t.Fatalf("creating room: %v", err)
+	}
+
+	msg := &chat.Message{ID: id, RoomID: "room-1", UserID: "author", Content: "hello"}
+	if err := chat.NewMessageRepository().Create(msg); err != nil {
+		t.Fatalf("creating message: %v", err)
+	}
+	return msg
+}
+
+type logRow struct {
+	provider, version string
+	isShadow          bool
+	isFlagged         bool
+	err               string
+}
+
+func logRows(t *testing.T, messageID string) []logRow {
+	t.Helper()
+	rows, err := sqlite.DB.Query(
+		`SELECT provider, provider_version, is_shadow, is_flagged, error FROM moderation_logs
+		 WHERE message_id = ? ORDER BY is_shadow`, messageID,
+	)
+	if err != nil {
+		t.Fatalf("querying logs: %v", err)
+	}
+	defer rows.Close()
+
+	var logs []logRow
+	for rows.Next() {
+		var l logRow
+		if err := rows.Scan(&l.provider, &l.version, &l.isShadow, &l.isFlagged, &l.err); err != nil {
+			t.Fatalf("scanning logs: %v", err)
+		}
+		logs = append(logs, l)
+	}
+	return logs
+}
+
+func TestWorker_ShadowResultIsNeverActedOn(t *testing.T) {
+	primary := Scorer{Provider: &fakeProvider{name: "primary", version: "v1", score: 0.1}, Threshold: 0.5}
+	shadow := &Scorer{Provider: &fakeProvider{name: "candidate", version: "v2", score: 0.9}, Threshold: 0.5}
+	w, published := newTestWorker(t, primary, shadow)
+	msg := createTestMessage(t, "msg-1")
+
+	w.moderate(context.Background(), QueueItem{Message: *msg})
+
+	stored, err := w.messageRepo.FindByID(msg.ID)
+	if err != nil {
+		t.Fatalf("FindByID: %v", err)
+	}
+	if stored.ModerationStatus != "approved" {
+		t.Errorf("status = %q, want the primary's approved", stored.ModerationStatus)
+	}
+	if len(*published) != 1 || (*published)[0] != "msg-1:approved" {
+		t.Errorf("published %v, want only msg-1:approved", *published)
+	}
+
+	want := []logRow{
+		{provider: "primary", version: "v1", isShadow: false, isFlagged: false},
+		{provider: "candidate", version: "v2", isShadow: true, isFlagged: true},
+	}
+	if got := logRows(t, msg.ID); len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("log rows = %+v, want %+v", got, want)
+	}
+}
+
+func TestShadowReport_PairsPrimaryWithShadow(t *testing.T) {
+	primary := Scorer{Provider: &fakeProvider{name: "primary", version: "v1", score: 0.1}, Threshold: 0.5}
+	shadow := &Scorer{Provider: &fakeProvider{name: "candidate", version: "v2", score: 0.9}, Threshold: 0.5}
+	w, _ := newTestWorker(t, primary, shadow)
+
+	w.moderate(context.Background(), QueueItem{Message: *createTestMessage(t, "disagree")})
+
+	// A failed shadow call is logged but isn't a comparison
+	w.shadow = &Scorer{Provider: &fakeProvider{name: "candidate", version: "v2", err: errors.New("timeout")}, Threshold: 0.5}
+	w.moderate(context.Background(), QueueItem{Message: *createTestMessage(t, "shadow-failed")})
+	if got := logRows(t, "shadow-failed"); len(got) != 2 || got[1].err == "" || !got[1].isShadow {
+		t.Fatalf("failed shadow call logged as %+v", got)
+	}
+
+	report, err := w.logRepo.ShadowReport(ShadowFilter{}, 10)
+	if err != nil {
+		t.Fatalf("ShadowReport: %v", err)
+	}
+	if report.Compared != 1 || report.Disagreements != 1 || report.DisagreementRate != 1 {
+		t.Errorf("report = %d compared, %d disagreements, rate %v; want 1, 1, 1",
+			report.Compared, report.Disagreements, report.DisagreementRate)
+	}
+	if len(report.Messages) != 1 {
+		t.Fatalf("got %d disagreeing messages, want 1", len(report.Messages))
+	}
+	d := report.Messages[0]
+	if d.MessageID != "disagree" || d.RoomID != "room-1" || d.Content != "hello" {
+		t.Errorf("disagreement = %+v", d)
+	}
+	if d.Primary.Provider != "primary" || d.Primary.Version != "v1" || d.Primary.IsFlagged {
+		t.Errorf("primary = %+v", d.Primary)
+	}
+	if d.Shadow.Provider != "candidate" || d.Shadow.Version != "v2" || !d.Shadow.IsFlagged {
+		t.Errorf("shadow = %+v", d.Shadow)
+	}
+
+	report, err = w.logRepo.ShadowReport(ShadowFilter{Provider: "candidate", Version: "v3"}, 10)
+	if err != nil {
+		t.Fatalf("ShadowReport: %v", err)
+	}
+	if report.Compared != 0 {
+		t.Errorf("version filter compared %d results, want 0", report.Compared)
+	}
+}
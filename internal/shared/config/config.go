@@ -2,6 +2,8 @@ package config
 
 import (
 	"log"
+	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -12,6 +14,14 @@ type Config struct {
 	ServerConfig
 	JWTConfig
 	MistralAIConfig
+	ModerationConfig
+	ClassifierConfig
+	MailConfig
+	AuthConfig
+	OIDCConfig
+	ExportConfig
+	BlobConfig
+	AvatarConfig
 }
 
 // Individual service configs
@@ -22,14 +32,77 @@ type RedisConfig struct {
 	Addr string
 }
 type ServerConfig struct {
-	Port string
+	Port   string
+	AppURL string // Frontend base URL for links sent by email
 }
 type JWTConfig struct {
-	Secret string
+	Secret    string        // HS256 secret; optional once KeysDir is set
+	KeysDir   string        // Directory of <kid>.pem keys for RS256/EdDSA signing
+	ActiveKID string        // Signing key; defaults to the last private key by name
+	KeyGrace  time.Duration // How long retired keys keep validating after they stop signing
 }
 type MistralAIConfig struct {
 	Key string
 }
+type ModerationConfig struct {
+	Provider        string
+	Model           string
+	Threshold       float64
+	ShadowProvider  string // Empty disables shadow evaluation
+	ShadowModel     string
+	ShadowThreshold float64
+	CheckProfiles   bool // Screen usernames in the API with the primary provider
+}
+type ClassifierConfig struct {
+	ModelPath string
+}
+type MailConfig struct {
+	Driver       string // smtp, file or log
+	From         string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	Dir          string // Output directory for the file driver
+}
+
+type ExportConfig struct {
+	Dir     string        // Where archives are written until their link expires
+	LinkTTL time.Duration // How long a download link works after the archive is built
+}
+
+type BlobConfig struct {
+	Driver string // local
+	Dir    string // Root directory for the local driver
+}
+
+type AvatarConfig struct {
+	MaxBytes     int64
+	MaxDimension int // Largest width or height in pixels
+}
+
+type AuthConfig struct {
+	PasswordMinLength   int
+	PasswordCheckCommon bool          // Refuse passwords on the bundled common password list
+	LoginMaxFailures    int           // Failed logins per account before lockout
+	LoginMaxIPFailures  int           // Failed logins per IP before it is throttled
+	LoginFailureWindow  time.Duration // How long failures are counted
+	LoginLockout        time.Duration
+	LoginDelayAfter     int // Failures before progressive delays start
+	LoginMaxDelay       time.Duration
+	AccountDeletion     string // anonymize or purge a deleted user's messages
+}
+
+type OIDCConfig struct {
+	IssuerURL    string // Empty disables single sign-on
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	GroupsClaim  string
+	RoleMapping  map[string]string // IdP group -> global role
+	AllowSignup  bool              // Create accounts for unknown identities
+}
 
 func init() {
 	viper.AutomaticEnv()
@@ -37,11 +110,19 @@ func init() {
 
 func NewConfig() *Config {
 	return &Config{
-		DBConfig:        LoadDBConfig(),
-		RedisConfig:     LoadRedisConfig(),
-		ServerConfig:    LoadServerConfig(),
-		JWTConfig:       LoadJWTConfig(),
-		MistralAIConfig: LoadMistralAIConfig(),
+		DBConfig:         LoadDBConfig(),
+		RedisConfig:      LoadRedisConfig(),
+		ServerConfig:     LoadServerConfig(),
+		JWTConfig:        LoadJWTConfig(),
+		MistralAIConfig:  LoadMistralAIConfig(),
+		ModerationConfig: LoadModerationConfig(),
+		ClassifierConfig: LoadClassifierConfig(),
+		MailConfig:       LoadMailConfig(),
+		AuthConfig:       LoadAuthConfig(),
+		OIDCConfig:       LoadOIDCConfig(),
+		ExportConfig:     LoadExportConfig(),
+		BlobConfig:       LoadBlobConfig(),
+		AvatarConfig:     LoadAvatarConfig(),
 	}
 }
 
@@ -68,17 +149,30 @@ func LoadServerConfig() ServerConfig {
 	if port == "" {
 		log.Fatal("PORT environment variable missing")
 	}
+	appURL := viper.GetString("APP_URL")
+	if appURL == "" {
+		appURL = "http://localhost:5173"
+	}
 	return ServerConfig{
-		Port: port,
+		Port:   port,
+		AppURL: appURL,
 	}
 }
 func LoadJWTConfig() JWTConfig {
 	secret := viper.GetString("JWT_SECRET")
-	if secret == "" {
-		log.Fatal("JWT_SECRET environment variable missing")
+	keysDir := viper.GetString("JWT_KEYS_DIR")
+	if secret == "" && keysDir == "" {
+		log.Fatal("JWT_SECRET or JWT_KEYS_DIR environment variable missing")
+	}
+	grace := viper.GetDuration("JWT_KEY_GRACE")
+	if grace == 0 {
+		grace = 24 * time.Hour
 	}
 	return JWTConfig{
-		Secret: secret,
+		Secret:    secret,
+		KeysDir:   keysDir,
+		ActiveKID: viper.GetString("JWT_ACTIVE_KID"),
+		KeyGrace:  grace,
 	}
 }
 func LoadMistralAIConfig() MistralAIConfig {
@@ -90,3 +184,197 @@ func LoadMistralAIConfig() MistralAIConfig {
 		Key: apiKey,
 	}
 }
+func LoadModerationConfig() ModerationConfig {
+	provider := viper.GetString("MODERATION_PROVIDER")
+	if provider == "" {
+		provider = "mistralai"
+	}
+	threshold := viper.GetFloat64("MODERATION_THRESHOLD")
+	if threshold == 0 {
+		threshold = 0.70
+	}
+	shadowThreshold := viper.GetFloat64("MODERATION_SHADOW_THRESHOLD")
+	if shadowThreshold == 0 {
+		shadowThreshold = threshold
+	}
+	checkProfiles := true
+	if viper.IsSet("MODERATION_CHECK_PROFILES") {
+		checkProfiles = viper.GetBool("MODERATION_CHECK_PROFILES")
+	}
+	return ModerationConfig{
+		Provider:        provider,
+		Model:           viper.GetString("MODERATION_MODEL"),
+		Threshold:       threshold,
+		ShadowProvider:  viper.GetString("MODERATION_SHADOW_PROVIDER"),
+		ShadowModel:     viper.GetString("MODERATION_SHADOW_MODEL"),
+		ShadowThreshold: shadowThreshold,
+		CheckProfiles:   checkProfiles,
+	}
+}
+func LoadClassifierConfig() ClassifierConfig {
+	path := viper.GetString("CLASSIFIER_MODEL_PATH")
+	if path == "" {
+		path = "data/classifier.json"
+	}
+	return ClassifierConfig{
+		ModelPath: path,
+	}
+}
+func LoadMailConfig() MailConfig {
+	driver := viper.GetString("MAIL_DRIVER")
+	if driver == "" {
+		driver = "log"
+	}
+	from := viper.GetString("MAIL_FROM")
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+	port := viper.GetInt("SMTP_PORT")
+	if port == 0 {
+		port = 587
+	}
+	dir := viper.GetString("MAIL_DIR")
+	if dir == "" {
+		dir = "data/mail"
+	}
+	return MailConfig{
+		Driver:       driver,
+		From:         from,
+		SMTPHost:     viper.GetString("SMTP_HOST"),
+		SMTPPort:     port,
+		SMTPUsername: viper.GetString("SMTP_USERNAME"),
+		SMTPPassword: viper.GetString("SMTP_PASSWORD"),
+		Dir:          dir,
+	}
+}
+func LoadExportConfig() ExportConfig {
+	dir := viper.GetString("EXPORT_DIR")
+	if dir == "" {
+		dir = "data/exports"
+	}
+	linkTTL := viper.GetDuration("EXPORT_LINK_TTL")
+	if linkTTL == 0 {
+		linkTTL = 24 * time.Hour
+	}
+	return ExportConfig{
+		Dir:     dir,
+		LinkTTL: linkTTL,
+	}
+}
+func LoadBlobConfig() BlobConfig {
+	driver := viper.GetString("BLOB_DRIVER")
+	if driver == "" {
+		driver = "local"
+	}
+	dir := viper.GetString("BLOB_DIR")
+	if dir == "" {
+		dir = "data/blobs"
+	}
+	return BlobConfig{
+		Driver: driver,
+		Dir:    dir,
+	}
+}
+func LoadAvatarConfig() AvatarConfig {
+	maxBytes := viper.GetInt64("AVATAR_MAX_BYTES")
+	if maxBytes == 0 {
+		maxBytes = 1 << 20
+	}
+	maxDimension := viper.GetInt("AVATAR_MAX_DIMENSION")
+	if maxDimension == 0 {
+		maxDimension = 1024
+	}
+	return AvatarConfig{
+		MaxBytes:     maxBytes,
+		MaxDimension: maxDimension,
+	}
+}
+func LoadAuthConfig() AuthConfig {
+	minLength := viper.GetInt("PASSWORD_MIN_LENGTH")
+	if minLength == 0 {
+		minLength = 8
+	}
+	checkCommon := true
+	if viper.IsSet("PASSWORD_CHECK_COMMON") {
+		checkCommon = viper.GetBool("PASSWORD_CHECK_COMMON")
+	}
+	maxFailures := viper.GetInt("LOGIN_MAX_FAILURES")
+	if maxFailures == 0 {
+		maxFailures = 10
+	}
+	maxIPFailures := viper.GetInt("LOGIN_MAX_IP_FAILURES")
+	if maxIPFailures == 0 {
+		maxIPFailures = 100
+	}
+	window := viper.GetDuration("LOGIN_FAILURE_WINDOW")
+	if window == 0 {
+		window = 15 * time.Minute
+	}
+	lockout := viper.GetDuration("LOGIN_LOCKOUT_DURATION")
+	if lockout == 0 {
+		lockout = 15 * time.Minute
+	}
+	delayAfter := viper.GetInt("LOGIN_DELAY_AFTER")
+	if delayAfter == 0 {
+		delayAfter = 3
+	}
+	maxDelay := viper.GetDuration("LOGIN_MAX_DELAY")
+	if maxDelay == 0 {
+		maxDelay = 30 * time.Second
+	}
+	deletion := viper.GetString("ACCOUNT_DELETION_MESSAGES")
+	if deletion == "" {
+		deletion = "anonymize"
+	}
+	return AuthConfig{
+		PasswordMinLength:   minLength,
+		PasswordCheckCommon: checkCommon,
+		LoginMaxFailures:    maxFailures,
+		LoginMaxIPFailures:  maxIPFailures,
+		LoginFailureWindow:  window,
+		LoginLockout:        lockout,
+		LoginDelayAfter:     delayAfter,
+		LoginMaxDelay:       maxDelay,
+		AccountDeletion:     deletion,
+	}
+}
+
+func LoadOIDCConfig() OIDCConfig {
+	redirectURL := viper.GetString("OIDC_REDIRECT_URL")
+	if redirectURL == "" {
+		redirectURL = "http://localhost:5173/api/auth/oidc/callback"
+	}
+	scopes := strings.Fields(viper.GetString("OIDC_SCOPES"))
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+	groupsClaim := viper.GetString("OIDC_GROUPS_CLAIM")
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+	allowSignup := true
+	if viper.IsSet("OIDC_ALLOW_SIGNUP") {
+		allowSignup = viper.GetBool("OIDC_ALLOW_SIGNUP")
+	}
+
+	// OIDC_ROLE_MAPPING="chat-admins=admin,chat-mods=moderator"
+	roleMapping := make(map[string]string)
+	for _, pair := range strings.Split(viper.GetString("OIDC_ROLE_MAPPING"), ",") {
+		group, role, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		roleMapping[strings.TrimSpace(group)] = strings.TrimSpace(role)
+	}
+
+	return OIDCConfig{
+		IssuerURL:    viper.GetString("OIDC_ISSUER_URL"),
+		ClientID:     viper.GetString("OIDC_CLIENT_ID"),
+		ClientSecret: viper.GetString("OIDC_CLIENT_SECRET"),
+		RedirectURL:  redirectURL,
+		Scopes:       scopes,
+		GroupsClaim:  groupsClaim,
+		RoleMapping:  roleMapping,
+		AllowSignup:  allowSignup,
+	}
+}
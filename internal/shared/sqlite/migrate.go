@@ -0,0 +1,381 @@
+package sqlite
+
+import "log"
+
+// Migrate creates the schema and adds any columns missing from an older
+// database. It is safe to run repeatedly.
+func Migrate() {
+	// Users table
+	DB.Exec(`
+  		CREATE TABLE IF NOT EXISTS users (
+  			id TEXT PRIMARY KEY,
+  			email TEXT UNIQUE NOT NULL,
+  			password_hash TEXT NOT NULL,
+  			username TEXT UNIQUE NOT NULL,
+  			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+  		);
+  	`)
+
+	// Rooms table
+	DB.Exec(`
+		CREATE TABLE IF NOT EXISTS rooms (
+  			id TEXT PRIMARY KEY,
+  			name TEXT NOT NULL,
+  			created_by TEXT REFERENCES users(id),
+  			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+  		);
+	`)
+
+	// Messages table
+	DB.Exec(`
+		CREATE TABLE IF NOT EXISTS messages (
+  			id TEXT PRIMARY KEY,
+  			room_id TEXT REFERENCES rooms(id),
+  			user_id TEXT REFERENCES users(id),
+  			content TEXT NOT NULL,
+  			moderation_status TEXT DEFAULT 'pending',
+  			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+  		);
+	`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_messages_room_created ON messages(room_id, created_at);`)
+
+	// Messages users have reported to moderators
+	DB.Exec(`
+		CREATE TABLE IF NOT EXISTS message_reports (
+  			id TEXT PRIMARY KEY,
+  			message_id TEXT NOT NULL REFERENCES messages(id),
+  			reporter_id TEXT NOT NULL REFERENCES users(id),
+  			reason TEXT NOT NULL,
+  			resolved_at DATETIME,
+  			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  			UNIQUE (message_id, reporter_id)
+  		);
+	`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_message_reports_message ON message_reports(message_id);`)
+
+	// Moderation logs table
+	DB.Exec(`
+		CREATE TABLE IF NOT EXISTS moderation_logs (
+  			id TEXT PRIMARY KEY,
+  			message_id TEXT REFERENCES messages(id),
+  			provider TEXT DEFAULT '',
+  			provider_version TEXT DEFAULT '',
+  			threshold REAL DEFAULT 0,
+  			is_shadow INTEGER DEFAULT 0,
+  			toxicity_score REAL,
+  			category TEXT DEFAULT '',
+  			is_flagged INTEGER DEFAULT 0,
+  			error TEXT DEFAULT '',
+  			processed_at DATETIME DEFAULT CURRENT_TIMESTAMP
+  		);
+	`)
+
+	// Refresh tokens (hashed, rotated on every use)
+	DB.Exec(`
+		CREATE TABLE IF NOT EXISTS refresh_tokens (
+  			id TEXT PRIMARY KEY,
+  			user_id TEXT REFERENCES users(id),
+  			family_id TEXT NOT NULL,
+  			token_hash TEXT UNIQUE NOT NULL,
+  			expires_at DATETIME NOT NULL,
+  			used_at DATETIME,
+  			revoked_at DATETIME,
+  			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+  		);
+	`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens(family_id);`)
+
+	// Logins; id is shared with the refresh token family
+	DB.Exec(`
+		CREATE TABLE IF NOT EXISTS sessions (
+  			id TEXT PRIMARY KEY,
+  			user_id TEXT REFERENCES users(id),
+  			user_agent TEXT DEFAULT '',
+  			ip TEXT DEFAULT '',
+  			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  			last_seen_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  			revoked_at DATETIME
+  		);
+	`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id);`)
+
+	// Per-room roles (owner, moderator, member)
+	DB.Exec(`
+		CREATE TABLE IF NOT EXISTS room_members (
+  			room_id TEXT REFERENCES rooms(id),
+  			user_id TEXT REFERENCES users(id),
+  			role TEXT NOT NULL DEFAULT 'member',
+  			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  			PRIMARY KEY (room_id, user_id)
+  		);
+	`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_room_members_user ON room_members(user_id);`)
+
+	// Invite links to rooms; only a hash of each link's token is stored
+	DB.Exec(`
+		CREATE TABLE IF NOT EXISTS room_invites (
+  			id TEXT PRIMARY KEY,
+  			room_id TEXT NOT NULL REFERENCES rooms(id),
+  			created_by TEXT NOT NULL REFERENCES users(id),
+  			token_hash TEXT NOT NULL UNIQUE,
+  			max_uses INTEGER NOT NULL DEFAULT 0,
+  			uses INTEGER NOT NULL DEFAULT 0,
+  			expires_at DATETIME NOT NULL,
+  			revoked_at DATETIME,
+  			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+  		);
+	`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_room_invites_room ON room_invites(room_id);`)
+
+	// Discovery tags on rooms
+	DB.Exec(`
+		CREATE TABLE IF NOT EXISTS room_tags (
+  			room_id TEXT REFERENCES rooms(id),
+  			tag TEXT NOT NULL,
+  			PRIMARY KEY (room_id, tag)
+  		);
+	`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_room_tags_tag ON room_tags(tag);`)
+
+	// Users kept out of a room; expires_at NULL is a permanent ban
+	DB.Exec(`
+		CREATE TABLE IF NOT EXISTS room_bans (
+  			room_id TEXT REFERENCES rooms(id),
+  			user_id TEXT REFERENCES users(id),
+  			banned_by TEXT REFERENCES users(id),
+  			reason TEXT NOT NULL DEFAULT '',
+  			expires_at DATETIME,
+  			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  			PRIMARY KEY (room_id, user_id)
+  		);
+	`)
+
+	// TOTP two-factor authentication
+	DB.Exec(`
+		CREATE TABLE IF NOT EXISTS user_mfa (
+  			user_id TEXT PRIMARY KEY REFERENCES users(id),
+  			secret TEXT NOT NULL,
+  			last_step INTEGER DEFAULT 0,
+  			confirmed_at DATETIME,
+  			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+  		);
+	`)
+	DB.Exec(`
+		CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+  			id TEXT PRIMARY KEY,
+  			user_id TEXT REFERENCES users(id),
+  			code_hash TEXT NOT NULL,
+  			used_at DATETIME,
+  			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+  		);
+	`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user ON mfa_recovery_codes(user_id);`)
+
+	// External OIDC accounts linked to users
+	DB.Exec(`
+		CREATE TABLE IF NOT EXISTS user_identities (
+  			id TEXT PRIMARY KEY,
+  			user_id TEXT REFERENCES users(id),
+  			issuer TEXT NOT NULL,
+  			subject TEXT NOT NULL,
+  			email TEXT DEFAULT '',
+  			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  			UNIQUE (issuer, subject)
+  		);
+	`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_user_identities_user ON user_identities(user_id);`)
+
+	// Runtime settings changed by admins
+	DB.Exec(`
+		CREATE TABLE IF NOT EXISTS settings (
+  			key TEXT PRIMARY KEY,
+  			value TEXT NOT NULL,
+  			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+  		);
+	`)
+
+	// Single-use emailed tokens (password reset, ...)
+	DB.Exec(`
+		CREATE TABLE IF NOT EXISTS user_tokens (
+  			id TEXT PRIMARY KEY,
+  			user_id TEXT REFERENCES users(id),
+  			purpose TEXT NOT NULL,
+  			token_hash TEXT UNIQUE NOT NULL,
+  			expires_at DATETIME NOT NULL,
+  			used_at DATETIME,
+  			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+  		);
+	`)
+
+	// When each JWT key (or the HS256 secret, as "hs256") stopped signing
+	DB.Exec(`
+		CREATE TABLE IF NOT EXISTS jwt_key_retirements (
+  			kid TEXT PRIMARY KEY,
+  			retired_at DATETIME NOT NULL
+  		);
+	`)
+
+	// Moderator review decisions
+	DB.Exec(`
+		CREATE TABLE IF NOT EXISTS moderation_actions (
+  			id TEXT PRIMARY KEY,
+  			message_id TEXT REFERENCES messages(id),
+  			moderator_id TEXT REFERENCES users(id),
+  			action TEXT NOT NULL,
+  			reason TEXT DEFAULT '',
+  			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+  		);
+	`)
+
+	// Audit log (append-only, hash chained)
+	DB.Exec(`
+		CREATE TABLE IF NOT EXISTS audit_log (
+  			seq INTEGER PRIMARY KEY AUTOINCREMENT,
+  			id TEXT UNIQUE NOT NULL,
+  			actor_id TEXT NOT NULL,
+  			action TEXT NOT NULL,
+  			target_type TEXT NOT NULL,
+  			target_id TEXT NOT NULL,
+  			reason TEXT DEFAULT '',
+  			before_state TEXT DEFAULT '',
+  			after_state TEXT DEFAULT '',
+  			created_at TEXT NOT NULL,
+  			prev_hash TEXT UNIQUE NOT NULL,
+  			hash TEXT NOT NULL
+  		);
+	`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(actor_id);`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_id);`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_audit_log_action ON audit_log(action);`)
+	DB.Exec(`
+		CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+		BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END;
+	`)
+	DB.Exec(`
+		CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+		BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END;
+	`)
+
+	// Webhook subscriptions and their delivery log
+	DB.Exec(`
+		CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+  			id TEXT PRIMARY KEY,
+  			url TEXT NOT NULL,
+  			secret TEXT NOT NULL,
+  			events TEXT NOT NULL,
+  			active INTEGER DEFAULT 1,
+  			created_by TEXT REFERENCES users(id),
+  			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+  		);
+	`)
+	DB.Exec(`
+		CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  			id TEXT PRIMARY KEY,
+  			subscription_id TEXT REFERENCES webhook_subscriptions(id),
+  			event TEXT NOT NULL,
+  			payload TEXT NOT NULL,
+  			status TEXT DEFAULT 'pending',
+  			attempts INTEGER DEFAULT 0,
+  			response_code INTEGER DEFAULT 0,
+  			error TEXT DEFAULT '',
+  			next_attempt_at DATETIME,
+  			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  			delivered_at DATETIME
+  		);
+	`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at);`)
+
+	// API keys for bots and integrations; only hashes are stored
+	DB.Exec(`
+		CREATE TABLE IF NOT EXISTS api_keys (
+  			id TEXT PRIMARY KEY,
+  			user_id TEXT REFERENCES users(id),
+  			name TEXT NOT NULL,
+  			prefix TEXT NOT NULL,
+  			key_hash TEXT UNIQUE NOT NULL,
+  			scopes TEXT NOT NULL,
+  			created_by TEXT REFERENCES users(id),
+  			last_used_at DATETIME,
+  			expires_at DATETIME,
+  			revoked_at DATETIME,
+  			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+  		);
+	`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_api_keys_user ON api_keys(user_id);`)
+
+	// Users whose messages a user doesn't want to see
+	DB.Exec(`
+		CREATE TABLE IF NOT EXISTS user_blocks (
+  			blocker_id TEXT REFERENCES users(id),
+  			blocked_id TEXT REFERENCES users(id),
+  			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  			PRIMARY KEY (blocker_id, blocked_id)
+  		);
+	`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_user_blocks_blocked ON user_blocks(blocked_id);`)
+
+	// Personal data exports; archives live on disk until their link expires
+	DB.Exec(`
+		CREATE TABLE IF NOT EXISTS data_exports (
+  			id TEXT PRIMARY KEY,
+  			user_id TEXT REFERENCES users(id),
+  			status TEXT NOT NULL DEFAULT 'pending',
+  			token_hash TEXT UNIQUE NOT NULL,
+  			file_path TEXT DEFAULT '',
+  			size INTEGER DEFAULT 0,
+  			error TEXT DEFAULT '',
+  			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  			started_at DATETIME,
+  			completed_at DATETIME,
+  			expires_at DATETIME
+  		);
+	`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_data_exports_user ON data_exports(user_id);`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_data_exports_status ON data_exports(status);`)
+
+	// Columns added after the initial schema. SQLite has no
+	// ADD COLUMN IF NOT EXISTS, so existing columns are skipped.
+	addColumn("moderation_logs", "provider", "TEXT DEFAULT ''")
+	addColumn("moderation_logs", "provider_version", "TEXT DEFAULT ''")
+	addColumn("moderation_logs", "threshold", "REAL DEFAULT 0")
+	addColumn("moderation_logs", "is_shadow", "INTEGER DEFAULT 0")
+	addColumn("moderation_logs", "category", "TEXT DEFAULT ''")
+	addColumn("moderation_logs", "error", "TEXT DEFAULT ''")
+	addColumn("users", "verified_at", "DATETIME")
+	addColumn("rooms", "require_verified", "INTEGER DEFAULT 0")
+	addColumn("rooms", "visibility", "TEXT NOT NULL DEFAULT 'public'")
+	addColumn("rooms", "kind", "TEXT NOT NULL DEFAULT 'room'")
+	addColumn("rooms", "description", "TEXT NOT NULL DEFAULT ''")
+	addColumn("rooms", "topic", "TEXT NOT NULL DEFAULT ''")
+	addColumn("rooms", "archived_at", "DATETIME")
+	addColumn("users", "role", "TEXT NOT NULL DEFAULT 'user'")
+	addColumn("sessions", "mfa", "INTEGER DEFAULT 0")
+	addColumn("users", "is_bot", "INTEGER DEFAULT 0")
+	addColumn("users", "deleted_at", "DATETIME")
+	addColumn("users", "display_name", "TEXT NOT NULL DEFAULT ''")
+	addColumn("users", "bio", "TEXT NOT NULL DEFAULT ''")
+	addColumn("users", "avatar_key", "TEXT NOT NULL DEFAULT ''")
+
+	// Room creators predating room_members own their rooms
+	DB.Exec(`
+		INSERT OR IGNORE INTO room_members (room_id, user_id, role)
+		SELECT id, created_by, 'owner' FROM rooms WHERE created_by IS NOT NULL
+	`)
+
+	log.Println("Tables created successfully")
+}
+
+func addColumn(table, column, definition string) {
+	var count int
+	DB.QueryRow(
+		`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column,
+	).Scan(&count)
+	if count > 0 {
+		return
+	}
+
+	if _, err := DB.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + definition); err != nil {
+		log.Printf("error while adding column %s.%s: %v", table, column, err)
+	}
+}
@@ -0,0 +1,55 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Dispatcher records a pending delivery for every subscription to an event.
+// Sending happens separately in Worker, so emitting never blocks on subscribers.
+type Dispatcher struct {
+	subRepo      SubscriptionRepository
+	deliveryRepo DeliveryRepository
+}
+
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		subRepo:      NewSubscriptionRepository(),
+		deliveryRepo: NewDeliveryRepository(),
+	}
+}
+
+func (d *Dispatcher) Emit(event string, data any) error {
+	subs, err := d.subRepo.FindByEvent(event)
+	if err != nil {
+		return fmt.Errorf("error while finding subscriptions for %s: %w", event, err)
+	}
+	if len(subs) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(Envelope{
+		ID:        uuid.New().String(),
+		Event:     event,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		return fmt.Errorf("error while marshaling webhook envelope: %w", err)
+	}
+
+	for _, sub := range subs {
+		if err := d.deliveryRepo.Create(&Delivery{
+			SubscriptionID: sub.ID,
+			Event:          event,
+			Payload:        payload,
+		}); err != nil {
+			return fmt.Errorf("error while creating webhook delivery: %w", err)
+		}
+	}
+
+	return nil
+}
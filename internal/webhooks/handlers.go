@@ -0,0 +1,188 @@
+package webhooks
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mr1hm/go-chat-moderator/internal/auth"
+)
+
+type Handler struct {
+	subRepo      SubscriptionRepository
+	deliveryRepo DeliveryRepository
+}
+
+func NewHandler() *Handler {
+	return &Handler{
+		subRepo:      NewSubscriptionRepository(),
+		deliveryRepo: NewDeliveryRepository(),
+	}
+}
+
+func (h *Handler) CreateSubscription(c *gin.Context) {
+	var req CreateSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	for _, event := range req.Events {
+		if !IsKnownEvent(event) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "unknown event: " + event,
+			})
+			return
+		}
+	}
+
+	secret, err := generateSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to generate secret",
+		})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	sub := &Subscription{
+		URL:       req.URL,
+		Secret:    secret,
+		Events:    req.Events,
+		CreatedBy: userID.(string),
+	}
+	if err := h.subRepo.Create(sub); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to create subscription",
+		})
+		return
+	}
+
+	// The secret is only ever shown here
+	c.JSON(http.StatusCreated, sub)
+}
+
+func (h *Handler) ListSubscriptions(c *gin.Context) {
+	subs, err := h.subRepo.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to list subscriptions",
+		})
+		return
+	}
+
+	for _, sub := range subs {
+		sub.Secret = ""
+	}
+
+	c.JSON(http.StatusOK, subs)
+}
+
+func (h *Handler) DeleteSubscription(c *gin.Context) {
+	if err := h.subRepo.Delete(c.Param("id")); err != nil {
+		if errors.Is(err, ErrSubscriptionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": ErrSubscriptionNotFound.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to delete subscription",
+		})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) ListDeliveries(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+
+	if _, err := h.subRepo.FindByID(c.Param("id")); err != nil {
+		if errors.Is(err, ErrSubscriptionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": ErrSubscriptionNotFound.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to get subscription",
+		})
+		return
+	}
+
+	deliveries, err := h.deliveryRepo.ListBySubscription(c.Param("id"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to list deliveries",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// Redeliver queues a fresh copy of a past delivery, leaving the original in the log
+func (h *Handler) Redeliver(c *gin.Context) {
+	original, err := h.deliveryRepo.FindByID(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, ErrDeliveryNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": ErrDeliveryNotFound.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to get delivery",
+		})
+		return
+	}
+
+	d := &Delivery{
+		SubscriptionID: original.SubscriptionID,
+		Event:          original.Event,
+		Payload:        original.Payload,
+	}
+	if err := h.deliveryRepo.Create(d); err != nil {
+		log.Printf("error while redelivering [ %s ]: %v", original.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to queue redelivery",
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, d)
+}
+
+func generateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+func RegisterRoutes(r *gin.Engine, authHandler *auth.Handler) *Handler {
+	handler := NewHandler()
+
+	wh := r.Group("/webhooks")
+	wh.Use(authHandler.AuthMiddleware(), authHandler.RequireRole(auth.RoleAdmin))
+	{
+		wh.POST("", handler.CreateSubscription)
+		wh.GET("", handler.ListSubscriptions)
+		wh.DELETE("/:id", handler.DeleteSubscription)
+		wh.GET("/:id/deliveries", handler.ListDeliveries)
+		wh.POST("/deliveries/:id/redeliver", handler.Redeliver)
+	}
+
+	return handler
+}
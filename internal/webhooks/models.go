@@ -0,0 +1,72 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+)
+
+// Events that can be subscribed to
+const (
+	EventMessageFlagged   = "message.flagged"
+	EventMessageApproved  = "message.approved"
+	EventMessageRemoved   = "message.removed"
+	EventRoomMemberKicked = "room.member_kicked"
+	EventRoomMemberBanned = "room.member_banned"
+)
+
+var knownEvents = []string{
+	EventMessageFlagged,
+	EventMessageApproved,
+	EventMessageRemoved,
+	EventRoomMemberKicked,
+	EventRoomMemberBanned,
+}
+
+func IsKnownEvent(event string) bool {
+	return slices.Contains(knownEvents, event)
+}
+
+// Delivery statuses
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+type Subscription struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"` // Only returned on creation
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Delivery struct {
+	ID             string          `json:"id"`
+	SubscriptionID string          `json:"subscription_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	ResponseCode   int             `json:"response_code,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+}
+
+// Envelope is the JSON body POSTed to subscribers
+type Envelope struct {
+	ID        string    `json:"id"`
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+type CreateSubscriptionRequest struct {
+	URL    string   `json:"url" binding:"required,url"`
+	Events []string `json:"events" binding:"required,min=1"`
+}
@@ -0,0 +1,258 @@
+package webhooks
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mr1hm/go-chat-moderator/internal/shared/sqlite"
+)
+
+var (
+	ErrSubscriptionNotFound = errors.New("webhook subscription not found")
+	ErrDeliveryNotFound     = errors.New("webhook delivery not found")
+)
+
+// Matches CURRENT_TIMESTAMP so scheduled times compare correctly in SQL
+const sqliteTimeLayout = "2006-01-02 15:04:05"
+
+type SubscriptionRepository interface {
+	Create(sub *Subscription) error
+	FindByID(id string) (*Subscription, error)
+	FindByEvent(event string) ([]*Subscription, error)
+	List() ([]*Subscription, error)
+	Delete(id string) error
+}
+
+type sqliteSubscriptionRepo struct{}
+
+func NewSubscriptionRepository() SubscriptionRepository {
+	return &sqliteSubscriptionRepo{}
+}
+
+func (r *sqliteSubscriptionRepo) Create(sub *Subscription) error {
+	sub.ID = uuid.New().String()
+	sub.Active = true
+	sub.CreatedAt = time.Now().UTC()
+
+	_, err := sqlite.DB.Exec(
+		`INSERT INTO webhook_subscriptions (id, url, secret, events, created_by) VALUES (?, ?, ?, ?, ?)`,
+		sub.ID, sub.URL, sub.Secret, strings.Join(sub.Events, ","), sub.CreatedBy,
+	)
+
+	return err
+}
+
+func (r *sqliteSubscriptionRepo) FindByID(id string) (*Subscription, error) {
+	row := sqlite.DB.QueryRow(
+		`SELECT id, url, secret, events, active, created_by, created_at FROM webhook_subscriptions WHERE id = ?`, id,
+	)
+
+	sub, err := scanSubscription(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSubscriptionNotFound
+	}
+
+	return sub, err
+}
+
+func (r *sqliteSubscriptionRepo) FindByEvent(event string) ([]*Subscription, error) {
+	return r.query(
+		`SELECT id, url, secret, events, active, created_by, created_at FROM webhook_subscriptions
+		 WHERE active = 1 AND (',' || events || ',') LIKE ?`,
+		"%,"+event+",%",
+	)
+}
+
+func (r *sqliteSubscriptionRepo) List() ([]*Subscription, error) {
+	return r.query(
+		`SELECT id, url, secret, events, active, created_by, created_at FROM webhook_subscriptions ORDER BY created_at DESC`,
+	)
+}
+
+func (r *sqliteSubscriptionRepo) Delete(id string) error {
+	// Keep the row so its delivery log stays readable
+	res, err := sqlite.DB.Exec(`UPDATE webhook_subscriptions SET active = 0 WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrSubscriptionNotFound
+	}
+
+	return nil
+}
+
+func (r *sqliteSubscriptionRepo) query(query string, args ...any) ([]*Subscription, error) {
+	rows, err := sqlite.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error while querying webhook subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	subs := []*Subscription{}
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error while scanning webhook subscriptions: %w", err)
+		}
+		subs = append(subs, sub)
+	}
+
+	return subs, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSubscription(s scanner) (*Subscription, error) {
+	sub := &Subscription{}
+	var events string
+	if err := s.Scan(&sub.ID, &sub.URL, &sub.Secret, &events, &sub.Active, &sub.CreatedBy, &sub.CreatedAt); err != nil {
+		return nil, err
+	}
+	sub.Events = strings.Split(events, ",")
+
+	return sub, nil
+}
+
+// Delivery Repository
+type DeliveryRepository interface {
+	Create(d *Delivery) error
+	FindByID(id string) (*Delivery, error)
+	ListBySubscription(subscriptionID string, limit int) ([]*Delivery, error)
+	Due(limit int) ([]*Delivery, error)
+	Claim(d *Delivery, lease time.Duration) (bool, error)
+	Update(d *Delivery) error
+}
+
+type sqliteDeliveryRepo struct{}
+
+func NewDeliveryRepository() DeliveryRepository {
+	return &sqliteDeliveryRepo{}
+}
+
+func (r *sqliteDeliveryRepo) Create(d *Delivery) error {
+	d.ID = uuid.New().String()
+	d.Status = StatusPending
+	d.CreatedAt = time.Now().UTC()
+	d.NextAttemptAt = d.CreatedAt
+
+	_, err := sqlite.DB.Exec(
+		`INSERT INTO webhook_deliveries (id, subscription_id, event, payload, status, next_attempt_at)
+		 VALUES (?, ?, ?, ?, ?, ?)`,
+		d.ID, d.SubscriptionID, d.Event, string(d.Payload), d.Status, d.NextAttemptAt.Format(sqliteTimeLayout),
+	)
+
+	return err
+}
+
+const deliveryColumns = `id, subscription_id, event, payload, status, attempts, response_code, error, next_attempt_at, created_at, delivered_at`
+
+func (r *sqliteDeliveryRepo) FindByID(id string) (*Delivery, error) {
+	d, err := scanDelivery(sqlite.DB.QueryRow(
+		`SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE id = ?`, id,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDeliveryNotFound
+	}
+
+	return d, err
+}
+
+func (r *sqliteDeliveryRepo) ListBySubscription(subscriptionID string, limit int) ([]*Delivery, error) {
+	return r.query(
+		`SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE subscription_id = ? ORDER BY created_at DESC LIMIT ?`,
+		subscriptionID, limit,
+	)
+}
+
+// Due returns pending deliveries whose next attempt time has passed
+func (r *sqliteDeliveryRepo) Due(limit int) ([]*Delivery, error) {
+	return r.query(
+		`SELECT `+deliveryColumns+` FROM webhook_deliveries
+		 WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at LIMIT ?`,
+		StatusPending, time.Now().UTC().Format(sqliteTimeLayout), limit,
+	)
+}
+
+// Claim pushes next_attempt_at forward by lease so no other worker picks up
+// the delivery while it is in flight. It reports false if another worker won.
+func (r *sqliteDeliveryRepo) Claim(d *Delivery, lease time.Duration) (bool, error) {
+	res, err := sqlite.DB.Exec(
+		`UPDATE webhook_deliveries SET next_attempt_at = ? WHERE id = ? AND status = ? AND next_attempt_at = ?`,
+		time.Now().UTC().Add(lease).Format(sqliteTimeLayout), d.ID, StatusPending, d.NextAttemptAt.UTC().Format(sqliteTimeLayout),
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+
+	return n == 1, err
+}
+
+func (r *sqliteDeliveryRepo) Update(d *Delivery) error {
+	var deliveredAt any
+	if d.DeliveredAt != nil {
+		deliveredAt = d.DeliveredAt.UTC().Format(sqliteTimeLayout)
+	}
+
+	_, err := sqlite.DB.Exec(
+		`UPDATE webhook_deliveries
+		 SET status = ?, attempts = ?, response_code = ?, error = ?, next_attempt_at = ?, delivered_at = ?
+		 WHERE id = ?`,
+		d.Status, d.Attempts, d.ResponseCode, d.Error, d.NextAttemptAt.UTC().Format(sqliteTimeLayout), deliveredAt, d.ID,
+	)
+
+	return err
+}
+
+func (r *sqliteDeliveryRepo) query(query string, args ...any) ([]*Delivery, error) {
+	rows, err := sqlite.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error while querying webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []*Delivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error while scanning webhook deliveries: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+func scanDelivery(s scanner) (*Delivery, error) {
+	d := &Delivery{}
+	var payload string
+	var deliveredAt sql.NullTime
+	if err := s.Scan(
+		&d.ID,
+		&d.SubscriptionID,
+		&d.Event,
+		&payload,
+		&d.Status,
+		&d.Attempts,
+		&d.ResponseCode,
+		&d.Error,
+		&d.NextAttemptAt,
+		&d.CreatedAt,
+		&deliveredAt,
+	); err != nil {
+		return nil, err
+	}
+	d.Payload = []byte(payload)
+	if deliveredAt.Valid {
+		d.DeliveredAt = &deliveredAt.Time
+	}
+
+	return d, nil
+}
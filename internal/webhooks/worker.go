@@ -0,0 +1,147 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	maxAttempts  = 8
+	baseBackoff  = 10 * time.Second
+	maxBackoff   = time.Hour
+	claimLease   = time.Minute
+	batchSize    = 20
+	errorBodyMax = 512
+)
+
+// Worker sends due deliveries and reschedules failures with exponential backoff
+type Worker struct {
+	subRepo      SubscriptionRepository
+	deliveryRepo DeliveryRepository
+	httpClient   *http.Client
+	ticker       *time.Ticker
+}
+
+func NewWorker() *Worker {
+	return &Worker{
+		subRepo:      NewSubscriptionRepository(),
+		deliveryRepo: NewDeliveryRepository(),
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		ticker: time.NewTicker(time.Second),
+	}
+}
+
+func (w *Worker) Run(ctx context.Context) {
+	log.Println("Webhook worker started")
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.ticker.C:
+			w.processDue()
+		}
+	}
+}
+
+func (w *Worker) processDue() {
+	deliveries, err := w.deliveryRepo.Due(batchSize)
+	if err != nil {
+		log.Printf("error while loading due webhook deliveries: %v", err)
+		return
+	}
+
+	for _, d := range deliveries {
+		claimed, err := w.deliveryRepo.Claim(d, claimLease)
+		if err != nil {
+			log.Printf("error while claiming webhook delivery [ %s ]: %v", d.ID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		w.attempt(d)
+	}
+}
+
+func (w *Worker) attempt(d *Delivery) {
+	sub, err := w.subRepo.FindByID(d.SubscriptionID)
+	if err != nil {
+		log.Printf("error while loading subscription for delivery [ %s ]: %v", d.ID, err)
+		return
+	}
+
+	d.Attempts++
+	if !sub.Active {
+		d.Status = StatusFailed
+		d.Error = "subscription deleted"
+	} else {
+		d.ResponseCode, err = w.send(sub, d)
+		if err == nil {
+			now := time.Now().UTC()
+			d.Status = StatusDelivered
+			d.Error = ""
+			d.DeliveredAt = &now
+		} else {
+			d.Error = err.Error()
+			if d.Attempts >= maxAttempts {
+				d.Status = StatusFailed
+			} else {
+				d.NextAttemptAt = time.Now().UTC().Add(backoff(d.Attempts))
+			}
+		}
+	}
+
+	if err := w.deliveryRepo.Update(d); err != nil {
+		log.Printf("error while updating webhook delivery [ %s ]: %v", d.ID, err)
+		return
+	}
+
+	log.Printf("Webhook delivery [ %s ] %s to %s: status=%s attempt=%d", d.ID, d.Event, sub.URL, d.Status, d.Attempts)
+}
+
+// send POSTs the signed payload. Any non-2xx response is an error.
+func (w *Worker) send(sub *Subscription, d *Delivery) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, sub.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("error while creating request: %w", err)
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, d.Event)
+	req.Header.Set(HeaderDelivery, d.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, timestamp, d.Payload))
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error while doing request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, errorBodyMax))
+		return resp.StatusCode, fmt.Errorf("endpoint returned %d: %s", resp.StatusCode, body)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// backoff doubles the wait after each failed attempt, capped at maxBackoff
+func backoff(attempts int) time.Duration {
+	wait := baseBackoff << (attempts - 1)
+	if wait <= 0 || wait > maxBackoff {
+		return maxBackoff
+	}
+	return wait
+}
@@ -0,0 +1,99 @@
+package webhooks
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSign_VerifySignature(t *testing.T) {
+	body := []byte(`{"event":"message.flagged"}`)
+	sig := Sign("secret", 1700000000, body)
+
+	if !VerifySignature("secret", 1700000000, body, sig) {
+		t.Error("expected signature to verify")
+	}
+	if VerifySignature("other-secret", 1700000000, body, sig) {
+		t.Error("expected signature with wrong secret to fail")
+	}
+	if VerifySignature("secret", 1700000001, body, sig) {
+		t.Error("expected signature with different timestamp to fail")
+	}
+	if VerifySignature("secret", 1700000000, []byte(`{}`), sig) {
+		t.Error("expected signature over different body to fail")
+	}
+}
+
+func TestWorker_Send_Success(t *testing.T) {
+	payload := []byte(`{"id":"evt-1","event":"message.flagged","data":{}}`)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ts, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+		if err != nil {
+			t.Errorf("expected numeric timestamp header, got %q", r.Header.Get(HeaderTimestamp))
+		}
+		if !VerifySignature("whsec_test", ts, body, r.Header.Get(HeaderSignature)) {
+			t.Error("expected valid signature")
+		}
+		if r.Header.Get(HeaderEvent) != EventMessageFlagged {
+			t.Errorf("expected event header, got %q", r.Header.Get(HeaderEvent))
+		}
+		if r.Header.Get(HeaderDelivery) != "delivery-1" {
+			t.Errorf("expected delivery header, got %q", r.Header.Get(HeaderDelivery))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	w := &Worker{httpClient: server.Client()}
+	sub := &Subscription{URL: server.URL, Secret: "whsec_test"}
+	d := &Delivery{ID: "delivery-1", Event: EventMessageFlagged, Payload: payload}
+
+	code, err := w.send(sub, d)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", code)
+	}
+}
+
+func TestWorker_Send_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("down for maintenance"))
+	}))
+	defer server.Close()
+
+	w := &Worker{httpClient: server.Client()}
+	code, err := w.send(&Subscription{URL: server.URL}, &Delivery{Payload: []byte(`{}`)})
+	if err == nil {
+		t.Fatal("expected error for non-2xx response")
+	}
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %d", code)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{4, 80 * time.Second},
+		{10, time.Hour},
+		{100, time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := backoff(tt.attempts); got != tt.expected {
+			t.Errorf("backoff(%d): expected %v, got %v", tt.attempts, tt.expected, got)
+		}
+	}
+}